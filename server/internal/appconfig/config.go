@@ -23,6 +23,12 @@ type Config struct {
 	Seed SeedConfig `json:"seed"`
 
 	Omise OmiseConfig `json:"omise"`
+
+	Jobs JobsConfig `json:"jobs"`
+
+	Documents DocumentsConfig `json:"documents"`
+
+	Carriers CarriersConfig `json:"carriers"`
 }
 
 type HTTPConfig struct {
@@ -74,6 +80,64 @@ type OmiseConfig struct {
 	WebhookSecret string `json:"webhookSecret"`
 }
 
+type JobsConfig struct {
+	// ClassificationIntervalHours is how often ABC / XYZ classes are recomputed.
+	// 0 means daily; a negative value disables the job.
+	ClassificationIntervalHours int `json:"classificationIntervalHours"`
+}
+
+type DocumentsConfig struct {
+	// FontPath and BoldFontPath are TrueType fonts embedded in rendered PDFs. Tax documents
+	// need a font with Thai glyphs (e.g. Sarabun); empty falls back to Helvetica, which
+	// cannot print Thai. BoldFontPath is optional.
+	FontPath     string `json:"fontPath"`
+	BoldFontPath string `json:"boldFontPath"`
+}
+
+// CarriersConfig holds courier API credentials. A courier is offered only when its
+// credentials are set; the LOCAL test carrier is always available.
+type CarriersConfig struct {
+	Flash    FlashConfig    `json:"flash"`
+	Kerry    KerryConfig    `json:"kerry"`
+	JT       JTConfig       `json:"jt"`
+	ThaiPost ThaiPostConfig `json:"thaiPost"`
+
+	// WebhookSecret authenticates tracking webhooks from carriers that do not sign their
+	// own: the LOCAL carrier signs with it and Thailand Post sends it as a URL token.
+	// Webhooks from those carriers are refused while it is empty.
+	WebhookSecret string `json:"webhookSecret"`
+}
+
+type FlashConfig struct {
+	BaseURL   string `json:"baseUrl"` // Empty uses the production open API
+	MchID     string `json:"mchId"`
+	SecretKey string `json:"secretKey"`
+}
+
+type KerryConfig struct {
+	BaseURL string `json:"baseUrl"` // SmartEDI endpoint issued with the merchant contract
+	AppID   string `json:"appId"`
+	AppKey  string `json:"appKey"`
+
+	// ConsignmentPrefix is the merchant code Kerry assigns; consignment numbers are
+	// generated by the merchant and must start with it.
+	ConsignmentPrefix string `json:"consignmentPrefix"`
+}
+
+type JTConfig struct {
+	BaseURL      string `json:"baseUrl"` // Open platform endpoint issued with the merchant contract
+	APIAccount   string `json:"apiAccount"`
+	PrivateKey   string `json:"privateKey"`
+	CustomerCode string `json:"customerCode"`
+	Password     string `json:"password"`
+}
+
+type ThaiPostConfig struct {
+	// Token is the tracking API token from track.thailandpost.co.th. Thailand Post has no
+	// booking API, so parcels are registered with the barcode from the counter receipt.
+	Token string `json:"token"`
+}
+
 func (c Config) Validate() error {
 	if strings.TrimSpace(c.HTTP.Addr) == "" {
 		return fmt.Errorf("config: http.addr is required")
@@ -124,3 +188,13 @@ func (c Config) SessionTTL() time.Duration {
 	return time.Duration(c.Session.TTLSeconds) * time.Second
 }
 
+// ClassificationInterval returns how often to reclassify stock, or 0 when disabled.
+func (c Config) ClassificationInterval() time.Duration {
+	if c.Jobs.ClassificationIntervalHours < 0 {
+		return 0
+	}
+	if c.Jobs.ClassificationIntervalHours == 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.Jobs.ClassificationIntervalHours) * time.Hour
+}
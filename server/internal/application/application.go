@@ -10,24 +10,31 @@ import (
 
 	"stockflows/server/internal/appconfig"
 	"stockflows/server/internal/auth"
+	"stockflows/server/internal/carriers"
 	"stockflows/server/internal/deps"
 	authmodule "stockflows/server/internal/modules/auth"
 	billingmodule "stockflows/server/internal/modules/billing"
 	branchesmodule "stockflows/server/internal/modules/branches"
 	categoriesmodule "stockflows/server/internal/modules/categories"
+	consignmentmodule "stockflows/server/internal/modules/consignment"
 	customersmodule "stockflows/server/internal/modules/customers"
+	documentsmodule "stockflows/server/internal/modules/documents"
 	"stockflows/server/internal/modules/health"
 	ordersmodule "stockflows/server/internal/modules/orders"
 	orgsmodule "stockflows/server/internal/modules/orgs"
 	productsmodule "stockflows/server/internal/modules/products"
+	promotionsmodule "stockflows/server/internal/modules/promotions"
 	purchaseordersmodule "stockflows/server/internal/modules/purchaseorders"
 	reportsmodule "stockflows/server/internal/modules/reports"
 	returnsmodule "stockflows/server/internal/modules/returns"
+	shippingmodule "stockflows/server/internal/modules/shipping"
 	auditmodule "stockflows/server/internal/modules/audit"
 	stockmodule "stockflows/server/internal/modules/stock"
 	suppliersmodule "stockflows/server/internal/modules/suppliers"
 	uploadsmodule "stockflows/server/internal/modules/uploads"
 	usersmodule "stockflows/server/internal/modules/users"
+	webhooksmodule "stockflows/server/internal/modules/webhooks"
+	writeoffsmodule "stockflows/server/internal/modules/writeoffs"
 	"stockflows/server/internal/repo"
 	platformapp "stockflows/server/platform/app"
 	"stockflows/server/platform/db/mongodb"
@@ -49,6 +56,11 @@ func Run(ctx context.Context, cfg appconfig.Config) error {
 
 	router := buildRouter(deps)
 
+	if interval := cfg.ClassificationInterval(); interval > 0 {
+		go runClassificationJob(ctx, deps, interval)
+	}
+	go runWebhookRetryJob(ctx, deps)
+
 	srv := &http.Server{
 		Addr:              cfg.HTTP.Addr,
 		Handler:           router,
@@ -113,12 +125,18 @@ func buildRouter(deps deps.Dependencies) *gin.Engine {
 		customersmodule.New(deps),
 		suppliersmodule.New(deps),
 		purchaseordersmodule.New(deps),
+		consignmentmodule.New(deps),
 		ordersmodule.New(deps),
+		shippingmodule.New(deps),
+		promotionsmodule.New(deps),
 		returnsmodule.New(deps),
+		documentsmodule.New(deps),
+		writeoffsmodule.New(deps),
 		uploadsmodule.New(deps),
 		billingmodule.New(deps),
 		reportsmodule.New(deps),
 		auditmodule.New(deps),
+		webhooksmodule.New(deps),
 	)
 
 	return r
@@ -171,10 +189,11 @@ func buildDependencies(ctx context.Context, cfg appconfig.Config) (deps.Dependen
 	}
 
 	return deps.Dependencies{
-		Mongo:  mongoClient,
-		MinIO:  minioClient,
-		Sess:   sessStore,
-		Repo:   appRepo,
-		Config: cfg,
+		Mongo:    mongoClient,
+		MinIO:    minioClient,
+		Sess:     sessStore,
+		Repo:     appRepo,
+		Carriers: carriers.NewRegistry(cfg.Carriers),
+		Config:   cfg,
 	}, cleanup, nil
 }
@@ -0,0 +1,60 @@
+package application
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"stockflows/server/internal/deps"
+	"stockflows/server/internal/services/analysis"
+	"stockflows/server/internal/services/orderevents"
+)
+
+// webhookRetryInterval is how often due webhook deliveries are retried
+const webhookRetryInterval = 10 * time.Second
+
+// runWebhookRetryJob retries webhook deliveries that are due until ctx is done
+func runWebhookRetryJob(ctx context.Context, d deps.Dependencies) {
+	ticker := time.NewTicker(webhookRetryInterval)
+	defer ticker.Stop()
+
+	svc := orderevents.New(d.Repo)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			svc.RetryDue(ctx)
+		}
+	}
+}
+
+// runClassificationJob recomputes ABC / XYZ classes for every org each interval until ctx is done
+func runClassificationJob(ctx context.Context, d deps.Dependencies, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reclassifyAll(ctx, d)
+		}
+	}
+}
+
+func reclassifyAll(ctx context.Context, d deps.Dependencies) {
+	orgs, err := d.Repo.ListOrgs(ctx)
+	if err != nil {
+		log.Printf("classification job: list orgs: %v", err)
+		return
+	}
+	svc := analysis.New(d.Repo)
+	now := time.Now().UTC()
+	for _, org := range orgs {
+		if _, err := svc.Reclassify(ctx, org, now); err != nil {
+			log.Printf("classification job: org %s: %v", org.ID, err)
+		}
+	}
+}
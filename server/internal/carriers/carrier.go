@@ -0,0 +1,198 @@
+// Package carriers books parcels with couriers behind one interface. Each courier is an
+// adapter registered in a Registry; the LOCAL carrier needs no account and is meant for
+// testing the shipping flow end to end.
+package carriers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownCarrier  = errors.New("carriers: unknown carrier")
+	ErrUnsupported     = errors.New("carriers: not supported by this carrier")
+	ErrNotFound        = errors.New("carriers: shipment not found")
+	ErrNotCancellable  = errors.New("carriers: shipment can no longer be cancelled")
+	ErrIncomplete      = errors.New("carriers: sender and recipient need a name, phone and address")
+	ErrTrackingMissing = errors.New("carriers: tracking number is required for this carrier")
+)
+
+// APIError is a failed call to a courier's API
+type APIError struct {
+	Carrier    string
+	StatusCode int
+	Message    string
+}
+
+func (e APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s: %s (status=%d)", strings.ToLower(e.Carrier), e.Message, e.StatusCode)
+	}
+	return fmt.Sprintf("%s: request failed (status=%d)", strings.ToLower(e.Carrier), e.StatusCode)
+}
+
+// Status is a tracking status normalized across couriers
+type Status string
+
+const (
+	StatusCreated        Status = "CREATED" // Booked, not yet handed to the courier
+	StatusPickedUp       Status = "PICKED_UP"
+	StatusInTransit      Status = "IN_TRANSIT"
+	StatusOutForDelivery Status = "OUT_FOR_DELIVERY"
+	StatusDelivered      Status = "DELIVERED"
+	StatusFailed         Status = "FAILED"   // Delivery attempt failed; the courier will retry or return it
+	StatusReturned       Status = "RETURNED" // Returned to sender
+	StatusCancelled      Status = "CANCELLED"
+)
+
+func validStatus(s Status) bool {
+	switch s {
+	case StatusCreated, StatusPickedUp, StatusInTransit, StatusOutForDelivery,
+		StatusDelivered, StatusFailed, StatusReturned, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// LabelSize is the paper a label is printed on
+type LabelSize string
+
+const (
+	Label4x6 LabelSize = "4x6" // Thermal label printers
+	LabelA5  LabelSize = "A5"
+	LabelA4  LabelSize = "A4"
+)
+
+// ParseLabelSize accepts 4x6, A5 or A4 in any case; empty means 4x6
+func ParseLabelSize(s string) (LabelSize, bool) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "", "4X6":
+		return Label4x6, true
+	case "A5":
+		return LabelA5, true
+	case "A4":
+		return LabelA4, true
+	}
+	return "", false
+}
+
+// Address is a sender or recipient
+type Address struct {
+	Name       string `json:"name"`
+	Phone      string `json:"phone"`
+	Address    string `json:"address"`
+	PostalCode string `json:"postalCode,omitempty"` // Taken from the end of Address when empty
+}
+
+// Parcel describes what is being sent
+type Parcel struct {
+	WeightGram int `json:"weightGram"`
+	LengthCm   int `json:"lengthCm,omitempty"`
+	WidthCm    int `json:"widthCm,omitempty"`
+	HeightCm   int `json:"heightCm,omitempty"`
+}
+
+// ShipmentRequest asks a carrier to carry one parcel
+type ShipmentRequest struct {
+	Reference   string  `json:"reference"` // Our order ID, printed on the label
+	Service     string  `json:"service,omitempty"`
+	Sender      Address `json:"sender"`
+	Recipient   Address `json:"recipient"`
+	Parcel      Parcel  `json:"parcel"`
+	CODAmount   int64   `json:"codAmount,omitempty"` // Cash to collect on delivery (satang)
+	Description string  `json:"description,omitempty"`
+
+	// TrackingNumber registers a parcel already labelled at the counter, for carriers
+	// without a booking API
+	TrackingNumber string `json:"trackingNumber,omitempty"`
+}
+
+// Rate is a price quote for one service
+type Rate struct {
+	Carrier string `json:"carrier"`
+	Service string `json:"service"`
+	Name    string `json:"name"`
+	Price   int64  `json:"price"`          // Satang
+	Days    int    `json:"days,omitempty"` // Estimated transit days
+}
+
+// Shipment is a booked parcel
+type Shipment struct {
+	Carrier        string    `json:"carrier"`
+	Service        string    `json:"service,omitempty"`
+	TrackingNumber string    `json:"trackingNumber"`
+	ExternalID     string    `json:"externalId,omitempty"` // The courier's own ID when it differs from the tracking number
+	SortCode       string    `json:"sortCode,omitempty"`   // Hub routing code printed on the label
+	Fee            int64     `json:"fee,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// TrackingEvent is one scan in a parcel's journey
+type TrackingEvent struct {
+	Time        time.Time `json:"time"`
+	Status      Status    `json:"status"`
+	Description string    `json:"description"`
+	Location    string    `json:"location,omitempty"`
+	Code        string    `json:"code,omitempty"` // The courier's own status code
+}
+
+// Tracking is a parcel's current status and history, oldest event first
+type Tracking struct {
+	TrackingNumber string          `json:"trackingNumber"`
+	Status         Status          `json:"status"`
+	Events         []TrackingEvent `json:"events"`
+}
+
+// Carrier is a courier integration. Methods a courier's API does not offer return
+// ErrUnsupported; callers render labels locally when Label does.
+type Carrier interface {
+	Code() string
+	Name() string
+	Rates(ctx context.Context, req ShipmentRequest) ([]Rate, error)
+	CreateShipment(ctx context.Context, req ShipmentRequest) (Shipment, error)
+	Label(ctx context.Context, sh Shipment, size LabelSize) ([]byte, error)
+	Cancel(ctx context.Context, sh Shipment) error
+	Track(ctx context.Context, trackingNumber string) (Tracking, error)
+}
+
+var httpClient = &http.Client{Timeout: 20 * time.Second}
+
+var postalCodeRe = regexp.MustCompile(`\b(\d{5})\s*$`)
+
+// PostalCode returns the Thai postal code an address ends with, or ""
+func PostalCode(address string) string {
+	if m := postalCodeRe.FindStringSubmatch(strings.TrimSpace(address)); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// normalize fills postal codes and checks both parties can be delivered to
+func normalize(req ShipmentRequest) (ShipmentRequest, error) {
+	for _, a := range []*Address{&req.Sender, &req.Recipient} {
+		a.Name, a.Phone, a.Address = strings.TrimSpace(a.Name), strings.TrimSpace(a.Phone), strings.TrimSpace(a.Address)
+		if a.PostalCode == "" {
+			a.PostalCode = PostalCode(a.Address)
+		}
+		if a.Name == "" || a.Phone == "" || a.Address == "" {
+			return req, ErrIncomplete
+		}
+	}
+	if req.Parcel.WeightGram <= 0 {
+		req.Parcel.WeightGram = 1000
+	}
+	return req, nil
+}
+
+// latest returns the status of the last event, or fallback when there are none
+func latest(events []TrackingEvent, fallback Status) Status {
+	if len(events) == 0 {
+		return fallback
+	}
+	return events[len(events)-1].Status
+}
@@ -0,0 +1,282 @@
+package carriers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/appconfig"
+)
+
+// Flash is Flash Express through its open API. Requests are form posts signed with the
+// merchant's secret key.
+type Flash struct {
+	cfg appconfig.FlashConfig
+}
+
+func NewFlash(cfg appconfig.FlashConfig) *Flash {
+	if strings.TrimSpace(cfg.BaseURL) == "" {
+		cfg.BaseURL = "https://open-api.flashexpress.com"
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &Flash{cfg: cfg}
+}
+
+func (f *Flash) Code() string { return "FLASH" }
+func (f *Flash) Name() string { return "Flash Express" }
+
+func (f *Flash) Rates(ctx context.Context, req ShipmentRequest) ([]Rate, error) {
+	req, err := normalize(req)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		EstimatePrice int64 `json:"estimatePrice"` // Satang
+	}
+	err = f.call(ctx, "/open/v1/orders/estimate_rate", url.Values{
+		"weight":          {strconv.Itoa(req.Parcel.WeightGram)},
+		"srcPostalCode":   {req.Sender.PostalCode},
+		"dstPostalCode":   {req.Recipient.PostalCode},
+		"expressCategory": {"1"},
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return []Rate{{Carrier: f.Code(), Service: "STANDARD", Name: "Flash Standard", Price: out.EstimatePrice, Days: 2}}, nil
+}
+
+func (f *Flash) CreateShipment(ctx context.Context, req ShipmentRequest) (Shipment, error) {
+	req, err := normalize(req)
+	if err != nil {
+		return Shipment{}, err
+	}
+	params := url.Values{
+		"outTradeNo":       {req.Reference},
+		"srcName":          {req.Sender.Name},
+		"srcPhone":         {req.Sender.Phone},
+		"srcDetailAddress": {req.Sender.Address},
+		"srcPostalCode":    {req.Sender.PostalCode},
+		"dstName":          {req.Recipient.Name},
+		"dstPhone":         {req.Recipient.Phone},
+		"dstDetailAddress": {req.Recipient.Address},
+		"dstPostalCode":    {req.Recipient.PostalCode},
+		"articleCategory":  {"99"}, // Other
+		"expressCategory":  {"1"},  // Standard
+		"weight":           {strconv.Itoa(req.Parcel.WeightGram)},
+		"insured":          {"0"},
+		"codEnabled":       {"0"},
+		"remark":           {req.Description},
+	}
+	if req.CODAmount > 0 {
+		params.Set("codEnabled", "1")
+		params.Set("codAmount", strconv.FormatInt(req.CODAmount, 10))
+	}
+	if req.Parcel.LengthCm > 0 {
+		params.Set("length", strconv.Itoa(req.Parcel.LengthCm))
+		params.Set("width", strconv.Itoa(req.Parcel.WidthCm))
+		params.Set("height", strconv.Itoa(req.Parcel.HeightCm))
+	}
+	var out struct {
+		PNO      string `json:"pno"`
+		SortCode string `json:"sortCode"`
+	}
+	if err := f.call(ctx, "/open/v3/orders", params, &out); err != nil {
+		return Shipment{}, err
+	}
+	return Shipment{
+		Carrier:        f.Code(),
+		Service:        "STANDARD",
+		TrackingNumber: out.PNO,
+		SortCode:       out.SortCode,
+		CreatedAt:      time.Now().UTC(),
+	}, nil
+}
+
+// Label downloads Flash's own label, which only comes in the thermal size
+func (f *Flash) Label(ctx context.Context, sh Shipment, size LabelSize) ([]byte, error) {
+	if size != Label4x6 {
+		return nil, ErrUnsupported
+	}
+	resp, err := f.post(ctx, "/open/v1/orders/"+url.PathEscape(sh.TrackingNumber)+"/pre_print", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(resp, []byte("%PDF")) {
+		return nil, f.apiError(http.StatusOK, resp)
+	}
+	return resp, nil
+}
+
+func (f *Flash) Cancel(ctx context.Context, sh Shipment) error {
+	return f.call(ctx, "/open/v1/orders/"+url.PathEscape(sh.TrackingNumber)+"/cancel", url.Values{}, nil)
+}
+
+func (f *Flash) Track(ctx context.Context, trackingNumber string) (Tracking, error) {
+	var out struct {
+		State  int `json:"state"`
+		Routes []struct {
+			RoutedAt    int64  `json:"routedAt"`
+			RouteAction string `json:"routeAction"`
+			Message     string `json:"message"`
+			State       int    `json:"state"`
+		} `json:"routes"`
+	}
+	if err := f.call(ctx, "/open/v1/orders/"+url.PathEscape(trackingNumber)+"/routes", url.Values{}, &out); err != nil {
+		return Tracking{}, err
+	}
+	t := Tracking{TrackingNumber: trackingNumber, Status: FlashStatus(out.State)}
+	for i := len(out.Routes) - 1; i >= 0; i-- { // Flash lists the latest route first
+		r := out.Routes[i]
+		t.Events = append(t.Events, TrackingEvent{
+			Time:        time.Unix(r.RoutedAt, 0).UTC(),
+			Status:      FlashStatus(r.State),
+			Description: r.Message,
+			Code:        r.RouteAction,
+		})
+	}
+	return t, nil
+}
+
+// ParseWebhook decodes a route push: a form signed like our requests, with the route in
+// a JSON data field
+func (f *Flash) ParseWebhook(_ *http.Request, body []byte) ([]WebhookEvent, error) {
+	params, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, ErrBadPayload
+	}
+	if params.Get("mchId") != f.cfg.MchID || !equal(f.Sign(params), params.Get("sign")) {
+		return nil, ErrBadSignature
+	}
+	var route struct {
+		PNO         string `json:"pno"`
+		State       int    `json:"state"`
+		RoutedAt    int64  `json:"routedAt"`
+		RouteAction string `json:"routeAction"`
+		Message     string `json:"message"`
+		StoreName   string `json:"storeName"`
+	}
+	if err := json.Unmarshal([]byte(params.Get("data")), &route); err != nil || route.PNO == "" {
+		return nil, ErrBadPayload
+	}
+	at := time.Now().UTC()
+	if route.RoutedAt > 0 {
+		at = time.Unix(route.RoutedAt, 0).UTC()
+	}
+	return []WebhookEvent{{
+		TrackingNumber: route.PNO,
+		Event: TrackingEvent{
+			Time:        at,
+			Status:      FlashStatus(route.State),
+			Description: route.Message,
+			Location:    route.StoreName,
+			Code:        route.RouteAction,
+		},
+	}}, nil
+}
+
+// FlashStatus maps Flash parcel states to tracking statuses
+func FlashStatus(state int) Status {
+	switch state {
+	case 1:
+		return StatusPickedUp
+	case 2, 4: // In transit, held at a hub
+		return StatusInTransit
+	case 3:
+		return StatusOutForDelivery
+	case 5:
+		return StatusDelivered
+	case 6:
+		return StatusFailed
+	case 7:
+		return StatusReturned
+	case 8, 9: // Closed, cancelled
+		return StatusCancelled
+	}
+	return StatusCreated
+}
+
+// Sign computes Flash's signature: the non-empty parameters sorted by name, joined as a
+// query string with the secret key appended, hashed with SHA-256 in upper case hex
+func (f *Flash) Sign(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "sign" && strings.TrimSpace(params.Get(k)) != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + params.Get(k) + "&")
+	}
+	b.WriteString("key=" + f.cfg.SecretKey)
+	sum := sha256.Sum256([]byte(b.String()))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// call posts a signed request and decodes the data of a successful response into out
+func (f *Flash) call(ctx context.Context, path string, params url.Values, out any) error {
+	body, err := f.post(ctx, path, params)
+	if err != nil {
+		return err
+	}
+	var env struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &env); err != nil {
+		return err
+	}
+	if env.Code != 1 {
+		return APIError{Carrier: f.Code(), StatusCode: http.StatusOK, Message: env.Message}
+	}
+	if out == nil || len(env.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(env.Data, out)
+}
+
+func (f *Flash) post(ctx context.Context, path string, params url.Values) ([]byte, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	params.Set("mchId", f.cfg.MchID)
+	params.Set("nonceStr", hex.EncodeToString(nonce))
+	params.Set("sign", f.Sign(params))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.cfg.BaseURL+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, f.apiError(resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (f *Flash) apiError(status int, body []byte) error {
+	var v struct {
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &v)
+	return APIError{Carrier: f.Code(), StatusCode: status, Message: v.Message}
+}
@@ -0,0 +1,225 @@
+package carriers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/appconfig"
+)
+
+// JT is J&T Express through its open platform. Each request carries a JSON bizContent
+// form field and a digest of it keyed with the account's private key.
+type JT struct {
+	cfg appconfig.JTConfig
+}
+
+func NewJT(cfg appconfig.JTConfig) *JT {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &JT{cfg: cfg}
+}
+
+func (j *JT) Code() string { return "JT" }
+func (j *JT) Name() string { return "J&T Express" }
+
+func (j *JT) Rates(context.Context, ShipmentRequest) ([]Rate, error) {
+	return nil, ErrUnsupported // Prices are contractual
+}
+
+func (j *JT) CreateShipment(ctx context.Context, req ShipmentRequest) (Shipment, error) {
+	req, err := normalize(req)
+	if err != nil {
+		return Shipment{}, err
+	}
+	service := strings.ToUpper(req.Service)
+	if service == "" {
+		service = "EZ" // Standard
+	}
+	biz := map[string]any{
+		"customerCode": j.cfg.CustomerCode,
+		"password":     j.cfg.Password,
+		"txlogisticId": req.Reference,
+		"expressType":  service,
+		"orderType":    "1",
+		"serviceType":  "01", // Pickup from sender
+		"sender": map[string]string{
+			"name": req.Sender.Name, "mobile": req.Sender.Phone, "address": req.Sender.Address, "postCode": req.Sender.PostalCode,
+		},
+		"receiver": map[string]string{
+			"name": req.Recipient.Name, "mobile": req.Recipient.Phone, "address": req.Recipient.Address, "postCode": req.Recipient.PostalCode,
+		},
+		"weight":        strconv.FormatFloat(float64(req.Parcel.WeightGram)/1000, 'f', 2, 64),
+		"totalQuantity": 1,
+		"remark":        req.Description,
+	}
+	if req.CODAmount > 0 {
+		biz["itemsValue"] = strconv.FormatFloat(float64(req.CODAmount)/100, 'f', 2, 64)
+	}
+	var out struct {
+		BillCode    string `json:"billCode"`
+		SortingCode string `json:"sortingCode"`
+	}
+	if err := j.call(ctx, "/api/order/addOrder", biz, &out); err != nil {
+		return Shipment{}, err
+	}
+	return Shipment{
+		Carrier:        j.Code(),
+		Service:        service,
+		TrackingNumber: out.BillCode,
+		ExternalID:     req.Reference,
+		SortCode:       out.SortingCode,
+		CreatedAt:      time.Now().UTC(),
+	}, nil
+}
+
+// Label is rendered locally
+func (j *JT) Label(context.Context, Shipment, LabelSize) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (j *JT) Cancel(ctx context.Context, sh Shipment) error {
+	return j.call(ctx, "/api/order/cancelOrder", map[string]any{
+		"customerCode": j.cfg.CustomerCode,
+		"password":     j.cfg.Password,
+		"txlogisticId": sh.ExternalID,
+		"billCode":     sh.TrackingNumber,
+		"reason":       "Cancelled by merchant",
+	}, nil)
+}
+
+// jtTrace is one waybill's scans as J&T reports them, in trace responses and pushes
+type jtTrace struct {
+	BillCode string `json:"billCode"`
+	Details  []struct {
+		ScanTime        string `json:"scanTime"`
+		ScanType        string `json:"scanType"`
+		Desc            string `json:"desc"`
+		ScanNetworkName string `json:"scanNetworkName"`
+	} `json:"details"`
+}
+
+func (j *JT) Track(ctx context.Context, trackingNumber string) (Tracking, error) {
+	var out []jtTrace
+	if err := j.call(ctx, "/api/logistics/trace", map[string]any{"billCodes": trackingNumber}, &out); err != nil {
+		return Tracking{}, err
+	}
+	if len(out) == 0 {
+		return Tracking{}, ErrNotFound
+	}
+	t := Tracking{TrackingNumber: trackingNumber, Events: out[0].events()}
+	t.Status = latest(t.Events, StatusCreated)
+	return t, nil
+}
+
+func (tr jtTrace) events() []TrackingEvent {
+	events := make([]TrackingEvent, 0, len(tr.Details))
+	for _, d := range tr.Details {
+		events = append(events, TrackingEvent{
+			Time:        eventTime("2006-01-02 15:04:05", d.ScanTime),
+			Status:      JTStatus(d.ScanType),
+			Description: d.Desc,
+			Location:    d.ScanNetworkName,
+			Code:        d.ScanType,
+		})
+	}
+	return events
+}
+
+// ParseWebhook decodes a trace push: a bizContent form field holding one waybill or a
+// list of them, with the digest header computed as for our requests
+func (j *JT) ParseWebhook(r *http.Request, body []byte) ([]WebhookEvent, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, ErrBadPayload
+	}
+	biz := form.Get("bizContent")
+	if biz == "" || !equal(j.Digest(biz), r.Header.Get("digest")) {
+		return nil, ErrBadSignature
+	}
+	var traces []jtTrace
+	if strings.HasPrefix(strings.TrimSpace(biz), "{") {
+		var one jtTrace
+		if err := json.Unmarshal([]byte(biz), &one); err != nil {
+			return nil, ErrBadPayload
+		}
+		traces = append(traces, one)
+	} else if err := json.Unmarshal([]byte(biz), &traces); err != nil {
+		return nil, ErrBadPayload
+	}
+	var out []WebhookEvent
+	for _, tr := range traces {
+		for _, e := range tr.events() {
+			out = append(out, WebhookEvent{TrackingNumber: strings.TrimSpace(tr.BillCode), Event: e})
+		}
+	}
+	return out, nil
+}
+
+// JTStatus maps J&T scan types to tracking statuses
+func JTStatus(scanType string) Status {
+	s := strings.ToLower(scanType)
+	switch {
+	case strings.Contains(s, "pick"):
+		return StatusPickedUp
+	case strings.Contains(s, "sign"), strings.Contains(s, "deliver") && !strings.Contains(s, "out"):
+		return StatusDelivered
+	case strings.Contains(s, "out for") || strings.Contains(s, "dispatch"):
+		return StatusOutForDelivery
+	case strings.Contains(s, "return"):
+		return StatusReturned
+	case strings.Contains(s, "problem") || strings.Contains(s, "fail"):
+		return StatusFailed
+	case strings.Contains(s, "cancel"):
+		return StatusCancelled
+	}
+	return StatusInTransit
+}
+
+// Digest signs a bizContent payload: base64 of the MD5 of the payload and private key
+func (j *JT) Digest(bizContent string) string {
+	sum := md5.Sum([]byte(bizContent + j.cfg.PrivateKey))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (j *JT) call(ctx context.Context, path string, biz map[string]any, out any) error {
+	payload, err := json.Marshal(biz)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"bizContent": {string(payload)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.cfg.BaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("apiAccount", j.cfg.APIAccount)
+	req.Header.Set("digest", j.Digest(string(payload)))
+	req.Header.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	var env struct {
+		Code string          `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	_ = json.Unmarshal(body, &env)
+	if resp.StatusCode >= 400 || env.Code != "1" {
+		return APIError{Carrier: j.Code(), StatusCode: resp.StatusCode, Message: env.Msg}
+	}
+	if out == nil || len(env.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(env.Data, out)
+}
@@ -0,0 +1,183 @@
+package carriers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/appconfig"
+)
+
+// Kerry is Kerry Express (KEX) through SmartEDI. The merchant generates consignment
+// numbers under its assigned prefix; Kerry pushes status updates rather than offering a
+// tracking lookup, so Track is unsupported and statuses arrive by webhook.
+type Kerry struct {
+	cfg appconfig.KerryConfig
+}
+
+func NewKerry(cfg appconfig.KerryConfig) *Kerry {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &Kerry{cfg: cfg}
+}
+
+func (k *Kerry) Code() string { return "KERRY" }
+func (k *Kerry) Name() string { return "Kerry Express" }
+
+func (k *Kerry) Rates(context.Context, ShipmentRequest) ([]Rate, error) {
+	return nil, ErrUnsupported // Prices are contractual
+}
+
+func (k *Kerry) CreateShipment(ctx context.Context, req ShipmentRequest) (Shipment, error) {
+	req, err := normalize(req)
+	if err != nil {
+		return Shipment{}, err
+	}
+	conNo := k.consignment(req.Reference)
+	service := strings.ToUpper(req.Service)
+	if service == "" {
+		service = "ND" // Next day
+	}
+	shipment := map[string]any{
+		"con_no":        conNo,
+		"action_code":   "A",
+		"s_name":        req.Sender.Name,
+		"s_address":     req.Sender.Address,
+		"s_zipcode":     req.Sender.PostalCode,
+		"s_mobile":      req.Sender.Phone,
+		"r_name":        req.Recipient.Name,
+		"r_address":     req.Recipient.Address,
+		"r_zipcode":     req.Recipient.PostalCode,
+		"r_mobile1":     req.Recipient.Phone,
+		"service_code":  service,
+		"tot_pkg":       1,
+		"weight":        float64(req.Parcel.WeightGram) / 1000,
+		"ref_no":        req.Reference,
+		"special_note":  req.Description,
+		"cod_amount":    float64(req.CODAmount) / 100,
+		"cod_type":      "",
+		"declare_value": 0,
+	}
+	if req.CODAmount > 0 {
+		shipment["cod_type"] = "CASH"
+	}
+	if err := k.shipmentInfo(ctx, shipment); err != nil {
+		return Shipment{}, err
+	}
+	return Shipment{Carrier: k.Code(), Service: service, TrackingNumber: conNo, CreatedAt: time.Now().UTC()}, nil
+}
+
+// Label is rendered locally; Kerry accepts merchant-printed labels with its barcode
+func (k *Kerry) Label(context.Context, Shipment, LabelSize) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (k *Kerry) Cancel(ctx context.Context, sh Shipment) error {
+	return k.shipmentInfo(ctx, map[string]any{"con_no": sh.TrackingNumber, "action_code": "D"})
+}
+
+func (k *Kerry) Track(context.Context, string) (Tracking, error) {
+	return Tracking{}, ErrUnsupported
+}
+
+// ParseWebhook decodes a status push, authenticated by the same app_id and app_key
+// headers we send Kerry
+func (k *Kerry) ParseWebhook(r *http.Request, body []byte) ([]WebhookEvent, error) {
+	if !equal(k.cfg.AppID, r.Header.Get("app_id")) || !equal(k.cfg.AppKey, r.Header.Get("app_key")) {
+		return nil, ErrBadSignature
+	}
+	var in struct {
+		Req struct {
+			Status struct {
+				ConNo      string `json:"con_no"`
+				StatusCode string `json:"status_code"`
+				StatusDesc string `json:"status_desc"`
+				StatusDate string `json:"status_date"`
+				Location   string `json:"location"`
+			} `json:"status"`
+		} `json:"req"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil || in.Req.Status.ConNo == "" {
+		return nil, ErrBadPayload
+	}
+	st := in.Req.Status
+	return []WebhookEvent{{
+		TrackingNumber: strings.ToUpper(strings.TrimSpace(st.ConNo)),
+		Event: TrackingEvent{
+			Time:        eventTime("2006-01-02 15:04:05", st.StatusDate),
+			Status:      KerryStatus(st.StatusCode),
+			Description: st.StatusDesc,
+			Location:    st.Location,
+			Code:        st.StatusCode,
+		},
+	}}, nil
+}
+
+// KerryStatus maps Kerry status codes to tracking statuses
+func KerryStatus(code string) Status {
+	switch strings.ToUpper(strings.TrimSpace(code)) {
+	case "010", "020", "PUP": // Booked, picked up
+		return StatusPickedUp
+	case "030", "040", "050", "TRN":
+		return StatusInTransit
+	case "060", "OFD":
+		return StatusOutForDelivery
+	case "POD", "070":
+		return StatusDelivered
+	case "080", "DEX":
+		return StatusFailed
+	case "RTS", "090":
+		return StatusReturned
+	case "CAN":
+		return StatusCancelled
+	}
+	return StatusInTransit
+}
+
+// consignment builds a consignment number from the merchant prefix and our reference
+func (k *Kerry) consignment(reference string) string {
+	ref := strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') {
+			return r
+		}
+		return -1
+	}, reference)
+	return strings.ToUpper(k.cfg.ConsignmentPrefix + ref)
+}
+
+func (k *Kerry) shipmentInfo(ctx context.Context, shipment map[string]any) error {
+	payload, err := json.Marshal(map[string]any{"req": map[string]any{"shipment": shipment}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.cfg.BaseURL+"/SmartEDI/shipment_info", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("app_id", k.cfg.AppID)
+	req.Header.Set("app_key", k.cfg.AppKey)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	var out struct {
+		Res struct {
+			Shipment struct {
+				StatusCode string `json:"status_code"`
+				StatusDesc string `json:"status_desc"`
+			} `json:"shipment"`
+		} `json:"res"`
+	}
+	_ = json.Unmarshal(body, &out)
+	if resp.StatusCode >= 400 || out.Res.Shipment.StatusCode != "000" {
+		return APIError{Carrier: k.Code(), StatusCode: resp.StatusCode, Message: out.Res.Shipment.StatusDesc}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package carriers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/platform/pdf"
+)
+
+// LabelData is everything printed on a shipping label
+type LabelData struct {
+	CarrierName string
+	Shipment    Shipment
+	Sender      Address
+	Recipient   Address
+	Reference   string
+	CODAmount   int64
+	WeightGram  int
+	Contents    string // e.g. "3 items"
+}
+
+// labelBase is the 4x6 inch layout; A5 and A4 scale it up to fit the page
+var labelBase = pdf.Label4x6
+
+// RenderLabel lays out a shipping label. regular may be nil to use Helvetica, in which
+// case Thai addresses cannot be printed.
+func RenderLabel(size LabelSize, l LabelData, regular, bold *pdf.Font) []byte {
+	page := pdf.Label4x6
+	switch size {
+	case LabelA5:
+		page = pdf.A5
+	case LabelA4:
+		page = pdf.A4
+	}
+	s, ox, oy := 1.0, 0.0, 0.0
+	if size != Label4x6 {
+		const margin = 18.0
+		s = (page.Width - 2*margin) / labelBase.Width
+		if h := (page.Height - 2*margin) / labelBase.Height; h < s {
+			s = h
+		}
+		ox, oy = (page.Width-labelBase.Width*s)/2, margin
+	}
+
+	d := pdf.New(page)
+	thai := regular != nil && regular.Has("ผู้รับ")
+	if regular != nil {
+		d.SetFonts(regular, bold)
+	}
+	caption := func(th, en string) string {
+		if thai {
+			return th + " / " + en
+		}
+		return en
+	}
+	// Drawing helpers in 4x6 label points
+	const m = 12.0
+	w := labelBase.Width - 2*m
+	x := func(v float64) float64 { return ox + v*s }
+	y := func(v float64) float64 { return oy + v*s }
+	text := func(px, py, size float64, b bool, str string) { d.Text(x(px), y(py), size*s, b, str) }
+	right := func(px, py, size float64, b bool, str string) { d.TextRight(x(px), y(py), size*s, b, str) }
+	hline := func(py float64) { d.Line(x(m), y(py), x(m+w), y(py)) }
+	wrap := func(str string, width, size float64) []string { return d.Wrap(str, width*s, size*s, false) }
+
+	d.AddPage()
+	d.Rect(x(4), y(4), (labelBase.Width-8)*s, (labelBase.Height-8)*s)
+
+	// Carrier, service and hub sort code
+	at := m + 14
+	text(m, at, 14, true, l.CarrierName)
+	if l.Shipment.SortCode != "" {
+		right(m+w, at+4, 22, true, l.Shipment.SortCode)
+	}
+	if l.Shipment.Service != "" {
+		text(m, at+11, 8, false, l.Shipment.Service)
+	}
+	at += 20
+	hline(at)
+
+	// Tracking barcode
+	at += 6
+	_ = d.Barcode(x(m), y(at), w*s, 56*s, l.Shipment.TrackingNumber)
+	at += 56 + 12
+	tn := l.Shipment.TrackingNumber
+	d.Text(x(m+w/2)-d.TextWidth(tn, 12*s, true)/2, y(at), 12*s, true, tn)
+	at += 8
+	hline(at)
+
+	// Recipient
+	at += 11
+	text(m, at, 7, true, caption("ผู้รับ", "TO"))
+	at += 14
+	text(m, at, 12, true, l.Recipient.Name)
+	if l.Recipient.Phone != "" {
+		right(m+w, at, 10, true, l.Recipient.Phone)
+	}
+	for i, ln := range wrap(l.Recipient.Address, w, 10) {
+		if i == 5 {
+			break
+		}
+		at += 12
+		text(m, at, 10, false, ln)
+	}
+	if l.Recipient.PostalCode != "" {
+		at += 24
+		right(m+w, at, 22, true, l.Recipient.PostalCode)
+	}
+	at += 8
+	hline(at)
+
+	// Sender
+	at += 10
+	text(m, at, 7, true, caption("ผู้ส่ง", "FROM"))
+	at += 10
+	text(m, at, 8, true, strings.TrimSpace(l.Sender.Name+"  "+l.Sender.Phone))
+	for i, ln := range wrap(l.Sender.Address, w, 7) {
+		if i == 2 {
+			break
+		}
+		at += 9
+		text(m, at, 7, false, ln)
+	}
+	at += 7
+	hline(at)
+
+	// Cash on delivery
+	if l.CODAmount > 0 {
+		at += 6
+		d.FillRect(x(m), y(at), w*s, 26*s, 0.85)
+		d.Rect(x(m), y(at), w*s, 26*s)
+		cod := caption("เก็บเงินปลายทาง", "COD") + "  " + baht(l.CODAmount, regular != nil)
+		d.Text(x(m+w/2)-d.TextWidth(cod, 13*s, true)/2, y(at+18), 13*s, true, cod)
+		at += 26
+	}
+
+	// Order reference and parcel details along the bottom
+	foot := labelBase.Height - m - 4
+	details := []string{"Ref " + l.Reference}
+	if l.WeightGram > 0 {
+		details = append(details, strconv.FormatFloat(float64(l.WeightGram)/1000, 'f', 2, 64)+" kg")
+	}
+	if l.Contents != "" {
+		details = append(details, l.Contents)
+	}
+	created := l.Shipment.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	text(m, foot, 7, false, strings.Join(details, "   "))
+	right(m+w, foot, 7, false, created.In(bangkok).Format("02/01/2006"))
+	if l.Reference != "" && at+40 < foot-12 {
+		_ = d.Barcode(x(m), y(foot-40), w*0.6*s, 28*s, l.Reference)
+	}
+
+	return d.Bytes()
+}
+
+// baht formats satang; Helvetica has no baht sign, so THB is written instead
+func baht(v int64, sign bool) string {
+	prefix := "THB "
+	if sign {
+		prefix = "฿"
+	}
+	whole := strconv.FormatInt(v/100, 10)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return fmt.Sprintf("%s%s.%02d", prefix, whole, v%100)
+}
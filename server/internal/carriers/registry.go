@@ -0,0 +1,58 @@
+package carriers
+
+import (
+	"strings"
+
+	"stockflows/server/internal/appconfig"
+)
+
+// Registry holds the carriers an installation can book with, in display order
+type Registry struct {
+	carriers []Carrier
+}
+
+// NewRegistry registers the LOCAL carrier and every courier with credentials configured
+func NewRegistry(cfg appconfig.CarriersConfig) *Registry {
+	r := &Registry{}
+	r.Register(NewLocal(cfg.WebhookSecret))
+	if cfg.Flash.MchID != "" && cfg.Flash.SecretKey != "" {
+		r.Register(NewFlash(cfg.Flash))
+	}
+	if cfg.Kerry.BaseURL != "" && cfg.Kerry.AppID != "" && cfg.Kerry.AppKey != "" {
+		r.Register(NewKerry(cfg.Kerry))
+	}
+	if cfg.JT.BaseURL != "" && cfg.JT.APIAccount != "" && cfg.JT.PrivateKey != "" {
+		r.Register(NewJT(cfg.JT))
+	}
+	if cfg.ThaiPost.Token != "" {
+		r.Register(NewThaiPost(cfg.ThaiPost, cfg.WebhookSecret))
+	}
+	return r
+}
+
+// Register adds a carrier, replacing any with the same code
+func (r *Registry) Register(c Carrier) {
+	for i, existing := range r.carriers {
+		if existing.Code() == c.Code() {
+			r.carriers[i] = c
+			return
+		}
+	}
+	r.carriers = append(r.carriers, c)
+}
+
+// Get looks a carrier up by code, ignoring case
+func (r *Registry) Get(code string) (Carrier, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, c := range r.carriers {
+		if c.Code() == code {
+			return c, nil
+		}
+	}
+	return nil, ErrUnknownCarrier
+}
+
+// List returns the registered carriers
+func (r *Registry) List() []Carrier {
+	return append([]Carrier(nil), r.carriers...)
+}
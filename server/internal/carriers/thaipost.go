@@ -0,0 +1,224 @@
+package carriers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"stockflows/server/internal/appconfig"
+)
+
+var bangkok = time.FixedZone("ICT", 7*60*60)
+
+// ThaiPost is Thailand Post (EMS and registered mail). There is no booking API: parcels
+// are lodged at the counter and registered here with the barcode from the receipt.
+// Tracking uses the public track API, which trades the configured token for a
+// short-lived access token.
+type ThaiPost struct {
+	cfg           appconfig.ThaiPostConfig
+	baseURL       string
+	webhookSecret string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewThaiPost creates the adapter. Thailand Post's hook service does not sign requests,
+// so the hook URL registered with it carries webhookSecret as a token parameter.
+func NewThaiPost(cfg appconfig.ThaiPostConfig, webhookSecret string) *ThaiPost {
+	return &ThaiPost{cfg: cfg, baseURL: "https://trackapi.thailandpost.co.th/post/api/v1", webhookSecret: webhookSecret}
+}
+
+func (t *ThaiPost) Code() string { return "THAIPOST" }
+func (t *ThaiPost) Name() string { return "Thailand Post" }
+
+func (t *ThaiPost) Rates(context.Context, ShipmentRequest) ([]Rate, error) {
+	return nil, ErrUnsupported
+}
+
+// CreateShipment registers a parcel already lodged at a post office
+func (t *ThaiPost) CreateShipment(_ context.Context, req ShipmentRequest) (Shipment, error) {
+	tracking := strings.ToUpper(strings.TrimSpace(req.TrackingNumber))
+	if tracking == "" {
+		return Shipment{}, ErrTrackingMissing
+	}
+	service := strings.ToUpper(req.Service)
+	if service == "" {
+		service = "EMS"
+	}
+	return Shipment{Carrier: t.Code(), Service: service, TrackingNumber: tracking, CreatedAt: time.Now().UTC()}, nil
+}
+
+// Label is rendered locally, e.g. to stick the address on the parcel before lodging it
+func (t *ThaiPost) Label(context.Context, Shipment, LabelSize) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// Cancel has nothing to call; lodged parcels are recalled at the counter
+func (t *ThaiPost) Cancel(context.Context, Shipment) error {
+	return nil
+}
+
+func (t *ThaiPost) Track(ctx context.Context, trackingNumber string) (Tracking, error) {
+	var out struct {
+		Response struct {
+			Items map[string][]struct {
+				Status            string `json:"status"`
+				StatusDescription string `json:"status_description"`
+				StatusDate        string `json:"status_date"`
+				Location          string `json:"location"`
+			} `json:"items"`
+		} `json:"response"`
+		Status  bool   `json:"status"`
+		Message string `json:"message"`
+	}
+	err := t.post(ctx, "/track", map[string]any{
+		"status":   "all",
+		"language": "EN",
+		"barcode":  []string{trackingNumber},
+	}, &out)
+	if err != nil {
+		return Tracking{}, err
+	}
+	items := out.Response.Items[strings.ToUpper(trackingNumber)]
+	if len(items) == 0 {
+		return Tracking{}, ErrNotFound
+	}
+	tr := Tracking{TrackingNumber: trackingNumber}
+	for _, it := range items {
+		tr.Events = append(tr.Events, TrackingEvent{
+			Time:        eventTime("02/01/2006 15:04:05", it.StatusDate),
+			Status:      ThaiPostStatus(it.Status),
+			Description: it.StatusDescription,
+			Location:    it.Location,
+			Code:        it.Status,
+		})
+	}
+	tr.Status = latest(tr.Events, StatusCreated)
+	return tr, nil
+}
+
+// ParseWebhook decodes a hook push, which lists status changes for the subscribed barcodes
+func (t *ThaiPost) ParseWebhook(r *http.Request, body []byte) ([]WebhookEvent, error) {
+	if !equal(t.webhookSecret, r.URL.Query().Get("token")) {
+		return nil, ErrBadSignature
+	}
+	var in struct {
+		Items []struct {
+			Barcode           string `json:"barcode"`
+			Status            string `json:"status"`
+			StatusDescription string `json:"status_description"`
+			StatusDate        string `json:"status_date"`
+			Location          string `json:"location"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, ErrBadPayload
+	}
+	out := make([]WebhookEvent, 0, len(in.Items))
+	for _, it := range in.Items {
+		out = append(out, WebhookEvent{
+			TrackingNumber: strings.ToUpper(strings.TrimSpace(it.Barcode)),
+			Event: TrackingEvent{
+				Time:        eventTime("02/01/2006 15:04:05", it.StatusDate),
+				Status:      ThaiPostStatus(it.Status),
+				Description: it.StatusDescription,
+				Location:    it.Location,
+				Code:        it.Status,
+			},
+		})
+	}
+	return out, nil
+}
+
+// ThaiPostStatus maps Thailand Post status codes, grouped by their first digit
+func ThaiPostStatus(code string) Status {
+	switch {
+	case code == "":
+		return StatusCreated
+	case strings.HasPrefix(code, "1"):
+		return StatusPickedUp
+	case strings.HasPrefix(code, "3"):
+		return StatusOutForDelivery
+	case strings.HasPrefix(code, "4"):
+		return StatusFailed
+	case strings.HasPrefix(code, "5"):
+		return StatusDelivered
+	case strings.HasPrefix(code, "7"):
+		return StatusReturned
+	}
+	return StatusInTransit
+}
+
+// accessToken returns a cached access token, fetching a new one when it has expired
+func (t *ThaiPost) accessToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+"/authenticate/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Token "+t.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	var out struct {
+		Token  string `json:"token"`
+		Expire string `json:"expire"`
+	}
+	if err := t.do(req, &out); err != nil {
+		return "", err
+	}
+	t.token = out.Token
+	t.expires = time.Now().Add(50 * time.Minute) // Tokens last an hour
+	if at, err := time.ParseInLocation("2006-01-02 15:04:05", out.Expire, bangkok); err == nil {
+		t.expires = at.Add(-5 * time.Minute)
+	}
+	return t.token, nil
+}
+
+func (t *ThaiPost) post(ctx context.Context, path string, body any, out any) error {
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+token)
+	req.Header.Set("Content-Type", "application/json")
+	return t.do(req, out)
+}
+
+func (t *ThaiPost) do(req *http.Request, out any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		var v struct {
+			Message string `json:"message"`
+			Detail  string `json:"detail"`
+		}
+		_ = json.Unmarshal(body, &v)
+		if v.Message == "" {
+			v.Message = v.Detail
+		}
+		return APIError{Carrier: t.Code(), StatusCode: resp.StatusCode, Message: v.Message}
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,55 @@
+package carriers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBadSignature = errors.New("carriers: webhook signature does not verify")
+	ErrBadPayload   = errors.New("carriers: malformed webhook payload")
+)
+
+// WebhookEvent is a tracking update pushed by a courier for one parcel
+type WebhookEvent struct {
+	TrackingNumber string
+	Event          TrackingEvent
+}
+
+// WebhookReceiver is implemented by carriers that push tracking updates. ParseWebhook
+// checks the request came from the courier, returning ErrBadSignature when it did not,
+// and decodes the updates it carries.
+type WebhookReceiver interface {
+	ParseWebhook(r *http.Request, body []byte) ([]WebhookEvent, error)
+}
+
+// SignWebhook is the signature carriers without their own scheme are expected to send:
+// the hex HMAC-SHA256 of the body keyed with the configured webhook secret
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// equal compares secrets in constant time. An empty expected value never matches, so an
+// unconfigured secret refuses every webhook.
+func equal(expected, got string) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.TrimSpace(got))) == 1
+}
+
+// eventTime parses a courier timestamp in Bangkok time, falling back to now
+func eventTime(layout, value string) time.Time {
+	if at, err := time.ParseInLocation(layout, strings.TrimSpace(value), bangkok); err == nil {
+		return at.UTC()
+	}
+	return time.Now().UTC()
+}
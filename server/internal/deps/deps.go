@@ -2,6 +2,7 @@ package deps
 
 import (
 	"stockflows/server/internal/appconfig"
+	"stockflows/server/internal/carriers"
 	"stockflows/server/internal/repo"
 	"stockflows/server/platform/db/mongodb"
 	"stockflows/server/platform/session"
@@ -9,9 +10,10 @@ import (
 )
 
 type Dependencies struct {
-	Mongo  *mongodb.Client
-	MinIO  *minio.Client
-	Sess   session.Store
-	Repo   *repo.Repo
-	Config appconfig.Config
+	Mongo    *mongodb.Client
+	MinIO    *minio.Client
+	Sess     session.Store
+	Repo     *repo.Repo
+	Carriers *carriers.Registry
+	Config   appconfig.Config
 }
@@ -22,11 +22,113 @@ type Organization struct {
 	Address string `bson:"address,omitempty" json:"address,omitempty"`
 
 	Subscription Subscription `bson:"subscription,omitempty" json:"subscription,omitempty"`
+	Settings     OrgSettings  `bson:"settings,omitempty" json:"settings"`
 
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
 }
 
+// DefaultWriteOffApprovalThreshold applies when an org has not configured one (satang)
+const DefaultWriteOffApprovalThreshold int64 = 500000
+
+// OrgSettings holds org-wide configuration
+type OrgSettings struct {
+	// Write-offs valued above this amount need approval by an org admin (0 = use default).
+	// A product's write-offs posted without approval over the last day count together.
+	WriteOffApprovalThreshold int64 `bson:"writeOffApprovalThreshold,omitempty" json:"writeOffApprovalThreshold,omitempty"`
+
+	// ABC / XYZ classification parameters (zero values use defaults)
+	Classification ClassificationPolicy `bson:"classification,omitempty" json:"classification,omitempty"`
+
+	// VAT registration and how prices are quoted
+	Tax TaxSettings `bson:"tax,omitempty" json:"tax,omitempty"`
+}
+
+// DefaultVATRate is the Thai standard VAT rate in percent
+const DefaultVATRate = 7.0
+
+// TaxSettings controls how sales are taxed
+type TaxSettings struct {
+	VATRegistered    bool    `bson:"vatRegistered" json:"vatRegistered"`
+	PricesIncludeTax bool    `bson:"pricesIncludeTax" json:"pricesIncludeTax"`                 // Selling prices already contain VAT
+	StandardRate     float64 `bson:"standardRate,omitempty" json:"standardRate,omitempty"` // Percent; 0 uses DefaultVATRate
+}
+
+// Rate returns the standard rate in percent
+func (s TaxSettings) Rate() float64 {
+	if s.StandardRate <= 0 {
+		return DefaultVATRate
+	}
+	return s.StandardRate
+}
+
+// TaxClass decides which rate applies to a product
+type TaxClass string
+
+const (
+	TaxClassStandard  TaxClass = "STANDARD"   // Standard VAT rate
+	TaxClassZeroRated TaxClass = "ZERO_RATED" // Taxable at 0%, e.g. exports
+	TaxClassExempt    TaxClass = "EXEMPT"     // Outside VAT, e.g. unprocessed agricultural goods
+)
+
+// TaxSummary is the VAT breakdown of a sale, purchase or return. Amounts are ex-tax.
+type TaxSummary struct {
+	PricesIncludeTax bool    `bson:"pricesIncludeTax" json:"pricesIncludeTax"`
+	Rate             float64 `bson:"rate" json:"rate"` // Standard rate applied, in percent
+	Standard         int64   `bson:"standard" json:"standard"`
+	ZeroRated        int64   `bson:"zeroRated" json:"zeroRated"`
+	Exempt           int64   `bson:"exempt" json:"exempt"`
+	Tax              int64   `bson:"tax" json:"tax"`
+}
+
+// Net is the ex-tax amount of the document
+func (t TaxSummary) Net() int64 { return t.Standard + t.ZeroRated + t.Exempt }
+
+// ClassificationPolicy controls ABC (value contribution) and XYZ (demand variability) classification
+type ClassificationPolicy struct {
+	Scope      string  `bson:"scope,omitempty" json:"scope,omitempty"`           // BRANCH (rank within each branch) or ORG (rank org-wide)
+	Basis      string  `bson:"basis,omitempty" json:"basis,omitempty"`           // REVENUE or MARGIN
+	WindowDays int     `bson:"windowDays,omitempty" json:"windowDays,omitempty"` // Days of sales considered
+	AShare     float64 `bson:"aShare,omitempty" json:"aShare,omitempty"`         // Cumulative contribution covered by A, e.g. 0.8
+	BShare     float64 `bson:"bShare,omitempty" json:"bShare,omitempty"`         // Cumulative contribution covered by A+B, e.g. 0.95
+	XMaxCV     float64 `bson:"xMaxCv,omitempty" json:"xMaxCv,omitempty"`         // Weekly demand coefficient of variation limit for X
+	YMaxCV     float64 `bson:"yMaxCv,omitempty" json:"yMaxCv,omitempty"`         // ... and for Y; above is Z
+}
+
+// WithDefaults fills unset classification parameters
+func (p ClassificationPolicy) WithDefaults() ClassificationPolicy {
+	if p.Scope == "" {
+		p.Scope = "BRANCH"
+	}
+	if p.Basis == "" {
+		p.Basis = "REVENUE"
+	}
+	if p.WindowDays <= 0 {
+		p.WindowDays = 90
+	}
+	if p.AShare <= 0 {
+		p.AShare = 0.8
+	}
+	if p.BShare <= 0 {
+		p.BShare = 0.95
+	}
+	if p.XMaxCV <= 0 {
+		p.XMaxCV = 0.5
+	}
+	if p.YMaxCV <= 0 {
+		p.YMaxCV = 1.0
+	}
+	return p
+}
+
+// ApprovalThreshold returns the effective write-off approval threshold
+func (s OrgSettings) ApprovalThreshold() int64 {
+	if s.WriteOffApprovalThreshold > 0 {
+		return s.WriteOffApprovalThreshold
+	}
+	return DefaultWriteOffApprovalThreshold
+}
+
 type Subscription struct {
 	Status string `bson:"status,omitempty" json:"status,omitempty"` // e.g. "trialing", "active", "past_due", "canceled"
 	Plan   string `bson:"plan,omitempty" json:"plan,omitempty"`
@@ -42,6 +144,7 @@ type Branch struct {
 	OrgID   string `bson:"orgId" json:"orgId"`
 	Name    string `bson:"name" json:"name"`
 	Address string `bson:"address,omitempty" json:"address,omitempty"`
+	Phone   string `bson:"phone,omitempty" json:"phone,omitempty"` // Sender phone on shipping labels
 	IsMain  bool   `bson:"isMain" json:"isMain"`
 
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
@@ -97,6 +200,7 @@ type CostingMethod string
 const (
 	CostingMethodFIFO          CostingMethod = "FIFO"
 	CostingMethodMovingAverage CostingMethod = "MOVING_AVERAGE"
+	CostingMethodStandard      CostingMethod = "STANDARD" // Valued at Product.StandardCost; differences go to variance
 )
 
 type Product struct {
@@ -119,11 +223,36 @@ type Product struct {
 	CostingMethod CostingMethod `bson:"costingMethod,omitempty" json:"costingMethod,omitempty"`
 	AverageCost   int64         `bson:"averageCost,omitempty" json:"averageCost,omitempty"`
 	TotalQuantity int           `bson:"totalQuantity,omitempty" json:"totalQuantity,omitempty"`
+	StandardCost  int64         `bson:"standardCost,omitempty" json:"standardCost,omitempty"`
+
+	TaxClass TaxClass `bson:"taxClass,omitempty" json:"taxClass,omitempty"` // Empty means STANDARD
+
+	// Replenishment configuration
+	SupplierID   string `bson:"supplierId,omitempty" json:"supplierId,omitempty"`     // Preferred supplier
+	LeadTimeDays int    `bson:"leadTimeDays,omitempty" json:"leadTimeDays,omitempty"` // Overrides the supplier's lead time
+
+	// Selling beyond stock
+	BackorderPolicy BackorderPolicy `bson:"backorderPolicy,omitempty" json:"backorderPolicy,omitempty"` // Empty means orders must be covered by stock
+	ReleaseDate     string          `bson:"releaseDate,omitempty" json:"releaseDate,omitempty"`         // Pre-orders: expected availability, YYYY-MM-DD
 
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
 }
 
+// BackorderPolicy says whether orders may take more of a product than the branch has
+type BackorderPolicy string
+
+const (
+	BackorderPolicyNone      BackorderPolicy = ""          // Orders beyond available stock are refused
+	BackorderPolicyBackorder BackorderPolicy = "BACKORDER" // The shortfall waits for the next receipt
+	BackorderPolicyPreorder  BackorderPolicy = "PREORDER"  // Sold ahead of release; every unit short waits for the release
+)
+
+// AllowsBackorder reports whether orders may take more of the product than is available
+func (p Product) AllowsBackorder() bool {
+	return p.BackorderPolicy == BackorderPolicyBackorder || p.BackorderPolicy == BackorderPolicyPreorder
+}
+
 type StockLevel struct {
 	ID        string `bson:"_id" json:"id"`
 	OrgID     string `bson:"orgId" json:"orgId"`
@@ -135,9 +264,25 @@ type StockLevel struct {
 	MinStock    int    `bson:"minStock" json:"minStock"`
 	BinLocation string `bson:"binLocation,omitempty" json:"binLocation,omitempty"`
 
+	// Replenishment parameters (MinStock acts as the reorder point)
+	SafetyStock int `bson:"safetyStock,omitempty" json:"safetyStock,omitempty"`
+	ReorderQty  int `bson:"reorderQty,omitempty" json:"reorderQty,omitempty"`
+	MaxStock    int `bson:"maxStock,omitempty" json:"maxStock,omitempty"` // Order-up-to level; takes precedence over ReorderQty
+
+	// ConsignedQty is the part of Quantity owned by consignors rather than the org
+	ConsignedQty int `bson:"consignedQty,omitempty" json:"consignedQty,omitempty"`
+
 	// For moving average at branch level
 	AverageCost int64 `bson:"averageCost,omitempty" json:"averageCost,omitempty"`
 
+	// ABC / XYZ classification, recomputed on a schedule
+	ABCClass     string    `bson:"abcClass,omitempty" json:"abcClass,omitempty"` // A|B|C
+	XYZClass     string    `bson:"xyzClass,omitempty" json:"xyzClass,omitempty"` // X|Y|Z
+	ClassifiedAt time.Time `bson:"classifiedAt,omitempty" json:"classifiedAt,omitempty"`
+
+	// Set by SET (count) adjustments; drives the cycle-count plan
+	LastCountedAt time.Time `bson:"lastCountedAt,omitempty" json:"lastCountedAt,omitempty"`
+
 	// Optimistic locking version
 	Version int `bson:"version" json:"version"`
 
@@ -152,6 +297,12 @@ type Customer struct {
 	Email   string `bson:"email,omitempty" json:"email,omitempty"`
 	Address string `bson:"address,omitempty" json:"address,omitempty"`
 
+	Group string `bson:"group,omitempty" json:"group,omitempty"` // Customer group for promotions, e.g. VIP, WHOLESALE
+
+	// Printed as the buyer on full tax invoices
+	TaxID     string `bson:"taxId,omitempty" json:"taxId,omitempty"`
+	TaxBranch string `bson:"taxBranch,omitempty" json:"taxBranch,omitempty"` // e.g. "00000" for head office
+
 	Points     int   `bson:"points" json:"points"`
 	TotalSpent int64 `bson:"totalSpent" json:"totalSpent"`
 
@@ -169,6 +320,9 @@ type Supplier struct {
 	Address     string `bson:"address,omitempty" json:"address,omitempty"`
 	TaxID       string `bson:"taxId,omitempty" json:"taxId,omitempty"`
 
+	// LeadTimeDays is the typical number of days from order to receipt.
+	LeadTimeDays int `bson:"leadTimeDays,omitempty" json:"leadTimeDays,omitempty"`
+
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
 }
@@ -181,6 +335,43 @@ type PurchaseOrderItem struct {
 	Quantity    int    `bson:"quantity" json:"quantity"`
 	UnitCost    int64  `bson:"unitCost" json:"unitCost"`
 	Discount    int64  `bson:"discount,omitempty" json:"discount,omitempty"`
+
+	TaxClass  TaxClass `bson:"taxClass,omitempty" json:"taxClass,omitempty"`
+	TaxAmount int64    `bson:"taxAmount,omitempty" json:"taxAmount,omitempty"` // Input VAT on the line after discounts
+	NetAmount int64    `bson:"netAmount,omitempty" json:"netAmount,omitempty"` // Ex-tax line amount after discounts
+
+	// LandedUnitCost is the unit cost after discount, shipping, tax and later cost documents
+	LandedUnitCost int64 `bson:"landedUnitCost,omitempty" json:"landedUnitCost,omitempty"`
+}
+
+// LandedCostMethod decides how order-level costs are spread across purchase order lines
+type LandedCostMethod string
+
+const (
+	LandedCostByValue    LandedCostMethod = "VALUE"
+	LandedCostByQuantity LandedCostMethod = "QUANTITY"
+	LandedCostByWeight   LandedCostMethod = "WEIGHT" // Uses Product.WeightGram
+)
+
+// LandedCostAllocation is one line's share of an additional cost document
+type LandedCostAllocation struct {
+	ProductID      string `bson:"productId" json:"productId"`
+	Amount         int64  `bson:"amount" json:"amount"`
+	RevaluedAmount int64  `bson:"revaluedAmount" json:"revaluedAmount"` // Added to remaining lot quantities
+	COGSAdjustment int64  `bson:"cogsAdjustment" json:"cogsAdjustment"` // Share for units already sold
+}
+
+// LandedCost is an additional cost (freight, customs, insurance) attached after receipt
+type LandedCost struct {
+	ID          string                 `bson:"id" json:"id"`
+	Type        string                 `bson:"type" json:"type"` // FREIGHT|CUSTOMS|INSURANCE|OTHER
+	Amount      int64                  `bson:"amount" json:"amount"`
+	Method      LandedCostMethod       `bson:"method" json:"method"`
+	Reference   string                 `bson:"reference,omitempty" json:"reference,omitempty"` // Invoice number from the forwarder etc.
+	Notes       string                 `bson:"notes,omitempty" json:"notes,omitempty"`
+	Allocations []LandedCostAllocation `bson:"allocations" json:"allocations"`
+	CreatedBy   string                 `bson:"createdBy" json:"createdBy"`
+	CreatedAt   time.Time              `bson:"createdAt" json:"createdAt"`
 }
 
 type PurchaseOrder struct {
@@ -201,6 +392,14 @@ type PurchaseOrder struct {
 	TaxRate        float64 `bson:"taxRate,omitempty" json:"taxRate,omitempty"`
 	ShippingCost   int64   `bson:"shippingCost,omitempty" json:"shippingCost,omitempty"`
 	PaidAmount     int64   `bson:"paidAmount,omitempty" json:"paidAmount,omitempty"`
+	Tax            *TaxSummary `bson:"tax,omitempty" json:"tax,omitempty"` // Line-level input VAT; absent on older orders
+	Documents      []DocumentRef `bson:"documents,omitempty" json:"documents,omitempty"`
+
+	// Landed cost allocation into lot unit costs
+	AllocationMethod     LandedCostMethod `bson:"allocationMethod,omitempty" json:"allocationMethod,omitempty"` // How shipping is spread; default VALUE
+	TaxRecoverable       bool             `bson:"taxRecoverable,omitempty" json:"taxRecoverable,omitempty"`     // Input VAT is reclaimed, so it is not part of cost
+	LandedCosts          []LandedCost     `bson:"landedCosts,omitempty" json:"landedCosts,omitempty"`
+	LandedCostInProgress bool             `bson:"landedCostInProgress,omitempty" json:"-"` // Held while a landed cost is being spread
 
 	// Notes and shipping
 	Note            string `bson:"note,omitempty" json:"note,omitempty"`
@@ -221,9 +420,12 @@ type InventoryLot struct {
 	BranchID  string `bson:"branchId" json:"branchId"`
 	ProductID string `bson:"productId" json:"productId"`
 
-	// Source describes where this lot came from (e.g. "PO", "ADJUSTMENT", "RETURN").
+	// Source describes where this lot came from (e.g. "PO", "ADJUSTMENT", "RETURN", "CONSIGNMENT").
 	Source string `bson:"source" json:"source"`
 
+	// OwnerID is the consignor supplier for consigned stock; empty means the org owns the lot.
+	OwnerID string `bson:"ownerId,omitempty" json:"ownerId,omitempty"`
+
 	PurchaseOrderID string `bson:"purchaseOrderId,omitempty" json:"purchaseOrderId,omitempty"`
 	ReferenceNo     string `bson:"referenceNo,omitempty" json:"referenceNo,omitempty"`
 
@@ -244,8 +446,70 @@ type ShippingInfo struct {
 	Carrier        string `bson:"carrier" json:"carrier"`
 	TrackingNumber string `bson:"trackingNumber" json:"trackingNumber"`
 	LabelURL       string `bson:"labelUrl,omitempty" json:"labelUrl,omitempty"`
+	Service        string `bson:"service,omitempty" json:"service,omitempty"`
+	ExternalID     string `bson:"externalId,omitempty" json:"externalId,omitempty"` // The courier's shipment ID when it differs from the tracking number
+	SortCode       string `bson:"sortCode,omitempty" json:"sortCode,omitempty"`
+	Fee            int64  `bson:"fee,omitempty" json:"fee,omitempty"` // Quoted by the carrier when booked (satang)
+	WeightGram     int    `bson:"weightGram,omitempty" json:"weightGram,omitempty"`
+	CODAmount      int64  `bson:"codAmount,omitempty" json:"codAmount,omitempty"`   // Cash the courier collects on delivery (satang)
+	BookedDate     string `bson:"bookedDate,omitempty" json:"bookedDate,omitempty"` // Set when booked through a carrier adapter
+	PickListID     string `bson:"pickListId,omitempty" json:"pickListId,omitempty"`
+	PickedDate     string `bson:"pickedDate,omitempty" json:"pickedDate,omitempty"` // When the order went on a pick list
+	PackedDate     string `bson:"packedDate,omitempty" json:"packedDate,omitempty"`
+	PackedBy       string `bson:"packedBy,omitempty" json:"packedBy,omitempty"`
 	ShippedDate    string `bson:"shippedDate,omitempty" json:"shippedDate,omitempty"`
 	DeliveredDate  string `bson:"deliveredDate,omitempty" json:"deliveredDate,omitempty"`
+
+	// Tracking as pushed by the carrier's webhook, oldest event first
+	TrackingStatus string          `bson:"trackingStatus,omitempty" json:"trackingStatus,omitempty"` // Normalized, e.g. IN_TRANSIT
+	TrackingEvents []TrackingEvent `bson:"trackingEvents,omitempty" json:"trackingEvents,omitempty"`
+}
+
+// TrackingEvent is one carrier scan of a shipped parcel
+type TrackingEvent struct {
+	Time        time.Time `bson:"time" json:"time"`
+	Status      string    `bson:"status" json:"status"` // Normalized: PICKED_UP, IN_TRANSIT, OUT_FOR_DELIVERY, DELIVERED, FAILED, RETURNED...
+	Description string    `bson:"description,omitempty" json:"description,omitempty"`
+	Location    string    `bson:"location,omitempty" json:"location,omitempty"`
+	Code        string    `bson:"code,omitempty" json:"code,omitempty"` // The carrier's own status code
+}
+
+// Shipment is part of an order sent as its own parcel. Orders sent in one parcel have
+// none; their parcel is the order's ShippingInfo.
+type Shipment struct {
+	ID     string         `bson:"id" json:"id"`
+	Status string         `bson:"status" json:"status"` // SHIPPED|DELIVERED|CANCELLED
+	Items  []ShipmentItem `bson:"items" json:"items"`
+
+	ShippingInfo `bson:",inline"`
+
+	// Set when the shipment is delivered and its stock taken
+	StockCommitted bool       `bson:"stockCommitted,omitempty" json:"stockCommitted,omitempty"`
+	COGS           int64      `bson:"cogs,omitempty" json:"cogs,omitempty"`
+	CostLines      []CostLine `bson:"costLines,omitempty" json:"costLines,omitempty"`
+
+	// Set when the carrier remits the parcel's COD
+	RemittanceID string `bson:"remittanceId,omitempty" json:"remittanceId,omitempty"`
+	Remitted     int64  `bson:"remitted,omitempty" json:"remitted,omitempty"`
+
+	CreatedBy string    `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+const (
+	ShipmentStatusShipped   = "SHIPPED"
+	ShipmentStatusDelivered = "DELIVERED"
+	ShipmentStatusCancelled = "CANCELLED"
+)
+
+// ShipmentItem is how much of one product a shipment carries
+type ShipmentItem struct {
+	ProductID string `bson:"productId" json:"productId"`
+	SKU       string `bson:"sku" json:"sku"`
+	Name      string `bson:"name" json:"name"`
+	Quantity  int    `bson:"quantity" json:"quantity"`
+	Cost      int64  `bson:"cost,omitempty" json:"cost,omitempty"`         // Unit COGS, once delivered
+	LineCost  int64  `bson:"lineCost,omitempty" json:"lineCost,omitempty"` // COGS of the line, once delivered
 }
 
 type TransactionItem struct {
@@ -260,14 +524,36 @@ type TransactionItem struct {
 	LineCost int64 `bson:"lineCost,omitempty" json:"lineCost,omitempty"`
 
 	Quantity int `bson:"quantity" json:"quantity"`
+
+	// Orders shipped in parts: units in shipments that were not cancelled, and units
+	// cancelled before they shipped, whose reservation was released
+	QtyShipped   int `bson:"qtyShipped,omitempty" json:"qtyShipped,omitempty"`
+	QtyCancelled int `bson:"qtyCancelled,omitempty" json:"qtyCancelled,omitempty"`
+
+	// Units accepted beyond available stock. They hold no reservation until incoming stock
+	// is allocated to them, and cannot be picked or shipped before then.
+	QtyBackordered int  `bson:"qtyBackordered,omitempty" json:"qtyBackordered,omitempty"`
+	Preorder       bool `bson:"preorder,omitempty" json:"preorder,omitempty"`
+
+	Discount   int64    `bson:"discount,omitempty" json:"discount,omitempty"`     // Line discount, manual and promotional
+	Promotions []string `bson:"promotions,omitempty" json:"promotions,omitempty"` // Why promotions fired on this line
+
+	TaxClass  TaxClass `bson:"taxClass,omitempty" json:"taxClass,omitempty"`
+	TaxRate   float64  `bson:"taxRate,omitempty" json:"taxRate,omitempty"`
+	TaxAmount int64    `bson:"taxAmount,omitempty" json:"taxAmount,omitempty"` // Output VAT on the line after all discounts
+	NetAmount int64    `bson:"netAmount,omitempty" json:"netAmount,omitempty"` // Ex-tax line amount after all discounts
 }
 
+// Kept is the line's quantity less units cancelled before they shipped
+func (it TransactionItem) Kept() int { return it.Quantity - it.QtyCancelled }
+
 type CostLine struct {
 	ProductID string `bson:"productId" json:"productId"`
 	LotID     string `bson:"lotId" json:"lotId"`
 	Quantity  int    `bson:"quantity" json:"quantity"`
 	UnitCost  int64  `bson:"unitCost" json:"unitCost"`
 	Amount    int64  `bson:"amount" json:"amount"`
+	OwnerID   string `bson:"ownerId,omitempty" json:"ownerId,omitempty"` // Consignor when the lot was consigned
 }
 
 type Transaction struct {
@@ -280,7 +566,7 @@ type Transaction struct {
 	Type    string `bson:"type" json:"type"` // SALE|STOCK_IN|STOCK_OUT|ADJUSTMENT
 
 	Status            string `bson:"status" json:"status"`             // COMPLETED|PENDING|CANCELLED|REFUNDED
-	FulfillmentStatus string `bson:"fulfillmentStatus" json:"fulfillmentStatus"` // PENDING|...
+	FulfillmentStatus string `bson:"fulfillmentStatus" json:"fulfillmentStatus"` // PENDING|...|PARTIALLY_SHIPPED|SHIPPED|PARTIALLY_DELIVERED|DELIVERED
 
 	Items []TransactionItem `bson:"items" json:"items"`
 	Total int64             `bson:"total" json:"total"`
@@ -293,12 +579,23 @@ type Transaction struct {
 	RecipientPhone   string       `bson:"recipientPhone,omitempty" json:"recipientPhone,omitempty"`
 	RecipientAddress string       `bson:"recipientAddress,omitempty" json:"recipientAddress,omitempty"`
 	PaymentMethod    string       `bson:"paymentMethod,omitempty" json:"paymentMethod,omitempty"`
+	PaymentStatus    string       `bson:"paymentStatus,omitempty" json:"paymentStatus,omitempty"` // Derived from the payment ledger
+	PaidAmount       int64        `bson:"paidAmount,omitempty" json:"paidAmount,omitempty"`       // Net of refunds
+	COD              *CODInfo     `bson:"cod,omitempty" json:"cod,omitempty"`                     // Set when the courier collects payment on delivery
 	Note             string       `bson:"note,omitempty" json:"note,omitempty"`
 	CancellationReason string     `bson:"cancellationReason,omitempty" json:"cancellationReason,omitempty"`
 	ReferenceID        string     `bson:"referenceId,omitempty" json:"referenceId,omitempty"`
 	ShippingInfo       *ShippingInfo `bson:"shippingInfo,omitempty" json:"shippingInfo,omitempty"`
+	Shipments          []Shipment `bson:"shipments,omitempty" json:"shipments,omitempty"` // Parcels of an order shipped in parts
 	CostLines          []CostLine `bson:"costLines,omitempty" json:"costLines,omitempty"`
 
+	DiscountAmount int64              `bson:"discountAmount,omitempty" json:"discountAmount,omitempty"` // Order and line discounts
+	Promotions     []AppliedPromotion `bson:"promotions,omitempty" json:"promotions,omitempty"`
+	CouponCodes    []string           `bson:"couponCodes,omitempty" json:"couponCodes,omitempty"`
+	ShippingCost   int64              `bson:"shippingCost,omitempty" json:"shippingCost,omitempty"`
+	Tax            *TaxSummary        `bson:"tax,omitempty" json:"tax,omitempty"` // Absent when no VAT was charged
+	Documents      []DocumentRef      `bson:"documents,omitempty" json:"documents,omitempty"` // Invoices, receipts and credit notes issued
+
 	StockCommitted        bool `bson:"stockCommitted,omitempty" json:"stockCommitted,omitempty"`
 	StockCommitInProgress bool `bson:"stockCommitInProgress,omitempty" json:"stockCommitInProgress,omitempty"`
 
@@ -403,6 +700,7 @@ const (
 	ReturnReasonDamaged        ReturnReason = "DAMAGED"
 	ReturnReasonQuality        ReturnReason = "QUALITY"
 	ReturnReasonOther          ReturnReason = "OTHER"
+	ReturnReasonUndeliverable  ReturnReason = "UNDELIVERABLE" // Returned to sender by the carrier
 )
 
 // ItemCondition describes the state of returned items
@@ -440,6 +738,9 @@ type ReturnItem struct {
 	Notes       string        `bson:"notes,omitempty" json:"notes,omitempty"`
 	Restockable bool          `bson:"restockable" json:"restockable"`
 	LotID       string        `bson:"lotId,omitempty" json:"lotId,omitempty"` // Created lot for restocked items
+	TaxClass    TaxClass      `bson:"taxClass,omitempty" json:"taxClass,omitempty"`
+	TaxAmount   int64         `bson:"taxAmount,omitempty" json:"taxAmount,omitempty"` // Share of the original line's VAT
+	NetAmount   int64         `bson:"netAmount,omitempty" json:"netAmount,omitempty"` // Share of the original line's ex-tax amount
 }
 
 // Return represents a return/RMA request
@@ -457,6 +758,11 @@ type Return struct {
 	OriginalPOID    string `bson:"originalPurchaseOrderId,omitempty" json:"originalPurchaseOrderId,omitempty"` // PO ID for supplier returns
 	OriginalRefNo   string `bson:"originalReferenceNo,omitempty" json:"originalReferenceNo,omitempty"`
 
+	// ReturnedToSender marks a parcel the carrier brought back undelivered. The sale's
+	// stock was never committed, so receiving it releases the reservation instead of
+	// restocking.
+	ReturnedToSender bool `bson:"returnedToSender,omitempty" json:"returnedToSender,omitempty"`
+
 	// For customer returns
 	CustomerID    string `bson:"customerId,omitempty" json:"customerId,omitempty"`
 	CustomerName  string `bson:"customerName,omitempty" json:"customerName,omitempty"`
@@ -474,6 +780,8 @@ type Return struct {
 	RefundAmount   int64 `bson:"refundAmount,omitempty" json:"refundAmount,omitempty"`     // For customer refunds
 	CreditAmount   int64 `bson:"creditAmount,omitempty" json:"creditAmount,omitempty"`     // Supplier credit expected
 	CreditReceived int64 `bson:"creditReceived,omitempty" json:"creditReceived,omitempty"` // Supplier credit received
+	Tax            *TaxSummary `bson:"tax,omitempty" json:"tax,omitempty"`                  // VAT reversed by the return
+	Documents      []DocumentRef `bson:"documents,omitempty" json:"documents,omitempty"`     // Credit notes issued
 
 	// Shipping (for supplier returns)
 	ShippingInfo *ShippingInfo `bson:"shippingInfo,omitempty" json:"shippingInfo,omitempty"`
@@ -500,6 +808,108 @@ type Return struct {
 	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
 }
 
+// ==================== CONSIGNMENT ====================
+
+// ConsignmentPayableStatus tracks settlement with the consignor
+type ConsignmentPayableStatus string
+
+const (
+	ConsignmentPayableOpen ConsignmentPayableStatus = "OPEN"
+	ConsignmentPayablePaid ConsignmentPayableStatus = "PAID"
+	ConsignmentPayableVoid ConsignmentPayableStatus = "VOID" // Sale was cancelled before settlement
+)
+
+// ConsignmentPayable is the amount owed to a consignor for consigned goods that were sold
+type ConsignmentPayable struct {
+	ID         string `bson:"_id" json:"id"`
+	OrgID      string `bson:"orgId" json:"orgId"`
+	BranchID   string `bson:"branchId" json:"branchId"`
+	SupplierID string `bson:"supplierId" json:"supplierId"` // Consignor
+
+	TransactionID string `bson:"transactionId" json:"transactionId"`
+	WriteOffID    string `bson:"writeOffId,omitempty" json:"writeOffId,omitempty"` // Set instead of TransactionID for goods written off
+	ProductID     string `bson:"productId" json:"productId"`
+	ProductName   string `bson:"productName,omitempty" json:"productName,omitempty"`
+	ProductSKU    string `bson:"productSku,omitempty" json:"productSku,omitempty"`
+	LotID         string `bson:"lotId" json:"lotId"`
+
+	Quantity int   `bson:"quantity" json:"quantity"`
+	UnitCost int64 `bson:"unitCost" json:"unitCost"` // Agreed consignment cost
+	Amount   int64 `bson:"amount" json:"amount"`
+
+	Status    ConsignmentPayableStatus `bson:"status" json:"status"`
+	PaidAt    time.Time                `bson:"paidAt,omitempty" json:"paidAt,omitempty"`
+	PaidBy    string                   `bson:"paidBy,omitempty" json:"paidBy,omitempty"`
+	Reference string                   `bson:"reference,omitempty" json:"reference,omitempty"` // Payment reference
+
+	SoldAt    time.Time `bson:"soldAt" json:"soldAt"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ==================== WRITE-OFFS ====================
+
+// WriteOffReason is a standardized reason code for removing stock as a loss
+type WriteOffReason string
+
+const (
+	WriteOffReasonDamaged WriteOffReason = "DAMAGED"
+	WriteOffReasonExpired WriteOffReason = "EXPIRED"
+	WriteOffReasonTheft   WriteOffReason = "THEFT"
+	WriteOffReasonSample  WriteOffReason = "SAMPLE"
+)
+
+// WriteOffStatus tracks the write-off lifecycle
+type WriteOffStatus string
+
+const (
+	WriteOffStatusPending   WriteOffStatus = "PENDING_APPROVAL"
+	WriteOffStatusPosted    WriteOffStatus = "POSTED" // Stock consumed
+	WriteOffStatusRejected  WriteOffStatus = "REJECTED"
+	WriteOffStatusCancelled WriteOffStatus = "CANCELLED"
+)
+
+// WriteOffItem is one product (optionally one lot) being written off
+type WriteOffItem struct {
+	ProductID   string         `bson:"productId" json:"productId"`
+	ProductName string         `bson:"productName" json:"productName"`
+	ProductSKU  string         `bson:"productSku,omitempty" json:"productSku,omitempty"`
+	LotID       string         `bson:"lotId,omitempty" json:"lotId,omitempty"` // Specific lot; empty consumes FIFO
+	Quantity    int            `bson:"quantity" json:"quantity"`
+	Reason      WriteOffReason `bson:"reason" json:"reason"`
+	Notes       string         `bson:"notes,omitempty" json:"notes,omitempty"`
+
+	EstimatedCost int64      `bson:"estimatedCost" json:"estimatedCost"`             // Used for the approval check
+	TotalCost     int64      `bson:"totalCost,omitempty" json:"totalCost,omitempty"` // Actual cost once posted
+	CostLines     []CostLine `bson:"costLines,omitempty" json:"costLines,omitempty"`
+}
+
+// WriteOff is a document removing damaged, expired, stolen or sampled stock
+type WriteOff struct {
+	ID          string `bson:"_id" json:"id"`
+	OrgID       string `bson:"orgId" json:"orgId"`
+	BranchID    string `bson:"branchId" json:"branchId"`
+	ReferenceNo string `bson:"referenceNo" json:"referenceNo"` // e.g., WO-000001
+
+	Status WriteOffStatus `bson:"status" json:"status"`
+	Items  []WriteOffItem `bson:"items" json:"items"`
+	Photos []string       `bson:"photos,omitempty" json:"photos,omitempty"` // Upload keys
+	Notes  string         `bson:"notes,omitempty" json:"notes,omitempty"`
+
+	EstimatedValue  int64 `bson:"estimatedValue" json:"estimatedValue"`
+	TotalValue      int64 `bson:"totalValue,omitempty" json:"totalValue,omitempty"`
+	RequireApproval bool  `bson:"requireApproval" json:"requireApproval"`
+
+	RequestedBy     string    `bson:"requestedBy" json:"requestedBy"`
+	ApprovedBy      string    `bson:"approvedBy,omitempty" json:"approvedBy,omitempty"`
+	ApprovedAt      time.Time `bson:"approvedAt,omitempty" json:"approvedAt,omitempty"`
+	RejectionReason string    `bson:"rejectionReason,omitempty" json:"rejectionReason,omitempty"`
+	PostedAt        time.Time `bson:"postedAt,omitempty" json:"postedAt,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
 // ==================== AUDIT TRAIL ====================
 
 // AuditAction represents the type of change
@@ -540,3 +950,431 @@ type AuditLog struct {
 
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 }
+
+// CostVarianceType distinguishes purchase price variance from standard cost revaluation
+type CostVarianceType string
+
+const (
+	CostVariancePurchasePrice CostVarianceType = "PURCHASE_PRICE" // Actual receipt cost vs standard
+	CostVarianceRevaluation   CostVarianceType = "REVALUATION"    // On-hand stock moved to a new standard
+)
+
+// CostVariance is a ledger entry for standard costed products. Amount is positive when
+// actual (or new) cost is above standard (or old) cost, i.e. unfavourable.
+type CostVariance struct {
+	ID        string           `bson:"_id" json:"id"`
+	OrgID     string           `bson:"orgId" json:"orgId"`
+	BranchID  string           `bson:"branchId" json:"branchId"`
+	ProductID string           `bson:"productId" json:"productId"`
+	Type      CostVarianceType `bson:"type" json:"type"`
+
+	SupplierID      string `bson:"supplierId,omitempty" json:"supplierId,omitempty"`
+	PurchaseOrderID string `bson:"purchaseOrderId,omitempty" json:"purchaseOrderId,omitempty"`
+	ReferenceNo     string `bson:"referenceNo,omitempty" json:"referenceNo,omitempty"`
+
+	Quantity     int   `bson:"quantity" json:"quantity"`
+	StandardCost int64 `bson:"standardCost" json:"standardCost"` // Standard (or old standard) unit cost
+	ActualCost   int64 `bson:"actualCost" json:"actualCost"`     // Actual (or new standard) unit cost
+	Amount       int64 `bson:"amount" json:"amount"`
+
+	Notes     string    `bson:"notes,omitempty" json:"notes,omitempty"`
+	CreatedBy string    `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// ==================== ORDER EVENTS ====================
+
+// OrderEventType names a change in an order's life
+type OrderEventType string
+
+const (
+	OrderEventCreated           OrderEventType = "ORDER_CREATED"
+	OrderEventUpdated           OrderEventType = "ORDER_UPDATED"
+	OrderEventDeleted           OrderEventType = "ORDER_DELETED"
+	OrderEventConfirmed         OrderEventType = "ORDER_CONFIRMED"
+	OrderEventCompleted         OrderEventType = "ORDER_COMPLETED"
+	OrderEventCancelled         OrderEventType = "ORDER_CANCELLED"
+	OrderEventPaymentReceived   OrderEventType = "PAYMENT_RECEIVED"
+	OrderEventPaymentVoided     OrderEventType = "PAYMENT_VOIDED"
+	OrderEventPaymentRefunded   OrderEventType = "PAYMENT_REFUNDED"
+	OrderEventFulfillment       OrderEventType = "FULFILLMENT_CHANGED" // Set by hand or in bulk
+	OrderEventPicking           OrderEventType = "PICKING"
+	OrderEventPacked            OrderEventType = "PACKED"
+	OrderEventShipped           OrderEventType = "SHIPPED"
+	OrderEventShipmentCancelled OrderEventType = "SHIPMENT_CANCELLED"
+	OrderEventTracking          OrderEventType = "TRACKING_UPDATED"
+	OrderEventDelivered         OrderEventType = "DELIVERED"
+	OrderEventReturnOpened      OrderEventType = "RETURN_OPENED"
+	OrderEventReturnReceived    OrderEventType = "RETURN_RECEIVED"
+	OrderEventNote              OrderEventType = "NOTE_ADDED"
+	OrderEventStockAllocated    OrderEventType = "STOCK_ALLOCATED" // Incoming stock filled backordered units
+)
+
+// OrderEventTypes lists every event type, for validating webhook subscriptions
+var OrderEventTypes = []OrderEventType{
+	OrderEventCreated, OrderEventUpdated, OrderEventDeleted, OrderEventConfirmed, OrderEventCompleted,
+	OrderEventCancelled, OrderEventPaymentReceived, OrderEventPaymentVoided, OrderEventPaymentRefunded,
+	OrderEventFulfillment, OrderEventPicking, OrderEventPacked, OrderEventShipped, OrderEventShipmentCancelled,
+	OrderEventTracking, OrderEventDelivered, OrderEventReturnOpened, OrderEventReturnReceived, OrderEventNote,
+	OrderEventStockAllocated,
+}
+
+// OrderEvent is one entry in an order's history. Events are only ever appended; the
+// order's timeline, its audit trail and outgoing webhooks are all fed from them.
+type OrderEvent struct {
+	ID       string         `bson:"_id" json:"id"`
+	OrgID    string         `bson:"orgId" json:"orgId"`
+	BranchID string         `bson:"branchId,omitempty" json:"branchId,omitempty"`
+	OrderID  string         `bson:"orderId" json:"orderId"`
+	Type     OrderEventType `bson:"type" json:"type"`
+	Message  string         `bson:"message" json:"message"`
+
+	ActorID   string `bson:"actorId,omitempty" json:"actorId,omitempty"` // A user, or "carrier:flash", "system"
+	ActorName string `bson:"actorName,omitempty" json:"actorName,omitempty"`
+
+	// What the change was, e.g. the payment, the new status or the fields edited
+	Payload map[string]interface{} `bson:"payload,omitempty" json:"payload,omitempty"`
+
+	// The order's statuses once the change was made
+	Status            string `bson:"status" json:"status"`
+	FulfillmentStatus string `bson:"fulfillmentStatus,omitempty" json:"fulfillmentStatus,omitempty"`
+	PaymentStatus     string `bson:"paymentStatus,omitempty" json:"paymentStatus,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// WebhookSubscription is an org's endpoint for order events. Deliveries are signed with
+// the secret; Events empty means every event.
+type WebhookSubscription struct {
+	ID          string           `bson:"_id" json:"id"`
+	OrgID       string           `bson:"orgId" json:"orgId"`
+	URL         string           `bson:"url" json:"url"`
+	Description string           `bson:"description,omitempty" json:"description,omitempty"`
+	Secret      string           `bson:"secret" json:"secret,omitempty"` // Shown when created only
+	Events      []OrderEventType `bson:"events,omitempty" json:"events,omitempty"`
+	Active      bool             `bson:"active" json:"active"`
+
+	// Outcome of the most recent delivery
+	LastStatus     int        `bson:"lastStatus,omitempty" json:"lastStatus,omitempty"` // HTTP status; 0 when unreachable
+	LastError      string     `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	LastDeliveryAt *time.Time `bson:"lastDeliveryAt,omitempty" json:"lastDeliveryAt,omitempty"`
+	Failures       int        `bson:"failures,omitempty" json:"failures,omitempty"` // Consecutive; reset by a success
+
+	CreatedBy string    `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Wants reports whether the subscription takes an event type
+func (w WebhookSubscription) Wants(t OrderEventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for one subscription. It is retried from this
+// record until the endpoint accepts it or the attempts run out.
+type WebhookDelivery struct {
+	ID        string         `bson:"_id" json:"id"`
+	OrgID     string         `bson:"orgId" json:"orgId"`
+	WebhookID string         `bson:"webhookId" json:"webhookId"`
+	EventID   string         `bson:"eventId" json:"eventId"`
+	EventType OrderEventType `bson:"eventType" json:"eventType"`
+	Body      string         `bson:"body" json:"-"` // Envelope as first sent, so retries carry the same bytes
+
+	Status        WebhookDeliveryStatus `bson:"status" json:"status"`
+	Attempts      int                   `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time             `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"`
+	LastStatus    int                   `bson:"lastStatus,omitempty" json:"lastStatus,omitempty"` // HTTP status; 0 when unreachable
+	LastError     string                `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	DeliveredAt   *time.Time            `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// WebhookDeliveryStatus is where a delivery stands
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "PENDING"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "DELIVERED"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "FAILED" // Refused, or out of attempts
+)
+
+// ==================== PAYMENTS ====================
+
+// PaymentType distinguishes money received from money returned
+type PaymentType string
+
+const (
+	PaymentTypePayment PaymentType = "PAYMENT"
+	PaymentTypeRefund  PaymentType = "REFUND"
+)
+
+// PaymentEntryStatus tracks whether a ledger entry still counts
+type PaymentEntryStatus string
+
+const (
+	PaymentEntryActive PaymentEntryStatus = "ACTIVE"
+	PaymentEntryVoided PaymentEntryStatus = "VOIDED" // Entered in error; excluded from totals
+)
+
+// PaymentMethodCOD is cash collected by the courier on delivery and remitted later
+const PaymentMethodCOD = "COD"
+
+// CODInfo tracks an order paid cash on delivery: what the courier should collect and
+// what it has paid over to us
+type CODInfo struct {
+	Expected     int64  `bson:"expected" json:"expected"`                           // Cash to collect from the recipient (satang)
+	Remitted     int64  `bson:"remitted,omitempty" json:"remitted,omitempty"`       // Paid over by the courier
+	Shortfall    int64  `bson:"shortfall,omitempty" json:"shortfall,omitempty"`     // Expected less remitted when the courier paid short
+	RemittanceID string `bson:"remittanceId,omitempty" json:"remittanceId,omitempty"` // Statement the cash was remitted on
+	RemittedDate string `bson:"remittedDate,omitempty" json:"remittedDate,omitempty"`
+}
+
+// COD remittance line outcomes
+const (
+	CODLineMatched   = "MATCHED"
+	CODLineShort     = "SHORT"     // Remitted less than expected; the order stays part paid
+	CODLineOver      = "OVER"      // Remitted more than expected
+	CODLineUnmatched = "UNMATCHED" // No COD order awaiting remittance has the tracking number
+	CODLineDuplicate = "DUPLICATE" // Already remitted, or repeated in the statement
+)
+
+// CODRemittance is an imported carrier statement of cash collected on delivery
+type CODRemittance struct {
+	ID        string `bson:"_id" json:"id"`
+	OrgID     string `bson:"orgId" json:"orgId"`
+	Carrier   string `bson:"carrier" json:"carrier"`
+	Reference string `bson:"reference,omitempty" json:"reference,omitempty"` // The carrier's statement or transfer number
+	FileName  string `bson:"fileName,omitempty" json:"fileName,omitempty"`
+
+	Lines     []CODRemittanceLine `bson:"lines" json:"lines"`
+	Total     int64               `bson:"total" json:"total"`         // Sum of all lines
+	Applied   int64               `bson:"applied" json:"applied"`     // Recorded as payments on orders
+	Shortfall int64               `bson:"shortfall" json:"shortfall"` // Sum of short lines' shortfalls
+	Matched   int                 `bson:"matched" json:"matched"`     // Lines applied to an order, short or not
+	Flagged   int                 `bson:"flagged" json:"flagged"`     // Lines that are short, over, unmatched or duplicate
+
+	CreatedBy string    `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// CODRemittanceLine is one parcel on a remittance statement
+type CODRemittanceLine struct {
+	Row            int    `bson:"row" json:"row"` // Line in the CSV, counting the header
+	TrackingNumber string `bson:"trackingNumber" json:"trackingNumber"`
+	Amount         int64  `bson:"amount" json:"amount"`
+	Status         string `bson:"status" json:"status"`
+	OrderID        string `bson:"orderId,omitempty" json:"orderId,omitempty"`
+	ShipmentID     string `bson:"shipmentId,omitempty" json:"shipmentId,omitempty"` // Parcel of an order shipped in parts
+	Expected       int64  `bson:"expected,omitempty" json:"expected,omitempty"`
+	Difference     int64  `bson:"difference,omitempty" json:"difference,omitempty"` // Amount less expected
+	PaymentID      string `bson:"paymentId,omitempty" json:"paymentId,omitempty"`
+	Note           string `bson:"note,omitempty" json:"note,omitempty"`
+}
+
+// Order payment statuses derived from the payment ledger
+const (
+	PaymentStatusUnpaid        = "UNPAID"
+	PaymentStatusPartiallyPaid = "PARTIALLY_PAID"
+	PaymentStatusPaid          = "PAID"
+	PaymentStatusOverpaid      = "OVERPAID"
+)
+
+// Payment is one entry in an order's payment sub-ledger
+type Payment struct {
+	ID            string `bson:"_id" json:"id"`
+	OrgID         string `bson:"orgId" json:"orgId"`
+	BranchID      string `bson:"branchId" json:"branchId"`
+	TransactionID string `bson:"transactionId" json:"transactionId"`
+
+	Type      PaymentType        `bson:"type" json:"type"`
+	Method    string             `bson:"method" json:"method"` // CASH|QR|CARD|TRANSFER|COD|...
+	Amount    int64              `bson:"amount" json:"amount"` // Always positive; Type gives the direction
+	Reference string             `bson:"reference,omitempty" json:"reference,omitempty"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	RefundOf  string             `bson:"refundOf,omitempty" json:"refundOf,omitempty"` // Payment a refund returns money from
+	Status    PaymentEntryStatus `bson:"status" json:"status"`
+
+	RefundInProgress bool `bson:"refundInProgress,omitempty" json:"-"` // Held while a refund is taken from the payment
+
+	VoidedBy   string    `bson:"voidedBy,omitempty" json:"voidedBy,omitempty"`
+	VoidedAt   time.Time `bson:"voidedAt,omitempty" json:"voidedAt,omitempty"`
+	VoidReason string    `bson:"voidReason,omitempty" json:"voidReason,omitempty"`
+
+	CreatedBy string    `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// PaymentStatusFor derives an order's payment status from its total and net paid amount
+func PaymentStatusFor(total, paid int64) string {
+	switch {
+	case paid <= 0:
+		return PaymentStatusUnpaid
+	case paid < total:
+		return PaymentStatusPartiallyPaid
+	case paid == total:
+		return PaymentStatusPaid
+	default:
+		return PaymentStatusOverpaid
+	}
+}
+
+// ==================== PROMOTIONS ====================
+
+// PromotionType selects how a promotion computes its discount
+type PromotionType string
+
+const (
+	PromotionPercentOff  PromotionType = "PERCENT_OFF"  // Percent off each qualifying line
+	PromotionFixedOff    PromotionType = "FIXED_OFF"    // Amount off the qualifying lines, spread by value
+	PromotionBuyXGetY    PromotionType = "BUY_X_GET_Y"  // Buy BuyQty, get GetQty of the cheapest at GetPercent off
+	PromotionBundlePrice PromotionType = "BUNDLE_PRICE" // Every BundleQty qualifying units for BundlePrice
+	PromotionTiered      PromotionType = "TIERED"       // Percent off by total qualifying quantity
+)
+
+// PromotionTier is one step of a tiered quantity discount
+type PromotionTier struct {
+	MinQty  int     `bson:"minQty" json:"minQty"`
+	Percent float64 `bson:"percent" json:"percent"`
+}
+
+// Promotion is a discount rule evaluated at checkout and order creation
+type Promotion struct {
+	ID          string        `bson:"_id" json:"id"`
+	OrgID       string        `bson:"orgId" json:"orgId"`
+	Name        string        `bson:"name" json:"name"`
+	Description string        `bson:"description,omitempty" json:"description,omitempty"`
+	Type        PromotionType `bson:"type" json:"type"`
+	IsActive    bool          `bson:"isActive" json:"isActive"`
+	Priority    int           `bson:"priority" json:"priority"`   // Lower runs first
+	Stackable   bool          `bson:"stackable" json:"stackable"` // Non-stackable promotions never share a line
+
+	// Scope; empty lists match everything
+	StartsAt       *time.Time `bson:"startsAt,omitempty" json:"startsAt,omitempty"`
+	EndsAt         *time.Time `bson:"endsAt,omitempty" json:"endsAt,omitempty"`
+	BranchIDs      []string   `bson:"branchIds,omitempty" json:"branchIds,omitempty"`
+	Channels       []string   `bson:"channels,omitempty" json:"channels,omitempty"`
+	CustomerGroups []string   `bson:"customerGroups,omitempty" json:"customerGroups,omitempty"`
+	CategoryIDs    []string   `bson:"categoryIds,omitempty" json:"categoryIds,omitempty"` // Includes sub-categories
+	ProductIDs     []string   `bson:"productIds,omitempty" json:"productIds,omitempty"`
+	MinSubtotal    int64      `bson:"minSubtotal,omitempty" json:"minSubtotal,omitempty"` // Of the qualifying lines
+
+	// Parameters by type
+	Percent     float64         `bson:"percent,omitempty" json:"percent,omitempty"`
+	AmountOff   int64           `bson:"amountOff,omitempty" json:"amountOff,omitempty"`
+	BuyQty      int             `bson:"buyQty,omitempty" json:"buyQty,omitempty"`
+	GetQty      int             `bson:"getQty,omitempty" json:"getQty,omitempty"`
+	GetPercent  float64         `bson:"getPercent,omitempty" json:"getPercent,omitempty"` // 0 means free
+	BundleQty   int             `bson:"bundleQty,omitempty" json:"bundleQty,omitempty"`
+	BundlePrice int64           `bson:"bundlePrice,omitempty" json:"bundlePrice,omitempty"`
+	Tiers       []PromotionTier `bson:"tiers,omitempty" json:"tiers,omitempty"`
+
+	// Coupon; a promotion with a code only applies when the code is entered
+	CouponCode       string `bson:"couponCode,omitempty" json:"couponCode,omitempty"`
+	UsageLimit       int    `bson:"usageLimit,omitempty" json:"usageLimit,omitempty"`             // 0 is unlimited
+	PerCustomerLimit int    `bson:"perCustomerLimit,omitempty" json:"perCustomerLimit,omitempty"` // 0 is unlimited
+	UsedCount        int    `bson:"usedCount" json:"usedCount"`
+
+	CreatedBy string    `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// AppliedPromotionLine is the part of a promotion's discount given to one line
+type AppliedPromotionLine struct {
+	ProductID string `bson:"productId" json:"productId"`
+	Quantity  int    `bson:"quantity" json:"quantity"` // Units the promotion acted on
+	Amount    int64  `bson:"amount" json:"amount"`
+}
+
+// AppliedPromotion records a promotion that fired on a transaction
+type AppliedPromotion struct {
+	PromotionID string                 `bson:"promotionId" json:"promotionId"`
+	Name        string                 `bson:"name" json:"name"`
+	Type        PromotionType          `bson:"type" json:"type"`
+	CouponCode  string                 `bson:"couponCode,omitempty" json:"couponCode,omitempty"`
+	Amount      int64                  `bson:"amount" json:"amount"`
+	Explanation string                 `bson:"explanation" json:"explanation"`
+	Lines       []AppliedPromotionLine `bson:"lines" json:"lines"`
+}
+
+// ==================== DOCUMENTS ====================
+
+// DocumentType is the kind of rendered business document
+type DocumentType string
+
+const (
+	DocumentTaxInvoice    DocumentType = "TAX_INVOICE"    // Full tax invoice with buyer details
+	DocumentReceipt       DocumentType = "RECEIPT"        // Receipt; an abbreviated tax invoice for VAT registered orgs
+	DocumentCreditNote    DocumentType = "CREDIT_NOTE"    // For refunds and customer returns
+	DocumentPurchaseOrder DocumentType = "PURCHASE_ORDER" // Sent to the supplier
+)
+
+// DocumentStatus tracks a numbered document from claiming its number to storing its PDF
+type DocumentStatus string
+
+const (
+	DocumentPending DocumentStatus = "PENDING" // Source claimed; the number or PDF is not stored yet
+	DocumentIssued  DocumentStatus = "ISSUED"
+)
+
+// Document sources
+const (
+	DocumentSourceOrder         = "ORDER"
+	DocumentSourceReturn        = "RETURN"
+	DocumentSourcePurchaseOrder = "PURCHASE_ORDER"
+)
+
+// DocumentParty is a seller, buyer or supplier as printed on a document
+type DocumentParty struct {
+	Name      string `bson:"name" json:"name"`
+	TaxID     string `bson:"taxId,omitempty" json:"taxId,omitempty"`
+	TaxBranch string `bson:"taxBranch,omitempty" json:"taxBranch,omitempty"`
+	Address   string `bson:"address,omitempty" json:"address,omitempty"`
+	Phone     string `bson:"phone,omitempty" json:"phone,omitempty"`
+}
+
+// Document is a rendered PDF stored in object storage. Tax documents keep their number
+// and content once issued; reprints return the stored file.
+type Document struct {
+	ID       string         `bson:"_id" json:"id"`
+	OrgID    string         `bson:"orgId" json:"orgId"`
+	BranchID string         `bson:"branchId,omitempty" json:"branchId,omitempty"`
+	Type     DocumentType   `bson:"type" json:"type"`
+	Number   string         `bson:"number" json:"number"` // Sequential per org and type, e.g. INV-000001
+	Status   DocumentStatus `bson:"status,omitempty" json:"status,omitempty"`
+
+	SourceType string         `bson:"sourceType" json:"sourceType"` // ORDER, RETURN or PURCHASE_ORDER
+	SourceID   string         `bson:"sourceId" json:"sourceId"`
+	SourceRef  string         `bson:"sourceRef,omitempty" json:"sourceRef,omitempty"` // Order ID, RMA or PO number
+	RefersTo   string         `bson:"refersTo,omitempty" json:"refersTo,omitempty"`   // Credit notes: the invoice or receipt number corrected
+	Party      *DocumentParty `bson:"party,omitempty" json:"party,omitempty"`         // Buyer, or the supplier on purchase orders
+
+	Total int64       `bson:"total" json:"total"`
+	Tax   *TaxSummary `bson:"tax,omitempty" json:"tax,omitempty"`
+
+	ObjectKey   string `bson:"objectKey" json:"objectKey"`
+	ContentType string `bson:"contentType" json:"contentType"`
+	Size        int64  `bson:"size" json:"size"`
+
+	IssuedBy  string    `bson:"issuedBy" json:"issuedBy"`
+	IssuedAt  time.Time `bson:"issuedAt" json:"issuedAt"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// DocumentRef links a document from the order, return or purchase order it was issued for
+type DocumentRef struct {
+	ID     string       `bson:"id" json:"id"`
+	Type   DocumentType `bson:"type" json:"type"`
+	Number string       `bson:"number" json:"number"`
+}
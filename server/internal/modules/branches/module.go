@@ -50,6 +50,7 @@ func (m *Module) list(c *gin.Context) {
 type createBranchRequest struct {
 	Name    string `json:"name"`
 	Address string `json:"address"`
+	Phone   string `json:"phone"`
 	IsMain  bool   `json:"isMain"`
 }
 
@@ -78,6 +79,7 @@ func (m *Module) create(c *gin.Context) {
 		OrgID:   orgID,
 		Name:    req.Name,
 		Address: strings.TrimSpace(req.Address),
+		Phone:   strings.TrimSpace(req.Phone),
 		IsMain:  req.IsMain,
 	}
 
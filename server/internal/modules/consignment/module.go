@@ -0,0 +1,341 @@
+package consignmentmodule
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/deps"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/consignment"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Module struct {
+	deps deps.Dependencies
+}
+
+func New(deps deps.Dependencies) *Module { return &Module{deps: deps} }
+
+func (m *Module) Name() string { return "consignment" }
+
+func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/consignment")
+	g.Use(auth.RequireUser(), auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager))
+
+	g.POST("/receipts", m.receive)
+	g.GET("/stock", m.listStock)
+	g.GET("/payables", m.listPayables)
+	g.POST("/payables/pay", m.payPayables)
+	g.GET("/statement", m.statement)
+}
+
+type receiveItem struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+	UnitCost  int64  `json:"unitCost"` // Agreed cost payable to the consignor when sold
+}
+
+type receiveRequest struct {
+	BranchID    string        `json:"branchId"`
+	SupplierID  string        `json:"supplierId"`
+	ReferenceNo string        `json:"referenceNo"` // Consignor's delivery note
+	Notes       string        `json:"notes"`
+	Items       []receiveItem `json:"items"`
+}
+
+// receive books consigned goods into stock as lots owned by the consignor
+func (m *Module) receive(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req receiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	req.BranchID = strings.TrimSpace(req.BranchID)
+	if req.BranchID == "" {
+		req.BranchID = auth.GetBranchIDForRequest(c, u)
+	}
+	req.SupplierID = strings.TrimSpace(req.SupplierID)
+	if req.BranchID == "" || req.SupplierID == "" || len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branchId, supplierId and items are required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := m.deps.Repo.GetBranchByOrg(ctx, orgID, req.BranchID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branchId"})
+		return
+	}
+	if _, err := m.deps.Repo.GetSupplierByOrg(ctx, orgID, req.SupplierID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid supplierId"})
+		return
+	}
+
+	// Validate everything before touching stock.
+	products := make([]models.Product, 0, len(req.Items))
+	for _, it := range req.Items {
+		if it.Quantity <= 0 || it.UnitCost < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid items"})
+			return
+		}
+		p, err := m.deps.Repo.GetProductByOrg(ctx, orgID, strings.TrimSpace(it.ProductID))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid productId", "productId": it.ProductID})
+			return
+		}
+		// Ownership is tracked through lots, which moving average costing does not consume.
+		if p.CostingMethod == models.CostingMethodMovingAverage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "consignment requires FIFO costing", "productId": p.ID})
+			return
+		}
+		products = append(products, p)
+	}
+
+	receivedAt := time.Now().UTC()
+	lots := make([]models.InventoryLot, 0, len(req.Items))
+	movements := make([]models.StockMovement, 0, len(req.Items))
+	// rollback undoes the lots and stock booked so far when a later item fails.
+	rollback := func() {
+		for i, lot := range lots {
+			qty := req.Items[i].Quantity
+			if _, err := m.deps.Repo.AdjustStock(ctx, orgID, req.BranchID, lot.ProductID, -qty); err != nil {
+				log.Printf("consignment: rollback stock for %s: %v", lot.ProductID, err)
+			}
+			if err := m.deps.Repo.AdjustConsignedQty(ctx, orgID, req.BranchID, lot.ProductID, -qty); err != nil {
+				log.Printf("consignment: rollback consigned qty for %s: %v", lot.ProductID, err)
+			}
+			if err := m.deps.Repo.DeleteInventoryLot(ctx, lot.ID); err != nil {
+				log.Printf("consignment: rollback lot %s: %v", lot.ID, err)
+			}
+		}
+	}
+	for i, it := range req.Items {
+		p := products[i]
+		prev, _ := m.deps.Repo.GetStockLevel(ctx, orgID, req.BranchID, p.ID)
+		lot, err := m.deps.Repo.CreateInventoryLot(ctx, models.InventoryLot{
+			ID:           primitive.NewObjectID().Hex(),
+			OrgID:        orgID,
+			BranchID:     req.BranchID,
+			ProductID:    p.ID,
+			Source:       "CONSIGNMENT",
+			OwnerID:      req.SupplierID,
+			ReferenceNo:  strings.TrimSpace(req.ReferenceNo),
+			UnitCost:     it.UnitCost,
+			QtyReceived:  it.Quantity,
+			QtyRemaining: it.Quantity,
+			ReceivedAt:   receivedAt,
+		})
+		if err != nil {
+			rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create lot"})
+			return
+		}
+
+		newStock, err := m.deps.Repo.AdjustStock(ctx, orgID, req.BranchID, p.ID, it.Quantity)
+		if err != nil {
+			_ = m.deps.Repo.DeleteInventoryLot(ctx, lot.ID)
+			rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to adjust stock"})
+			return
+		}
+		if err := m.deps.Repo.AdjustConsignedQty(ctx, orgID, req.BranchID, p.ID, it.Quantity); err != nil {
+			_, _ = m.deps.Repo.AdjustStock(ctx, orgID, req.BranchID, p.ID, -it.Quantity)
+			_ = m.deps.Repo.DeleteInventoryLot(ctx, lot.ID)
+			rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to adjust consigned stock"})
+			return
+		}
+		lots = append(lots, lot)
+
+		movements = append(movements, models.StockMovement{
+			ID:               "MV-" + primitive.NewObjectID().Hex(),
+			OrgID:            orgID,
+			BranchID:         req.BranchID,
+			ProductID:        p.ID,
+			Type:             "CONSIGNMENT_IN",
+			Quantity:         it.Quantity,
+			PreviousQuantity: prev.Quantity,
+			NewQuantity:      newStock.Quantity,
+			UnitCost:         it.UnitCost,
+			TotalCost:        it.UnitCost * int64(it.Quantity),
+			ReferenceType:    "CONSIGNMENT",
+			ReferenceID:      req.SupplierID,
+			ReferenceNumber:  strings.TrimSpace(req.ReferenceNo),
+			LotID:            lot.ID,
+			Notes:            strings.TrimSpace(req.Notes),
+			CreatedBy:        u.ID,
+		})
+	}
+
+	// Movements are only written once every item has been booked.
+	for _, mv := range movements {
+		m.deps.Repo.CreateStockMovement(ctx, mv)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": lots})
+}
+
+// listStock returns open consigned lots, optionally for one consignor or branch
+func (m *Module) listStock(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	filter := bson.M{"ownerId": bson.M{"$exists": true, "$ne": ""}, "qtyRemaining": bson.M{"$gt": 0}}
+	if supplierID := strings.TrimSpace(c.Query("supplierId")); supplierID != "" {
+		filter["ownerId"] = supplierID
+	}
+	if branchID := strings.TrimSpace(c.Query("branchId")); branchID != "" {
+		filter["branchId"] = branchID
+	}
+
+	lots, total, err := m.deps.Repo.ListInventoryLotsByOrg(c.Request.Context(), orgID, filter, 1, 1000)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list consigned stock"})
+		return
+	}
+
+	var value int64
+	for _, l := range lots {
+		value += int64(l.QtyRemaining) * l.UnitCost
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": lots,
+		"meta": gin.H{"total": total, "value": value},
+	})
+}
+
+func (m *Module) listPayables(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	filter := bson.M{}
+	if supplierID := strings.TrimSpace(c.Query("supplierId")); supplierID != "" {
+		filter["supplierId"] = supplierID
+	}
+	if status := strings.ToUpper(strings.TrimSpace(c.Query("status"))); status != "" {
+		filter["status"] = status
+	}
+
+	payables, err := m.deps.Repo.ListConsignmentPayablesByOrg(c.Request.Context(), orgID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list payables"})
+		return
+	}
+
+	var totalAmount int64
+	for _, p := range payables {
+		totalAmount += p.Amount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": payables,
+		"meta": gin.H{"total": len(payables), "amount": totalAmount},
+	})
+}
+
+type payRequest struct {
+	IDs       []string `json:"ids"`
+	Reference string   `json:"reference"`
+}
+
+// payPayables marks open payables as settled with the consignor
+func (m *Module) payPayables(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req payRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids required"})
+		return
+	}
+
+	updated, err := m.deps.Repo.UpdateConsignmentPayablesStatus(c.Request.Context(), orgID, req.IDs, models.ConsignmentPayableOpen, bson.M{
+		"status":    models.ConsignmentPayablePaid,
+		"paidAt":    time.Now().UTC(),
+		"paidBy":    u.ID,
+		"reference": strings.TrimSpace(req.Reference),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update payables"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"updated": updated}})
+}
+
+// statement reports stock held, sold and owed for one consignor over a period
+func (m *Module) statement(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	supplierID := strings.TrimSpace(c.Query("supplierId"))
+	if supplierID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "supplierId is required"})
+		return
+	}
+	supplier, err := m.deps.Repo.GetSupplierByOrg(c.Request.Context(), orgID, supplierID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "supplier not found"})
+		return
+	}
+
+	// Get date range (default: current month)
+	now := time.Now().UTC()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	endDate := startDate.AddDate(0, 1, 0)
+	if from := c.Query("from"); from != "" {
+		if t, err := time.Parse("2006-01-02", from); err == nil {
+			startDate = t
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if t, err := time.Parse("2006-01-02", to); err == nil {
+			endDate = t.AddDate(0, 0, 1)
+		}
+	}
+
+	st, err := consignment.New(m.deps.Repo).Statement(c.Request.Context(), orgID, supplierID, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build statement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": st,
+		"meta": gin.H{
+			"supplierName": supplier.Name,
+			"from":         startDate.Format("2006-01-02"),
+			"to":           endDate.AddDate(0, 0, -1).Format("2006-01-02"),
+		},
+	})
+}
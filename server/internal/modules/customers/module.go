@@ -96,10 +96,13 @@ func (m *Module) get(c *gin.Context) {
 }
 
 type createCustomerRequest struct {
-	Name    string `json:"name"`
-	Phone   string `json:"phone"`
-	Email   string `json:"email"`
-	Address string `json:"address"`
+	Name      string `json:"name"`
+	Phone     string `json:"phone"`
+	Email     string `json:"email"`
+	Address   string `json:"address"`
+	Group     string `json:"group"`
+	TaxID     string `json:"taxId"`
+	TaxBranch string `json:"taxBranch"`
 }
 
 func (m *Module) create(c *gin.Context) {
@@ -129,6 +132,9 @@ func (m *Module) create(c *gin.Context) {
 		Phone:     req.Phone,
 		Email:     strings.TrimSpace(req.Email),
 		Address:   strings.TrimSpace(req.Address),
+		Group:     strings.ToUpper(strings.TrimSpace(req.Group)),
+		TaxID:     strings.TrimSpace(req.TaxID),
+		TaxBranch: strings.TrimSpace(req.TaxBranch),
 		Points:    0,
 		TotalSpent: 0,
 	}
@@ -143,10 +149,13 @@ func (m *Module) create(c *gin.Context) {
 }
 
 type updateCustomerRequest struct {
-	Name    *string `json:"name"`
-	Phone   *string `json:"phone"`
-	Email   *string `json:"email"`
-	Address *string `json:"address"`
+	Name      *string `json:"name"`
+	Phone     *string `json:"phone"`
+	Email     *string `json:"email"`
+	Address   *string `json:"address"`
+	Group     *string `json:"group"`
+	TaxID     *string `json:"taxId"`
+	TaxBranch *string `json:"taxBranch"`
 }
 
 func (m *Module) update(c *gin.Context) {
@@ -177,6 +186,15 @@ func (m *Module) update(c *gin.Context) {
 	if req.Address != nil {
 		patch["address"] = strings.TrimSpace(*req.Address)
 	}
+	if req.Group != nil {
+		patch["group"] = strings.ToUpper(strings.TrimSpace(*req.Group))
+	}
+	if req.TaxID != nil {
+		patch["taxId"] = strings.TrimSpace(*req.TaxID)
+	}
+	if req.TaxBranch != nil {
+		patch["taxBranch"] = strings.TrimSpace(*req.TaxBranch)
+	}
 	if len(patch) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
 		return
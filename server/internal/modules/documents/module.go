@@ -0,0 +1,140 @@
+package documentsmodule
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/deps"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/documents"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Module struct {
+	deps deps.Dependencies
+}
+
+func New(deps deps.Dependencies) *Module { return &Module{deps: deps} }
+
+func (m *Module) Name() string { return "documents" }
+
+// RegisterRoutes exposes issued documents. Documents are issued from their source:
+// POST /orders/:id/documents, /returns/:id/credit-note and /purchase-orders/:id/document.
+func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/documents")
+	g.Use(auth.RequireUser())
+
+	g.GET("", m.list)
+	g.GET("/:id", m.get)
+	g.GET("/:id/pdf", m.download)
+}
+
+// list filters by ?type, ?sourceType, ?sourceId, ?number and ?branchId
+func (m *Module) list(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	filter := bson.M{}
+	if v := strings.ToUpper(strings.TrimSpace(c.Query("type"))); v != "" {
+		filter["type"] = v
+	}
+	if v := strings.ToUpper(strings.TrimSpace(c.Query("sourceType"))); v != "" {
+		filter["sourceType"] = v
+	}
+	if v := strings.TrimSpace(c.Query("sourceId")); v != "" {
+		filter["sourceId"] = v
+	}
+	if v := strings.TrimSpace(c.Query("number")); v != "" {
+		filter["number"] = v
+	}
+	if v := strings.TrimSpace(c.Query("branchId")); v != "" {
+		filter["branchId"] = v
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	docs, total, err := m.deps.Repo.ListDocumentsByOrg(c.Request.Context(), orgID, filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list documents"})
+		return
+	}
+	if docs == nil {
+		docs = []models.Document{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": docs,
+		"meta": gin.H{"total": total, "page": page, "limit": limit},
+	})
+}
+
+func (m *Module) get(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	doc, err := m.deps.Repo.GetDocumentByOrg(c.Request.Context(), orgID, c.Param("id"))
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get document"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": doc})
+}
+
+// download streams the stored PDF; ?download=1 asks the browser to save it
+func (m *Module) download(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	doc, err := m.deps.Repo.GetDocumentByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get document"})
+		return
+	}
+
+	obj, err := documents.New(m.deps.Repo, m.deps.MinIO, m.deps.Config).Open(ctx, doc)
+	if err != nil {
+		if err == documents.ErrStorageNotConfigured {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		if err == documents.ErrPending {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read document"})
+		return
+	}
+	defer obj.Close()
+
+	disposition := "inline"
+	if c.Query("download") != "" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition+"; filename=\""+strings.ReplaceAll(doc.Number, "\"", "")+".pdf\"")
+	c.DataFromReader(http.StatusOK, doc.Size, doc.ContentType, obj, nil)
+}
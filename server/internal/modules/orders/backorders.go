@@ -0,0 +1,72 @@
+package ordersmodule
+
+import (
+	"net/http"
+	"strings"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/backorders"
+	"stockflows/server/internal/services/orderevents"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Backorders and pre-orders
+// ============================================================================
+//
+// A product that allows backorders can be ordered beyond what the branch has available.
+// The order reserves what there is and counts the rest as backordered on its lines. Those
+// units hold no stock, so the order cannot be picked, shipped or delivered in full until
+// incoming stock is allocated to them; a shipment can still take the units that are ready.
+
+// backordered counts the order's units waiting for stock
+func backordered(txn models.Transaction) int {
+	n := 0
+	for _, it := range txn.Items {
+		n += it.QtyBackordered
+	}
+	return n
+}
+
+type allocateBackordersRequest struct {
+	BranchID   string   `json:"branchId"`
+	ProductIDs []string `json:"productIds"`
+}
+
+// allocateBackorders gives stock the branch has not promised to backordered orders, oldest
+// first. Receipts and transfers do this on their own; this is for stock that turned up
+// another way, such as a count or a cancelled order.
+func (m *Module) allocateBackorders(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req allocateBackordersRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+			return
+		}
+	}
+	branchID := strings.TrimSpace(req.BranchID)
+	if branchID == "" {
+		branchID = auth.GetBranchIDForRequest(c, u)
+	}
+
+	src := orderevents.Source{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	allocations, err := backorders.New(m.deps.Repo).Allocate(c.Request.Context(), *u, orgID, branchID, uniqueIDs(req.ProductIDs), "", src)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to allocate backorders"})
+		return
+	}
+	units := 0
+	for _, a := range allocations {
+		units += a.Quantity
+	}
+	c.JSON(http.StatusOK, gin.H{"data": allocations, "meta": gin.H{"units": units}})
+}
@@ -0,0 +1,542 @@
+package ordersmodule
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/audit"
+	"stockflows/server/internal/services/orderevents"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ============================================================================
+// Cash on delivery
+// ============================================================================
+
+// codFor returns the COD details for an order paid by method, or nil when the method is
+// not COD. amount defaults to the order total.
+func codFor(method string, amount, total int64) *models.CODInfo {
+	if method != models.PaymentMethodCOD {
+		return nil
+	}
+	if amount <= 0 {
+		amount = total
+	}
+	return &models.CODInfo{Expected: amount}
+}
+
+// maxRemittanceBytes caps an uploaded remittance statement
+const maxRemittanceBytes = 5 << 20
+
+// Column headers carriers use on remittance statements, compared lower case with
+// everything but letters and digits removed
+var (
+	remittanceTrackingHeaders = []string{"trackingnumber", "trackingno", "tracking", "pno", "conno", "consignmentno", "billcode", "waybillno", "waybill", "awb", "barcode"}
+	remittanceAmountHeaders   = []string{"codamount", "cod", "remittedamount", "remitted", "collectedamount", "collected", "amount"}
+)
+
+// remittanceLine is one parsed statement row
+type remittanceLine struct {
+	Row            int
+	TrackingNumber string
+	Amount         int64
+}
+
+// parseRemittanceCSV reads the tracking number and COD amount (in baht) of each row.
+// The columns are found by their headers, so the carrier's own export can be uploaded
+// as is.
+func parseRemittanceCSV(r io.Reader) ([]remittanceLine, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("statement is not a CSV file")
+	}
+	trackingCol, amountCol := -1, -1
+	keys := make([]string, len(header))
+	for i, h := range header {
+		keys[i] = headerKey(h)
+	}
+	for _, want := range remittanceTrackingHeaders {
+		if trackingCol = indexOf(keys, want); trackingCol >= 0 {
+			break
+		}
+	}
+	for _, want := range remittanceAmountHeaders {
+		if amountCol = indexOf(keys, want); amountCol >= 0 {
+			break
+		}
+	}
+	if trackingCol < 0 || amountCol < 0 {
+		return nil, errors.New("statement needs a tracking number and a COD amount column")
+	}
+
+	lines := make([]remittanceLine, 0)
+	for row := 2; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		if trackingCol >= len(rec) || strings.TrimSpace(rec[trackingCol]) == "" {
+			continue // Blank and summary rows
+		}
+		if amountCol >= len(rec) {
+			return nil, fmt.Errorf("row %d: missing amount", row)
+		}
+		amount, err := parseBaht(rec[amountCol])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid amount %q", row, rec[amountCol])
+		}
+		lines = append(lines, remittanceLine{
+			Row:            row,
+			TrackingNumber: strings.ToUpper(strings.TrimSpace(rec[trackingCol])),
+			Amount:         amount,
+		})
+	}
+	return lines, nil
+}
+
+func headerKey(h string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, h) // Also drops a UTF-8 byte order mark
+}
+
+func indexOf(keys []string, want string) int {
+	for i, k := range keys {
+		if k == want {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseBaht parses an amount such as "1,250.50", "฿80" or "THB 99.5" into satang
+func parseBaht(s string) (int64, error) {
+	s = strings.NewReplacer(",", "", "฿", "", "THB", "", " ", "").Replace(strings.ToUpper(strings.TrimSpace(s)))
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || len(frac) > 2 || strings.HasPrefix(whole, "-") {
+		return 0, errors.New("invalid amount")
+	}
+	v := int64(0)
+	if whole != "" {
+		n, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		v = n * 100
+	}
+	if frac != "" {
+		n, err := strconv.Atoi(frac)
+		if err != nil || n < 0 {
+			return 0, errors.New("invalid amount")
+		}
+		if len(frac) == 1 {
+			n *= 10
+		}
+		v += int64(n)
+	}
+	return v, nil
+}
+
+// codParcel is one parcel an order went out in: the order's own, or one of its shipments
+type codParcel struct {
+	txn      models.Transaction
+	shipment int // Index into txn.Shipments; -1 for the order's own parcel
+}
+
+func (p codParcel) carrier() string {
+	if p.shipment >= 0 {
+		return p.txn.Shipments[p.shipment].Carrier
+	}
+	return p.txn.ShippingInfo.Carrier
+}
+
+// matchRemittance pairs statement lines with COD orders by tracking number, including the
+// parcels of orders shipped in parts. Lines that can be applied carry the order (and the
+// shipment); the rest are flagged with a note saying why.
+func (m *Module) matchRemittance(ctx context.Context, orgID, carrier string, in []remittanceLine) ([]models.CODRemittanceLine, map[string]models.Transaction, error) {
+	numbers := make([]string, 0, len(in))
+	for _, l := range in {
+		numbers = append(numbers, l.TrackingNumber)
+	}
+	txns, err := m.deps.Repo.ListTransactionsByTrackingNumbers(ctx, orgID, numbers)
+	if err != nil {
+		return nil, nil, err
+	}
+	byTracking := make(map[string][]codParcel, len(txns))
+	for _, t := range txns {
+		if t.ShippingInfo != nil && t.ShippingInfo.TrackingNumber != "" {
+			tn := strings.ToUpper(t.ShippingInfo.TrackingNumber)
+			byTracking[tn] = append(byTracking[tn], codParcel{txn: t, shipment: -1})
+		}
+		for i, sh := range t.Shipments {
+			if sh.TrackingNumber != "" {
+				tn := strings.ToUpper(sh.TrackingNumber)
+				byTracking[tn] = append(byTracking[tn], codParcel{txn: t, shipment: i})
+			}
+		}
+	}
+	carrierNames := []string{carrier}
+	if cr, err := m.deps.Carriers.Get(carrier); err == nil {
+		carrierNames = append(carrierNames, cr.Name())
+	}
+
+	orders := make(map[string]models.Transaction)
+	seen := make(map[string]bool, len(in))
+	out := make([]models.CODRemittanceLine, 0, len(in))
+	for _, l := range in {
+		line := models.CODRemittanceLine{Row: l.Row, TrackingNumber: l.TrackingNumber, Amount: l.Amount, Status: models.CODLineUnmatched}
+		out = append(out, line)
+		cur := &out[len(out)-1]
+		if seen[l.TrackingNumber] {
+			cur.Status, cur.Note = models.CODLineDuplicate, "tracking number repeated in the statement"
+			continue
+		}
+		seen[l.TrackingNumber] = true
+
+		var parcel *codParcel
+		for i, p := range byTracking[l.TrackingNumber] {
+			for _, name := range carrierNames {
+				if strings.EqualFold(strings.TrimSpace(p.carrier()), name) {
+					parcel = &byTracking[l.TrackingNumber][i]
+				}
+			}
+		}
+		if parcel == nil {
+			if others := byTracking[l.TrackingNumber]; len(others) > 0 {
+				cur.OrderID = others[0].txn.ID
+				cur.Note = "order " + others[0].txn.ID + " was shipped with " + others[0].carrier()
+			} else {
+				cur.Note = "no order has this tracking number"
+			}
+			continue
+		}
+
+		txn := parcel.txn
+		expected, remittedOn, cancelled := int64(0), "", false
+		if txn.COD != nil {
+			expected, remittedOn = txn.COD.Expected, txn.COD.RemittanceID
+		}
+		if parcel.shipment >= 0 {
+			sh := txn.Shipments[parcel.shipment]
+			cur.ShipmentID = sh.ID
+			expected, remittedOn = sh.CODAmount, sh.RemittanceID
+			cancelled = sh.Status == models.ShipmentStatusCancelled
+		}
+		switch {
+		case txn.COD == nil:
+			cur.OrderID, cur.Note = txn.ID, "order "+txn.ID+" is not cash on delivery"
+		case txn.Status == "CANCELLED" || txn.Status == "REFUNDED":
+			cur.OrderID, cur.Note = txn.ID, "order "+txn.ID+" is cancelled"
+		case cancelled:
+			cur.OrderID, cur.Note = txn.ID, "shipment "+cur.ShipmentID+" is cancelled"
+		case remittedOn != "":
+			cur.OrderID, cur.Status = txn.ID, models.CODLineDuplicate
+			cur.Note = "already remitted on " + remittedOn
+		default:
+			cur.OrderID, cur.Expected = txn.ID, expected
+			cur.Difference = l.Amount - expected
+			switch {
+			case cur.Difference < 0:
+				cur.Status, cur.Note = models.CODLineShort, "short by "+formatBaht(-cur.Difference)
+			case cur.Difference > 0:
+				cur.Status, cur.Note = models.CODLineOver, "over by "+formatBaht(cur.Difference)
+			default:
+				cur.Status = models.CODLineMatched
+			}
+			orders[txn.ID] = txn
+		}
+	}
+	return out, orders, nil
+}
+
+// importRemittance applies a carrier's COD remittance statement (multipart: file,
+// carrier, reference). Each parcel matched to a COD order is recorded as a COD payment
+// of the amount remitted, marking the order paid or, when short, part paid. Unmatched,
+// duplicate, short and over lines are flagged. ?preview=true matches without recording.
+func (m *Module) importRemittance(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	carrier := strings.TrimSpace(c.PostForm("carrier"))
+	if carrier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "carrier is required"})
+		return
+	}
+	carrier = strings.ToUpper(carrier)
+	if cr, err := m.deps.Carriers.Get(carrier); err == nil {
+		carrier = cr.Code()
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if file.Size > maxRemittanceBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file too large"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read upload"})
+		return
+	}
+	defer f.Close()
+	parsed, err := parseRemittanceCSV(io.LimitReader(f, maxRemittanceBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(parsed) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "statement has no lines"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	lines, orders, err := m.matchRemittance(ctx, orgID, carrier, parsed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to match orders"})
+		return
+	}
+	rem := models.CODRemittance{
+		ID:        "REM-" + primitive.NewObjectID().Hex(),
+		OrgID:     orgID,
+		Carrier:   carrier,
+		Reference: strings.TrimSpace(c.PostForm("reference")),
+		FileName:  file.Filename,
+		Lines:     lines,
+		CreatedBy: u.ID,
+	}
+	tallyRemittance(&rem, orders)
+	if c.Query("preview") == "true" {
+		c.JSON(http.StatusOK, gin.H{"data": rem, "meta": gin.H{"preview": true}})
+		return
+	}
+
+	// The statement is saved first so every order it claims points at a real document.
+	created, err := m.deps.Repo.CreateCODRemittance(ctx, rem)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save remittance"})
+		return
+	}
+	rem = created
+	saveLines := func() {
+		tallyRemittance(&rem, orders)
+		if err := m.deps.Repo.UpdateCODRemittanceByOrg(ctx, orgID, rem.ID, bson.M{
+			"lines": rem.Lines, "total": rem.Total, "applied": rem.Applied,
+			"shortfall": rem.Shortfall, "matched": rem.Matched, "flagged": rem.Flagged,
+		}); err != nil {
+			log.Printf("orders: save remittance %s: %v", rem.ID, err)
+		}
+	}
+
+	remittedDate := time.Now().UTC().Format(time.RFC3339)
+	reference := rem.Reference
+	if reference == "" {
+		reference = rem.ID
+	}
+	for i := range rem.Lines {
+		l := &rem.Lines[i]
+		txn, ok := orders[l.OrderID]
+		if !ok || !appliesRemittance(l.Status) {
+			continue
+		}
+
+		var shortfall int64
+		if l.Difference < 0 {
+			shortfall = -l.Difference
+		}
+		// Claim the parcel before paying it: a concurrent upload of the same parcel loses here.
+		// A parcel of an order shipped in parts adds what it remitted to the order's COD.
+		claim := func() error { return m.deps.Repo.ClaimCODRemittance(ctx, orgID, txn.ID, rem.ID) }
+		release := func() { _ = m.deps.Repo.ReleaseCODRemittance(ctx, orgID, txn.ID, rem.ID) }
+		if l.ShipmentID != "" {
+			claim = func() error {
+				return m.deps.Repo.ClaimShipmentCODRemittance(ctx, orgID, txn.ID, l.ShipmentID, rem.ID, l.Amount, shortfall, remittedDate)
+			}
+			release = func() {
+				_ = m.deps.Repo.ReleaseShipmentCODRemittance(ctx, orgID, txn.ID, l.ShipmentID, rem.ID, l.Amount, shortfall)
+			}
+		}
+		if err := claim(); err != nil {
+			if !errors.Is(err, repo.ErrConflict) {
+				saveLines()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order", "row": l.Row})
+				return
+			}
+			l.Status, l.Note = models.CODLineDuplicate, "already remitted on another statement"
+			continue
+		}
+
+		if l.Amount > 0 {
+			payment, err := m.deps.Repo.CreatePayment(ctx, models.Payment{
+				ID:            "PAY-" + primitive.NewObjectID().Hex(),
+				OrgID:         orgID,
+				BranchID:      txn.BranchID,
+				TransactionID: txn.ID,
+				Type:          models.PaymentTypePayment,
+				Method:        models.PaymentMethodCOD,
+				Amount:        l.Amount,
+				Reference:     reference,
+				Note:          "COD remitted by " + carrier,
+				CreatedBy:     u.ID,
+			})
+			if err != nil {
+				release()
+				l.Status, l.Note = models.CODLineUnmatched, "payment could not be recorded"
+				saveLines()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record payment", "row": l.Row})
+				return
+			}
+			l.PaymentID = payment.ID
+		}
+		if l.ShipmentID == "" {
+			cod := *txn.COD
+			cod.Remitted, cod.RemittanceID, cod.RemittedDate = l.Amount, rem.ID, remittedDate
+			cod.Shortfall = shortfall
+			if _, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{"cod": cod}); err != nil {
+				saveLines()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order", "row": l.Row})
+				return
+			}
+		} else if err := m.settleShipmentCOD(ctx, orgID, txn.ID, rem.ID); err != nil {
+			saveLines()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order", "row": l.Row})
+			return
+		}
+		updated, _, err := m.syncPayments(ctx, orgID, txn)
+		if err != nil {
+			saveLines()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order", "row": l.Row})
+			return
+		}
+		ch := orderevents.Change{
+			Type:    models.OrderEventPaymentReceived,
+			Message: "COD of " + formatBaht(l.Amount) + " remitted by " + carrier,
+			Payload: map[string]interface{}{"paymentId": l.PaymentID, "method": models.PaymentMethodCOD, "amount": l.Amount, "reference": reference, "remittanceId": rem.ID},
+		}
+		if l.ShipmentID != "" {
+			ch.Message += " for shipment " + l.ShipmentID
+			ch.Payload["shipmentId"] = l.ShipmentID
+		}
+		if shortfall > 0 {
+			ch.Message += " (" + formatBaht(shortfall) + " short)"
+			ch.Payload["shortfall"] = shortfall
+		}
+		m.recordEvent(c, *u, updated, ch)
+	}
+	saveLines()
+
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "CODRemittance", rem.ID, models.AuditActionCreate,
+		nil, rem, c.ClientIP(), c.Request.UserAgent(), "Imported "+carrier+" COD remittance "+reference)
+	c.JSON(http.StatusCreated, gin.H{"data": rem})
+}
+
+// settleShipmentCOD marks the COD of an order shipped in parts as remitted once nothing
+// is left to ship and every parcel still on the order that collects cash has been remitted
+func (m *Module) settleShipmentCOD(ctx context.Context, orgID, transactionID, remittanceID string) error {
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, transactionID)
+	if err != nil {
+		return err
+	}
+	if txn.COD == nil || len(unshipped(txn)) > 0 {
+		return nil
+	}
+	for _, sh := range txn.Shipments {
+		if sh.Status != models.ShipmentStatusCancelled && sh.CODAmount > 0 && sh.RemittanceID == "" {
+			return nil
+		}
+	}
+	_, err = m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{"cod.remittanceId": remittanceID})
+	return err
+}
+
+// appliesRemittance reports whether a statement line is paid onto its order
+func appliesRemittance(status string) bool {
+	return status == models.CODLineMatched || status == models.CODLineShort || status == models.CODLineOver
+}
+
+// tallyRemittance totals a statement from its lines
+func tallyRemittance(rem *models.CODRemittance, orders map[string]models.Transaction) {
+	rem.Total, rem.Applied, rem.Shortfall, rem.Matched, rem.Flagged = 0, 0, 0, 0, 0
+	for _, l := range rem.Lines {
+		rem.Total += l.Amount
+		if _, ok := orders[l.OrderID]; !ok || !appliesRemittance(l.Status) {
+			rem.Flagged++
+			continue
+		}
+		if l.Status != models.CODLineMatched {
+			rem.Flagged++
+		}
+		if l.Status == models.CODLineShort {
+			rem.Shortfall -= l.Difference
+		}
+		rem.Matched++
+		rem.Applied += l.Amount
+	}
+}
+
+// listRemittances returns imported statements newest first (?carrier)
+func (m *Module) listRemittances(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+	filter := bson.M{}
+	if carrier := strings.TrimSpace(c.Query("carrier")); carrier != "" {
+		filter["carrier"] = strings.ToUpper(carrier)
+	}
+	list, err := m.deps.Repo.ListCODRemittancesByOrg(c.Request.Context(), orgID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list remittances"})
+		return
+	}
+	if list == nil {
+		list = []models.CODRemittance{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func (m *Module) getRemittance(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+	rem, err := m.deps.Repo.GetCODRemittanceByOrg(c.Request.Context(), orgID, c.Param("remittanceId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "remittance not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rem})
+}
@@ -0,0 +1,107 @@
+package ordersmodule
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/audit"
+	"stockflows/server/internal/services/documents"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type issueDocumentRequest struct {
+	Type  string                `json:"type"`  // TAX_INVOICE, RECEIPT or CREDIT_NOTE
+	Buyer *models.DocumentParty `json:"buyer"` // Overrides the customer's details on the document
+}
+
+// issueDocument renders a tax invoice, receipt or credit note for the order. Each type is
+// issued once; asking again returns the stored document with its original number.
+func (m *Module) issueDocument(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req issueDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	typ := models.DocumentType(strings.ToUpper(strings.TrimSpace(req.Type)))
+	switch typ {
+	case models.DocumentTaxInvoice, models.DocumentReceipt, models.DocumentCreditNote:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be TAX_INVOICE, RECEIPT or CREDIT_NOTE"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	doc, created, err := documents.New(m.deps.Repo, m.deps.MinIO, m.deps.Config).ForOrder(ctx, *u, txn, typ, req.Buyer)
+	if err != nil {
+		switch {
+		case errors.Is(err, documents.ErrStorageNotConfigured):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		case errors.Is(err, documents.ErrNotVATRegistered), errors.Is(err, documents.ErrSellerTaxID),
+			errors.Is(err, documents.ErrBuyerRequired), errors.Is(err, documents.ErrNotIssuable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue document"})
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Document", doc.ID, models.AuditActionCreate,
+			nil, doc, c.ClientIP(), c.Request.UserAgent(), string(doc.Type)+" "+doc.Number+" for order "+txn.ID)
+	}
+	c.JSON(status, gin.H{"data": doc, "meta": gin.H{"created": created}})
+}
+
+// listDocuments returns the documents issued for the order, including credit notes
+// issued for its returns
+func (m *Module) listDocuments(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	sources := bson.A{bson.M{"sourceType": models.DocumentSourceOrder, "sourceId": txn.ID}}
+	if returns, err := m.deps.Repo.ListReturnsByOriginalOrder(ctx, orgID, txn.ID); err == nil {
+		for _, r := range returns {
+			sources = append(sources, bson.M{"sourceType": models.DocumentSourceReturn, "sourceId": r.ID})
+		}
+	}
+	docs, total, err := m.deps.Repo.ListDocumentsByOrg(ctx, orgID, bson.M{"$or": sources}, 1, 100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list documents"})
+		return
+	}
+	if docs == nil {
+		docs = []models.Document{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": docs, "meta": gin.H{"total": total}})
+}
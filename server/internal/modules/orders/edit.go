@@ -0,0 +1,236 @@
+package ordersmodule
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+)
+
+// Kinds of line change found when an order is edited
+const (
+	LineAdded    = "ADDED"
+	LineRemoved  = "REMOVED"
+	LineQuantity = "QUANTITY"
+	LineSwapped  = "SWAPPED"
+)
+
+// LineChange is one difference between an order's lines before and after an edit
+type LineChange struct {
+	Kind          string `bson:"kind" json:"kind"`
+	ProductID     string `bson:"productId" json:"productId"`
+	Name          string `bson:"name" json:"name"`
+	FromProductID string `bson:"fromProductId,omitempty" json:"fromProductId,omitempty"` // SWAPPED: the product it replaced
+	FromName      string `bson:"fromName,omitempty" json:"fromName,omitempty"`
+	FromQuantity  int    `bson:"fromQuantity" json:"fromQuantity"`
+	ToQuantity    int    `bson:"toQuantity" json:"toQuantity"`
+}
+
+// lineQuantities totals quantities per product, keeping the order products first appear in
+func lineQuantities(items []models.TransactionItem) (map[string]int, []string) {
+	qty := make(map[string]int, len(items))
+	order := make([]string, 0, len(items))
+	for _, it := range items {
+		if _, ok := qty[it.ID]; !ok {
+			order = append(order, it.ID)
+		}
+		qty[it.ID] += it.Quantity
+	}
+	return qty, order
+}
+
+// diffLines compares an order's lines before and after an edit. A product that left the
+// order in the same position a new product took is reported as a swap.
+func diffLines(before, after []models.TransactionItem) []LineChange {
+	oldQty, oldOrder := lineQuantities(before)
+	newQty, newOrder := lineQuantities(after)
+	names := make(map[string]string, len(before)+len(after))
+	for _, it := range before {
+		names[it.ID] = it.Name
+	}
+	for _, it := range after {
+		names[it.ID] = it.Name
+	}
+
+	// Products only on one side, by the position of their first line
+	removedAt := make(map[int]string)
+	for i, it := range before {
+		if _, kept := newQty[it.ID]; !kept {
+			removedAt[i] = it.ID
+		}
+	}
+	swappedOut := make(map[string]bool)
+	swappedIn := make(map[string]bool)
+	changes := make([]LineChange, 0)
+	for i, it := range after {
+		if _, existed := oldQty[it.ID]; existed || swappedIn[it.ID] {
+			continue
+		}
+		from, ok := removedAt[i]
+		if !ok || swappedOut[from] {
+			continue
+		}
+		swappedOut[from], swappedIn[it.ID] = true, true
+		changes = append(changes, LineChange{
+			Kind: LineSwapped, ProductID: it.ID, Name: names[it.ID],
+			FromProductID: from, FromName: names[from],
+			FromQuantity: oldQty[from], ToQuantity: newQty[it.ID],
+		})
+	}
+
+	for _, id := range oldOrder {
+		switch n, kept := newQty[id]; {
+		case !kept && !swappedOut[id]:
+			changes = append(changes, LineChange{Kind: LineRemoved, ProductID: id, Name: names[id], FromQuantity: oldQty[id]})
+		case kept && n != oldQty[id]:
+			changes = append(changes, LineChange{Kind: LineQuantity, ProductID: id, Name: names[id], FromQuantity: oldQty[id], ToQuantity: n})
+		}
+	}
+	for _, id := range newOrder {
+		if _, existed := oldQty[id]; !existed && !swappedIn[id] {
+			changes = append(changes, LineChange{Kind: LineAdded, ProductID: id, Name: names[id], ToQuantity: newQty[id]})
+		}
+	}
+	return changes
+}
+
+// keptOrderDiscount is the order-level discount an order was given, separate from the line
+// discounts (manual and promotional) already on its items
+func keptOrderDiscount(txn models.Transaction) int64 {
+	d := txn.DiscountAmount
+	for _, it := range txn.Items {
+		d -= it.Discount
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// reserveDiff moves the branch's reservations from the lines an order holds to the lines it
+// should hold, touching only the quantities that changed. Increases are reserved before
+// anything is released, and a shortage or a failed release puts back what was already moved,
+// leaving every reservation as it was. Products that allow backorders take what the branch
+// has and backorder the rest; a cut drops backordered units before reserved ones. It returns
+// want with each line's backordered units set, and an undo that puts the reservations back
+// if the order itself cannot be saved.
+func (m *Module) reserveDiff(ctx context.Context, orgID, branchID string, held, want []models.TransactionItem) ([]models.TransactionItem, func(), string, error) {
+	oldQty, _ := lineQuantities(held)
+	newQty, _ := lineQuantities(want)
+	oldBack := make(map[string]int)
+	preorder := make(map[string]bool)
+	for _, it := range held {
+		oldBack[it.ID] += it.QtyBackordered
+		preorder[it.ID] = preorder[it.ID] || it.Preorder
+	}
+	ids := make([]string, 0, len(oldQty)+len(newQty))
+	for id := range oldQty {
+		ids = append(ids, id)
+	}
+	for id := range newQty {
+		if _, ok := oldQty[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids) // A fixed order so concurrent edits take stock in the same sequence
+
+	reserved := make(map[string]int)
+	released := make(map[string]int)
+	undo := func() {
+		for id, qty := range reserved {
+			_, _ = m.deps.Repo.ReleaseReservedStock(ctx, orgID, branchID, id, qty)
+		}
+		for id, qty := range released {
+			_, _ = m.deps.Repo.ReserveStock(ctx, orgID, branchID, id, qty)
+		}
+	}
+
+	newBack := make(map[string]int)
+	for _, id := range ids {
+		delta := newQty[id] - oldQty[id]
+		newBack[id] = oldBack[id]
+		if delta <= 0 {
+			continue
+		}
+		_, _ = m.deps.Repo.AdjustStock(ctx, orgID, branchID, id, 0)
+		take := delta
+		_, err := m.deps.Repo.ReserveStock(ctx, orgID, branchID, id, delta)
+		if errors.Is(err, repo.ErrInsufficientStock) {
+			var p models.Product
+			if p, err = m.deps.Repo.GetProductByOrg(ctx, orgID, id); err == nil {
+				take, err = m.reserveAvailable(ctx, orgID, branchID, p, delta)
+				newBack[id] += delta - take
+				preorder[id] = p.BackorderPolicy == models.BackorderPolicyPreorder
+			}
+		}
+		if err != nil {
+			undo()
+			return nil, func() {}, id, err
+		}
+		if take > 0 {
+			reserved[id] = take
+		}
+	}
+	for _, id := range ids {
+		delta := oldQty[id] - newQty[id]
+		if delta <= 0 {
+			continue
+		}
+		dropped := oldBack[id]
+		if dropped > delta {
+			dropped = delta
+		}
+		newBack[id] -= dropped
+		if delta -= dropped; delta == 0 {
+			continue
+		}
+		if _, err := m.deps.Repo.ReleaseReservedStock(ctx, orgID, branchID, id, delta); err != nil {
+			undo()
+			return nil, func() {}, id, err
+		}
+		released[id] = delta
+	}
+	return backorderLines(want, newBack, preorder), undo, "", nil
+}
+
+// reserveAvailable reserves whatever the branch has left of a product, up to qty, for a
+// product that allows backorders. It fails with ErrInsufficientStock for one that does not.
+func (m *Module) reserveAvailable(ctx context.Context, orgID, branchID string, p models.Product, qty int) (int, error) {
+	if !p.AllowsBackorder() {
+		return 0, repo.ErrInsufficientStock
+	}
+	level, err := m.deps.Repo.GetStockLevel(ctx, orgID, branchID, p.ID)
+	if err != nil {
+		return 0, err
+	}
+	take := level.Quantity - level.Reserved
+	if take > qty {
+		take = qty
+	}
+	if take <= 0 {
+		return 0, nil
+	}
+	if _, err := m.deps.Repo.ReserveStock(ctx, orgID, branchID, p.ID, take); err != nil {
+		return 0, err
+	}
+	return take, nil
+}
+
+// backorderLines spreads each product's backordered units over its lines, last line first,
+// so the earliest lines are the ones that ship first
+func backorderLines(items []models.TransactionItem, back map[string]int, preorder map[string]bool) []models.TransactionItem {
+	out := make([]models.TransactionItem, len(items))
+	copy(out, items)
+	for i := len(out) - 1; i >= 0; i-- {
+		n := back[out[i].ID]
+		if n > out[i].Quantity {
+			n = out[i].Quantity
+		}
+		back[out[i].ID] -= n
+		out[i].QtyBackordered = n
+		out[i].Preorder = n > 0 && preorder[out[i].ID]
+	}
+	return out
+}
@@ -0,0 +1,250 @@
+package ordersmodule
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/orderevents"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxNote caps a note added to an order's history
+const maxNote = 2000
+
+// recordEvent appends a change to the order's history. The change itself is already
+// saved, so failing to record it is logged rather than failing the request.
+func (m *Module) recordEvent(c *gin.Context, actor models.User, order models.Transaction, ch orderevents.Change) {
+	src := orderevents.Source{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if _, err := orderevents.New(m.deps.Repo).Record(c.Request.Context(), actor, order, ch, src); err != nil {
+		log.Printf("orders: record %s for %s: %v", ch.Type, order.ID, err)
+	}
+}
+
+// createdChange describes a new order
+func createdChange(txn models.Transaction) orderevents.Change {
+	msg := "Order created"
+	if txn.Status == "DRAFT" {
+		msg = "Draft order created"
+	}
+	if txn.Channel != "" {
+		msg += " (" + txn.Channel + ")"
+	}
+	ch := orderevents.Change{
+		Type:    models.OrderEventCreated,
+		Message: msg,
+		Payload: map[string]interface{}{"channel": txn.Channel, "total": txn.Total, "items": len(txn.Items)},
+		After:   txn,
+	}
+	if n := backordered(txn); n > 0 {
+		ch.Message += fmt.Sprintf("; %d units backordered", n)
+		ch.Payload["backordered"] = n
+	}
+	return ch
+}
+
+// updatedChange describes an edit, naming the fields it set
+func updatedChange(before, after models.Transaction, patch bson.M) orderevents.Change {
+	fields := make([]string, 0, len(patch))
+	for k := range patch {
+		if k != "updatedAt" {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	msg := "Order updated: " + strings.Join(fields, ", ")
+	if before.Status == "DRAFT" && after.Status != "DRAFT" {
+		msg = "Draft submitted"
+	}
+	ch := orderevents.Change{
+		Type:    models.OrderEventUpdated,
+		Message: msg,
+		Payload: map[string]interface{}{"fields": fields, "total": after.Total},
+		Before:  before,
+		After:   after,
+	}
+	if n := backordered(after); n != backordered(before) {
+		ch.Payload["backordered"] = n
+	}
+	return ch
+}
+
+// fulfillmentChange describes a fulfillment status set by hand
+func fulfillmentChange(before, after models.Transaction) orderevents.Change {
+	ch := orderevents.Change{
+		Type:    models.OrderEventFulfillment,
+		Message: "Fulfillment changed from " + before.FulfillmentStatus + " to " + after.FulfillmentStatus,
+		Payload: map[string]interface{}{"from": before.FulfillmentStatus, "to": after.FulfillmentStatus},
+		Before:  before,
+		After:   after,
+	}
+	if after.FulfillmentStatus == "SHIPPED" {
+		ch.Type = models.OrderEventShipped
+		ch.Message = "Order shipped" + carrierInfo(after.ShippingInfo)
+	}
+	if s := after.ShippingInfo; s != nil {
+		ch.Payload["carrier"] = s.Carrier
+		ch.Payload["trackingNumber"] = s.TrackingNumber
+	}
+	return ch
+}
+
+// shippedChange describes an order handed to the carrier
+func shippedChange(before, after models.Transaction, booked bool) orderevents.Change {
+	ch := orderevents.Change{
+		Type:    models.OrderEventShipped,
+		Message: "Order shipped" + carrierInfo(after.ShippingInfo),
+		Payload: map[string]interface{}{"booked": booked},
+		Before:  before.ShippingInfo,
+		After:   after.ShippingInfo,
+	}
+	if s := after.ShippingInfo; s != nil {
+		ch.Payload["carrier"] = s.Carrier
+		ch.Payload["trackingNumber"] = s.TrackingNumber
+		if s.CODAmount > 0 {
+			ch.Payload["codAmount"] = s.CODAmount
+		}
+	}
+	return ch
+}
+
+// paymentChange describes a ledger entry added to an order
+func paymentChange(p models.Payment) orderevents.Change {
+	ch := orderevents.Change{
+		Type:    models.OrderEventPaymentReceived,
+		Message: "Payment of " + formatBaht(p.Amount) + " received via " + p.Method,
+		Payload: map[string]interface{}{"paymentId": p.ID, "method": p.Method, "amount": p.Amount},
+	}
+	if p.Type == models.PaymentTypeRefund {
+		ch.Type = models.OrderEventPaymentRefunded
+		ch.Message = "Refund of " + formatBaht(p.Amount) + " via " + p.Method
+		ch.Payload["refundOf"] = p.RefundOf
+	}
+	if p.Reference != "" {
+		ch.Payload["reference"] = p.Reference
+	}
+	if p.Note != "" {
+		ch.Payload["note"] = p.Note
+	}
+	return ch
+}
+
+// deliveredChange describes an order handed to the customer
+func deliveredChange(before, after models.Transaction) orderevents.Change {
+	return orderevents.Change{
+		Type:    models.OrderEventDelivered,
+		Message: "Order delivered",
+		Payload: map[string]interface{}{"stockCommitted": after.StockCommitted},
+		Before:  before.ShippingInfo,
+		After:   after.ShippingInfo,
+	}
+}
+
+// TimelineEvent is one entry of an order's timeline
+type TimelineEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Status    string                 `json:"status"`
+	Message   string                 `json:"message"`
+	Timestamp string                 `json:"timestamp"`
+	UserID    string                 `json:"userId,omitempty"`
+	UserName  string                 `json:"userName,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// getTimeline returns the order's history from its event log. Orders placed before the
+// log existed have their timeline pieced together from the order as it stands.
+func (m *Module) getTimeline(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	events, err := m.deps.Repo.ListOrderEventsByOrder(ctx, orgID, txn.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load timeline"})
+		return
+	}
+	if len(events) == 0 {
+		c.JSON(http.StatusOK, gin.H{"data": m.legacyTimeline(c, txn), "meta": gin.H{"source": "order"}})
+		return
+	}
+
+	timeline := make([]TimelineEvent, 0, len(events))
+	for _, e := range events {
+		timeline = append(timeline, TimelineEvent{
+			ID:        e.ID,
+			Type:      string(e.Type),
+			Status:    "completed",
+			Message:   e.Message,
+			Timestamp: e.CreatedAt.Format(time.RFC3339),
+			UserID:    e.ActorID,
+			UserName:  e.ActorName,
+			Data:      e.Payload,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": timeline, "meta": gin.H{"source": "events"}})
+}
+
+type addNoteRequest struct {
+	Note     string `json:"note"`
+	Internal *bool  `json:"internal"` // Staff only; true unless set
+}
+
+// addNote adds a note to the order's history
+func (m *Module) addNote(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req addNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	note := strings.TrimSpace(req.Note)
+	if note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "note is required"})
+		return
+	}
+	if len([]rune(note)) > maxNote {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "note is too long"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	internal := req.Internal == nil || *req.Internal
+	ev, err := orderevents.New(m.deps.Repo).Record(ctx, *u, txn, orderevents.Change{
+		Type:    models.OrderEventNote,
+		Message: note,
+		Payload: map[string]interface{}{"internal": internal},
+	}, orderevents.Source{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add note"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": ev})
+}
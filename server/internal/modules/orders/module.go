@@ -1,8 +1,11 @@
 package ordersmodule
 
 import (
+	"context"
 	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,7 +13,11 @@ import (
 	"stockflows/server/internal/deps"
 	"stockflows/server/internal/models"
 	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/consignment"
 	"stockflows/server/internal/services/costing"
+	"stockflows/server/internal/services/orderevents"
+	"stockflows/server/internal/services/promotions"
+	"stockflows/server/internal/services/tax"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -28,6 +35,7 @@ func (m *Module) Name() string { return "orders" }
 func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 	r.GET("/transactions", auth.RequireUser(), m.listTransactions)
 	r.POST("/checkout", auth.RequireUser(), m.checkout)
+	r.POST("/carriers/:code/webhook", m.carrierWebhook) // Verified by the carrier's adapter, not a login
 
 	orders := r.Group("/orders")
 	orders.Use(auth.RequireUser())
@@ -36,6 +44,12 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 	orders.GET("/stats", m.stats)
 	orders.GET("/next-number", m.nextNumber)
 	orders.POST("/quick", m.quickAdd)
+	orders.POST("/parse-text", m.parseText)
+	orders.POST("/pick-list", m.createPickList)
+	orders.GET("/cod/remittances", m.listRemittances)
+	orders.GET("/cod/remittances/:remittanceId", m.getRemittance)
+	orders.POST("/cod/remittances", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.importRemittance)
+	orders.POST("/backorders/allocate", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.allocateBackorders)
 	orders.GET("/:id", m.getOrder)
 	orders.PATCH("/:id", m.updateOrder)
 	orders.DELETE("/:id", m.deleteOrder)
@@ -45,9 +59,24 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 	orders.POST("/:id/confirm", m.confirm)
 	orders.POST("/:id/complete", m.complete)
 	orders.POST("/:id/payment", m.recordPayment)
+	orders.GET("/:id/payments", m.listPayments)
+	orders.POST("/:id/payments/:paymentId/void", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.voidPayment)
+	orders.POST("/:id/payments/:paymentId/refund", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.refundPayment)
+	orders.POST("/:id/pack", m.confirmPack)
 	orders.POST("/:id/ship", m.markShipped)
+	orders.GET("/:id/label", m.getLabel)
+	orders.GET("/:id/tracking", m.getTracking)
+	orders.POST("/:id/shipment/cancel", m.cancelShipment)
 	orders.POST("/:id/deliver", m.markDelivered)
+	orders.GET("/:id/shipments", m.listShipments)
+	orders.POST("/:id/shipments", m.createShipment)
+	orders.POST("/:id/shipments/:shipmentId/deliver", m.deliverShipment)
+	orders.POST("/:id/shipments/:shipmentId/cancel", m.cancelShipmentPart)
+	orders.POST("/:id/cancel-remaining", m.cancelRemaining)
 	orders.GET("/:id/timeline", m.getTimeline)
+	orders.POST("/:id/notes", m.addNote)
+	orders.GET("/:id/documents", m.listDocuments)
+	orders.POST("/:id/documents", m.issueDocument)
 }
 
 // OrderResponse is the frontend-expected format for orders
@@ -66,11 +95,15 @@ type OrderResponse struct {
 	Status            string                 `json:"status"`
 	FulfillmentStatus string                 `json:"fulfillmentStatus"`
 	PaymentStatus     string                 `json:"paymentStatus"`
+	PaymentMethod     string                 `json:"paymentMethod,omitempty"`
+	COD               *models.CODInfo        `json:"cod,omitempty"`
 	Items             []OrderItemResponse    `json:"items"`
 	Subtotal          int64                  `json:"subtotal"`
 	DiscountAmount    int64                  `json:"discountAmount"`
+	Promotions        []models.AppliedPromotion `json:"promotions,omitempty"`
 	TaxRate           float64                `json:"taxRate"`
 	TaxAmount         int64                  `json:"taxAmount"`
+	PricesIncludeTax  bool                   `json:"pricesIncludeTax"` // Tax is contained in the amounts rather than added
 	ShippingCost      int64                  `json:"shippingCost"`
 	TotalAmount       int64                  `json:"totalAmount"`
 	PaidAmount        int64                  `json:"paidAmount"`
@@ -78,9 +111,11 @@ type OrderResponse struct {
 	TotalCost         int64                  `json:"totalCost"`
 	GrossProfit       int64                  `json:"grossProfit"`
 	Shipping          *models.ShippingInfo   `json:"shipping,omitempty"`
+	Shipments         []models.Shipment      `json:"shipments,omitempty"` // Orders shipped in parts
 	Recipient         *RecipientResponse     `json:"recipient,omitempty"`
 	CustomerNote      string                 `json:"customerNote,omitempty"`
 	InternalNote      string                 `json:"internalNote,omitempty"`
+	Documents         []models.DocumentRef   `json:"documents,omitempty"`
 	CreatedAt         string                 `json:"createdAt"`
 	UpdatedAt         string                 `json:"updatedAt"`
 }
@@ -107,14 +142,25 @@ type OrderItemResponse struct {
 	LineTotal   int64  `json:"lineTotal"`
 	UnitCost    int64  `json:"unitCost"`
 	LineCost    int64  `json:"lineCost"`
+	TaxClass    string  `json:"taxClass,omitempty"`
+	TaxRate     float64 `json:"taxRate"`
+	TaxAmount   int64   `json:"taxAmount"`
+
+	Promotions []string `json:"promotions,omitempty"` // Why promotions fired on this line
+
+	QtyShipped   int `json:"qtyShipped,omitempty"`   // Orders shipped in parts
+	QtyCancelled int `json:"qtyCancelled,omitempty"` // Dropped before shipping
+
+	QtyBackordered int  `json:"qtyBackordered,omitempty"` // Waiting for stock
+	Preorder       bool `json:"preorder,omitempty"`
 }
 
 func (m *Module) transactionToOrder(txn models.Transaction, branchName string) OrderResponse {
 	items := make([]OrderItemResponse, 0, len(txn.Items))
 	var subtotal int64
 	for i, it := range txn.Items {
-		lineTotal := it.Price * int64(it.Quantity)
-		subtotal += lineTotal
+		subtotal += it.Price * int64(it.Quantity)
+		lineTotal := it.Price*int64(it.Quantity) - it.Discount
 		items = append(items, OrderItemResponse{
 			ID:          it.ID + "-" + string(rune(i)),
 			ProductID:   it.ID,
@@ -123,22 +169,47 @@ func (m *Module) transactionToOrder(txn models.Transaction, branchName string) O
 			Unit:        "pcs",
 			Quantity:    it.Quantity,
 			UnitPrice:   it.Price,
-			Discount:    0,
+			Discount:    it.Discount,
 			LineTotal:   lineTotal,
 			UnitCost:    it.Cost,
 			LineCost:    it.LineCost,
+			TaxClass:    string(it.TaxClass),
+			TaxRate:     it.TaxRate,
+			TaxAmount:   it.TaxAmount,
+			Promotions:  it.Promotions,
+			QtyShipped:   it.QtyShipped,
+			QtyCancelled: it.QtyCancelled,
+			QtyBackordered: it.QtyBackordered,
+			Preorder:       it.Preorder,
 		})
 	}
 
-	paymentStatus := "UNPAID"
-	paidAmount := int64(0)
-	if txn.Status == "COMPLETED" {
-		paymentStatus = "PAID"
-		paidAmount = txn.Total
-	} else if txn.Status == "REFUNDED" {
+	// The payment ledger is authoritative; orders from before it existed fall back to status.
+	paymentStatus := txn.PaymentStatus
+	paidAmount := txn.PaidAmount
+	if paymentStatus == "" {
+		paymentStatus = models.PaymentStatusUnpaid
+		if txn.Status == "COMPLETED" {
+			paymentStatus = models.PaymentStatusPaid
+			paidAmount = txn.Total
+		}
+	}
+	if txn.Status == "REFUNDED" {
 		paymentStatus = "REFUNDED"
 	}
-	dueAmount := txn.Total - paidAmount
+	dueAmount := int64(0)
+	if paidAmount < txn.Total {
+		dueAmount = txn.Total - paidAmount
+	}
+
+	var taxRate float64
+	var taxAmount int64
+	var pricesIncludeTax bool
+	if txn.Tax != nil {
+		taxRate = txn.Tax.Rate
+		taxAmount = txn.Tax.Tax
+		pricesIncludeTax = txn.Tax.PricesIncludeTax
+	}
 
 	// Build recipient from transaction data
 	var recipient *RecipientResponse
@@ -165,21 +236,27 @@ func (m *Module) transactionToOrder(txn models.Transaction, branchName string) O
 		Status:            txn.Status,
 		FulfillmentStatus: txn.FulfillmentStatus,
 		PaymentStatus:     paymentStatus,
+		PaymentMethod:     txn.PaymentMethod,
+		COD:               txn.COD,
 		Items:             items,
 		Subtotal:          subtotal,
-		DiscountAmount:    0,
-		TaxRate:           0, // Default tax rate
-		TaxAmount:         0,
-		ShippingCost:      0,
+		DiscountAmount:    txn.DiscountAmount,
+		Promotions:        txn.Promotions,
+		TaxRate:           taxRate,
+		TaxAmount:         taxAmount,
+		PricesIncludeTax:  pricesIncludeTax,
+		ShippingCost:      txn.ShippingCost,
 		TotalAmount:       txn.Total,
 		PaidAmount:        paidAmount,
 		DueAmount:         dueAmount,
 		TotalCost:         txn.COGS,
 		GrossProfit:       txn.Profit,
 		Shipping:          txn.ShippingInfo,
+		Shipments:         txn.Shipments,
 		Recipient:         recipient,
 		CustomerNote:      "", // Not stored in transaction currently
 		InternalNote:      txn.Note,
+		Documents:         txn.Documents,
 		CreatedAt:         txn.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:         txn.UpdatedAt.Format(time.RFC3339),
 	}
@@ -293,9 +370,11 @@ func (m *Module) deleteOrder(c *gin.Context) {
 		return
 	}
 
-	// Release any reserved stock
+	// Release any reserved stock; backordered units never held any
 	for _, item := range txn.Items {
-		_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, txn.BranchID, item.ID, item.Quantity)
+		if qty := item.Quantity - item.QtyBackordered; qty > 0 {
+			_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, txn.BranchID, item.ID, qty)
+		}
 	}
 
 	err = m.deps.Repo.DeleteTransactionByOrg(c.Request.Context(), orgID, id)
@@ -303,6 +382,7 @@ func (m *Module) deleteOrder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete order"})
 		return
 	}
+	m.recordEvent(c, *u, txn, orderevents.Change{Type: models.OrderEventDeleted, Message: "Order deleted", Before: txn})
 
 	c.JSON(http.StatusOK, gin.H{"data": nil})
 }
@@ -421,6 +501,7 @@ type checkoutRequest struct {
 	PaymentMethod string         `json:"paymentMethod"` // CASH|QR|CARD|...
 	Note          string         `json:"note"`
 	AutoDeliver   bool           `json:"autoDeliver"`
+	CouponCodes   []string       `json:"couponCodes,omitempty"`
 }
 
 func (m *Module) checkout(c *gin.Context) {
@@ -460,6 +541,7 @@ func (m *Module) checkout(c *gin.Context) {
 			SKU:      p.SKU,
 			Name:     p.Name,
 			Category: p.Category,
+			TaxClass: p.TaxClass,
 			Image:    p.Image,
 			Price:    p.Price,
 			Cost:     0,
@@ -480,6 +562,13 @@ func (m *Module) checkout(c *gin.Context) {
 		}
 	}
 
+	promos, ok := m.applyPromotions(c, orgID, branchID, "POS", customerID, req.CouponCodes, items)
+	if !ok {
+		return
+	}
+	// VAT is added on top of the listed prices unless the org quotes VAT-inclusive prices
+	taxSummary, total := tax.Sale(tax.New(m.deps.Repo).Settings(c.Request.Context(), orgID), items, 0, 0, 0)
+
 	orderID := "ORD-" + primitive.NewObjectID().Hex()[18:]
 	now := time.Now().UTC().Format(time.RFC3339)
 	txn := models.Transaction{
@@ -498,46 +587,51 @@ func (m *Module) checkout(c *gin.Context) {
 		RecipientName:     recipientName,
 		RecipientPhone:    recipientPhone,
 		PaymentMethod:     strings.TrimSpace(req.PaymentMethod),
+		PaymentStatus:     models.PaymentStatusPaid,
+		PaidAmount:        total,
 		Note:              strings.TrimSpace(req.Note),
+		DiscountAmount:    promos.Discount,
+		Promotions:        promos.Applied,
+		CouponCodes:       promotions.Codes(promos.Applied),
+		Tax:               taxSummary,
 		StockCommitted:    false,
 		StockCommitInProgress: false,
 	}
 
-	// Reserve stock (do not decrement physical until DELIVERED).
-	reserved := make([]models.TransactionItem, 0, len(items))
-	for _, it := range items {
-		_, _ = m.deps.Repo.AdjustStock(c.Request.Context(), orgID, branchID, it.ID, 0)
-		_, err := m.deps.Repo.ReserveStock(c.Request.Context(), orgID, branchID, it.ID, it.Quantity)
-		if err != nil {
-			// rollback reservations best-effort
-			for _, done := range reserved {
-				_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, branchID, done.ID, done.Quantity)
-			}
-			if errors.Is(err, repo.ErrInsufficientStock) {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock", "productId": it.ID})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reserve stock"})
+	// Reserve stock (do not decrement physical until DELIVERED); lines beyond stock are
+	// backordered where the product allows.
+	lines, undo, productID, err := m.reserveDiff(c.Request.Context(), orgID, branchID, nil, items)
+	if err != nil {
+		m.releasePromotions(c, orgID, customerID, promos.Applied)
+		if errors.Is(err, repo.ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock", "productId": productID})
 			return
 		}
-		reserved = append(reserved, it)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reserve stock"})
+		return
 	}
+	txn.Items = lines
 
 	created, err := m.deps.Repo.CreateTransaction(c.Request.Context(), txn)
 	if err != nil {
-		for _, done := range reserved {
-			_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, branchID, done.ID, done.Quantity)
-		}
+		undo()
+		m.releasePromotions(c, orgID, customerID, promos.Applied)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create transaction"})
 		return
 	}
+	m.recordEvent(c, *u, created, createdChange(created))
+	if p, ok := m.recordTillPayment(c.Request.Context(), created); ok {
+		m.recordEvent(c, *u, created, paymentChange(p))
+	}
 
-	if req.AutoDeliver {
-		updated, err := m.commitSaleDelivered(c, orgID, created, "", "")
+	// Backordered goods cannot be handed over yet; the sale is delivered once they are allocated
+	if req.AutoDeliver && backordered(created) == 0 {
+		updated, err := m.commitSaleDelivered(c.Request.Context(), orgID, created, "", "")
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		m.recordEvent(c, *u, updated, deliveredChange(created, updated))
 		c.JSON(http.StatusOK, gin.H{"data": updated})
 		return
 	}
@@ -578,11 +672,12 @@ func (m *Module) updateFulfillment(c *gin.Context) {
 	}
 
 	if status == "DELIVERED" && strings.ToUpper(txn.Type) == "SALE" {
-		updated, err := m.commitSaleDelivered(c, orgID, txn, req.Carrier, req.TrackingNumber)
+		updated, err := m.commitSaleDelivered(c.Request.Context(), orgID, txn, req.Carrier, req.TrackingNumber)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		m.recordEvent(c, *u, updated, deliveredChange(txn, updated))
 		c.JSON(http.StatusOK, gin.H{"data": updated})
 		return
 	}
@@ -618,10 +713,11 @@ func (m *Module) updateFulfillment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
 		return
 	}
+	m.recordEvent(c, *u, updated, fulfillmentChange(txn, updated))
 	c.JSON(http.StatusOK, gin.H{"data": updated})
 }
 
-func (m *Module) commitSaleDelivered(c *gin.Context, orgID string, txn models.Transaction, carrier, trackingNumber string) (models.Transaction, error) {
+func (m *Module) commitSaleDelivered(ctx context.Context, orgID string, txn models.Transaction, carrier, trackingNumber string) (models.Transaction, error) {
 	// Idempotency: if already committed, just update fulfillment status + shipping info.
 	if txn.StockCommitted {
 		patch := bson.M{"fulfillmentStatus": "DELIVERED"}
@@ -639,13 +735,19 @@ func (m *Module) commitSaleDelivered(c *gin.Context, orgID string, txn models.Tr
 			shipping.DeliveredDate = time.Now().UTC().Format(time.RFC3339)
 			patch["shippingInfo"] = shipping
 		}
-		return m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, txn.ID, patch)
+		return m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, patch)
+	}
+	if len(txn.Shipments) > 0 {
+		return models.Transaction{}, errShipsInParts
+	}
+	if backordered(txn) > 0 {
+		return models.Transaction{}, errAwaitingStock
 	}
 
-	locked, err := m.deps.Repo.LockTransactionForStockCommit(c.Request.Context(), orgID, txn.ID)
+	locked, err := m.deps.Repo.LockTransactionForStockCommit(ctx, orgID, txn.ID)
 	if err != nil {
 		if errors.Is(err, repo.ErrConflict) {
-			current, getErr := m.deps.Repo.GetTransactionByOrg(c.Request.Context(), orgID, txn.ID)
+			current, getErr := m.deps.Repo.GetTransactionByOrg(ctx, orgID, txn.ID)
 			if getErr == nil && current.StockCommitted {
 				return current, nil
 			}
@@ -658,27 +760,28 @@ func (m *Module) commitSaleDelivered(c *gin.Context, orgID string, txn models.Tr
 	type committedItem struct {
 		productID string
 		qty       int
+		newQty    int
 	}
 	committed := make([]committedItem, 0, len(txn.Items))
 	rollbackStock := func() {
 		for _, it := range committed {
-			_ = m.deps.Repo.UncommitReservedStock(c.Request.Context(), orgID, txn.BranchID, it.productID, it.qty)
+			_ = m.deps.Repo.UncommitReservedStock(ctx, orgID, txn.BranchID, it.productID, it.qty)
 		}
 	}
 
 	// Commit physical stock (decrement quantity and reserved).
 	for _, it := range txn.Items {
 		if it.Quantity <= 0 {
-			_ = m.deps.Repo.UnlockTransactionStockCommit(c.Request.Context(), orgID, txn.ID)
+			_ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID)
 			return models.Transaction{}, errors.New("invalid transaction items")
 		}
-		_, err := m.deps.Repo.CommitReservedStock(c.Request.Context(), orgID, txn.BranchID, it.ID, it.Quantity)
+		level, err := m.deps.Repo.CommitReservedStock(ctx, orgID, txn.BranchID, it.ID, it.Quantity)
 		if err != nil {
 			rollbackStock()
-			_ = m.deps.Repo.UnlockTransactionStockCommit(c.Request.Context(), orgID, txn.ID)
+			_ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID)
 			return models.Transaction{}, errors.New("failed to commit stock")
 		}
-		committed = append(committed, committedItem{productID: it.ID, qty: it.Quantity})
+		committed = append(committed, committedItem{productID: it.ID, qty: it.Quantity, newQty: level.Quantity})
 	}
 
 	// Compute COGS per item based on product's costing method.
@@ -689,18 +792,18 @@ func (m *Module) commitSaleDelivered(c *gin.Context, orgID string, txn models.Tr
 
 	for _, it := range txn.Items {
 		// Get product to check costing method
-		product, perr := m.deps.Repo.GetProductByOrg(c.Request.Context(), orgID, it.ID)
+		product, perr := m.deps.Repo.GetProductByOrg(ctx, orgID, it.ID)
 		if perr != nil {
 			rollbackStock()
-			_ = m.deps.Repo.UnlockTransactionStockCommit(c.Request.Context(), orgID, txn.ID)
+			_ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID)
 			return models.Transaction{}, errors.New("failed to get product for COGS calculation")
 		}
 
 		// Use costing service to compute COGS based on product's method
-		result, err := costingSvc.ComputeCOGS(c.Request.Context(), orgID, txn.BranchID, product, it.Quantity)
+		result, err := costingSvc.ComputeCOGS(ctx, orgID, txn.BranchID, product, it.Quantity)
 		if err != nil && errors.Is(err, repo.ErrInsufficientLots) {
 			// Fallback for FIFO: create an adjustment lot using the product's last purchase cost.
-			_, _ = m.deps.Repo.CreateInventoryLot(c.Request.Context(), models.InventoryLot{
+			_, _ = m.deps.Repo.CreateInventoryLot(ctx, models.InventoryLot{
 				ID:           primitive.NewObjectID().Hex(),
 				OrgID:        orgID,
 				BranchID:     txn.BranchID,
@@ -711,20 +814,20 @@ func (m *Module) commitSaleDelivered(c *gin.Context, orgID string, txn models.Tr
 				QtyRemaining: it.Quantity,
 				ReceivedAt:   time.Now().UTC(),
 			})
-			result, err = costingSvc.ComputeCOGS(c.Request.Context(), orgID, txn.BranchID, product, it.Quantity)
+			result, err = costingSvc.ComputeCOGS(ctx, orgID, txn.BranchID, product, it.Quantity)
 		}
 		if err != nil {
 			// Rollback lots + stock best-effort.
 			for _, l := range allLines {
-				_ = m.deps.Repo.IncrementLotRemaining(c.Request.Context(), l.LotID, l.Quantity)
+				_ = m.deps.Repo.IncrementLotRemaining(ctx, l.LotID, l.Quantity)
 			}
 			rollbackStock()
-			_ = m.deps.Repo.UnlockTransactionStockCommit(c.Request.Context(), orgID, txn.ID)
+			_ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID)
 			return models.Transaction{}, err
 		}
 
 		// Update product total quantity for moving average tracking
-		_ = costingSvc.UpdateMovingAverageOnSale(c.Request.Context(), orgID, it.ID, it.Quantity)
+		_ = costingSvc.UpdateMovingAverageOnSale(ctx, orgID, it.ID, it.Quantity)
 
 		allLines = append(allLines, result.CostLines...)
 		itemCost[it.ID] += result.TotalCOGS
@@ -768,22 +871,47 @@ func (m *Module) commitSaleDelivered(c *gin.Context, orgID string, txn models.Tr
 		patch["shippingInfo"] = shipping
 	}
 
-	updated, err := m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, txn.ID, patch)
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, patch)
 	if err != nil {
 		// Best-effort rollback.
 		for _, l := range allLines {
-			_ = m.deps.Repo.IncrementLotRemaining(c.Request.Context(), l.LotID, l.Quantity)
+			_ = m.deps.Repo.IncrementLotRemaining(ctx, l.LotID, l.Quantity)
 		}
 		rollbackStock()
-		_ = m.deps.Repo.UnlockTransactionStockCommit(c.Request.Context(), orgID, txn.ID)
+		_ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID)
 		return models.Transaction{}, err
 	}
 
+	// Record the sale on each product's stock card.
+	for i, it := range updatedItems {
+		m.deps.Repo.CreateStockMovement(ctx, models.StockMovement{
+			ID:               "MV-" + primitive.NewObjectID().Hex(),
+			OrgID:            orgID,
+			BranchID:         updated.BranchID,
+			ProductID:        it.ID,
+			Type:             "SALE_OUT",
+			Quantity:         it.Quantity,
+			PreviousQuantity: committed[i].newQty + it.Quantity,
+			NewQuantity:      committed[i].newQty,
+			UnitCost:         it.Cost,
+			TotalCost:        it.LineCost,
+			ReferenceType:    "ORDER",
+			ReferenceID:      updated.ID,
+			ReferenceNumber:  updated.ID,
+			CreatedBy:        updated.UserID,
+		})
+	}
+
+	// Consigned goods sold become a payable to their consignor.
+	if _, err := consignment.New(m.deps.Repo).RecordSale(ctx, orgID, updated, allLines); err != nil {
+		log.Printf("orders: consignor payables for %s: %v", updated.ID, err)
+	}
+
 	// Update customer points/total spent at delivery time (so cancelled orders don't earn points).
 	if strings.TrimSpace(updated.CustomerID) != "" {
 		pointsEarned := int(updated.Total / 100)
 		_, _ = m.deps.Mongo.Collection(repo.ColCustomers).UpdateOne(
-			c.Request.Context(),
+			ctx,
 			bson.M{"_id": updated.CustomerID, "orgId": orgID},
 			bson.M{"$inc": bson.M{"points": pointsEarned, "totalSpent": updated.Total}},
 		)
@@ -826,13 +954,21 @@ func (m *Module) bulkStatus(c *gin.Context) {
 			if strings.ToUpper(txn.Type) != "SALE" {
 				continue
 			}
-			if _, err := m.commitSaleDelivered(c, orgID, txn, "", ""); err == nil {
+			if updated, err := m.commitSaleDelivered(c.Request.Context(), orgID, txn, "", ""); err == nil {
+				m.recordEvent(c, *u, updated, deliveredChange(txn, updated))
 				updatedCount++
 			}
 		}
 		c.JSON(http.StatusOK, gin.H{"updated": updatedCount})
 		return
 	}
+	// Read the orders first so each one's history says what it moved from
+	before := make([]models.Transaction, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		if txn, err := m.deps.Repo.GetTransactionByOrg(c.Request.Context(), orgID, id); err == nil && txn.FulfillmentStatus != status {
+			before = append(before, txn)
+		}
+	}
 	modified, err := m.deps.Repo.BulkUpdateTransactionsByOrg(c.Request.Context(), orgID, req.IDs, bson.M{
 		"fulfillmentStatus": status,
 	})
@@ -840,6 +976,13 @@ func (m *Module) bulkStatus(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update orders"})
 		return
 	}
+	for _, txn := range before {
+		after := txn
+		after.FulfillmentStatus = status
+		ch := fulfillmentChange(txn, after)
+		ch.Payload["bulk"] = true
+		m.recordEvent(c, *u, after, ch)
+	}
 	c.JSON(http.StatusOK, gin.H{"updated": modified})
 }
 
@@ -868,6 +1011,22 @@ func (m *Module) cancel(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
 		return
 	}
+	// Cancelling again would release or restock the order's stock a second time
+	if txn.Status == "CANCELLED" || txn.Status == "REFUNDED" {
+		c.JSON(http.StatusOK, gin.H{"data": txn})
+		return
+	}
+	// Orders still holding reservations are locked, so a backorder allocation or an edit
+	// cannot reserve for them while they are cancelled
+	unlock := func() {}
+	if !txn.StockCommitted {
+		txn, err = m.deps.Repo.LockTransactionForStockCommit(c.Request.Context(), orgID, id)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "order is being updated; try again"})
+			return
+		}
+		unlock = func() { _ = m.deps.Repo.UnlockTransactionStockCommit(c.Request.Context(), orgID, id) }
+	}
 
 	wasShipped := txn.FulfillmentStatus == "SHIPPED" || txn.FulfillmentStatus == "DELIVERED"
 	newFulfillmentStatus := "CANCELLED"
@@ -879,30 +1038,67 @@ func (m *Module) cancel(c *gin.Context) {
 		newFinancialStatus = "REFUNDED"
 	}
 
-	updated, err := m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, id, bson.M{
+	if liveShipments(txn) {
+		unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": "order ships in parts; cancel the remainder and return what was delivered"})
+		return
+	}
+
+	// Only the cancel that moves the order out of a live status touches its stock
+	updated, err := m.deps.Repo.CancelTransactionByOrg(c.Request.Context(), orgID, id, bson.M{
 		"status":             newFinancialStatus,
 		"fulfillmentStatus":  newFulfillmentStatus,
 		"cancellationReason": strings.TrimSpace(req.Reason),
 		"stockCommitInProgress": false,
 	})
 	if err != nil {
+		unlock()
 		if err == repo.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
 			return
 		}
+		if err == repo.ErrConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "order is already cancelled"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel order"})
 		return
 	}
+	m.releasePromotions(c, orgID, updated.CustomerID, updated.Promotions)
+	msg := "Order cancelled"
+	if updated.CancellationReason != "" {
+		msg += ": " + updated.CancellationReason
+	}
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventCancelled,
+		Message: msg,
+		Payload: map[string]interface{}{"reason": updated.CancellationReason, "restock": req.Restock, "fulfillmentStatus": newFulfillmentStatus},
+		Before:  txn,
+		After:   updated,
+	})
 
 	if updated.StockCommitted {
+		// Restocked consigned goods go back to the consignor's lots and their unpaid payables are voided.
+		restored, err := consignment.New(m.deps.Repo).ReverseSale(c.Request.Context(), orgID, updated, req.Restock)
+		if err != nil {
+			// Only the consigned goods already back in their lots are restocked; the rest is
+			// left for a stock adjustment rather than being booked as owned stock.
+			log.Printf("orders: reverse consignor payables for %s: %v", updated.ID, err)
+			for productID, r := range restored {
+				m.restock(c.Request.Context(), orgID, updated, productID, r.Quantity, r.Cost, u.ID)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order cancelled but restocking failed", "data": updated})
+			return
+		}
 		if req.Restock {
 			// Restock physical inventory and create return lots so FIFO remains consistent.
 			for _, item := range updated.Items {
-				_, _ = m.deps.Repo.AdjustStock(c.Request.Context(), orgID, updated.BranchID, item.ID, item.Quantity)
-				unitCost := int64(0)
-				if item.Quantity > 0 {
-					unitCost = item.LineCost / int64(item.Quantity)
+				m.restock(c.Request.Context(), orgID, updated, item.ID, item.Quantity, item.LineCost, u.ID)
+				ownedQty := item.Quantity - restored[item.ID].Quantity
+				if ownedQty <= 0 {
+					continue
 				}
+				unitCost := (item.LineCost - restored[item.ID].Cost) / int64(ownedQty)
 				_, _ = m.deps.Repo.CreateInventoryLot(c.Request.Context(), models.InventoryLot{
 					ID:           primitive.NewObjectID().Hex(),
 					OrgID:        orgID,
@@ -910,22 +1106,55 @@ func (m *Module) cancel(c *gin.Context) {
 					ProductID:    item.ID,
 					Source:       "RETURN",
 					UnitCost:     unitCost,
-					QtyReceived:  item.Quantity,
-					QtyRemaining: item.Quantity,
+					QtyReceived:  ownedQty,
+					QtyRemaining: ownedQty,
 					ReceivedAt:   time.Now().UTC(),
 				})
 			}
 		}
-	} else {
-		// Order not delivered yet: always release reservations.
+	} else if txn.Status != "DRAFT" {
+		// Order not delivered yet: release its reservations. Drafts never reserved stock.
 		for _, item := range updated.Items {
-			_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, updated.BranchID, item.ID, item.Quantity)
+			if qty := item.Quantity - item.QtyCancelled - item.QtyBackordered; qty > 0 {
+				_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, updated.BranchID, item.ID, qty)
+			}
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": updated})
 }
 
+// restock puts goods of a cancelled sale back on hand and records the movement for the
+// stock card
+func (m *Module) restock(ctx context.Context, orgID string, txn models.Transaction, productID string, qty int, cost int64, userID string) {
+	level, err := m.deps.Repo.AdjustStock(ctx, orgID, txn.BranchID, productID, qty)
+	if err != nil {
+		log.Printf("orders: restock %s for %s: %v", productID, txn.ID, err)
+		return
+	}
+	var unitCost int64
+	if qty > 0 {
+		unitCost = cost / int64(qty)
+	}
+	m.deps.Repo.CreateStockMovement(ctx, models.StockMovement{
+		ID:               "MV-" + primitive.NewObjectID().Hex(),
+		OrgID:            orgID,
+		BranchID:         txn.BranchID,
+		ProductID:        productID,
+		Type:             "RETURN_IN",
+		Quantity:         qty,
+		PreviousQuantity: level.Quantity - qty,
+		NewQuantity:      level.Quantity,
+		UnitCost:         unitCost,
+		TotalCost:        cost,
+		ReferenceType:    "ORDER",
+		ReferenceID:      txn.ID,
+		ReferenceNumber:  txn.ID,
+		Reason:           "order cancelled",
+		CreatedBy:        userID,
+	})
+}
+
 // --- New Order Creation Endpoints ---
 
 type createOrderItem struct {
@@ -958,7 +1187,11 @@ type createOrderRequest struct {
 		Province   string `json:"province,omitempty"`
 		PostalCode string `json:"postalCode,omitempty"`
 	} `json:"recipient,omitempty"`
-	SaveAsDraft bool `json:"saveAsDraft,omitempty"`
+	SaveAsDraft bool     `json:"saveAsDraft,omitempty"`
+	CouponCodes []string `json:"couponCodes,omitempty"`
+
+	PaymentMethod string `json:"paymentMethod,omitempty"` // COD has the courier collect on delivery
+	CODAmount     int64  `json:"codAmount,omitempty"`     // Cash to collect; defaults to the order total
 }
 
 func (m *Module) createOrder(c *gin.Context) {
@@ -992,7 +1225,6 @@ func (m *Module) createOrder(c *gin.Context) {
 
 	// Build transaction items with custom prices
 	items := make([]models.TransactionItem, 0, len(req.Items))
-	var subtotal int64
 	for _, it := range req.Items {
 		if it.Quantity <= 0 || strings.TrimSpace(it.ProductID) == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid items"})
@@ -1010,35 +1242,54 @@ func (m *Module) createOrder(c *gin.Context) {
 			unitPrice = p.Price
 		}
 
-		lineTotal := unitPrice*int64(it.Quantity) - it.Discount
-		subtotal += lineTotal
-
 		items = append(items, models.TransactionItem{
 			ID:       p.ID,
 			SKU:      p.SKU,
 			Name:     p.Name,
 			Category: p.Category,
+			TaxClass: p.TaxClass,
 			Image:    p.Image,
 			Price:    unitPrice,
 			Cost:     0,
 			LineCost: 0,
 			Quantity: it.Quantity,
+			Discount: it.Discount,
 		})
 	}
 
-	// Calculate totals (TaxRate is stored as percentage, e.g., 7 for 7%)
-	taxAmount := int64(float64(subtotal-req.DiscountAmount) * (req.TaxRate / 100))
-	total := subtotal - req.DiscountAmount + taxAmount + req.ShippingCost
-
-	// Generate order ID
-	orderID := "ORD-" + primitive.NewObjectID().Hex()[18:]
+	// Set channel
+	channel := strings.ToUpper(strings.TrimSpace(req.Channel))
+	if channel == "" {
+		channel = "WEB"
+	}
 
-	// Set dates
-	now := time.Now().UTC()
-	orderDate := now.Format(time.RFC3339)
+	// Stored as RFC3339 UTC so orders sort by date, as backorders are served
+	orderDate := time.Now().UTC().Format(time.RFC3339)
 	if req.OrderDate != "" {
-		orderDate = req.OrderDate
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(req.OrderDate))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "orderDate must be RFC3339"})
+			return
+		}
+		orderDate = t.UTC().Format(time.RFC3339)
+	}
+
+	// Promotions apply after manual line discounts and before the order discount
+	var lineDiscounts int64
+	for _, it := range items {
+		lineDiscounts += it.Discount
 	}
+	promos, ok := m.applyPromotions(c, orgID, branchID, channel, strings.TrimSpace(req.CustomerID), req.CouponCodes, items)
+	if !ok {
+		return
+	}
+
+	// Tax each line after all discounts; req.TaxRate only applies to orgs without tax settings
+	settings := tax.New(m.deps.Repo).Settings(c.Request.Context(), orgID)
+	taxSummary, total := tax.Sale(settings, items, req.DiscountAmount, req.ShippingCost, req.TaxRate)
+
+	// Generate order ID
+	orderID := "ORD-" + primitive.NewObjectID().Hex()[18:]
 
 	// Determine status
 	status := "PENDING"
@@ -1070,12 +1321,6 @@ func (m *Module) createOrder(c *gin.Context) {
 		}
 	}
 
-	// Set channel
-	channel := strings.ToUpper(strings.TrimSpace(req.Channel))
-	if channel == "" {
-		channel = "WEB"
-	}
-
 	txn := models.Transaction{
 		ID:                    orderID,
 		OrgID:                 orgID,
@@ -1093,43 +1338,44 @@ func (m *Module) createOrder(c *gin.Context) {
 		RecipientPhone:        recipientPhone,
 		RecipientAddress:      recipientAddress,
 		Note:                  strings.TrimSpace(req.InternalNote),
+		DiscountAmount:        lineDiscounts + promos.Discount + req.DiscountAmount,
+		Promotions:            promos.Applied,
+		CouponCodes:           promotions.Codes(promos.Applied),
+		ShippingCost:          req.ShippingCost,
+		Tax:                   taxSummary,
 		StockCommitted:        false,
 		StockCommitInProgress: false,
 	}
+	if method := strings.ToUpper(strings.TrimSpace(req.PaymentMethod)); method != "" {
+		txn.PaymentMethod = method
+		txn.COD = codFor(method, req.CODAmount, total)
+	}
 
-	// Reserve stock for non-draft orders
+	// Reserve stock for non-draft orders; lines beyond stock are backordered where the product allows
+	undo := func() {}
 	if status != "DRAFT" {
-		reserved := make([]models.TransactionItem, 0, len(items))
-		for _, it := range items {
-			_, _ = m.deps.Repo.AdjustStock(c.Request.Context(), orgID, branchID, it.ID, 0)
-			_, err := m.deps.Repo.ReserveStock(c.Request.Context(), orgID, branchID, it.ID, it.Quantity)
-			if err != nil {
-				// Rollback reservations
-				for _, done := range reserved {
-					_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, branchID, done.ID, done.Quantity)
-				}
-				if errors.Is(err, repo.ErrInsufficientStock) {
-					c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock", "productId": it.ID})
-					return
-				}
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reserve stock"})
+		lines, release, productID, err := m.reserveDiff(c.Request.Context(), orgID, branchID, nil, items)
+		if err != nil {
+			m.releasePromotions(c, orgID, strings.TrimSpace(req.CustomerID), promos.Applied)
+			if errors.Is(err, repo.ErrInsufficientStock) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock", "productId": productID})
 				return
 			}
-			reserved = append(reserved, it)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reserve stock"})
+			return
 		}
+		txn.Items, undo = lines, release
 	}
 
 	created, err := m.deps.Repo.CreateTransaction(c.Request.Context(), txn)
 	if err != nil {
 		// Release reservations on failure
-		if status != "DRAFT" {
-			for _, it := range items {
-				_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, branchID, it.ID, it.Quantity)
-			}
-		}
+		undo()
+		m.releasePromotions(c, orgID, strings.TrimSpace(req.CustomerID), promos.Applied)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create order"})
 		return
 	}
+	m.recordEvent(c, *u, created, createdChange(created))
 
 	// Get branch name for response
 	branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
@@ -1144,6 +1390,13 @@ func (m *Module) createOrder(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"data": m.transactionToOrder(created, branchName)})
 }
 
+// updateOrderRequest is an order edit. Amounts left out keep the order's current value.
+type updateOrderRequest struct {
+	createOrderRequest
+	DiscountAmount *int64 `json:"discountAmount"`
+	ShippingCost   *int64 `json:"shippingCost"`
+}
+
 func (m *Module) updateOrder(c *gin.Context) {
 	u := auth.CurrentUser(c)
 	orgID := auth.GetOrgIDForRequest(c, u)
@@ -1158,40 +1411,69 @@ func (m *Module) updateOrder(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
 		return
 	}
-
-	// Only allow updating draft or pending orders
-	if txn.Status != "DRAFT" && txn.Status != "PENDING" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "can only update draft or pending orders"})
+	if txn.StockCommitted {
+		c.JSON(http.StatusConflict, gin.H{"error": "stock for this order has already been taken; use a return or exchange instead"})
 		return
 	}
 
-	var req createOrderRequest
+	var req updateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
 		return
 	}
 
+	// The edit works from the order as locked, so a delivery, shipment or another edit
+	// cannot commit or diff the same lines meanwhile
+	ctx := c.Request.Context()
+	txn, err = m.deps.Repo.LockTransactionForStockCommit(ctx, orgID, id)
+	if err != nil {
+		if errors.Is(err, repo.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "order is being updated; try again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+		return
+	}
+	unlock := func() { _ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, id) }
+
+	// Lines can change until the stock they hold leaves the shelf
+	if txn.Status != "DRAFT" && txn.Status != "PENDING" && txn.Status != "CONFIRMED" {
+		unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "can only update draft, pending or confirmed orders"})
+		return
+	}
+
 	patch := bson.M{}
+	items := txn.Items
+	changes := make([]LineChange, 0)
+	dropped := make([]promotions.Rejection, 0)
+	restorePromotions := func() {}
 
 	// Update items if provided
 	if len(req.Items) > 0 {
-		// Release old reservations if status is not DRAFT
-		if txn.Status != "DRAFT" {
-			for _, item := range txn.Items {
-				_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, txn.BranchID, item.ID, item.Quantity)
-			}
+		switch {
+		case txn.FulfillmentStatus == "SHIPPED" || txn.FulfillmentStatus == "DELIVERED" || txn.FulfillmentStatus == "RETURNED":
+			unlock()
+			c.JSON(http.StatusConflict, gin.H{"error": "order has already shipped; use a return or exchange instead"})
+			return
+		case len(txn.Shipments) > 0:
+			unlock()
+			c.JSON(http.StatusConflict, gin.H{"error": "order ships in parts; cancel the remainder instead"})
+			return
 		}
 
 		// Build new items
-		items := make([]models.TransactionItem, 0, len(req.Items))
-		var subtotal int64
+		items = make([]models.TransactionItem, 0, len(req.Items))
+		var lineDiscounts int64
 		for _, it := range req.Items {
 			if it.Quantity <= 0 || strings.TrimSpace(it.ProductID) == "" {
+				unlock()
 				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid items"})
 				return
 			}
-			p, perr := m.deps.Repo.GetProductByOrg(c.Request.Context(), orgID, strings.TrimSpace(it.ProductID))
+			p, perr := m.deps.Repo.GetProductByOrg(ctx, orgID, strings.TrimSpace(it.ProductID))
 			if perr != nil {
+				unlock()
 				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid productId: " + it.ProductID})
 				return
 			}
@@ -1201,49 +1483,85 @@ func (m *Module) updateOrder(c *gin.Context) {
 				unitPrice = p.Price
 			}
 
-			lineTotal := unitPrice*int64(it.Quantity) - it.Discount
-			subtotal += lineTotal
-
 			items = append(items, models.TransactionItem{
 				ID:       p.ID,
 				SKU:      p.SKU,
 				Name:     p.Name,
 				Category: p.Category,
+				TaxClass: p.TaxClass,
 				Image:    p.Image,
 				Price:    unitPrice,
 				Cost:     0,
 				LineCost: 0,
 				Quantity: it.Quantity,
+				Discount: it.Discount,
 			})
+			lineDiscounts += it.Discount
 		}
+		changes = diffLines(txn.Items, items)
 
-		// Reserve new stock if not draft
-		if txn.Status != "DRAFT" {
-			reserved := make([]models.TransactionItem, 0, len(items))
-			for _, it := range items {
-				_, _ = m.deps.Repo.AdjustStock(c.Request.Context(), orgID, txn.BranchID, it.ID, 0)
-				_, rerr := m.deps.Repo.ReserveStock(c.Request.Context(), orgID, txn.BranchID, it.ID, it.Quantity)
-				if rerr != nil {
-					for _, done := range reserved {
-						_, _ = m.deps.Repo.ReleaseReservedStock(c.Request.Context(), orgID, txn.BranchID, done.ID, done.Quantity)
-					}
-					if errors.Is(rerr, repo.ErrInsufficientStock) {
-						c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock", "productId": it.ID})
-						return
-					}
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reserve stock"})
-					return
-				}
-				reserved = append(reserved, it)
-			}
+		// Promotions are worked out again for the new lines
+		channel, customerID, codes := txn.Channel, txn.CustomerID, txn.CouponCodes
+		if req.Channel != "" {
+			channel = strings.ToUpper(req.Channel)
+		}
+		if req.CustomerID != "" {
+			customerID = req.CustomerID
+		}
+		if req.CouponCodes != nil {
+			codes = req.CouponCodes
+		}
+		promos, rejected, ok := m.reapplyPromotions(c, orgID, txn, channel, customerID, codes, items)
+		if !ok {
+			unlock()
+			return
+		}
+		dropped = rejected
+		restorePromotions = func() {
+			m.releasePromotions(c, orgID, customerID, promos.Applied)
+			m.redeemPromotions(c, orgID, txn.CustomerID, txn.Promotions)
 		}
 
-		// TaxRate is stored as percentage, e.g., 7 for 7%
-		taxAmount := int64(float64(subtotal-req.DiscountAmount) * (req.TaxRate / 100))
-		total := subtotal - req.DiscountAmount + taxAmount + req.ShippingCost
+		orderDiscount, shipping := keptOrderDiscount(txn), txn.ShippingCost
+		if req.DiscountAmount != nil {
+			orderDiscount = *req.DiscountAmount
+		}
+		if req.ShippingCost != nil {
+			shipping = *req.ShippingCost
+			patch["shippingCost"] = shipping
+		}
+		settings := tax.New(m.deps.Repo).Settings(ctx, orgID)
+		taxSummary, total := tax.Sale(settings, items, orderDiscount, shipping, req.TaxRate)
 
 		patch["items"] = items
 		patch["total"] = total
+		patch["discountAmount"] = lineDiscounts + promos.Discount + orderDiscount
+		patch["promotions"] = promos.Applied
+		patch["couponCodes"] = promotions.Codes(promos.Applied)
+		patch["tax"] = taxSummary
+		if txn.COD != nil && strings.TrimSpace(req.PaymentMethod) == "" {
+			patch["cod"] = codFor(models.PaymentMethodCOD, req.CODAmount, total)
+		}
+		if txn.PaidAmount > 0 {
+			patch["paymentStatus"] = models.PaymentStatusFor(total, txn.PaidAmount)
+		}
+
+		// A pick list or packed parcel no longer matches the order; it goes back to be picked again
+		if len(changes) > 0 && (txn.FulfillmentStatus == "PICKING" || txn.FulfillmentStatus == "PACKED") {
+			patch["fulfillmentStatus"] = "PENDING"
+			patch["pickListId"] = ""
+			patch["pickedDate"] = ""
+			patch["packedDate"] = ""
+			patch["packedBy"] = ""
+		}
+	}
+	if method := strings.ToUpper(strings.TrimSpace(req.PaymentMethod)); method != "" {
+		total := txn.Total
+		if t, ok := patch["total"].(int64); ok {
+			total = t
+		}
+		patch["paymentMethod"] = method
+		patch["cod"] = codFor(method, req.CODAmount, total)
 	}
 
 	// Update other fields if provided
@@ -1264,27 +1582,61 @@ func (m *Module) updateOrder(c *gin.Context) {
 	}
 
 	// Handle status change from DRAFT to PENDING
-	if txn.Status == "DRAFT" && !req.SaveAsDraft {
+	submit := txn.Status == "DRAFT" && !req.SaveAsDraft
+	if submit {
 		patch["status"] = "PENDING"
-		// Reserve stock when submitting draft
-		for _, it := range txn.Items {
-			_, _ = m.deps.Repo.AdjustStock(c.Request.Context(), orgID, txn.BranchID, it.ID, 0)
-			_, _ = m.deps.Repo.ReserveStock(c.Request.Context(), orgID, txn.BranchID, it.ID, it.Quantity)
-		}
 	}
 
 	if len(patch) == 0 {
+		unlock()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
 		return
 	}
 
-	updated, err := m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, id, patch)
+	// A draft holds no stock; any other order holds its lines. Only the difference moves.
+	var held, want []models.TransactionItem
+	if txn.Status != "DRAFT" {
+		held = txn.Items
+	}
+	if txn.Status != "DRAFT" || submit {
+		want = items
+	}
+	lines, undo, productID, err := m.reserveDiff(ctx, orgID, txn.BranchID, held, want)
+	if err != nil {
+		restorePromotions()
+		unlock()
+		if errors.Is(err, repo.ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock", "productId": productID})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reserve stock"})
+		return
+	}
+
+	if _, edited := patch["items"]; want != nil && (edited || submit) {
+		patch["items"] = lines // With the units left waiting for stock
+	}
+	patch["stockCommitInProgress"] = false
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, id, patch)
 	if err != nil {
+		undo()
+		restorePromotions()
+		unlock()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
 		return
 	}
+	delete(patch, "stockCommitInProgress")
+	ch := updatedChange(txn, updated, patch)
+	if len(changes) > 0 {
+		ch.Payload["lines"] = changes
+		ch.Payload["totalBefore"] = txn.Total
+	}
+	if len(dropped) > 0 {
+		ch.Payload["droppedCoupons"] = dropped
+	}
+	m.recordEvent(c, *u, updated, ch)
 
-	branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
+	branches, _ := m.deps.Repo.ListBranchesByOrg(ctx, orgID)
 	branchName := ""
 	for _, b := range branches {
 		if b.ID == updated.BranchID {
@@ -1293,7 +1645,7 @@ func (m *Module) updateOrder(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": m.transactionToOrder(updated, branchName)})
+	c.JSON(http.StatusOK, gin.H{"data": m.transactionToOrder(updated, branchName), "meta": gin.H{"lines": changes, "droppedCoupons": dropped}})
 }
 
 type quickAddRequest struct {
@@ -1363,16 +1715,16 @@ func (m *Module) quickAdd(c *gin.Context) {
 			SKU:      p.SKU,
 			Name:     p.Name,
 			Category: p.Category,
+			TaxClass: p.TaxClass,
 			Image:    p.Image,
 			Price:    unitPrice,
 			Cost:     0,
 			LineCost: 0,
 			Quantity: it.Quantity,
 		})
-		total += unitPrice * int64(it.Quantity)
 	}
 
-	total -= req.DiscountAmount
+	taxSummary, total := tax.Sale(tax.New(m.deps.Repo).Settings(c.Request.Context(), orgID), items, req.DiscountAmount, 0, 0)
 
 	recipientName := "Walk-in Customer"
 	if req.CustomerName != "" {
@@ -1402,7 +1754,11 @@ func (m *Module) quickAdd(c *gin.Context) {
 		RecipientName:         recipientName,
 		RecipientPhone:        "",
 		PaymentMethod:         strings.TrimSpace(req.PaymentMethod),
+		PaymentStatus:         models.PaymentStatusPaid,
+		PaidAmount:            total,
 		Note:                  "",
+		DiscountAmount:        req.DiscountAmount,
+		Tax:                   taxSummary,
 		StockCommitted:        false,
 		StockCommitInProgress: false,
 	}
@@ -1434,13 +1790,18 @@ func (m *Module) quickAdd(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create transaction"})
 		return
 	}
+	m.recordEvent(c, *u, created, createdChange(created))
+	if p, ok := m.recordTillPayment(c.Request.Context(), created); ok {
+		m.recordEvent(c, *u, created, paymentChange(p))
+	}
 
 	// Auto-deliver for quick add
-	updated, err := m.commitSaleDelivered(c, orgID, created, "", "")
+	updated, err := m.commitSaleDelivered(c.Request.Context(), orgID, created, "", "")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	m.recordEvent(c, *u, updated, deliveredChange(created, updated))
 
 	branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
 	branchName := ""
@@ -1483,30 +1844,37 @@ func (m *Module) confirm(c *gin.Context) {
 		return
 	}
 
+	patch := bson.M{
+		"status":            "CONFIRMED",
+		"fulfillmentStatus": "PROCESSING",
+	}
+
 	// If draft, reserve stock first
+	undo := func() {}
 	if txn.Status == "DRAFT" {
-		for _, it := range txn.Items {
-			_, _ = m.deps.Repo.AdjustStock(c.Request.Context(), orgID, txn.BranchID, it.ID, 0)
-			_, err := m.deps.Repo.ReserveStock(c.Request.Context(), orgID, txn.BranchID, it.ID, it.Quantity)
-			if err != nil {
-				if errors.Is(err, repo.ErrInsufficientStock) {
-					c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock", "productId": it.ID})
-					return
-				}
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reserve stock"})
+		lines, release, productID, err := m.reserveDiff(c.Request.Context(), orgID, txn.BranchID, nil, txn.Items)
+		if err != nil {
+			if errors.Is(err, repo.ErrInsufficientStock) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock", "productId": productID})
 				return
 			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reserve stock"})
+			return
 		}
+		patch["items"], undo = lines, release
 	}
 
-	updated, err := m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, id, bson.M{
-		"status":            "CONFIRMED",
-		"fulfillmentStatus": "PROCESSING",
-	})
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, id, patch)
 	if err != nil {
+		undo()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm order"})
 		return
 	}
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventConfirmed,
+		Message: "Order confirmed",
+		Payload: map[string]interface{}{"from": txn.Status},
+	})
 
 	branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
 	branchName := ""
@@ -1548,65 +1916,11 @@ func (m *Module) complete(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to complete order"})
 		return
 	}
-
-	branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
-	branchName := ""
-	for _, b := range branches {
-		if b.ID == updated.BranchID {
-			branchName = b.Name
-			break
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{"data": m.transactionToOrder(updated, branchName)})
-}
-
-type recordPaymentRequest struct {
-	Method string `json:"method"`
-	Amount int64  `json:"amount"`
-	Note   string `json:"note"`
-}
-
-func (m *Module) recordPayment(c *gin.Context) {
-	u := auth.CurrentUser(c)
-	orgID := auth.GetOrgIDForRequest(c, u)
-	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
-		return
-	}
-
-	id := c.Param("id")
-	var req recordPaymentRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
-		return
-	}
-
-	txn, err := m.deps.Repo.GetTransactionByOrg(c.Request.Context(), orgID, id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
-		return
-	}
-
-	// Cannot record payment for cancelled/refunded orders
-	if txn.Status == "CANCELLED" || txn.Status == "REFUNDED" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot record payment for cancelled or refunded orders"})
-		return
-	}
-
-	patch := bson.M{
-		"paymentMethod": strings.TrimSpace(req.Method),
-		"status":        "COMPLETED",
-	}
-	if req.Note != "" {
-		patch["paymentNote"] = strings.TrimSpace(req.Note)
-	}
-
-	updated, err := m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, id, patch)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record payment"})
-		return
-	}
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventCompleted,
+		Message: "Order completed",
+		Payload: map[string]interface{}{"from": txn.Status},
+	})
 
 	branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
 	branchName := ""
@@ -1623,6 +1937,13 @@ func (m *Module) recordPayment(c *gin.Context) {
 type shipRequest struct {
 	Carrier        string `json:"carrier"`
 	TrackingNumber string `json:"trackingNumber"`
+
+	// Book the parcel through the carrier's integration instead of recording a
+	// tracking number typed by hand
+	Book       bool   `json:"book"`
+	Service    string `json:"service"`
+	WeightGram int    `json:"weightGram"` // Overrides the weight summed from the products
+	CODAmount  int64  `json:"codAmount"`
 }
 
 func (m *Module) markShipped(c *gin.Context) {
@@ -1654,27 +1975,71 @@ func (m *Module) markShipped(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be confirmed before shipping"})
 		return
 	}
+	if len(txn.Shipments) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "order ships in parts; add a shipment instead"})
+		return
+	}
+	if backordered(txn) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": errAwaitingStock.Error()})
+		return
+	}
 
 	shipping := txn.ShippingInfo
 	if shipping == nil {
 		shipping = &models.ShippingInfo{}
 	}
-	if strings.TrimSpace(req.Carrier) != "" {
-		shipping.Carrier = strings.TrimSpace(req.Carrier)
+	// COD orders are shipped collecting what the courier is expected to remit
+	if req.CODAmount == 0 && txn.COD != nil {
+		req.CODAmount = txn.COD.Expected
 	}
-	if strings.TrimSpace(req.TrackingNumber) != "" {
-		shipping.TrackingNumber = strings.TrimSpace(req.TrackingNumber)
+	if req.Book {
+		if shipping.BookedDate != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "order already has a booked shipment; cancel it first"})
+			return
+		}
+		booked, err := m.bookShipment(c.Request.Context(), txn, req)
+		if err != nil {
+			carrierError(c, err)
+			return
+		}
+		shipping.Carrier = booked.Carrier
+		shipping.TrackingNumber = booked.TrackingNumber
+		shipping.Service = booked.Service
+		shipping.ExternalID = booked.ExternalID
+		shipping.SortCode = booked.SortCode
+		shipping.Fee = booked.Fee
+		shipping.WeightGram = req.WeightGram
+		shipping.CODAmount = req.CODAmount
+		shipping.BookedDate = booked.CreatedAt.Format(time.RFC3339)
+		shipping.LabelURL = "/api/orders/" + txn.ID + "/label"
+	} else {
+		if strings.TrimSpace(req.Carrier) != "" {
+			shipping.Carrier = strings.TrimSpace(req.Carrier)
+		}
+		if strings.TrimSpace(req.TrackingNumber) != "" {
+			shipping.TrackingNumber = strings.TrimSpace(req.TrackingNumber)
+		}
+		if req.CODAmount > 0 {
+			shipping.CODAmount = req.CODAmount
+		}
 	}
 	shipping.ShippedDate = time.Now().UTC().Format(time.RFC3339)
 
-	updated, err := m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, id, bson.M{
+	patch := bson.M{
 		"fulfillmentStatus": "SHIPPED",
 		"shippingInfo":      shipping,
-	})
+	}
+	if txn.COD == nil && req.CODAmount > 0 {
+		// Shipping with cash to collect makes the order COD
+		patch["paymentMethod"] = models.PaymentMethodCOD
+		patch["cod"] = codFor(models.PaymentMethodCOD, req.CODAmount, txn.Total)
+	}
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(c.Request.Context(), orgID, id, patch)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark as shipped"})
 		return
 	}
+	m.recordEvent(c, *u, updated, shippedChange(txn, updated, req.Book))
 
 	branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
 	branchName := ""
@@ -1711,11 +2076,12 @@ func (m *Module) markDelivered(c *gin.Context) {
 
 	// Use existing commitSaleDelivered for SALE type orders
 	if strings.ToUpper(txn.Type) == "SALE" {
-		updated, err := m.commitSaleDelivered(c, orgID, txn, "", "")
+		updated, err := m.commitSaleDelivered(c.Request.Context(), orgID, txn, "", "")
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		m.recordEvent(c, *u, updated, deliveredChange(txn, updated))
 
 		branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
 		branchName := ""
@@ -1738,6 +2104,7 @@ func (m *Module) markDelivered(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark as delivered"})
 		return
 	}
+	m.recordEvent(c, *u, updated, deliveredChange(txn, updated))
 
 	branches, _ := m.deps.Repo.ListBranchesByOrg(c.Request.Context(), orgID)
 	branchName := ""
@@ -1751,31 +2118,10 @@ func (m *Module) markDelivered(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": m.transactionToOrder(updated, branchName)})
 }
 
-type TimelineEvent struct {
-	ID        string `json:"id"`
-	Type      string `json:"type"`
-	Status    string `json:"status"`
-	Message   string `json:"message"`
-	Timestamp string `json:"timestamp"`
-	UserID    string `json:"userId,omitempty"`
-}
-
-func (m *Module) getTimeline(c *gin.Context) {
-	u := auth.CurrentUser(c)
-	orgID := auth.GetOrgIDForRequest(c, u)
-	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
-		return
-	}
-
-	id := c.Param("id")
-	txn, err := m.deps.Repo.GetTransactionByOrg(c.Request.Context(), orgID, id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
-		return
-	}
-
-	// Build timeline from transaction data
+// legacyTimeline pieces together the timeline of an order placed before the event log
+// from its fields and payments
+func (m *Module) legacyTimeline(c *gin.Context, txn models.Transaction) []TimelineEvent {
+	orgID := txn.OrgID
 	timeline := make([]TimelineEvent, 0)
 
 	// Order created
@@ -1788,8 +2134,26 @@ func (m *Module) getTimeline(c *gin.Context) {
 		UserID:    txn.UserID,
 	})
 
-	// Payment if completed
-	if txn.Status == "COMPLETED" || txn.PaymentMethod != "" {
+	// Payments from the ledger; orders from before it existed show one payment if completed
+	payments, _ := m.deps.Repo.ListPaymentsByTransaction(c.Request.Context(), orgID, txn.ID)
+	for _, p := range payments {
+		eventType, msg := "PAYMENT_RECEIVED", "Payment of "+formatBaht(p.Amount)+" received via "+p.Method
+		if p.Type == models.PaymentTypeRefund {
+			eventType, msg = "PAYMENT_REFUNDED", "Refund of "+formatBaht(p.Amount)+" via "+p.Method
+		}
+		if p.Status == models.PaymentEntryVoided {
+			msg += " (voided: " + p.VoidReason + ")"
+		}
+		timeline = append(timeline, TimelineEvent{
+			ID:        p.ID,
+			Type:      eventType,
+			Status:    "completed",
+			Message:   msg,
+			Timestamp: p.CreatedAt.Format(time.RFC3339),
+			UserID:    p.CreatedBy,
+		})
+	}
+	if len(payments) == 0 && (txn.Status == "COMPLETED" || txn.PaymentMethod != "") {
 		timeline = append(timeline, TimelineEvent{
 			ID:        "2",
 			Type:      "PAYMENT_RECEIVED",
@@ -1801,6 +2165,25 @@ func (m *Module) getTimeline(c *gin.Context) {
 
 	// Shipping info
 	if txn.ShippingInfo != nil {
+		if txn.ShippingInfo.PickedDate != "" {
+			timeline = append(timeline, TimelineEvent{
+				ID:        "3a",
+				Type:      "PICKING",
+				Status:    "completed",
+				Message:   "Added to pick list " + txn.ShippingInfo.PickListID,
+				Timestamp: txn.ShippingInfo.PickedDate,
+			})
+		}
+		if txn.ShippingInfo.PackedDate != "" {
+			timeline = append(timeline, TimelineEvent{
+				ID:        "3b",
+				Type:      "PACKED",
+				Status:    "completed",
+				Message:   "Order packed",
+				Timestamp: txn.ShippingInfo.PackedDate,
+				UserID:    txn.ShippingInfo.PackedBy,
+			})
+		}
 		if txn.ShippingInfo.ShippedDate != "" {
 			timeline = append(timeline, TimelineEvent{
 				ID:        "3",
@@ -1810,6 +2193,25 @@ func (m *Module) getTimeline(c *gin.Context) {
 				Timestamp: txn.ShippingInfo.ShippedDate,
 			})
 		}
+		for i, e := range txn.ShippingInfo.TrackingEvents {
+			if e.Status == "DELIVERED" {
+				continue // Shown as the delivery below
+			}
+			msg := e.Description
+			if msg == "" {
+				msg = strings.ReplaceAll(strings.ToLower(e.Status), "_", " ")
+			}
+			if e.Location != "" {
+				msg += " (" + e.Location + ")"
+			}
+			timeline = append(timeline, TimelineEvent{
+				ID:        "3c-" + strconv.Itoa(i),
+				Type:      "TRACKING_" + e.Status,
+				Status:    "completed",
+				Message:   msg,
+				Timestamp: e.Time.Format(time.RFC3339),
+			})
+		}
 		if txn.ShippingInfo.DeliveredDate != "" {
 			timeline = append(timeline, TimelineEvent{
 				ID:        "4",
@@ -1844,7 +2246,7 @@ func (m *Module) getTimeline(c *gin.Context) {
 		})
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": timeline})
+	return timeline
 }
 
 func carrierInfo(s *models.ShippingInfo) string {
@@ -0,0 +1,102 @@
+package ordersmodule
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/services/chatparse"
+
+	"github.com/gin-gonic/gin"
+)
+
+type parseTextRequest struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"` // Where the message came from; LINE when empty
+	BranchID string `json:"branchId,omitempty"`
+}
+
+// parseText reads a chat message pasted by sales staff and returns a draft createOrder
+// payload with the recipient and the products it mentions. Nothing is saved; confidence
+// is keyed by the draft's field paths so the form can highlight what to check.
+func (m *Module) parseText(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	branchID := auth.GetBranchIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req parseTextRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+	if utf8.RuneCountInString(req.Text) > chatparse.MaxText {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is too long"})
+		return
+	}
+	if req.BranchID != "" {
+		branchID = req.BranchID
+	}
+
+	products, err := m.deps.Repo.ListProductsByOrg(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load products"})
+		return
+	}
+	res := chatparse.Parse(req.Text, products)
+
+	channel := strings.ToUpper(strings.TrimSpace(req.Channel))
+	if channel == "" {
+		channel = "LINE"
+	}
+	draft := createOrderRequest{
+		BranchID:      branchID,
+		Channel:       channel,
+		CustomerName:  res.Name.Value,
+		CustomerPhone: res.Phone.Value,
+		Items:         make([]createOrderItem, 0, len(res.Items)),
+		SaveAsDraft:   true,
+	}
+	draft.Recipient.Name = res.Name.Value
+	draft.Recipient.Phone = res.Phone.Value
+	draft.Recipient.Address = res.Address.Value
+	draft.Recipient.Province = res.Province.Value
+	draft.Recipient.PostalCode = res.PostalCode.Value
+
+	confidence := map[string]float64{
+		"customerName":         res.Name.Confidence,
+		"customerPhone":        res.Phone.Confidence,
+		"recipient.name":       res.Name.Confidence,
+		"recipient.phone":      res.Phone.Confidence,
+		"recipient.address":    res.Address.Confidence,
+		"recipient.province":   res.Province.Confidence,
+		"recipient.postalCode": res.PostalCode.Confidence,
+	}
+	for i, it := range res.Items {
+		draft.Items = append(draft.Items, createOrderItem{
+			ProductID: it.ProductID,
+			Quantity:  it.Quantity,
+			UnitPrice: it.UnitPrice,
+		})
+		confidence["items."+strconv.Itoa(i)] = it.Confidence
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"draft":      draft,
+			"confidence": confidence,
+			"items":      res.Items,
+			"phones":     res.Phones,
+			"unmatched":  res.Unmatched,
+		},
+	})
+}
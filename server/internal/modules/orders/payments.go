@@ -0,0 +1,533 @@
+package ordersmodule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/audit"
+	"stockflows/server/internal/services/orderevents"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ============================================================================
+// Payment ledger
+// ============================================================================
+
+// paymentSummary totals an order's active ledger entries
+type paymentSummary struct {
+	Received int64    `json:"received"` // Sum of active payments
+	Refunded int64    `json:"refunded"` // Sum of active refunds
+	Paid     int64    `json:"paid"`     // Received - refunded
+	Due      int64    `json:"due"`      // Never negative; see Status for overpayment
+	Status   string   `json:"status"`
+	Methods  []string `json:"methods"`
+}
+
+func summarizePayments(total int64, entries []models.Payment) paymentSummary {
+	s := paymentSummary{Methods: make([]string, 0)}
+	seen := make(map[string]bool)
+	for _, p := range entries {
+		if p.Status == models.PaymentEntryVoided {
+			continue
+		}
+		if p.Type == models.PaymentTypeRefund {
+			s.Refunded += p.Amount
+			continue
+		}
+		s.Received += p.Amount
+		if !seen[p.Method] {
+			seen[p.Method] = true
+			s.Methods = append(s.Methods, p.Method)
+		}
+	}
+	s.Paid = s.Received - s.Refunded
+	s.Status = models.PaymentStatusFor(total, s.Paid)
+	if s.Paid < total {
+		s.Due = total - s.Paid
+	}
+	return s
+}
+
+// refundedFrom sums the active refunds already taken from a payment
+func refundedFrom(entries []models.Payment, paymentID string) int64 {
+	var sum int64
+	for _, p := range entries {
+		if p.Type == models.PaymentTypeRefund && p.RefundOf == paymentID && p.Status == models.PaymentEntryActive {
+			sum += p.Amount
+		}
+	}
+	return sum
+}
+
+// syncPayments recomputes the order's paid amount and payment status from its ledger.
+// A fully paid order is completed, as recording a payment always did, and a completed
+// order that is owed money again after a void or refund goes back to where it was
+// before it was paid: confirmed once fulfilment has started, pending otherwise.
+func (m *Module) syncPayments(ctx context.Context, orgID string, txn models.Transaction) (models.Transaction, paymentSummary, error) {
+	entries, err := m.deps.Repo.ListPaymentsByTransaction(ctx, orgID, txn.ID)
+	if err != nil {
+		return txn, paymentSummary{}, err
+	}
+	summary := summarizePayments(txn.Total, entries)
+
+	patch := bson.M{
+		"paymentStatus": summary.Status,
+		"paidAmount":    summary.Paid,
+	}
+	switch len(summary.Methods) {
+	case 0:
+	case 1:
+		patch["paymentMethod"] = summary.Methods[0]
+	default:
+		patch["paymentMethod"] = "SPLIT"
+	}
+	if (summary.Status == models.PaymentStatusPaid || summary.Status == models.PaymentStatusOverpaid) &&
+		txn.Status != "CANCELLED" && txn.Status != "REFUNDED" {
+		patch["status"] = "COMPLETED"
+	}
+	if (summary.Status == models.PaymentStatusUnpaid || summary.Status == models.PaymentStatusPartiallyPaid) &&
+		txn.Status == "COMPLETED" {
+		patch["status"] = "PENDING"
+		if txn.FulfillmentStatus != "PENDING" {
+			patch["status"] = "CONFIRMED"
+		}
+	}
+
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, patch)
+	if err != nil {
+		return txn, summary, err
+	}
+	return updated, summary, nil
+}
+
+// refundExcess refunds what has been paid beyond the order's total, taking it from the
+// order's payments newest first through the same ledger entries as a manual refund
+func (m *Module) refundExcess(ctx context.Context, orgID string, txn models.Transaction, userID, reason string) ([]models.Payment, error) {
+	entries, err := m.deps.Repo.ListPaymentsByTransaction(ctx, orgID, txn.ID)
+	if err != nil {
+		return nil, err
+	}
+	excess := summarizePayments(txn.Total, entries).Paid - txn.Total
+	refunds := make([]models.Payment, 0)
+	for i := len(entries) - 1; i >= 0 && excess > 0; i-- {
+		p := entries[i]
+		if p.Type != models.PaymentTypePayment || p.Status != models.PaymentEntryActive {
+			continue
+		}
+		refund, err := m.refundFrom(ctx, orgID, txn, p.ID, excess, userID, reason)
+		if err != nil {
+			return refunds, err
+		}
+		if refund.ID != "" {
+			refunds = append(refunds, refund)
+			excess -= refund.Amount
+		}
+	}
+	return refunds, nil
+}
+
+// refundFrom refunds up to amount from one payment under its refund lock. It returns an
+// empty payment when nothing is left of it.
+func (m *Module) refundFrom(ctx context.Context, orgID string, txn models.Transaction, paymentID string, amount int64, userID, reason string) (models.Payment, error) {
+	original, err := m.deps.Repo.LockPaymentForRefund(ctx, orgID, paymentID)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	defer func() { _ = m.deps.Repo.UnlockPaymentRefund(ctx, orgID, paymentID) }()
+
+	entries, err := m.deps.Repo.ListPaymentsByTransaction(ctx, orgID, txn.ID)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	if left := original.Amount - refundedFrom(entries, original.ID); left < amount {
+		amount = left
+	}
+	if amount <= 0 || original.Status != models.PaymentEntryActive {
+		return models.Payment{}, nil
+	}
+	return m.deps.Repo.CreatePayment(ctx, models.Payment{
+		ID:            "PAY-" + primitive.NewObjectID().Hex(),
+		OrgID:         orgID,
+		BranchID:      txn.BranchID,
+		TransactionID: txn.ID,
+		Type:          models.PaymentTypeRefund,
+		Method:        original.Method,
+		Amount:        amount,
+		Note:          reason,
+		RefundOf:      original.ID,
+		CreatedBy:     userID,
+	})
+}
+
+func (m *Module) branchName(ctx context.Context, orgID, branchID string) string {
+	if b, err := m.deps.Repo.GetBranchByOrg(ctx, orgID, branchID); err == nil {
+		return b.Name
+	}
+	return ""
+}
+
+// listPayments returns an order's payment ledger with totals
+func (m *Module) listPayments(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	txn, err := m.deps.Repo.GetTransactionByOrg(c.Request.Context(), orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	entries, err := m.deps.Repo.ListPaymentsByTransaction(c.Request.Context(), orgID, txn.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list payments"})
+		return
+	}
+	if entries == nil {
+		entries = []models.Payment{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": entries,
+		"meta": gin.H{"total": txn.Total, "summary": summarizePayments(txn.Total, entries)},
+	})
+}
+
+type recordPaymentRequest struct {
+	Method    string `json:"method"`
+	Amount    int64  `json:"amount"` // Defaults to the amount still due
+	Reference string `json:"reference"`
+	Note      string `json:"note"`
+}
+
+// recordPayment adds a payment to the order's ledger. Several payments of different
+// methods may be recorded; the order is completed once fully paid.
+func (m *Module) recordPayment(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	id := c.Param("id")
+	var req recordPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+
+	// Cannot record payment for cancelled/refunded orders
+	if txn.Status == "CANCELLED" || txn.Status == "REFUNDED" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot record payment for cancelled or refunded orders"})
+		return
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(req.Method))
+	if method == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method is required"})
+		return
+	}
+	if req.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+	amount := req.Amount
+	if amount == 0 {
+		entries, err := m.deps.Repo.ListPaymentsByTransaction(ctx, orgID, txn.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record payment"})
+			return
+		}
+		amount = summarizePayments(txn.Total, entries).Due
+		if amount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order is already paid"})
+			return
+		}
+	}
+
+	payment, err := m.deps.Repo.CreatePayment(ctx, models.Payment{
+		ID:            "PAY-" + primitive.NewObjectID().Hex(),
+		OrgID:         orgID,
+		BranchID:      txn.BranchID,
+		TransactionID: txn.ID,
+		Type:          models.PaymentTypePayment,
+		Method:        method,
+		Amount:        amount,
+		Reference:     strings.TrimSpace(req.Reference),
+		Note:          strings.TrimSpace(req.Note),
+		CreatedBy:     u.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record payment"})
+		return
+	}
+
+	updated, summary, err := m.syncPayments(ctx, orgID, txn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record payment"})
+		return
+	}
+	m.recordEvent(c, *u, updated, paymentChange(payment))
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": m.transactionToOrder(updated, m.branchName(ctx, orgID, updated.BranchID)),
+		"meta": gin.H{"payment": payment, "summary": summary},
+	})
+}
+
+type voidPaymentRequest struct {
+	Reason string `json:"reason"`
+}
+
+// voidPayment removes an entry made in error from the ledger totals. The entry is kept.
+func (m *Module) voidPayment(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req voidPaymentRequest
+	_ = c.ShouldBindJSON(&req)
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	before, err := m.deps.Repo.GetPaymentByOrg(ctx, orgID, c.Param("paymentId"))
+	if err != nil || before.TransactionID != txn.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return
+	}
+
+	// A payment with refunds taken from it must have those voided first. It is held like
+	// a refund would hold it, so no refund can be taken between the check and the void.
+	if before.Type == models.PaymentTypePayment {
+		if _, err := m.deps.Repo.LockPaymentForRefund(ctx, orgID, before.ID); err != nil {
+			if errors.Is(err, repo.ErrConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": "payment is being refunded or already voided; try again"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to void payment"})
+			return
+		}
+		defer func() { _ = m.deps.Repo.UnlockPaymentRefund(ctx, orgID, before.ID) }()
+
+		entries, err := m.deps.Repo.ListPaymentsByTransaction(ctx, orgID, txn.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to void payment"})
+			return
+		}
+		if refundedFrom(entries, before.ID) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "payment has refunds; void them first"})
+			return
+		}
+	}
+
+	voided, err := m.deps.Repo.VoidPayment(ctx, orgID, before.ID, u.ID, reason)
+	if err != nil {
+		if errors.Is(err, repo.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "payment is already voided"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to void payment"})
+		return
+	}
+
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Payment", voided.ID, models.AuditActionUpdate,
+		before, voided, c.ClientIP(), c.Request.UserAgent(), reason)
+
+	updated, summary, err := m.syncPayments(ctx, orgID, txn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+		return
+	}
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventPaymentVoided,
+		Message: "Payment of " + formatBaht(voided.Amount) + " voided: " + reason,
+		Payload: map[string]interface{}{"paymentId": voided.ID, "method": voided.Method, "amount": voided.Amount, "reason": reason},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": m.transactionToOrder(updated, m.branchName(ctx, orgID, updated.BranchID)),
+		"meta": gin.H{"payment": voided, "summary": summary},
+	})
+}
+
+type refundPaymentRequest struct {
+	Amount    int64  `json:"amount"` // Defaults to what is left of the payment
+	Method    string `json:"method"` // Defaults to the payment's method
+	Reference string `json:"reference"`
+	Reason    string `json:"reason"`
+}
+
+// refundPayment returns money from a payment, fully or in part
+func (m *Module) refundPayment(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req refundPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	original, err := m.deps.Repo.GetPaymentByOrg(ctx, orgID, c.Param("paymentId"))
+	if err != nil || original.TransactionID != txn.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return
+	}
+	if original.Type != models.PaymentTypePayment || original.Status != models.PaymentEntryActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only active payments can be refunded"})
+		return
+	}
+
+	// Held so concurrent refunds of the payment are worked out one after the other
+	if _, err := m.deps.Repo.LockPaymentForRefund(ctx, orgID, original.ID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "payment is being refunded; try again"})
+		return
+	}
+	defer func() { _ = m.deps.Repo.UnlockPaymentRefund(ctx, orgID, original.ID) }()
+
+	entries, err := m.deps.Repo.ListPaymentsByTransaction(ctx, orgID, txn.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refund payment"})
+		return
+	}
+	refundable := original.Amount - refundedFrom(entries, original.ID)
+	amount := req.Amount
+	if amount == 0 {
+		amount = refundable
+	}
+	if amount <= 0 || amount > refundable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount exceeds what is left of the payment", "refundable": refundable})
+		return
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(req.Method))
+	if method == "" {
+		method = original.Method
+	}
+
+	refund, err := m.deps.Repo.CreatePayment(ctx, models.Payment{
+		ID:            "PAY-" + primitive.NewObjectID().Hex(),
+		OrgID:         orgID,
+		BranchID:      txn.BranchID,
+		TransactionID: txn.ID,
+		Type:          models.PaymentTypeRefund,
+		Method:        method,
+		Amount:        amount,
+		Reference:     strings.TrimSpace(req.Reference),
+		Note:          reason,
+		RefundOf:      original.ID,
+		CreatedBy:     u.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refund payment"})
+		return
+	}
+
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Payment", refund.ID, models.AuditActionCreate,
+		nil, refund, c.ClientIP(), c.Request.UserAgent(), reason)
+
+	updated, summary, err := m.syncPayments(ctx, orgID, txn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+		return
+	}
+	ch := paymentChange(refund)
+	// A completed order whose money has all gone back is refunded
+	if txn.Status == "COMPLETED" && summary.Received > 0 && summary.Paid <= 0 {
+		if updated, err = m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{"status": "REFUNDED"}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+			return
+		}
+		ch.Message += "; order refunded in full"
+		ch.Payload["status"] = updated.Status
+	}
+	m.recordEvent(c, *u, updated, ch)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": m.transactionToOrder(updated, m.branchName(ctx, orgID, updated.BranchID)),
+		"meta": gin.H{"payment": refund, "summary": summary},
+	})
+}
+
+// recordTillPayment writes the ledger entry for a sale paid in full when it was rung up
+func (m *Module) recordTillPayment(ctx context.Context, txn models.Transaction) (models.Payment, bool) {
+	if txn.Total <= 0 {
+		return models.Payment{}, false
+	}
+	method := strings.ToUpper(strings.TrimSpace(txn.PaymentMethod))
+	if method == "" {
+		method = "CASH"
+	}
+	p, err := m.deps.Repo.CreatePayment(ctx, models.Payment{
+		ID:            "PAY-" + primitive.NewObjectID().Hex(),
+		OrgID:         txn.OrgID,
+		BranchID:      txn.BranchID,
+		TransactionID: txn.ID,
+		Type:          models.PaymentTypePayment,
+		Method:        method,
+		Amount:        txn.Total,
+		CreatedBy:     txn.UserID,
+	})
+	return p, err == nil
+}
+
+// formatBaht formats an amount in satang for messages, e.g. "฿1,250.50"
+func formatBaht(v int64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	whole := strconv.FormatInt(v/100, 10)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return fmt.Sprintf("%s฿%s.%02d", sign, whole, v%100)
+}
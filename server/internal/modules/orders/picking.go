@@ -0,0 +1,483 @@
+package ordersmodule
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/documents"
+	"stockflows/server/internal/services/orderevents"
+	"stockflows/server/platform/pdf"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxPickListOrders = 200
+
+type pickListRequest struct {
+	IDs    []string `json:"ids"`
+	Format string   `json:"format"` // json (default) or pdf; ?format= works too
+}
+
+// PickLine is one stop on the walking path: a product and how many to pick for all orders
+type PickLine struct {
+	BinLocation string          `json:"binLocation"`
+	ProductID   string          `json:"productId"`
+	SKU         string          `json:"sku"`
+	Name        string          `json:"name"`
+	Quantity    int             `json:"quantity"`
+	Orders      []PickLineOrder `json:"orders"`
+}
+
+// PickLineOrder is one order's share of a pick line
+type PickLineOrder struct {
+	OrderID  string `json:"orderId"`
+	Quantity int    `json:"quantity"`
+}
+
+// PackingSlip lists what goes into one order's parcel
+type PackingSlip struct {
+	OrderID          string            `json:"orderId"`
+	Channel          string            `json:"channel"`
+	RecipientName    string            `json:"recipientName"`
+	RecipientPhone   string            `json:"recipientPhone,omitempty"`
+	RecipientAddress string            `json:"recipientAddress,omitempty"`
+	Note             string            `json:"note,omitempty"`
+	Items            []PackingSlipItem `json:"items"`
+	Units            int               `json:"units"`
+}
+
+type PackingSlipItem struct {
+	ProductID   string `json:"productId"`
+	SKU         string `json:"sku"`
+	Name        string `json:"name"`
+	BinLocation string `json:"binLocation,omitempty"`
+	Quantity    int    `json:"quantity"`
+}
+
+// PickList is a consolidated pick for a batch of orders from one branch
+type PickList struct {
+	ID          string        `json:"id"`
+	BranchID    string        `json:"branchId"`
+	BranchName  string        `json:"branchName"`
+	GeneratedAt time.Time     `json:"generatedAt"`
+	GeneratedBy string        `json:"generatedBy"`
+	Lines       []PickLine    `json:"lines"`
+	Slips       []PackingSlip `json:"packingSlips"`
+	Units       int           `json:"units"`
+}
+
+// createPickList aggregates the selected orders into one pick list sorted by bin, with a
+// packing slip per order, and moves the orders to PICKING. Orders already PICKING can be
+// put on a new list, e.g. to reprint a lost one.
+func (m *Module) createPickList(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req pickListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	ids := uniqueIDs(req.IDs)
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids are required"})
+		return
+	}
+	if len(ids) > maxPickListOrders {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d orders per pick list", maxPickListOrders)})
+		return
+	}
+	format := strings.ToLower(c.DefaultQuery("format", req.Format))
+
+	ctx := c.Request.Context()
+	orders := make([]models.Transaction, 0, len(ids))
+	for _, id := range ids {
+		txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order " + id + " not found"})
+			return
+		}
+		if reason := notPickable(txn); reason != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order " + id + " " + reason})
+			return
+		}
+		if len(orders) > 0 && txn.BranchID != orders[0].BranchID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "orders on a pick list must be from the same branch"})
+			return
+		}
+		orders = append(orders, txn)
+	}
+
+	branchID := orders[0].BranchID
+	list := PickList{
+		ID:          "PL-" + primitive.NewObjectID().Hex()[12:],
+		BranchID:    branchID,
+		GeneratedAt: time.Now().UTC(),
+		GeneratedBy: u.ID,
+	}
+	if branch, err := m.deps.Repo.GetBranchByOrg(ctx, orgID, branchID); err == nil {
+		list.BranchName = branch.Name
+	}
+
+	bins := make(map[string]string)
+	binOf := func(productID string) string {
+		if bin, ok := bins[productID]; ok {
+			return bin
+		}
+		level, _ := m.deps.Repo.GetStockLevel(ctx, orgID, branchID, productID)
+		bins[productID] = level.BinLocation
+		return level.BinLocation
+	}
+
+	lines := make(map[string]*PickLine)
+	for _, txn := range orders {
+		slip := PackingSlip{
+			OrderID:          txn.ID,
+			Channel:          txn.Channel,
+			RecipientName:    txn.RecipientName,
+			RecipientPhone:   txn.RecipientPhone,
+			RecipientAddress: txn.RecipientAddress,
+			Note:             txn.Note,
+		}
+		for _, it := range txn.Items {
+			if it.Quantity <= 0 {
+				continue
+			}
+			bin := binOf(it.ID)
+			slip.Items = append(slip.Items, PackingSlipItem{ProductID: it.ID, SKU: it.SKU, Name: it.Name, BinLocation: bin, Quantity: it.Quantity})
+			slip.Units += it.Quantity
+
+			line := lines[it.ID]
+			if line == nil {
+				line = &PickLine{BinLocation: bin, ProductID: it.ID, SKU: it.SKU, Name: it.Name}
+				lines[it.ID] = line
+			}
+			line.Quantity += it.Quantity
+			if n := len(line.Orders); n > 0 && line.Orders[n-1].OrderID == txn.ID {
+				line.Orders[n-1].Quantity += it.Quantity
+			} else {
+				line.Orders = append(line.Orders, PickLineOrder{OrderID: txn.ID, Quantity: it.Quantity})
+			}
+		}
+		sort.SliceStable(slip.Items, func(i, j int) bool {
+			return binLess(slip.Items[i].BinLocation, slip.Items[j].BinLocation)
+		})
+		list.Slips = append(list.Slips, slip)
+		list.Units += slip.Units
+	}
+	for _, line := range lines {
+		list.Lines = append(list.Lines, *line)
+	}
+	sort.Slice(list.Lines, func(i, j int) bool {
+		a, b := list.Lines[i], list.Lines[j]
+		if a.BinLocation != b.BinLocation {
+			return binLess(a.BinLocation, b.BinLocation)
+		}
+		return a.SKU < b.SKU
+	})
+
+	// Move the batch to PICKING
+	for _, txn := range orders {
+		shipping := txn.ShippingInfo
+		if shipping == nil {
+			shipping = &models.ShippingInfo{}
+		}
+		shipping.PickListID = list.ID
+		shipping.PickedDate = list.GeneratedAt.Format(time.RFC3339)
+		updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{
+			"fulfillmentStatus": "PICKING",
+			"shippingInfo":      shipping,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order " + txn.ID})
+			return
+		}
+		m.recordEvent(c, *u, updated, orderevents.Change{
+			Type:    models.OrderEventPicking,
+			Message: "Added to pick list " + list.ID,
+			Payload: map[string]interface{}{"pickListId": list.ID, "from": txn.FulfillmentStatus},
+			Before:  gin.H{"fulfillmentStatus": txn.FulfillmentStatus},
+			After:   gin.H{"fulfillmentStatus": updated.FulfillmentStatus},
+		})
+	}
+
+	if format == "pdf" {
+		regular, bold, err := documents.Fonts(m.deps.Config.Documents)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load document fonts"})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+list.ID+".pdf")
+		c.Data(http.StatusOK, "application/pdf", pickListPDF(list, regular, bold))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "meta": gin.H{"orders": len(orders), "lines": len(list.Lines)}})
+}
+
+// notPickable explains why an order cannot go on a pick list, or returns ""
+func notPickable(txn models.Transaction) string {
+	switch {
+	case strings.ToUpper(txn.Type) != "SALE":
+		return "is not a sale"
+	case txn.Status != "CONFIRMED" && txn.Status != "COMPLETED":
+		return "must be confirmed before picking"
+	case txn.FulfillmentStatus != "PENDING" && txn.FulfillmentStatus != "PICKING":
+		return "is already " + strings.ToLower(txn.FulfillmentStatus)
+	case backordered(txn) > 0:
+		return "has units waiting for stock"
+	}
+	return ""
+}
+
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
+
+// binLess orders bin locations along the walking path: aisle by aisle, comparing runs of
+// digits by value so A-2 comes before A-10. Products without a bin go last.
+func binLess(a, b string) bool {
+	if a == "" || b == "" {
+		return a != "" && b == ""
+	}
+	a, b = strings.ToUpper(a), strings.ToUpper(b)
+	for a != "" && b != "" {
+		ra, rb := leadingRun(a), leadingRun(b)
+		if ra != rb {
+			na, errA := strconv.Atoi(ra)
+			nb, errB := strconv.Atoi(rb)
+			if errA == nil && errB == nil && na != nb {
+				return na < nb
+			}
+			return ra < rb
+		}
+		a, b = a[len(ra):], b[len(rb):]
+	}
+	return len(a) < len(b)
+}
+
+// leadingRun returns the leading run of digits or of non-digits in s
+func leadingRun(s string) string {
+	digit := s[0] >= '0' && s[0] <= '9'
+	i := 1
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == digit {
+		i++
+	}
+	return s[:i]
+}
+
+// pickListPDF prints the pick list followed by one packing slip per page
+func pickListPDF(list PickList, regular, bold *pdf.Font) []byte {
+	doc := pdf.New(pdf.A4)
+	if regular != nil {
+		doc.SetFonts(regular, bold)
+	}
+	doc.AddPage()
+	doc.Heading("Pick list "+list.ID, 14)
+	doc.Paragraph(fmt.Sprintf("Branch: %s    Orders: %d    Units: %d    Generated %s",
+		list.BranchName, len(list.Slips), list.Units, list.GeneratedAt.Format("2006-01-02 15:04 UTC")), 9)
+	doc.Space(6)
+	rows := make([][]string, len(list.Lines))
+	for i, l := range list.Lines {
+		orders := make([]string, len(l.Orders))
+		for j, o := range l.Orders {
+			orders[j] = fmt.Sprintf("%s x%d", o.OrderID, o.Quantity)
+		}
+		rows[i] = []string{l.BinLocation, l.SKU, l.Name, strconv.Itoa(l.Quantity), strings.Join(orders, ", "), "[  ]"}
+	}
+	doc.Table([]pdf.Column{
+		{Header: "Bin", Width: 60},
+		{Header: "SKU", Width: 80},
+		{Header: "Product", Width: 155},
+		{Header: "Qty", Width: 35, Right: true},
+		{Header: "Orders", Width: 160},
+		{Header: "Picked", Width: 35},
+	}, rows, 8)
+
+	for _, slip := range list.Slips {
+		doc.AddPage()
+		doc.Heading("Packing slip "+slip.OrderID, 14)
+		doc.Paragraph("Pick list: "+list.ID+"    Channel: "+slip.Channel, 9)
+		doc.Space(4)
+		doc.Paragraph("Ship to: "+slip.RecipientName, 10)
+		if slip.RecipientPhone != "" {
+			doc.Paragraph("Tel: "+slip.RecipientPhone, 9)
+		}
+		for _, ln := range doc.Wrap(slip.RecipientAddress, doc.Size().Width-2*doc.Margin(), 9, false) {
+			doc.Paragraph(ln, 9)
+		}
+		if slip.Note != "" {
+			doc.Paragraph("Note: "+slip.Note, 9)
+		}
+		doc.Space(6)
+		rows := make([][]string, len(slip.Items))
+		for i, it := range slip.Items {
+			rows[i] = []string{it.BinLocation, it.SKU, it.Name, strconv.Itoa(it.Quantity), "[  ]"}
+		}
+		doc.Table([]pdf.Column{
+			{Header: "Bin", Width: 60},
+			{Header: "SKU", Width: 90},
+			{Header: "Product", Width: 270},
+			{Header: "Qty", Width: 50, Right: true},
+			{Header: "Packed", Width: 45},
+		}, rows, 9)
+		doc.Space(6)
+		doc.Paragraph(fmt.Sprintf("Total units: %d", slip.Units), 9)
+	}
+	return doc.Bytes()
+}
+
+type packRequest struct {
+	Scans []string `json:"scans"` // One entry per scanned unit: SKU or product ID
+	Items []struct {
+		SKU      string `json:"sku"`
+		Quantity int    `json:"quantity"`
+	} `json:"items"` // Counted items, for scanners that send quantities
+}
+
+// PackCheck compares what was scanned for one order line with what was ordered
+type PackCheck struct {
+	ProductID string `json:"productId,omitempty"`
+	SKU       string `json:"sku"`
+	Name      string `json:"name,omitempty"`
+	Ordered   int    `json:"ordered"`
+	Scanned   int    `json:"scanned"`
+}
+
+// confirmPack verifies the scanned items against the order and marks it PACKED. Nothing
+// changes unless every line matches exactly; the response lists short, over and unknown
+// scans so the packer can fix the parcel.
+func (m *Module) confirmPack(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req packRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if len(req.Scans) == 0 && len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scans or items are required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if txn.FulfillmentStatus != "PICKING" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be picking before it can be packed"})
+		return
+	}
+
+	// Expected quantities per product, addressable by SKU or product ID
+	checks := make([]*PackCheck, 0, len(txn.Items))
+	byCode := make(map[string]*PackCheck)
+	for _, it := range txn.Items {
+		if it.Quantity <= 0 {
+			continue
+		}
+		chk := byCode[strings.ToUpper(it.ID)]
+		if chk == nil {
+			chk = &PackCheck{ProductID: it.ID, SKU: it.SKU, Name: it.Name}
+			checks = append(checks, chk)
+			byCode[strings.ToUpper(it.ID)] = chk
+			if it.SKU != "" {
+				byCode[strings.ToUpper(it.SKU)] = chk
+			}
+		}
+		chk.Ordered += it.Quantity
+	}
+
+	unknown := make(map[string]int)
+	scan := func(code string, qty int) {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" || qty <= 0 {
+			return
+		}
+		if chk := byCode[code]; chk != nil {
+			chk.Scanned += qty
+			return
+		}
+		unknown[code] += qty
+	}
+	for _, s := range req.Scans {
+		scan(s, 1)
+	}
+	for _, it := range req.Items {
+		scan(it.SKU, it.Quantity)
+	}
+
+	lines := make([]PackCheck, 0, len(checks)+len(unknown))
+	matched := len(unknown) == 0
+	for _, chk := range checks {
+		lines = append(lines, *chk)
+		if chk.Scanned != chk.Ordered {
+			matched = false
+		}
+	}
+	codes := make([]string, 0, len(unknown))
+	for code := range unknown {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		lines = append(lines, PackCheck{SKU: code, Scanned: unknown[code]})
+	}
+
+	if !matched {
+		c.JSON(http.StatusConflict, gin.H{"error": "scanned items do not match the order", "data": lines})
+		return
+	}
+
+	shipping := txn.ShippingInfo
+	if shipping == nil {
+		shipping = &models.ShippingInfo{}
+	}
+	shipping.PackedDate = time.Now().UTC().Format(time.RFC3339)
+	shipping.PackedBy = u.ID
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{
+		"fulfillmentStatus": "PACKED",
+		"shippingInfo":      shipping,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+		return
+	}
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventPacked,
+		Message: "Packed and verified by scan",
+		Payload: map[string]interface{}{"lines": len(lines)},
+		Before:  gin.H{"fulfillmentStatus": txn.FulfillmentStatus},
+		After:   gin.H{"fulfillmentStatus": updated.FulfillmentStatus},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"data": updated, "meta": gin.H{"lines": lines}})
+}
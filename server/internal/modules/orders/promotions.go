@@ -0,0 +1,110 @@
+package ordersmodule
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/promotions"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyPromotions evaluates the org's promotions against the order items, writes each line's
+// discount and explanation onto items and redeems the coupons used. It writes the error
+// response and returns false when the order cannot go ahead; on success the caller must
+// release the coupons if the order is not saved.
+func (m *Module) applyPromotions(c *gin.Context, orgID, branchID, channel, customerID string, codes []string, items []models.TransactionItem) (promotions.Result, bool) {
+	ctx := c.Request.Context()
+	svc := promotions.New(m.deps.Repo)
+
+	cart, err := svc.CartFor(ctx, orgID, branchID, channel, customerID, codes, items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to evaluate promotions"})
+		return promotions.Result{}, false
+	}
+	res, err := svc.Evaluate(ctx, orgID, customerID, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to evaluate promotions"})
+		return promotions.Result{}, false
+	}
+	if len(res.Rejected) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "coupon not applicable", "coupons": res.Rejected})
+		return promotions.Result{}, false
+	}
+	if err := svc.Redeem(ctx, orgID, customerID, res.Applied); err != nil {
+		if errors.Is(err, promotions.ErrCouponExhausted) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return promotions.Result{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to redeem coupon"})
+		return promotions.Result{}, false
+	}
+
+	promotions.Apply(items, res)
+	return res, true
+}
+
+// releasePromotions gives back the coupon uses of an order that was not saved or was cancelled
+func (m *Module) releasePromotions(c *gin.Context, orgID, customerID string, applied []models.AppliedPromotion) {
+	promotions.New(m.deps.Repo).Release(c.Request.Context(), orgID, customerID, applied)
+}
+
+// redeemPromotions takes back coupon uses given back by releasePromotions when the change
+// that released them is abandoned
+func (m *Module) redeemPromotions(c *gin.Context, orgID, customerID string, applied []models.AppliedPromotion) {
+	if err := promotions.New(m.deps.Repo).Redeem(c.Request.Context(), orgID, customerID, applied); err != nil {
+		log.Printf("orders: redeem coupons again: %v", err)
+	}
+}
+
+// reapplyPromotions evaluates an edited order's promotions against its new lines, like
+// applyPromotions. The order's own coupon uses are given back first so they do not count
+// against the coupons' limits. Coupons the order already had that the new lines no longer
+// qualify for are dropped and stay released; new codes that do not apply are refused. On
+// failure the old coupon uses are taken back.
+func (m *Module) reapplyPromotions(c *gin.Context, orgID string, txn models.Transaction, channel, customerID string, codes []string, items []models.TransactionItem) (promotions.Result, []promotions.Rejection, bool) {
+	ctx := c.Request.Context()
+	svc := promotions.New(m.deps.Repo)
+	svc.Release(ctx, orgID, txn.CustomerID, txn.Promotions)
+	fail := func(status int, body gin.H) (promotions.Result, []promotions.Rejection, bool) {
+		m.redeemPromotions(c, orgID, txn.CustomerID, txn.Promotions)
+		c.JSON(status, body)
+		return promotions.Result{}, nil, false
+	}
+
+	cart, err := svc.CartFor(ctx, orgID, txn.BranchID, channel, customerID, codes, items)
+	if err != nil {
+		return fail(http.StatusInternalServerError, gin.H{"error": "failed to evaluate promotions"})
+	}
+	cart.OrderID = txn.ID
+	res, err := svc.Evaluate(ctx, orgID, customerID, cart)
+	if err != nil {
+		return fail(http.StatusInternalServerError, gin.H{"error": "failed to evaluate promotions"})
+	}
+	had := make(map[string]bool, len(txn.CouponCodes))
+	for _, code := range txn.CouponCodes {
+		had[promotions.NormalizeCode(code)] = true
+	}
+	dropped, refused := make([]promotions.Rejection, 0), make([]promotions.Rejection, 0)
+	for _, r := range res.Rejected {
+		if had[promotions.NormalizeCode(r.CouponCode)] {
+			dropped = append(dropped, r)
+			continue
+		}
+		refused = append(refused, r)
+	}
+	if len(refused) > 0 {
+		return fail(http.StatusBadRequest, gin.H{"error": "coupon not applicable", "coupons": refused})
+	}
+	if err := svc.Redeem(ctx, orgID, customerID, res.Applied); err != nil {
+		if errors.Is(err, promotions.ErrCouponExhausted) {
+			return fail(http.StatusConflict, gin.H{"error": err.Error()})
+		}
+		return fail(http.StatusInternalServerError, gin.H{"error": "failed to redeem coupon"})
+	}
+
+	promotions.Apply(items, res)
+	return res, dropped, true
+}
@@ -0,0 +1,823 @@
+package ordersmodule
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/consignment"
+	"stockflows/server/internal/services/costing"
+	"stockflows/server/internal/services/orderevents"
+	"stockflows/server/internal/services/tax"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ============================================================================
+// Orders shipped in parts
+// ============================================================================
+//
+// An order can leave in several parcels. Each shipment carries some of the order's units
+// under its own carrier and tracking number, and its stock is committed, with COGS, when
+// it is delivered. Units not yet shipped stay reserved until they ship or are cancelled.
+// Once an order has a shipment it is fulfilled through shipments only.
+
+var errShipsInParts = errors.New("order ships in parts; deliver each shipment")
+
+var errAwaitingStock = errors.New("order has units waiting for stock; ship what is ready as a shipment")
+
+// unshipped returns the units of each product still waiting to ship
+func unshipped(txn models.Transaction) map[string]int {
+	out := make(map[string]int)
+	for _, it := range txn.Items {
+		if q := it.Quantity - it.QtyShipped - it.QtyCancelled; q > 0 {
+			out[it.ID] += q
+		}
+	}
+	return out
+}
+
+// shippable returns the unshipped units of each product that hold stock, leaving out
+// backordered units still waiting for it
+func shippable(txn models.Transaction) map[string]int {
+	out := make(map[string]int)
+	for _, it := range txn.Items {
+		if q := it.Quantity - it.QtyShipped - it.QtyCancelled - it.QtyBackordered; q > 0 {
+			out[it.ID] += q
+		}
+	}
+	return out
+}
+
+// liveShipments reports whether any shipment is on its way or delivered
+func liveShipments(txn models.Transaction) bool {
+	for _, s := range txn.Shipments {
+		if s.Status != models.ShipmentStatusCancelled {
+			return true
+		}
+	}
+	return false
+}
+
+func shipmentIndex(txn models.Transaction, id string) int {
+	for i, s := range txn.Shipments {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// shipUnits moves qty units of a product onto (or, when negative, back off) the order's
+// lines' shipped counts, filling lines in order
+func shipUnits(items []models.TransactionItem, productID string, qty int) {
+	for i := range items {
+		it := &items[i]
+		if it.ID != productID || qty == 0 {
+			continue
+		}
+		if qty > 0 {
+			take := it.Quantity - it.QtyShipped - it.QtyCancelled - it.QtyBackordered
+			if take > qty {
+				take = qty
+			}
+			if take > 0 {
+				it.QtyShipped += take
+				qty -= take
+			}
+			continue
+		}
+		back := it.QtyShipped
+		if back > -qty {
+			back = -qty
+		}
+		it.QtyShipped -= back
+		qty += back
+	}
+}
+
+// partFulfillment is the fulfillment status of an order shipped in parts
+func partFulfillment(txn models.Transaction) string {
+	left := 0
+	for _, q := range unshipped(txn) {
+		left += q
+	}
+	shipped, delivered := 0, 0
+	for _, s := range txn.Shipments {
+		switch s.Status {
+		case models.ShipmentStatusShipped:
+			shipped++
+		case models.ShipmentStatusDelivered:
+			delivered++
+		}
+	}
+	switch {
+	case shipped == 0 && delivered == 0:
+		return "PENDING"
+	case left == 0 && shipped == 0:
+		return "DELIVERED"
+	case left == 0 && delivered == 0:
+		return "SHIPPED"
+	case delivered > 0:
+		return "PARTIALLY_DELIVERED"
+	}
+	return "PARTIALLY_SHIPPED"
+}
+
+// lineCosts spreads the COGS of delivered shipments over the order's lines
+func lineCosts(items []models.TransactionItem, shipments []models.Shipment) []models.TransactionItem {
+	qty := make(map[string]int)
+	cost := make(map[string]int64)
+	for _, s := range shipments {
+		if s.Status != models.ShipmentStatusDelivered {
+			continue
+		}
+		for _, it := range s.Items {
+			qty[it.ProductID] += it.Quantity
+			cost[it.ProductID] += it.LineCost
+		}
+	}
+	out := make([]models.TransactionItem, len(items))
+	for i, it := range items {
+		if n := qty[it.ID]; n > 0 {
+			it.Cost = cost[it.ID] / int64(n)
+			take := it.Quantity - it.QtyCancelled
+			if take > n {
+				take = n
+			}
+			it.LineCost = it.Cost * int64(take)
+			qty[it.ID] -= take
+		}
+		out[i] = it
+	}
+	return out
+}
+
+// keptTotals prices an order for the units it still carries once some are cancelled. Line
+// discounts and the order discount shrink with the value dropped, shipping is kept, and tax
+// is worked out again. It sets each line's tax for its kept units and returns the tax
+// summary, the discount and the new total.
+func (m *Module) keptTotals(ctx context.Context, orgID string, txn models.Transaction, items []models.TransactionItem) (*models.TaxSummary, int64, int64) {
+	kept := make([]models.TransactionItem, len(items))
+	var gross, keptGross, discount int64
+	for i, it := range items {
+		gross += it.Price*int64(it.Quantity) - it.Discount
+		if it.Quantity > 0 {
+			q := it.Quantity - it.QtyCancelled
+			it.Discount = it.Discount * int64(q) / int64(it.Quantity)
+			it.Quantity = q
+		}
+		kept[i] = it
+		keptGross += it.Price*int64(it.Quantity) - it.Discount
+		discount += it.Discount
+	}
+	orderDiscount := keptOrderDiscount(txn)
+	if gross > 0 {
+		orderDiscount = orderDiscount * keptGross / gross
+	}
+
+	var legacyRate float64
+	if txn.Tax != nil {
+		legacyRate = txn.Tax.Rate
+	}
+	settings := tax.New(m.deps.Repo).Settings(ctx, orgID)
+	taxSummary, total := tax.Sale(settings, kept, orderDiscount, txn.ShippingCost, legacyRate)
+	for i := range items {
+		items[i].TaxRate, items[i].TaxAmount, items[i].NetAmount = kept[i].TaxRate, kept[i].TaxAmount, kept[i].NetAmount
+	}
+	return taxSummary, discount + orderDiscount, total
+}
+
+// awardPoints credits the customer for a delivered order
+func (m *Module) awardPoints(ctx context.Context, orgID string, txn models.Transaction) {
+	if strings.TrimSpace(txn.CustomerID) == "" {
+		return
+	}
+	_, _ = m.deps.Mongo.Collection(repo.ColCustomers).UpdateOne(
+		ctx,
+		bson.M{"_id": txn.CustomerID, "orgId": orgID},
+		bson.M{"$inc": bson.M{"points": int(txn.Total / 100), "totalSpent": txn.Total}},
+	)
+}
+
+func (m *Module) listShipments(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	txn, err := m.deps.Repo.GetTransactionByOrg(c.Request.Context(), orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	shipments := txn.Shipments
+	if shipments == nil {
+		shipments = []models.Shipment{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": shipments, "meta": gin.H{"unshipped": unshipped(txn), "fulfillmentStatus": txn.FulfillmentStatus}})
+}
+
+type shipmentLine struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+type createShipmentRequest struct {
+	shipRequest
+	Items []shipmentLine `json:"items"` // Empty ships everything not yet shipped
+}
+
+// createShipment sends part of an order, booked with a carrier or with tracking typed in
+func (m *Module) createShipment(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req createShipmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	switch {
+	case strings.ToUpper(txn.Type) != "SALE":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only sales can be shipped"})
+		return
+	case txn.Status == "CANCELLED" || txn.Status == "REFUNDED":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot ship cancelled or refunded orders"})
+		return
+	case txn.Status != "CONFIRMED" && txn.Status != "COMPLETED":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be confirmed before shipping"})
+		return
+	case txn.StockCommitted:
+		c.JSON(http.StatusConflict, gin.H{"error": "order has already been delivered"})
+		return
+	case len(txn.Shipments) == 0 && (txn.FulfillmentStatus == "SHIPPED" || txn.FulfillmentStatus == "DELIVERED" || txn.FulfillmentStatus == "RETURNED"):
+		c.JSON(http.StatusConflict, gin.H{"error": "order was shipped in one parcel"})
+		return
+	}
+
+	// Locked so two shipments cannot take the same units
+	txn, err = m.deps.Repo.LockTransactionForStockCommit(ctx, orgID, txn.ID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "order is being updated; try again"})
+		return
+	}
+	unlock := func() { _ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID) }
+
+	left := shippable(txn)
+	want := make(map[string]int)
+	order := make([]string, 0)
+	if len(req.Items) == 0 {
+		for _, it := range txn.Items {
+			if _, ok := want[it.ID]; !ok && left[it.ID] > 0 {
+				order = append(order, it.ID)
+				want[it.ID] = left[it.ID]
+			}
+		}
+	}
+	for _, l := range req.Items {
+		id := strings.TrimSpace(l.ProductID)
+		if id == "" || l.Quantity <= 0 {
+			unlock()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid items"})
+			return
+		}
+		if _, ok := want[id]; !ok {
+			order = append(order, id)
+		}
+		want[id] += l.Quantity
+	}
+	if len(want) == 0 {
+		unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing left to ship"})
+		return
+	}
+
+	items := append([]models.TransactionItem(nil), txn.Items...)
+	shipment := models.Shipment{
+		ID:        txn.ID + "-" + strconv.Itoa(len(txn.Shipments)+1),
+		Status:    models.ShipmentStatusShipped,
+		Items:     make([]models.ShipmentItem, 0, len(want)),
+		CreatedBy: u.ID,
+		CreatedAt: time.Now().UTC(),
+	}
+	part := txn
+	part.ID, part.Items = shipment.ID, nil
+	units := 0
+	for _, id := range order {
+		if want[id] > left[id] {
+			unlock()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quantity exceeds what is left to ship", "productId": id})
+			return
+		}
+		for _, it := range txn.Items {
+			if it.ID == id {
+				shipment.Items = append(shipment.Items, models.ShipmentItem{ProductID: id, SKU: it.SKU, Name: it.Name, Quantity: want[id]})
+				it.Quantity = want[id]
+				part.Items = append(part.Items, it)
+				break
+			}
+		}
+		shipUnits(items, id, want[id])
+		units += want[id]
+	}
+
+	s := &shipment.ShippingInfo
+	cancelBooking := func() {}
+	if req.Book {
+		booked, err := m.bookShipment(ctx, part, req.shipRequest)
+		if err != nil {
+			unlock()
+			carrierError(c, err)
+			return
+		}
+		// A parcel booked for a shipment that was never saved would be picked up unpaid for
+		cancelBooking = func() {
+			carrier, err := m.deps.Carriers.Get(booked.Carrier)
+			if err == nil {
+				err = carrier.Cancel(ctx, booked)
+			}
+			if err != nil {
+				log.Printf("orders: cancel booking %s for %s: %v", booked.TrackingNumber, shipment.ID, err)
+			}
+		}
+		s.Carrier, s.TrackingNumber, s.Service = booked.Carrier, booked.TrackingNumber, booked.Service
+		s.ExternalID, s.SortCode, s.Fee = booked.ExternalID, booked.SortCode, booked.Fee
+		s.WeightGram, s.CODAmount = req.WeightGram, req.CODAmount
+		s.BookedDate = booked.CreatedAt.Format(time.RFC3339)
+	} else {
+		s.Carrier = strings.TrimSpace(req.Carrier)
+		s.TrackingNumber = strings.TrimSpace(req.TrackingNumber)
+		s.CODAmount = req.CODAmount
+	}
+	s.ShippedDate = shipment.CreatedAt.Format(time.RFC3339)
+
+	after := txn
+	after.Items = items
+	after.Shipments = append(append([]models.Shipment(nil), txn.Shipments...), shipment)
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{
+		"items":                 items,
+		"shipments":             after.Shipments,
+		"fulfillmentStatus":     partFulfillment(after),
+		"stockCommitInProgress": false,
+	})
+	if err != nil {
+		cancelBooking()
+		unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save shipment"})
+		return
+	}
+
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventShipped,
+		Message: "Shipment " + shipment.ID + " shipped with " + strconv.Itoa(units) + " units" + carrierInfo(s),
+		Payload: map[string]interface{}{
+			"shipmentId": shipment.ID, "items": shipment.Items, "booked": req.Book,
+			"carrier": s.Carrier, "trackingNumber": s.TrackingNumber, "unshipped": unshipped(updated),
+		},
+		Before: txn.Shipments,
+		After:  updated.Shipments,
+	})
+	c.JSON(http.StatusCreated, gin.H{"data": shipment, "meta": gin.H{"unshipped": unshipped(updated), "fulfillmentStatus": updated.FulfillmentStatus}})
+}
+
+// commitShipment takes a delivered shipment's units off the shelf and computes their COGS.
+// The order is delivered, and its stock committed, once nothing is left to ship and every
+// shipment has arrived.
+func (m *Module) commitShipment(ctx context.Context, orgID string, txn models.Transaction, shipmentID string) (models.Transaction, error) {
+	locked, err := m.deps.Repo.LockTransactionForStockCommit(ctx, orgID, txn.ID)
+	if err != nil {
+		if errors.Is(err, repo.ErrConflict) {
+			return models.Transaction{}, errors.New("order is being updated; try again")
+		}
+		return models.Transaction{}, err
+	}
+	txn = locked
+	unlock := func() { _ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID) }
+
+	idx := shipmentIndex(txn, shipmentID)
+	if idx < 0 || txn.Shipments[idx].Status != models.ShipmentStatusShipped {
+		unlock()
+		return models.Transaction{}, errors.New("shipment is not on its way")
+	}
+	shipment := txn.Shipments[idx]
+	shipment.Items = append([]models.ShipmentItem(nil), shipment.Items...)
+
+	type committedItem struct {
+		productID string
+		qty       int
+		newQty    int
+	}
+	committed := make([]committedItem, 0, len(shipment.Items))
+	rollbackStock := func() {
+		for _, it := range committed {
+			_ = m.deps.Repo.UncommitReservedStock(ctx, orgID, txn.BranchID, it.productID, it.qty)
+		}
+	}
+
+	for _, it := range shipment.Items {
+		level, err := m.deps.Repo.CommitReservedStock(ctx, orgID, txn.BranchID, it.ProductID, it.Quantity)
+		if err != nil {
+			rollbackStock()
+			unlock()
+			return models.Transaction{}, errors.New("failed to commit stock")
+		}
+		committed = append(committed, committedItem{productID: it.ProductID, qty: it.Quantity, newQty: level.Quantity})
+	}
+
+	costingSvc := costing.New(m.deps.Repo)
+	lines := make([]models.CostLine, 0, len(shipment.Items))
+	var cogs int64
+	rollbackLots := func() {
+		for _, l := range lines {
+			_ = m.deps.Repo.IncrementLotRemaining(ctx, l.LotID, l.Quantity)
+		}
+	}
+	for i, it := range shipment.Items {
+		product, err := m.deps.Repo.GetProductByOrg(ctx, orgID, it.ProductID)
+		if err != nil {
+			rollbackLots()
+			rollbackStock()
+			unlock()
+			return models.Transaction{}, errors.New("failed to get product for COGS calculation")
+		}
+		result, err := costingSvc.ComputeCOGS(ctx, orgID, txn.BranchID, product, it.Quantity)
+		if err != nil && errors.Is(err, repo.ErrInsufficientLots) {
+			// As for whole orders: cover the shortfall with a lot at the last purchase cost
+			_, _ = m.deps.Repo.CreateInventoryLot(ctx, models.InventoryLot{
+				ID:           primitive.NewObjectID().Hex(),
+				OrgID:        orgID,
+				BranchID:     txn.BranchID,
+				ProductID:    it.ProductID,
+				Source:       "ADJUSTMENT",
+				UnitCost:     product.Cost,
+				QtyReceived:  it.Quantity,
+				QtyRemaining: it.Quantity,
+				ReceivedAt:   time.Now().UTC(),
+			})
+			result, err = costingSvc.ComputeCOGS(ctx, orgID, txn.BranchID, product, it.Quantity)
+		}
+		if err != nil {
+			rollbackLots()
+			rollbackStock()
+			unlock()
+			return models.Transaction{}, err
+		}
+		_ = costingSvc.UpdateMovingAverageOnSale(ctx, orgID, it.ProductID, it.Quantity)
+
+		lines = append(lines, result.CostLines...)
+		shipment.Items[i].LineCost = result.TotalCOGS
+		shipment.Items[i].Cost = result.TotalCOGS / int64(it.Quantity)
+		cogs += result.TotalCOGS
+	}
+
+	shipment.Status = models.ShipmentStatusDelivered
+	shipment.StockCommitted = true
+	shipment.COGS = cogs
+	shipment.CostLines = lines
+	shipment.DeliveredDate = time.Now().UTC().Format(time.RFC3339)
+
+	after := txn
+	after.Shipments = append([]models.Shipment(nil), txn.Shipments...)
+	after.Shipments[idx] = shipment
+	fulfillment := partFulfillment(after)
+	items := lineCosts(txn.Items, after.Shipments)
+	patch := bson.M{
+		"shipments":             after.Shipments,
+		"items":                 items,
+		"fulfillmentStatus":     fulfillment,
+		"cogs":                  txn.COGS + cogs,
+		"profit":                txn.Total - txn.COGS - cogs,
+		"costLines":             append(append([]models.CostLine(nil), txn.CostLines...), lines...),
+		"stockCommitInProgress": false,
+	}
+	if fulfillment == "DELIVERED" {
+		patch["stockCommitted"] = true
+	}
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, patch)
+	if err != nil {
+		rollbackLots()
+		rollbackStock()
+		unlock()
+		return models.Transaction{}, err
+	}
+
+	for i, it := range shipment.Items {
+		m.deps.Repo.CreateStockMovement(ctx, models.StockMovement{
+			ID:               "MV-" + primitive.NewObjectID().Hex(),
+			OrgID:            orgID,
+			BranchID:         updated.BranchID,
+			ProductID:        it.ProductID,
+			Type:             "SALE_OUT",
+			Quantity:         it.Quantity,
+			PreviousQuantity: committed[i].newQty + it.Quantity,
+			NewQuantity:      committed[i].newQty,
+			UnitCost:         it.Cost,
+			TotalCost:        it.LineCost,
+			ReferenceType:    "ORDER",
+			ReferenceID:      updated.ID,
+			ReferenceNumber:  shipment.ID,
+			CreatedBy:        updated.UserID,
+		})
+	}
+	if _, err := consignment.New(m.deps.Repo).RecordSale(ctx, orgID, updated, lines); err != nil {
+		log.Printf("orders: consignor payables for shipment %s: %v", shipment.ID, err)
+	}
+	if updated.StockCommitted {
+		m.awardPoints(ctx, orgID, updated)
+	}
+	return updated, nil
+}
+
+func (m *Module) deliverShipment(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if txn.Status == "CANCELLED" || txn.Status == "REFUNDED" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot deliver cancelled or refunded orders"})
+		return
+	}
+	idx := shipmentIndex(txn, c.Param("shipmentId"))
+	if idx < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shipment not found"})
+		return
+	}
+	if txn.Shipments[idx].Status != models.ShipmentStatusShipped {
+		c.JSON(http.StatusConflict, gin.H{"error": "shipment is already " + strings.ToLower(txn.Shipments[idx].Status)})
+		return
+	}
+
+	updated, err := m.commitShipment(ctx, orgID, txn, txn.Shipments[idx].ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m.recordEvent(c, *u, updated, shipmentDeliveredChange(txn, updated, idx))
+	c.JSON(http.StatusOK, gin.H{"data": updated.Shipments[idx], "meta": gin.H{"fulfillmentStatus": updated.FulfillmentStatus}})
+}
+
+// shipmentDeliveredChange describes a shipment handed to the customer
+func shipmentDeliveredChange(before, after models.Transaction, idx int) orderevents.Change {
+	s := after.Shipments[idx]
+	msg := "Shipment " + s.ID + " delivered"
+	if after.FulfillmentStatus == "DELIVERED" {
+		msg += "; order delivered"
+	}
+	return orderevents.Change{
+		Type:    models.OrderEventDelivered,
+		Message: msg,
+		Payload: map[string]interface{}{"shipmentId": s.ID, "cogs": s.COGS, "stockCommitted": after.StockCommitted},
+		Before:  before.Shipments[idx],
+		After:   s,
+	}
+}
+
+// cancelShipmentPart calls back a shipment that has not been delivered. Its units go back
+// to waiting to ship and keep their reservation.
+func (m *Module) cancelShipmentPart(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	idx := shipmentIndex(txn, c.Param("shipmentId"))
+	if idx < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "shipment not found"})
+		return
+	}
+	if txn.Shipments[idx].Status != models.ShipmentStatusShipped {
+		c.JSON(http.StatusConflict, gin.H{"error": "shipment is already " + strings.ToLower(txn.Shipments[idx].Status)})
+		return
+	}
+	txn, err = m.deps.Repo.LockTransactionForStockCommit(ctx, orgID, txn.ID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "order is being updated; try again"})
+		return
+	}
+	unlock := func() { _ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID) }
+	if txn.Shipments[idx].Status != models.ShipmentStatusShipped {
+		unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": "shipment is already " + strings.ToLower(txn.Shipments[idx].Status)})
+		return
+	}
+
+	shipment := txn.Shipments[idx]
+	if shipment.BookedDate != "" {
+		carrier, err := m.deps.Carriers.Get(shipment.Carrier)
+		if err == nil {
+			err = carrier.Cancel(ctx, shipmentOf(&shipment.ShippingInfo))
+		}
+		if err != nil {
+			unlock()
+			carrierError(c, err)
+			return
+		}
+	}
+	shipment.Status = models.ShipmentStatusCancelled
+
+	items := append([]models.TransactionItem(nil), txn.Items...)
+	for _, it := range shipment.Items {
+		shipUnits(items, it.ProductID, -it.Quantity)
+	}
+	after := txn
+	after.Items = items
+	after.Shipments = append([]models.Shipment(nil), txn.Shipments...)
+	after.Shipments[idx] = shipment
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{
+		"items":                 items,
+		"shipments":             after.Shipments,
+		"fulfillmentStatus":     partFulfillment(after),
+		"stockCommitInProgress": false,
+	})
+	if err != nil {
+		unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+		return
+	}
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventShipmentCancelled,
+		Message: "Shipment " + shipment.ID + " cancelled" + carrierInfo(&shipment.ShippingInfo),
+		Payload: map[string]interface{}{"shipmentId": shipment.ID, "carrier": shipment.Carrier, "trackingNumber": shipment.TrackingNumber},
+		Before:  txn.Shipments[idx],
+		After:   shipment,
+	})
+	c.JSON(http.StatusOK, gin.H{"data": shipment, "meta": gin.H{"unshipped": unshipped(updated), "fulfillmentStatus": updated.FulfillmentStatus}})
+}
+
+type cancelRemainingRequest struct {
+	Reason string `json:"reason"`
+}
+
+// cancelRemaining drops the units of a part-shipped order that have not shipped, releasing
+// only their reservations. Shipments already sent are left to arrive. The order is priced
+// again for the units it still carries, so points, COD expected and profit follow what the
+// customer actually gets; anything paid for the dropped units is refunded through the
+// payment ledger.
+func (m *Module) cancelRemaining(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req cancelRemainingRequest
+	_ = c.ShouldBindJSON(&req) // Optional body
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if txn.Status == "CANCELLED" || txn.Status == "REFUNDED" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order is already cancelled"})
+		return
+	}
+	if !liveShipments(txn) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing has shipped; cancel the order instead"})
+		return
+	}
+	txn, err = m.deps.Repo.LockTransactionForStockCommit(ctx, orgID, txn.ID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "order is being updated; try again"})
+		return
+	}
+	unlock := func() { _ = m.deps.Repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID) }
+
+	if len(unshipped(txn)) == 0 {
+		unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing left to ship"})
+		return
+	}
+	left := shippable(txn) // Backordered units hold no reservation to release
+	ids := make([]string, 0, len(left))
+	for id := range left {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		_, _ = m.deps.Repo.ReleaseReservedStock(ctx, orgID, txn.BranchID, id, left[id])
+	}
+
+	items := append([]models.TransactionItem(nil), txn.Items...)
+	for i := range items {
+		if q := items[i].Quantity - items[i].QtyShipped - items[i].QtyCancelled; q > 0 {
+			items[i].QtyCancelled += q
+			items[i].QtyBackordered = 0
+		}
+	}
+	taxSummary, discount, total := m.keptTotals(ctx, orgID, txn, items)
+	value := txn.Total - total
+
+	after := txn
+	after.Items = items
+	fulfillment := partFulfillment(after)
+	patch := bson.M{
+		"items":                 items,
+		"fulfillmentStatus":     fulfillment,
+		"total":                 total,
+		"tax":                   taxSummary,
+		"discountAmount":        discount,
+		"stockCommitInProgress": false,
+	}
+	if txn.COD != nil && txn.COD.RemittanceID == "" {
+		cod := *txn.COD
+		cod.Expected -= value
+		if cod.Expected < 0 {
+			cod.Expected = 0
+		}
+		patch["cod"] = cod
+	}
+	if txn.PaidAmount > 0 {
+		patch["paymentStatus"] = models.PaymentStatusFor(total, txn.PaidAmount)
+	}
+	if fulfillment == "DELIVERED" {
+		patch["stockCommitted"] = true
+		patch["profit"] = total - txn.COGS
+	}
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, patch)
+	if err != nil {
+		// The reservations are gone; put them back before giving up
+		for _, id := range ids {
+			_, _ = m.deps.Repo.ReserveStock(ctx, orgID, txn.BranchID, id, left[id])
+		}
+		unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+		return
+	}
+	if updated.StockCommitted {
+		m.awardPoints(ctx, orgID, updated)
+	}
+
+	msg := "Unshipped remainder cancelled"
+	if r := strings.TrimSpace(req.Reason); r != "" {
+		msg += ": " + r
+	}
+
+	// Money paid for the dropped units goes back through the ledger
+	refunds, err := m.refundExcess(ctx, orgID, updated, u.ID, msg)
+	if err != nil {
+		log.Printf("orders: refund cancelled remainder of %s: %v", updated.ID, err)
+	}
+	if len(refunds) > 0 {
+		if synced, _, err := m.syncPayments(ctx, orgID, updated); err == nil {
+			updated = synced
+		}
+	}
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventFulfillment,
+		Message: msg,
+		Payload: map[string]interface{}{
+			"released": left, "cancelledValue": value, "reason": strings.TrimSpace(req.Reason),
+			"from": txn.FulfillmentStatus, "to": updated.FulfillmentStatus,
+		},
+		Before: txn.Items,
+		After:  updated.Items,
+	})
+	for _, p := range refunds {
+		m.recordEvent(c, *u, updated, paymentChange(p))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": updated, "meta": gin.H{"released": left, "cancelledValue": value, "refunds": refunds}})
+}
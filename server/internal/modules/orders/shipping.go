@@ -0,0 +1,272 @@
+package ordersmodule
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/carriers"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/documents"
+	"stockflows/server/internal/services/orderevents"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// bookShipment books the order's parcel with a carrier adapter
+func (m *Module) bookShipment(ctx context.Context, txn models.Transaction, req shipRequest) (carriers.Shipment, error) {
+	carrier, err := m.deps.Carriers.Get(req.Carrier)
+	if err != nil {
+		return carriers.Shipment{}, err
+	}
+	sr := m.shipmentRequest(ctx, txn)
+	sr.Service = strings.TrimSpace(req.Service)
+	sr.TrackingNumber = strings.TrimSpace(req.TrackingNumber)
+	sr.CODAmount = req.CODAmount
+	if req.WeightGram > 0 {
+		sr.Parcel.WeightGram = req.WeightGram
+	}
+	return carrier.CreateShipment(ctx, sr)
+}
+
+// shipmentRequest describes the order's parcel: sent from its branch to the recipient
+func (m *Module) shipmentRequest(ctx context.Context, txn models.Transaction) carriers.ShipmentRequest {
+	sr := carriers.ShipmentRequest{
+		Reference: txn.ID,
+		Recipient: carriers.Address{Name: txn.RecipientName, Phone: txn.RecipientPhone, Address: txn.RecipientAddress},
+	}
+	if org, err := m.deps.Repo.GetOrg(ctx, txn.OrgID); err == nil {
+		sr.Sender.Name, sr.Sender.Address = org.Name, org.Address
+	}
+	if branch, err := m.deps.Repo.GetBranchByOrg(ctx, txn.OrgID, txn.BranchID); err == nil {
+		sr.Sender.Phone = branch.Phone
+		if branch.Address != "" {
+			sr.Sender.Address = branch.Address
+		}
+	}
+
+	sr.Sender.PostalCode = carriers.PostalCode(sr.Sender.Address)
+	sr.Recipient.PostalCode = carriers.PostalCode(sr.Recipient.Address)
+
+	units, weight := 0, 0
+	for _, it := range txn.Items {
+		units += it.Quantity
+		if p, err := m.deps.Repo.GetProductByOrg(ctx, txn.OrgID, it.ID); err == nil {
+			weight += p.WeightGram * it.Quantity
+		}
+	}
+	sr.Parcel.WeightGram = weight
+	sr.Description = strconv.Itoa(units) + " items"
+	if units == 1 {
+		sr.Description = "1 item"
+	}
+	return sr
+}
+
+// shipmentOf rebuilds the carrier's view of a booked shipment from the order
+func shipmentOf(s *models.ShippingInfo) carriers.Shipment {
+	sh := carriers.Shipment{
+		Carrier:        s.Carrier,
+		Service:        s.Service,
+		TrackingNumber: s.TrackingNumber,
+		ExternalID:     s.ExternalID,
+		SortCode:       s.SortCode,
+		Fee:            s.Fee,
+	}
+	if t, err := time.Parse(time.RFC3339, s.BookedDate); err == nil {
+		sh.CreatedAt = t
+	} else if t, err := time.Parse(time.RFC3339, s.ShippedDate); err == nil {
+		sh.CreatedAt = t
+	}
+	return sh
+}
+
+// carrierError responds to a failed carrier call
+func carrierError(c *gin.Context, err error) {
+	var apiErr carriers.APIError
+	switch {
+	case errors.Is(err, carriers.ErrUnknownCarrier):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown carrier"})
+	case errors.Is(err, carriers.ErrIncomplete), errors.Is(err, carriers.ErrTrackingMissing), errors.Is(err, carriers.ErrUnsupported):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, carriers.ErrNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, carriers.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &apiErr):
+		c.JSON(http.StatusBadGateway, gin.H{"error": apiErr.Error()})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": "carrier request failed"})
+	}
+}
+
+// getLabel prints the shipping label in 4x6, A5 or A4. Booked carriers supply their own
+// label where they can; otherwise, and for carriers entered by hand, it is rendered here.
+func (m *Module) getLabel(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+	size, ok := carriers.ParseLabelSize(c.Query("size"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be 4x6, A5 or A4"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if txn.ShippingInfo == nil || txn.ShippingInfo.TrackingNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order has no tracking number"})
+		return
+	}
+	sh := shipmentOf(txn.ShippingInfo)
+
+	carrierName := sh.Carrier
+	if carrier, err := m.deps.Carriers.Get(sh.Carrier); err == nil {
+		carrierName = carrier.Name()
+		if txn.ShippingInfo.BookedDate != "" {
+			data, err := carrier.Label(ctx, sh, size)
+			if err == nil {
+				m.sendLabel(c, txn.ID, size, data)
+				return
+			}
+			if !errors.Is(err, carriers.ErrUnsupported) {
+				carrierError(c, err)
+				return
+			}
+		}
+	}
+
+	sr := m.shipmentRequest(ctx, txn)
+	weight := txn.ShippingInfo.WeightGram
+	if weight == 0 {
+		weight = sr.Parcel.WeightGram
+	}
+	regular, bold, err := documents.Fonts(m.deps.Config.Documents)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load document fonts"})
+		return
+	}
+	m.sendLabel(c, txn.ID, size, carriers.RenderLabel(size, carriers.LabelData{
+		CarrierName: carrierName,
+		Shipment:    sh,
+		Sender:      sr.Sender,
+		Recipient:   sr.Recipient,
+		Reference:   txn.ID,
+		CODAmount:   txn.ShippingInfo.CODAmount,
+		WeightGram:  weight,
+		Contents:    sr.Description,
+	}, regular, bold))
+}
+
+func (m *Module) sendLabel(c *gin.Context, orderID string, size carriers.LabelSize, data []byte) {
+	disposition := "inline"
+	if _, ok := c.GetQuery("download"); ok {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition+`; filename="label-`+orderID+"-"+string(size)+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// getTracking asks the carrier where the parcel is
+func (m *Module) getTracking(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if txn.ShippingInfo == nil || txn.ShippingInfo.TrackingNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order has no tracking number"})
+		return
+	}
+	carrier, err := m.deps.Carriers.Get(txn.ShippingInfo.Carrier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "carrier " + txn.ShippingInfo.Carrier + " has no integration"})
+		return
+	}
+	tracking, err := carrier.Track(ctx, txn.ShippingInfo.TrackingNumber)
+	if err != nil {
+		carrierError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": tracking, "meta": gin.H{"carrier": carrier.Code()}})
+}
+
+// cancelShipment cancels a booking with the carrier and takes the order back to PACKED
+// (or PENDING if it was never packed) so it can be booked again
+func (m *Module) cancelShipment(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	s := txn.ShippingInfo
+	if s == nil || s.BookedDate == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order has no booked shipment"})
+		return
+	}
+	if txn.FulfillmentStatus == "DELIVERED" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot cancel a delivered shipment"})
+		return
+	}
+	carrier, err := m.deps.Carriers.Get(s.Carrier)
+	if err != nil {
+		carrierError(c, err)
+		return
+	}
+	if err := carrier.Cancel(ctx, shipmentOf(s)); err != nil {
+		carrierError(c, err)
+		return
+	}
+
+	before := *s
+	s.TrackingNumber, s.LabelURL, s.Service, s.ExternalID, s.SortCode = "", "", "", "", ""
+	s.Fee, s.CODAmount, s.BookedDate, s.ShippedDate = 0, 0, "", ""
+	status := "PENDING"
+	if s.PackedDate != "" {
+		status = "PACKED"
+	}
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{
+		"fulfillmentStatus": status,
+		"shippingInfo":      s,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+		return
+	}
+	m.recordEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventShipmentCancelled,
+		Message: "Cancelled " + carrier.Name() + " shipment " + before.TrackingNumber,
+		Payload: map[string]interface{}{"carrier": carrier.Code(), "trackingNumber": before.TrackingNumber},
+		Before:  before,
+		After:   updated.ShippingInfo,
+	})
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
@@ -0,0 +1,389 @@
+package ordersmodule
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/carriers"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/orderevents"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxWebhookBody caps what a carrier may push in one request
+const maxWebhookBody = 1 << 20
+
+// carrierWebhook receives tracking updates pushed by a carrier. It needs no login: the
+// carrier's adapter verifies the request, and updates only reach orders shipped with that
+// carrier under the pushed tracking number. Parcels we do not know are acknowledged and
+// listed as unmatched so the carrier stops retrying them.
+func (m *Module) carrierWebhook(c *gin.Context) {
+	carrier, err := m.deps.Carriers.Get(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown carrier"})
+		return
+	}
+	receiver, ok := carrier.(carriers.WebhookReceiver)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "carrier does not send webhooks"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	events, err := receiver.ParseWebhook(c.Request, body)
+	if errors.Is(err, carriers.ErrBadSignature) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	// Group updates by parcel, keeping the order they arrived in
+	parcels := make([]string, 0)
+	byParcel := map[string][]models.TrackingEvent{}
+	for _, e := range events {
+		if _, seen := byParcel[e.TrackingNumber]; !seen {
+			parcels = append(parcels, e.TrackingNumber)
+		}
+		byParcel[e.TrackingNumber] = append(byParcel[e.TrackingNumber], models.TrackingEvent{
+			Time:        e.Event.Time.UTC(),
+			Status:      string(e.Event.Status),
+			Description: strings.TrimSpace(e.Event.Description),
+			Location:    strings.TrimSpace(e.Event.Location),
+			Code:        e.Event.Code,
+		})
+	}
+
+	ctx := c.Request.Context()
+	updated, unmatched := 0, make([]string, 0)
+	for _, tn := range parcels {
+		txn, shipmentID, ok := m.orderForParcel(ctx, carrier, tn)
+		if !ok {
+			unmatched = append(unmatched, tn)
+			continue
+		}
+		apply := m.applyTracking
+		if shipmentID != "" {
+			apply = func(c *gin.Context, carrier carriers.Carrier, txn models.Transaction, events []models.TrackingEvent) error {
+				return m.applyShipmentTracking(c, carrier, txn, shipmentID, events)
+			}
+		}
+		if err := apply(c, carrier, txn, byParcel[tn]); err != nil {
+			// Carriers retry failed pushes; stored scans are not repeated, and a delivery
+			// whose commit failed is finished from the order's state on the retry
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update order"})
+			return
+		}
+		updated++
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"updated": updated, "unmatched": unmatched}})
+}
+
+// orderForParcel finds the order shipped with the carrier under a tracking number, and the
+// shipment when the parcel is one part of the order. Orders whose carrier was typed in by
+// hand match on the carrier's name as well as its code.
+func (m *Module) orderForParcel(ctx context.Context, carrier carriers.Carrier, trackingNumber string) (models.Transaction, string, bool) {
+	txns, err := m.deps.Repo.ListTransactionsByTracking(ctx, trackingNumber)
+	if err != nil {
+		return models.Transaction{}, "", false
+	}
+	sameCarrier := func(name string) bool {
+		name = strings.TrimSpace(name)
+		return strings.EqualFold(name, carrier.Code()) || strings.EqualFold(name, carrier.Name())
+	}
+	for _, txn := range txns {
+		for _, s := range txn.Shipments {
+			if s.TrackingNumber == trackingNumber && sameCarrier(s.Carrier) {
+				return txn, s.ID, true
+			}
+		}
+		if txn.ShippingInfo != nil && txn.ShippingInfo.TrackingNumber == trackingNumber && sameCarrier(txn.ShippingInfo.Carrier) {
+			return txn, "", true
+		}
+	}
+	return models.Transaction{}, "", false
+}
+
+// applyTracking stores new tracking events on the order and moves its fulfillment along:
+// a parcel on its way marks the order shipped, delivery commits the sale's stock, and a
+// parcel returned to sender opens a customer return to receive it back. Failed delivery
+// attempts are only recorded; the carrier retries or returns the parcel. Delivery and
+// return are decided from the stored scans against the order's fulfillment, so a retried
+// push finishes a commit that failed after its scans were saved.
+func (m *Module) applyTracking(c *gin.Context, carrier carriers.Carrier, txn models.Transaction, events []models.TrackingEvent) error {
+	ctx := c.Request.Context()
+	s := txn.ShippingInfo
+
+	added := make([]models.TrackingEvent, 0, len(events))
+	for _, e := range events {
+		if hasTrackingEvent(s.TrackingEvents, e) {
+			continue
+		}
+		s.TrackingEvents = append(s.TrackingEvents, e)
+		added = append(added, e)
+	}
+	if len(s.TrackingEvents) == 0 {
+		return nil
+	}
+	sort.SliceStable(s.TrackingEvents, func(i, j int) bool {
+		return s.TrackingEvents[i].Time.Before(s.TrackingEvents[j].Time)
+	})
+	last := s.TrackingEvents[len(s.TrackingEvents)-1]
+	s.TrackingStatus = last.Status
+
+	cancelled := txn.Status == "CANCELLED" || txn.Status == "REFUNDED"
+	// Changes are recorded as made by the carrier
+	actor := models.User{ID: "carrier:" + strings.ToLower(carrier.Code()), OrgID: txn.OrgID, Name: carrier.Name()}
+	updated := txn
+	if len(added) > 0 {
+		patch := bson.M{"shippingInfo": s}
+		switch carriers.Status(last.Status) {
+		case carriers.StatusPickedUp, carriers.StatusInTransit, carriers.StatusOutForDelivery:
+			switch txn.FulfillmentStatus {
+			case "PENDING", "PICKING", "PACKED":
+				if !cancelled {
+					patch["fulfillmentStatus"] = "SHIPPED"
+					if s.ShippedDate == "" {
+						s.ShippedDate = last.Time.Format(time.RFC3339)
+					}
+				}
+			}
+		}
+		var err error
+		updated, err = m.deps.Repo.UpdateTransactionByOrg(ctx, txn.OrgID, txn.ID, patch)
+		if err != nil {
+			return err
+		}
+
+		sort.SliceStable(added, func(i, j int) bool { return added[i].Time.Before(added[j].Time) })
+		for _, e := range added {
+			m.recordEvent(c, actor, updated, orderevents.Change{
+				Type:    models.OrderEventTracking,
+				Message: carrier.Name() + ": " + trackingMessage(e),
+				Payload: map[string]interface{}{
+					"status": e.Status, "description": e.Description, "location": e.Location,
+					"code": e.Code, "time": e.Time.Format(time.RFC3339), "trackingNumber": s.TrackingNumber,
+				},
+			})
+		}
+		if updated.FulfillmentStatus == "SHIPPED" && txn.FulfillmentStatus != "SHIPPED" {
+			m.recordEvent(c, actor, updated, shippedChange(txn, updated, false))
+		}
+	}
+
+	var err error
+
+	reason := carrier.Name() + " reported " + strings.ReplaceAll(strings.ToLower(last.Status), "_", " ")
+	if last.Description != "" {
+		reason += ": " + last.Description
+	}
+	switch carriers.Status(last.Status) {
+	case carriers.StatusDelivered:
+		if !cancelled && updated.FulfillmentStatus != "DELIVERED" {
+			before := updated
+			if strings.ToUpper(updated.Type) == "SALE" {
+				updated, err = m.commitSaleDelivered(ctx, txn.OrgID, updated, "", "")
+			} else {
+				updated, err = m.deps.Repo.UpdateTransactionByOrg(ctx, txn.OrgID, txn.ID, bson.M{"fulfillmentStatus": "DELIVERED"})
+			}
+			if err != nil {
+				return err
+			}
+			m.recordEvent(c, actor, updated, deliveredChange(before, updated))
+		}
+	case carriers.StatusReturned:
+		if updated.FulfillmentStatus != "RETURNED" && updated.FulfillmentStatus != "DELIVERED" {
+			before := updated
+			var ret models.Return
+			if !cancelled && !updated.StockCommitted {
+				if ret, err = m.openReturnToSender(ctx, actor, updated, reason); err != nil {
+					return err
+				}
+				reason += " (return " + ret.ReferenceNo + ")"
+			}
+			updated, err = m.deps.Repo.UpdateTransactionByOrg(ctx, txn.OrgID, txn.ID, bson.M{"fulfillmentStatus": "RETURNED"})
+			if err != nil {
+				return err
+			}
+			ch := fulfillmentChange(before, updated)
+			ch.Message = reason
+			m.recordEvent(c, actor, updated, ch)
+			if ret.ID != "" {
+				m.recordEvent(c, actor, updated, orderevents.Change{
+					Type:    models.OrderEventReturnOpened,
+					Message: "Return " + ret.ReferenceNo + " opened for the parcel coming back",
+					Payload: map[string]interface{}{"returnId": ret.ID, "referenceNo": ret.ReferenceNo, "returnedToSender": true},
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// applyShipmentTracking stores new tracking events on one shipment of an order shipped in
+// parts. Delivery commits the shipment's stock; other updates are only recorded, and a
+// parcel returned to sender is left for staff to cancel so its units can ship again. As
+// for whole orders, a delivered scan on a shipment still marked shipped commits it even
+// when the scan was stored by an earlier push.
+func (m *Module) applyShipmentTracking(c *gin.Context, carrier carriers.Carrier, txn models.Transaction, shipmentID string, events []models.TrackingEvent) error {
+	ctx := c.Request.Context()
+	idx := shipmentIndex(txn, shipmentID)
+	if idx < 0 {
+		return nil
+	}
+	s := txn.Shipments[idx].ShippingInfo
+
+	added := make([]models.TrackingEvent, 0, len(events))
+	for _, e := range events {
+		if hasTrackingEvent(s.TrackingEvents, e) {
+			continue
+		}
+		s.TrackingEvents = append(s.TrackingEvents, e)
+		added = append(added, e)
+	}
+	if len(s.TrackingEvents) == 0 {
+		return nil
+	}
+	sort.SliceStable(s.TrackingEvents, func(i, j int) bool {
+		return s.TrackingEvents[i].Time.Before(s.TrackingEvents[j].Time)
+	})
+	last := s.TrackingEvents[len(s.TrackingEvents)-1]
+	s.TrackingStatus = last.Status
+
+	actor := models.User{ID: "carrier:" + strings.ToLower(carrier.Code()), OrgID: txn.OrgID, Name: carrier.Name()}
+	updated := txn
+	if len(added) > 0 {
+		key := "shipments." + strconv.Itoa(idx) + "."
+		var err error
+		updated, err = m.deps.Repo.UpdateTransactionByOrg(ctx, txn.OrgID, txn.ID, bson.M{
+			key + "trackingEvents": s.TrackingEvents,
+			key + "trackingStatus": s.TrackingStatus,
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.SliceStable(added, func(i, j int) bool { return added[i].Time.Before(added[j].Time) })
+		for _, e := range added {
+			m.recordEvent(c, actor, updated, orderevents.Change{
+				Type:    models.OrderEventTracking,
+				Message: carrier.Name() + ": " + trackingMessage(e) + " (shipment " + shipmentID + ")",
+				Payload: map[string]interface{}{
+					"status": e.Status, "description": e.Description, "location": e.Location, "code": e.Code,
+					"time": e.Time.Format(time.RFC3339), "trackingNumber": s.TrackingNumber, "shipmentId": shipmentID,
+				},
+			})
+		}
+	}
+
+	cancelled := updated.Status == "CANCELLED" || updated.Status == "REFUNDED"
+	if carriers.Status(last.Status) == carriers.StatusDelivered && !cancelled &&
+		updated.Shipments[idx].Status == models.ShipmentStatusShipped {
+		delivered, err := m.commitShipment(ctx, txn.OrgID, updated, shipmentID)
+		if err != nil {
+			return err
+		}
+		m.recordEvent(c, actor, delivered, shipmentDeliveredChange(updated, delivered, idx))
+	}
+	return nil
+}
+
+// trackingMessage describes a carrier scan for the order's history
+func trackingMessage(e models.TrackingEvent) string {
+	msg := e.Description
+	if msg == "" {
+		msg = strings.ReplaceAll(strings.ToLower(e.Status), "_", " ")
+	}
+	if e.Location != "" {
+		msg += " (" + e.Location + ")"
+	}
+	return msg
+}
+
+// hasTrackingEvent reports whether a pushed event is already stored; carriers resend
+// events when a push is not acknowledged
+func hasTrackingEvent(events []models.TrackingEvent, e models.TrackingEvent) bool {
+	for _, x := range events {
+		if x.Time.Equal(e.Time) && x.Status == e.Status && x.Code == e.Code {
+			return true
+		}
+	}
+	return false
+}
+
+// openReturnToSender opens an approved customer return for a parcel the carrier is
+// bringing back, so the branch can receive it. One is opened per order.
+func (m *Module) openReturnToSender(ctx context.Context, actor models.User, txn models.Transaction, reason string) (models.Return, error) {
+	existing, err := m.deps.Repo.ListReturnsByOriginalOrder(ctx, txn.OrgID, txn.ID)
+	if err != nil {
+		return models.Return{}, err
+	}
+	for _, r := range existing {
+		if r.ReturnedToSender && r.Status != models.ReturnStatusCancelled {
+			return r, nil
+		}
+	}
+
+	now := time.Now().UTC()
+	ret := models.Return{
+		ID:               "rma-" + primitive.NewObjectID().Hex(),
+		OrgID:            txn.OrgID,
+		BranchID:         txn.BranchID,
+		Type:             models.ReturnTypeCustomer,
+		Status:           models.ReturnStatusApproved,
+		OriginalOrderID:  txn.ID,
+		OriginalRefNo:    txn.ID,
+		ReturnedToSender: true,
+		CustomerID:       txn.CustomerID,
+		CustomerName:     txn.RecipientName,
+		CustomerPhone:    txn.RecipientPhone,
+		RequestReason:    reason,
+		RequestedBy:      actor.ID,
+		ApprovedBy:       actor.ID,
+		RequestedAt:      now,
+		ApprovedAt:       now,
+	}
+	// The whole parcel comes back, so the return reverses every line and all of the VAT
+	for _, it := range txn.Items {
+		ret.Items = append(ret.Items, models.ReturnItem{
+			ProductID:   it.ID,
+			ProductName: it.Name,
+			ProductSKU:  it.SKU,
+			Quantity:    it.Quantity,
+			UnitCost:    it.Cost,
+			UnitPrice:   it.Price,
+			Reason:      models.ReturnReasonUndeliverable,
+			Restockable: true,
+			TaxClass:    it.TaxClass,
+			TaxAmount:   it.TaxAmount,
+			NetAmount:   it.NetAmount,
+		})
+		ret.TotalValue += int64(it.Quantity) * it.Price
+	}
+	if txn.Tax != nil {
+		sum := *txn.Tax
+		ret.Tax = &sum
+	}
+
+	seq, err := m.deps.Repo.NextCounter(ctx, "rma:"+txn.OrgID)
+	if err != nil {
+		return models.Return{}, err
+	}
+	ret.ReferenceNo = repo.FormatReturnReference(seq)
+	return m.deps.Repo.CreateReturn(ctx, ret)
+}
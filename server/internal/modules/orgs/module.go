@@ -7,7 +7,9 @@ import (
 	"stockflows/server/internal/auth"
 	"stockflows/server/internal/deps"
 	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/analysis"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/gin-gonic/gin"
@@ -27,6 +29,8 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 
 	g.GET("", m.list)
 	g.POST("", auth.RequireRoles(models.RolePlatformAdmin), m.create)
+	g.GET("/settings", m.getSettings)
+	g.PATCH("/settings", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin), m.updateSettings)
 }
 
 func (m *Module) list(c *gin.Context) {
@@ -100,3 +104,83 @@ func (m *Module) create(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"org": org})
 }
 
+func (m *Module) getSettings(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	org, err := m.deps.Repo.GetOrg(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "org not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": org.Settings,
+		"meta": gin.H{
+			"writeOffApprovalThreshold": org.Settings.ApprovalThreshold(),
+			"classification":            org.Settings.Classification.WithDefaults(),
+			"vatRate":                   org.Settings.Tax.Rate(),
+		},
+	})
+}
+
+type updateSettingsRequest struct {
+	WriteOffApprovalThreshold *int64                       `json:"writeOffApprovalThreshold"`
+	Classification            *models.ClassificationPolicy `json:"classification"`
+	Tax                       *models.TaxSettings          `json:"tax"`
+}
+
+func (m *Module) updateSettings(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req updateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	patch := bson.M{}
+	if req.WriteOffApprovalThreshold != nil {
+		if *req.WriteOffApprovalThreshold < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "writeOffApprovalThreshold must be >= 0"})
+			return
+		}
+		patch["settings.writeOffApprovalThreshold"] = *req.WriteOffApprovalThreshold
+	}
+	if req.Classification != nil {
+		p := *req.Classification
+		p.Scope = strings.ToUpper(strings.TrimSpace(p.Scope))
+		p.Basis = strings.ToUpper(strings.TrimSpace(p.Basis))
+		if err := analysis.ValidateClassification(p.WithDefaults()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		patch["settings.classification"] = p
+	}
+	if req.Tax != nil {
+		if req.Tax.StandardRate < 0 || req.Tax.StandardRate > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tax standardRate must be between 0 and 100"})
+			return
+		}
+		patch["settings.tax"] = *req.Tax
+	}
+	if len(patch) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
+		return
+	}
+
+	org, err := m.deps.Repo.UpdateOrg(c.Request.Context(), orgID, patch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update settings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": org.Settings})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"stockflows/server/internal/auth"
 	"stockflows/server/internal/deps"
@@ -37,6 +38,7 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 	g.POST("", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.create)
 	g.POST("/:id/image", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.uploadImage)
 	g.PATCH("/:id", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.update)
+	g.POST("/:id/standard-cost", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin), m.setStandardCost)
 	g.DELETE("/:id", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.delete)
 }
 
@@ -103,16 +105,22 @@ func (m *Module) get(c *gin.Context) {
 }
 
 type createProductRequest struct {
-	SKU         string `json:"sku"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Price       int64  `json:"price"`
-	Cost        int64  `json:"cost"`
-	Category    string `json:"category"`
-	Image       string `json:"image"`
-	ImageKey    string `json:"imageKey"`
-	Weight      int    `json:"weight"`
-	Dimensions  string `json:"dimensions"`
+	SKU          string `json:"sku"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Price        int64  `json:"price"`
+	Cost         int64  `json:"cost"`
+	Category     string `json:"category"`
+	Image        string `json:"image"`
+	ImageKey     string `json:"imageKey"`
+	Weight       int    `json:"weight"`
+	Dimensions   string `json:"dimensions"`
+	SupplierID   string `json:"supplierId"`
+	LeadTimeDays int    `json:"leadTimeDays"`
+	TaxClass     string `json:"taxClass"` // STANDARD (default), ZERO_RATED or EXEMPT
+
+	BackorderPolicy string `json:"backorderPolicy"` // Empty (refuse), BACKORDER or PREORDER
+	ReleaseDate     string `json:"releaseDate"`     // YYYY-MM-DD
 }
 
 func (m *Module) create(c *gin.Context) {
@@ -134,20 +142,49 @@ func (m *Module) create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "sku and name are required"})
 		return
 	}
+	if req.LeadTimeDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "leadTimeDays must be >= 0"})
+		return
+	}
 
 	p := models.Product{
-		ID:         primitive.NewObjectID().Hex(),
-		OrgID:      orgID,
-		SKU:        req.SKU,
-		Name:       req.Name,
-		Desc:       strings.TrimSpace(req.Description),
-		Price:      req.Price,
-		Cost:       req.Cost,
-		Category:   strings.TrimSpace(req.Category),
-		Image:      strings.TrimSpace(req.Image),
-		ImageKey:   strings.TrimSpace(req.ImageKey),
-		WeightGram: req.Weight,
-		Dimensions: strings.TrimSpace(req.Dimensions),
+		ID:           primitive.NewObjectID().Hex(),
+		OrgID:        orgID,
+		SKU:          req.SKU,
+		Name:         req.Name,
+		Desc:         strings.TrimSpace(req.Description),
+		Price:        req.Price,
+		Cost:         req.Cost,
+		Category:     strings.TrimSpace(req.Category),
+		Image:        strings.TrimSpace(req.Image),
+		ImageKey:     strings.TrimSpace(req.ImageKey),
+		WeightGram:   req.Weight,
+		Dimensions:   strings.TrimSpace(req.Dimensions),
+		SupplierID:   strings.TrimSpace(req.SupplierID),
+		LeadTimeDays: req.LeadTimeDays,
+	}
+	taxClass, ok := parseTaxClass(req.TaxClass)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid taxClass"})
+		return
+	}
+	p.TaxClass = taxClass
+	policy, ok := parseBackorderPolicy(req.BackorderPolicy)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid backorderPolicy"})
+		return
+	}
+	p.BackorderPolicy = policy
+	p.ReleaseDate = strings.TrimSpace(req.ReleaseDate)
+	if !validReleaseDate(p.ReleaseDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "releaseDate must be YYYY-MM-DD"})
+		return
+	}
+	if p.SupplierID != "" {
+		if _, err := m.deps.Repo.GetSupplierByOrg(c.Request.Context(), orgID, p.SupplierID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "supplier not found"})
+			return
+		}
 	}
 
 	created, err := m.deps.Repo.CreateProduct(c.Request.Context(), p)
@@ -164,16 +201,22 @@ func (m *Module) create(c *gin.Context) {
 }
 
 type updateProductRequest struct {
-	SKU         *string `json:"sku"`
-	Name        *string `json:"name"`
-	Description *string `json:"description"`
-	Price       *int64  `json:"price"`
-	Cost        *int64  `json:"cost"`
-	Category    *string `json:"category"`
-	Image       *string `json:"image"`
-	ImageKey    *string `json:"imageKey"`
-	Weight      *int    `json:"weight"`
-	Dimensions  *string `json:"dimensions"`
+	SKU          *string `json:"sku"`
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	Price        *int64  `json:"price"`
+	Cost         *int64  `json:"cost"`
+	Category     *string `json:"category"`
+	Image        *string `json:"image"`
+	ImageKey     *string `json:"imageKey"`
+	Weight       *int    `json:"weight"`
+	Dimensions   *string `json:"dimensions"`
+	SupplierID   *string `json:"supplierId"`
+	LeadTimeDays *int    `json:"leadTimeDays"`
+	TaxClass     *string `json:"taxClass"`
+
+	BackorderPolicy *string `json:"backorderPolicy"`
+	ReleaseDate     *string `json:"releaseDate"`
 }
 
 func (m *Module) update(c *gin.Context) {
@@ -222,6 +265,47 @@ func (m *Module) update(c *gin.Context) {
 	if req.Dimensions != nil {
 		patch["dimensions"] = strings.TrimSpace(*req.Dimensions)
 	}
+	if req.SupplierID != nil {
+		supplierID := strings.TrimSpace(*req.SupplierID)
+		if supplierID != "" {
+			if _, err := m.deps.Repo.GetSupplierByOrg(c.Request.Context(), orgID, supplierID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "supplier not found"})
+				return
+			}
+		}
+		patch["supplierId"] = supplierID
+	}
+	if req.LeadTimeDays != nil {
+		if *req.LeadTimeDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "leadTimeDays must be >= 0"})
+			return
+		}
+		patch["leadTimeDays"] = *req.LeadTimeDays
+	}
+	if req.TaxClass != nil {
+		taxClass, ok := parseTaxClass(*req.TaxClass)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid taxClass"})
+			return
+		}
+		patch["taxClass"] = taxClass
+	}
+	if req.BackorderPolicy != nil {
+		policy, ok := parseBackorderPolicy(*req.BackorderPolicy)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid backorderPolicy"})
+			return
+		}
+		patch["backorderPolicy"] = policy
+	}
+	if req.ReleaseDate != nil {
+		releaseDate := strings.TrimSpace(*req.ReleaseDate)
+		if !validReleaseDate(releaseDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "releaseDate must be YYYY-MM-DD"})
+			return
+		}
+		patch["releaseDate"] = releaseDate
+	}
 
 	if len(patch) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
@@ -436,3 +520,30 @@ func (m *Module) getImage(c *gin.Context) {
 	}
 	c.DataFromReader(http.StatusOK, info.Size, contentType, obj, nil)
 }
+
+// parseTaxClass accepts an empty class, which is taxed at the standard rate
+func parseTaxClass(raw string) (models.TaxClass, bool) {
+	switch c := models.TaxClass(strings.ToUpper(strings.TrimSpace(raw))); c {
+	case "", models.TaxClassStandard, models.TaxClassZeroRated, models.TaxClassExempt:
+		return c, true
+	}
+	return "", false
+}
+
+// parseBackorderPolicy accepts an empty policy, which refuses orders beyond available stock
+func parseBackorderPolicy(raw string) (models.BackorderPolicy, bool) {
+	switch p := models.BackorderPolicy(strings.ToUpper(strings.TrimSpace(raw))); p {
+	case models.BackorderPolicyNone, models.BackorderPolicyBackorder, models.BackorderPolicyPreorder:
+		return p, true
+	}
+	return "", false
+}
+
+// validReleaseDate accepts an empty date, which clears it
+func validReleaseDate(raw string) bool {
+	if raw == "" {
+		return true
+	}
+	_, err := time.Parse("2006-01-02", raw)
+	return err == nil
+}
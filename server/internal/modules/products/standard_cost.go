@@ -0,0 +1,74 @@
+package productsmodule
+
+import (
+	"net/http"
+	"strings"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/audit"
+	"stockflows/server/internal/services/costing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type setStandardCostRequest struct {
+	StandardCost int64  `json:"standardCost"` // Satang per unit
+	Notes        string `json:"notes"`
+}
+
+// setStandardCost switches a product to standard costing (or changes its standard) and
+// revalues owned stock on hand in every branch to the new standard.
+func (m *Module) setStandardCost(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req setStandardCostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if req.StandardCost <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "standardCost must be positive"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	before, err := m.deps.Repo.GetProductByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	notes := strings.TrimSpace(req.Notes)
+	entries, err := costing.New(m.deps.Repo).SetStandardCost(ctx, orgID, before, req.StandardCost, u.ID, notes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set standard cost"})
+		return
+	}
+
+	after, err := m.deps.Repo.GetProductByOrg(ctx, orgID, before.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load product"})
+		return
+	}
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Product", after.ID, models.AuditActionUpdate,
+		before, after, c.ClientIP(), c.Request.UserAgent(), notes)
+
+	var revaluation int64
+	for _, e := range entries {
+		revaluation += e.Amount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": after,
+		"meta": gin.H{
+			"revaluations": entries,
+			"amount":       revaluation,
+		},
+	})
+}
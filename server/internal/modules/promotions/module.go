@@ -0,0 +1,423 @@
+package promotionsmodule
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/deps"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/audit"
+	"stockflows/server/internal/services/promotions"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Module struct {
+	deps deps.Dependencies
+}
+
+func New(deps deps.Dependencies) *Module { return &Module{deps: deps} }
+
+func (m *Module) Name() string { return "promotions" }
+
+func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/promotions")
+	g.Use(auth.RequireUser())
+
+	g.GET("", m.list)
+	g.GET("/:id", m.get)
+	g.POST("/evaluate", m.evaluate)
+
+	manager := auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager)
+	g.POST("", manager, m.create)
+	g.PUT("/:id", manager, m.update)
+	g.DELETE("/:id", manager, m.delete)
+}
+
+func (m *Module) list(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	filter := bson.M{}
+	if v := c.Query("active"); v != "" {
+		filter["isActive"] = v == "true"
+	}
+	if t := c.Query("type"); t != "" {
+		filter["type"] = strings.ToUpper(t)
+	}
+	if code := c.Query("couponCode"); code != "" {
+		filter["couponCode"] = promotions.NormalizeCode(code)
+	}
+
+	promos, err := m.deps.Repo.ListPromotionsByOrg(c.Request.Context(), orgID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list promotions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": promos, "meta": gin.H{"total": len(promos)}})
+}
+
+func (m *Module) get(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	p, err := m.deps.Repo.GetPromotionByOrg(c.Request.Context(), orgID, c.Param("id"))
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get promotion"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": p})
+}
+
+type promotionRequest struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Type        models.PromotionType `json:"type"`
+	IsActive    *bool                `json:"isActive"`
+	Priority    int                  `json:"priority"`
+	Stackable   bool                 `json:"stackable"`
+
+	StartsAt       *time.Time `json:"startsAt"`
+	EndsAt         *time.Time `json:"endsAt"`
+	BranchIDs      []string   `json:"branchIds"`
+	Channels       []string   `json:"channels"`
+	CustomerGroups []string   `json:"customerGroups"`
+	CategoryIDs    []string   `json:"categoryIds"`
+	ProductIDs     []string   `json:"productIds"`
+	MinSubtotal    int64      `json:"minSubtotal"`
+
+	Percent     float64                `json:"percent"`
+	AmountOff   int64                  `json:"amountOff"`
+	BuyQty      int                    `json:"buyQty"`
+	GetQty      int                    `json:"getQty"`
+	GetPercent  float64                `json:"getPercent"`
+	BundleQty   int                    `json:"bundleQty"`
+	BundlePrice int64                  `json:"bundlePrice"`
+	Tiers       []models.PromotionTier `json:"tiers"`
+
+	CouponCode       string `json:"couponCode"`
+	UsageLimit       int    `json:"usageLimit"`
+	PerCustomerLimit int    `json:"perCustomerLimit"`
+}
+
+// apply copies the request onto p, normalizing codes and scope lists
+func (req promotionRequest) apply(p *models.Promotion) {
+	p.Name = strings.TrimSpace(req.Name)
+	p.Description = strings.TrimSpace(req.Description)
+	p.Type = models.PromotionType(strings.ToUpper(strings.TrimSpace(string(req.Type))))
+	p.IsActive = req.IsActive == nil || *req.IsActive
+	p.Priority = req.Priority
+	p.Stackable = req.Stackable
+
+	p.StartsAt = req.StartsAt
+	p.EndsAt = req.EndsAt
+	p.BranchIDs = cleanList(req.BranchIDs, false)
+	p.Channels = cleanList(req.Channels, true)
+	p.CustomerGroups = cleanList(req.CustomerGroups, true)
+	p.CategoryIDs = cleanList(req.CategoryIDs, false)
+	p.ProductIDs = cleanList(req.ProductIDs, false)
+	p.MinSubtotal = req.MinSubtotal
+
+	p.Percent = req.Percent
+	p.AmountOff = req.AmountOff
+	p.BuyQty = req.BuyQty
+	p.GetQty = req.GetQty
+	p.GetPercent = req.GetPercent
+	p.BundleQty = req.BundleQty
+	p.BundlePrice = req.BundlePrice
+	p.Tiers = req.Tiers
+
+	p.CouponCode = promotions.NormalizeCode(req.CouponCode)
+	p.UsageLimit = req.UsageLimit
+	p.PerCustomerLimit = req.PerCustomerLimit
+}
+
+func cleanList(in []string, upper bool) []string {
+	out := make([]string, 0, len(in))
+	for _, v := range in {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if upper {
+			v = strings.ToUpper(v)
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func (m *Module) create(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req promotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	p := models.Promotion{
+		ID:        "PRM-" + primitive.NewObjectID().Hex(),
+		OrgID:     orgID,
+		CreatedBy: u.ID,
+	}
+	req.apply(&p)
+	if err := promotions.Validate(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	created, err := m.deps.Repo.CreatePromotion(ctx, p)
+	if err != nil {
+		if err == repo.ErrConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "coupon code already in use"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create promotion"})
+		return
+	}
+
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Promotion", created.ID, models.AuditActionCreate,
+		nil, created, c.ClientIP(), c.Request.UserAgent(), "")
+
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+// update replaces a promotion's definition; its redemption count is kept
+func (m *Module) update(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req promotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	before, err := m.deps.Repo.GetPromotionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get promotion"})
+		return
+	}
+
+	p := before
+	req.apply(&p)
+	if err := promotions.Validate(p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patch := bson.M{
+		"name":             p.Name,
+		"description":      p.Description,
+		"type":             p.Type,
+		"isActive":         p.IsActive,
+		"priority":         p.Priority,
+		"stackable":        p.Stackable,
+		"startsAt":         p.StartsAt,
+		"endsAt":           p.EndsAt,
+		"branchIds":        p.BranchIDs,
+		"channels":         p.Channels,
+		"customerGroups":   p.CustomerGroups,
+		"categoryIds":      p.CategoryIDs,
+		"productIds":       p.ProductIDs,
+		"minSubtotal":      p.MinSubtotal,
+		"percent":          p.Percent,
+		"amountOff":        p.AmountOff,
+		"buyQty":           p.BuyQty,
+		"getQty":           p.GetQty,
+		"getPercent":       p.GetPercent,
+		"bundleQty":        p.BundleQty,
+		"bundlePrice":      p.BundlePrice,
+		"tiers":            p.Tiers,
+		"usageLimit":       p.UsageLimit,
+		"perCustomerLimit": p.PerCustomerLimit,
+	}
+	// An empty coupon code is unset rather than stored so the unique index only covers real codes
+	if p.CouponCode != "" {
+		patch["couponCode"] = p.CouponCode
+	}
+
+	updated, err := m.deps.Repo.UpdatePromotionByOrg(ctx, orgID, before.ID, patch)
+	if err == nil && p.CouponCode == "" && before.CouponCode != "" {
+		updated, err = m.deps.Repo.ClearPromotionCoupon(ctx, orgID, before.ID)
+	}
+	if err != nil {
+		if err == repo.ErrConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "coupon code already in use"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update promotion"})
+		return
+	}
+
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Promotion", updated.ID, models.AuditActionUpdate,
+		before, updated, c.ClientIP(), c.Request.UserAgent(), "")
+
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+func (m *Module) delete(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	before, err := m.deps.Repo.GetPromotionByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get promotion"})
+		return
+	}
+	if err := m.deps.Repo.DeletePromotionByOrg(ctx, orgID, before.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete promotion"})
+		return
+	}
+
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Promotion", before.ID, models.AuditActionDelete,
+		before, nil, c.ClientIP(), c.Request.UserAgent(), "")
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"deleted": true}})
+}
+
+type evaluateItem struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice int64  `json:"unitPrice"` // Defaults to the product price
+	Discount  int64  `json:"discount"`
+}
+
+type evaluateRequest struct {
+	BranchID    string         `json:"branchId"`
+	Channel     string         `json:"channel"`
+	CustomerID  string         `json:"customerId"`
+	CouponCodes []string       `json:"couponCodes"`
+	Items       []evaluateItem `json:"items"`
+}
+
+// evaluate previews the promotions a cart would get without redeeming any coupon
+func (m *Module) evaluate(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req evaluateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "items are required"})
+		return
+	}
+	branchID := strings.TrimSpace(req.BranchID)
+	if branchID == "" {
+		branchID = auth.GetBranchIDForRequest(c, u)
+	}
+	channel := strings.ToUpper(strings.TrimSpace(req.Channel))
+	if channel == "" {
+		channel = "POS"
+	}
+
+	ctx := c.Request.Context()
+	items := make([]models.TransactionItem, 0, len(req.Items))
+	for _, it := range req.Items {
+		if it.Quantity <= 0 || strings.TrimSpace(it.ProductID) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid items"})
+			return
+		}
+		p, err := m.deps.Repo.GetProductByOrg(ctx, orgID, strings.TrimSpace(it.ProductID))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid productId: " + it.ProductID})
+			return
+		}
+		price := it.UnitPrice
+		if price <= 0 {
+			price = p.Price
+		}
+		items = append(items, models.TransactionItem{
+			ID:       p.ID,
+			SKU:      p.SKU,
+			Name:     p.Name,
+			Price:    price,
+			Quantity: it.Quantity,
+			Discount: it.Discount,
+		})
+	}
+
+	svc := promotions.New(m.deps.Repo)
+	customerID := strings.TrimSpace(req.CustomerID)
+	cart, err := svc.CartFor(ctx, orgID, branchID, channel, customerID, req.CouponCodes, items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to evaluate promotions"})
+		return
+	}
+	res, err := svc.Evaluate(ctx, orgID, customerID, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to evaluate promotions"})
+		return
+	}
+	promotions.Apply(items, res)
+
+	var subtotal, discount int64
+	for _, it := range items {
+		subtotal += it.Price * int64(it.Quantity)
+		discount += it.Discount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"items":    items,
+			"applied":  res.Applied,
+			"rejected": res.Rejected,
+		},
+		"meta": gin.H{
+			"subtotal":          subtotal,
+			"promotionDiscount": res.Discount,
+			"discount":          discount,
+			"total":             subtotal - discount,
+		},
+	})
+}
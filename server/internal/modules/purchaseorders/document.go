@@ -0,0 +1,48 @@
+package purchaseordersmodule
+
+import (
+	"errors"
+	"net/http"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/documents"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renderDocument renders the purchase order as a PDF for the supplier and links it from
+// the order. Rendering again replaces the stored file so edits show up.
+func (m *Module) renderDocument(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	po, err := m.deps.Repo.GetPurchaseOrderByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "purchase order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get purchase order"})
+		return
+	}
+
+	doc, err := documents.New(m.deps.Repo, m.deps.MinIO, m.deps.Config).ForPurchaseOrder(ctx, *u, po)
+	if err != nil {
+		switch {
+		case errors.Is(err, documents.ErrStorageNotConfigured):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		case errors.Is(err, documents.ErrNotIssuable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot render a cancelled purchase order"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render purchase order"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": doc})
+}
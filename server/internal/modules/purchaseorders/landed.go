@@ -0,0 +1,262 @@
+package purchaseordersmodule
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/costing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+var landedCostTypes = map[string]bool{
+	"FREIGHT":   true,
+	"CUSTOMS":   true,
+	"INSURANCE": true,
+	"OTHER":     true,
+}
+
+// parseLandedCostMethod accepts an empty value (use the default) or one of the known methods
+func parseLandedCostMethod(v string) (models.LandedCostMethod, bool) {
+	method := models.LandedCostMethod(strings.ToUpper(strings.TrimSpace(v)))
+	switch method {
+	case "", models.LandedCostByValue, models.LandedCostByQuantity, models.LandedCostByWeight:
+		return method, true
+	}
+	return "", false
+}
+
+type addLandedCostRequest struct {
+	Type      string `json:"type"`   // FREIGHT|CUSTOMS|INSURANCE|OTHER
+	Amount    int64  `json:"amount"` // Satang
+	Method    string `json:"method"` // Defaults to the purchase order's allocation method
+	Reference string `json:"reference"`
+	Notes     string `json:"notes"`
+}
+
+// addLandedCost attaches a cost document to a received purchase order and spreads it over
+// the received lines. Stock still on hand is revalued; units already sold are expensed as a
+// COGS adjustment. Standard costed lines go to purchase price variance instead.
+func (m *Module) addLandedCost(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req addLandedCostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	costType := strings.ToUpper(strings.TrimSpace(req.Type))
+	if costType == "" {
+		costType = "OTHER"
+	}
+	if !landedCostTypes[costType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type"})
+		return
+	}
+	if req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+	method, ok := parseLandedCostMethod(req.Method)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid method"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	po, err := m.deps.Repo.GetPurchaseOrderByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "purchase order not found"})
+		return
+	}
+	if po.Status != "RECEIVED" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "landed costs can only be added to received purchase orders"})
+		return
+	}
+
+	// Lock the PO so two cost documents cannot revalue the same lots at once.
+	col := m.deps.Mongo.Collection(repo.ColPurchaseOrders)
+	lockRes, err := col.UpdateOne(ctx,
+		bson.M{"_id": po.ID, "orgId": orgID, "status": "RECEIVED", "landedCostInProgress": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"landedCostInProgress": true, "updatedAt": time.Now().UTC()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lock purchase order"})
+		return
+	}
+	if lockRes.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "another landed cost is being added to this purchase order"})
+		return
+	}
+	unlock := func() {
+		_, _ = col.UpdateOne(ctx,
+			bson.M{"_id": po.ID, "orgId": orgID},
+			bson.M{"$unset": bson.M{"landedCostInProgress": ""}, "$set": bson.M{"updatedAt": time.Now().UTC()}},
+		)
+	}
+	// Re-read under the lock so the lines reflect any cost added just before.
+	po, err = m.deps.Repo.GetPurchaseOrderByOrg(ctx, orgID, po.ID)
+	if err != nil {
+		unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load purchase order"})
+		return
+	}
+
+	if method == "" {
+		method = po.AllocationMethod
+	}
+	if method == "" {
+		method = models.LandedCostByValue
+	}
+
+	products := make(map[string]models.Product, len(po.Items))
+	for _, item := range po.Items {
+		p, err := m.deps.Repo.GetProductByOrg(ctx, orgID, item.ProductID)
+		if err != nil {
+			unlock()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid productId", "productId": item.ProductID})
+			return
+		}
+		products[item.ProductID] = p
+	}
+
+	// The cost document is saved before any lot is touched, so a revaluation never exists
+	// without its record. Allocations are filled in once every line is booked.
+	landedCost := models.LandedCost{
+		ID:          "LC-" + primitive.NewObjectID().Hex(),
+		Type:        costType,
+		Amount:      req.Amount,
+		Method:      method,
+		Reference:   strings.TrimSpace(req.Reference),
+		Notes:       strings.TrimSpace(req.Notes),
+		Allocations: []models.LandedCostAllocation{},
+		CreatedBy:   u.ID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if _, err := col.UpdateOne(ctx,
+		bson.M{"_id": po.ID, "orgId": orgID},
+		bson.M{"$push": bson.M{"landedCosts": landedCost}},
+	); err != nil {
+		unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update purchase order"})
+		return
+	}
+
+	shares := costing.Allocate(req.Amount, costing.AllocationBasis(po.Items, products, method))
+	costingSvc := costing.New(m.deps.Repo)
+
+	allocations := make([]models.LandedCostAllocation, 0, len(po.Items))
+	items := make([]models.PurchaseOrderItem, len(po.Items))
+	txnItems := make([]models.TransactionItem, 0)
+	var revalued, cogsAdjustment int64
+	// rollback reverses the lines already booked and drops the cost document.
+	rollback := func() {
+		for i, alloc := range allocations {
+			item := po.Items[i]
+			product, err := m.deps.Repo.GetProductByOrg(ctx, orgID, item.ProductID)
+			if err != nil {
+				product = products[item.ProductID]
+			}
+			if _, err := costingSvc.ApplyLandedCost(ctx, orgID, po, item, product, -alloc.Amount); err != nil {
+				log.Printf("purchaseorders: reverse landed cost %s on %s: %v", landedCost.ID, item.ProductID, err)
+			}
+		}
+		_, _ = col.UpdateOne(ctx,
+			bson.M{"_id": po.ID, "orgId": orgID},
+			bson.M{"$pull": bson.M{"landedCosts": bson.M{"id": landedCost.ID}}},
+		)
+		unlock()
+	}
+	for i, item := range po.Items {
+		alloc, err := costingSvc.ApplyLandedCost(ctx, orgID, po, item, products[item.ProductID], shares[i])
+		if err != nil {
+			rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revalue lots"})
+			return
+		}
+		allocations = append(allocations, alloc)
+		revalued += alloc.RevaluedAmount
+
+		if item.LandedUnitCost == 0 {
+			item.LandedUnitCost = item.UnitCost
+		}
+		item.LandedUnitCost += costing.UnitCostOf(shares[i], item.Quantity)
+		items[i] = item
+
+		if alloc.COGSAdjustment != 0 {
+			p := products[item.ProductID]
+			txnItems = append(txnItems, models.TransactionItem{
+				ID:       p.ID,
+				SKU:      p.SKU,
+				Name:     p.Name,
+				Category: p.Category,
+				Image:    p.Image,
+				LineCost: alloc.COGSAdjustment,
+			})
+			cogsAdjustment += alloc.COGSAdjustment
+		}
+	}
+	landedCost.Allocations = allocations
+
+	res, err := col.UpdateOne(ctx,
+		bson.M{"_id": po.ID, "orgId": orgID, "landedCosts.id": landedCost.ID},
+		bson.M{
+			"$set": bson.M{
+				"items":                     items,
+				"landedCosts.$.allocations": allocations,
+				"updatedAt":                 time.Now().UTC(),
+			},
+			"$unset": bson.M{"landedCostInProgress": ""},
+		},
+	)
+	if err != nil || res.MatchedCount == 0 {
+		rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update purchase order"})
+		return
+	}
+
+	// Units sold before the cost arrived are expensed now rather than rewriting past sales.
+	if cogsAdjustment != 0 {
+		if _, err := m.deps.Repo.CreateTransaction(ctx, models.Transaction{
+			ID:            "TXN-LC-" + primitive.NewObjectID().Hex(),
+			OrgID:         orgID,
+			BranchID:      po.BranchID,
+			Date:          landedCost.CreatedAt.Format(time.RFC3339),
+			Channel:       "POS",
+			Type:          "COGS_ADJUSTMENT",
+			Status:        "COMPLETED",
+			Items:         txnItems,
+			COGS:          cogsAdjustment,
+			Profit:        -cogsAdjustment,
+			UserID:        u.ID,
+			RecipientName: "Purchase Order",
+			Note:          "Landed cost (" + costType + ") on PO: " + po.ReferenceNo,
+			ReferenceID:   po.ID,
+		}); err != nil {
+			log.Printf("purchaseorders: cogs adjustment for landed cost %s: %v", landedCost.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": landedCost,
+		"meta": gin.H{
+			"revalued":       revalued,
+			"cogsAdjustment": cogsAdjustment,
+			"variance":       req.Amount - revalued - cogsAdjustment, // Standard costed lines
+			"purchaseOrder":  po.ID,
+		},
+	})
+}
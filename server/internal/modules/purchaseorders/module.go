@@ -1,6 +1,7 @@
 package purchaseordersmodule
 
 import (
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -9,7 +10,10 @@ import (
 	"stockflows/server/internal/deps"
 	"stockflows/server/internal/models"
 	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/backorders"
 	"stockflows/server/internal/services/costing"
+	"stockflows/server/internal/services/orderevents"
+	"stockflows/server/internal/services/tax"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -36,12 +40,15 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 	g.GET("/stats", m.stats)
 	g.GET("/:id", m.get)
 	g.POST("", m.create)
+	g.POST("/replenish", m.replenish)
 	g.PATCH("/:id", m.update)
 	g.DELETE("/:id", m.delete)
 	g.POST("/:id/receive", m.receive)
+	g.POST("/:id/landed-costs", m.addLandedCost)
 	g.POST("/:id/cancel", m.cancel)
 	g.POST("/:id/submit", m.submit)
 	g.POST("/:id/duplicate", m.duplicate)
+	g.POST("/:id/document", m.renderDocument)
 	g.POST("/:id/payment", m.recordPayment)
 	g.POST("/:id/status", m.updateStatus)
 	g.POST("/bulk-status", m.bulkUpdateStatus)
@@ -49,49 +56,56 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 
 // POResponse is the frontend-expected format for purchase orders
 type POResponse struct {
-	ID                   string           `json:"id"`
-	OrgID                string           `json:"orgId"`
-	BranchID             string           `json:"branchId"`
-	BranchName           string           `json:"branchName"`
-	OrderNumber          string           `json:"orderNumber"`
-	ReferenceNumber      string           `json:"referenceNumber,omitempty"`
-	OrderDate            string           `json:"orderDate"`
-	ExpectedDeliveryDate string           `json:"expectedDeliveryDate,omitempty"`
-	ReceivedDate         string           `json:"receivedDate,omitempty"`
-	SupplierID           string           `json:"supplierId"`
-	SupplierName         string           `json:"supplierName"`
-	SupplierCode         string           `json:"supplierCode,omitempty"`
-	Status               string           `json:"status"`
-	PaymentStatus        string           `json:"paymentStatus"`
-	Items                []POItemResponse `json:"items"`
-	Subtotal             int64            `json:"subtotal"`
-	DiscountAmount       int64            `json:"discountAmount"`
-	TaxRate              float64          `json:"taxRate"`
-	TaxAmount            int64            `json:"taxAmount"`
-	ShippingCost         int64            `json:"shippingCost"`
-	TotalAmount          int64            `json:"totalAmount"`
-	PaidAmount           int64            `json:"paidAmount"`
-	DueAmount            int64            `json:"dueAmount"`
-	Notes                string           `json:"notes,omitempty"`
-	InternalNotes        string           `json:"internalNotes,omitempty"`
-	CreatedBy            string           `json:"createdBy"`
-	CreatedByName        string           `json:"createdByName"`
-	CreatedAt            string           `json:"createdAt"`
-	UpdatedAt            string           `json:"updatedAt"`
+	ID                   string               `json:"id"`
+	OrgID                string               `json:"orgId"`
+	BranchID             string               `json:"branchId"`
+	BranchName           string               `json:"branchName"`
+	OrderNumber          string               `json:"orderNumber"`
+	ReferenceNumber      string               `json:"referenceNumber,omitempty"`
+	OrderDate            string               `json:"orderDate"`
+	ExpectedDeliveryDate string               `json:"expectedDeliveryDate,omitempty"`
+	ReceivedDate         string               `json:"receivedDate,omitempty"`
+	SupplierID           string               `json:"supplierId"`
+	SupplierName         string               `json:"supplierName"`
+	SupplierCode         string               `json:"supplierCode,omitempty"`
+	Status               string               `json:"status"`
+	PaymentStatus        string               `json:"paymentStatus"`
+	Items                []POItemResponse     `json:"items"`
+	Subtotal             int64                `json:"subtotal"`
+	DiscountAmount       int64                `json:"discountAmount"`
+	TaxRate              float64              `json:"taxRate"`
+	TaxAmount            int64                `json:"taxAmount"`
+	ShippingCost         int64                `json:"shippingCost"`
+	AllocationMethod     string               `json:"allocationMethod,omitempty"`
+	TaxRecoverable       bool                 `json:"taxRecoverable,omitempty"`
+	LandedCosts          []models.LandedCost  `json:"landedCosts,omitempty"`
+	TotalAmount          int64                `json:"totalAmount"`
+	PaidAmount           int64                `json:"paidAmount"`
+	DueAmount            int64                `json:"dueAmount"`
+	Notes                string               `json:"notes,omitempty"`
+	InternalNotes        string               `json:"internalNotes,omitempty"`
+	Documents            []models.DocumentRef `json:"documents,omitempty"`
+	CreatedBy            string               `json:"createdBy"`
+	CreatedByName        string               `json:"createdByName"`
+	CreatedAt            string               `json:"createdAt"`
+	UpdatedAt            string               `json:"updatedAt"`
 }
 
 type POItemResponse struct {
-	ID          string `json:"id"`
-	ProductID   string `json:"productId"`
-	ProductName string `json:"productName"`
-	ProductSku  string `json:"productSku"`
-	Unit        string `json:"unit"`
-	QtyOrdered  int    `json:"qtyOrdered"`
-	QtyReceived int    `json:"qtyReceived"`
-	QtyPending  int    `json:"qtyPending"`
-	UnitCost    int64  `json:"unitCost"`
-	Discount    int64  `json:"discount"`
-	LineTotal   int64  `json:"lineTotal"`
+	ID             string `json:"id"`
+	ProductID      string `json:"productId"`
+	ProductName    string `json:"productName"`
+	ProductSku     string `json:"productSku"`
+	Unit           string `json:"unit"`
+	QtyOrdered     int    `json:"qtyOrdered"`
+	QtyReceived    int    `json:"qtyReceived"`
+	QtyPending     int    `json:"qtyPending"`
+	UnitCost       int64  `json:"unitCost"`
+	Discount       int64  `json:"discount"`
+	LineTotal      int64  `json:"lineTotal"`
+	LandedUnitCost int64  `json:"landedUnitCost,omitempty"`
+	TaxClass       string `json:"taxClass,omitempty"`
+	TaxAmount      int64  `json:"taxAmount"`
 }
 
 func (m *Module) poToResponse(po models.PurchaseOrder, supplierName, branchName string) POResponse {
@@ -113,17 +127,20 @@ func (m *Module) poToResponse(po models.PurchaseOrder, supplierName, branchName
 		}
 
 		items = append(items, POItemResponse{
-			ID:          po.ID + "-item-" + string(rune('0'+i)),
-			ProductID:   it.ProductID,
-			ProductName: it.ProductName,
-			ProductSku:  productSku,
-			Unit:        unit,
-			QtyOrdered:  it.Quantity,
-			QtyReceived: qtyReceived,
-			QtyPending:  it.Quantity - qtyReceived,
-			UnitCost:    it.UnitCost,
-			Discount:    it.Discount,
-			LineTotal:   lineTotal,
+			ID:             po.ID + "-item-" + string(rune('0'+i)),
+			ProductID:      it.ProductID,
+			ProductName:    it.ProductName,
+			ProductSku:     productSku,
+			Unit:           unit,
+			QtyOrdered:     it.Quantity,
+			QtyReceived:    qtyReceived,
+			QtyPending:     it.Quantity - qtyReceived,
+			UnitCost:       it.UnitCost,
+			Discount:       it.Discount,
+			LineTotal:      lineTotal,
+			LandedUnitCost: it.LandedUnitCost,
+			TaxClass:       string(it.TaxClass),
+			TaxAmount:      it.TaxAmount,
 		})
 	}
 
@@ -140,8 +157,11 @@ func (m *Module) poToResponse(po models.PurchaseOrder, supplierName, branchName
 		status = "PENDING" // In progress
 	}
 
-	// Calculate tax amount from rate (rate is stored as percentage, e.g., 7 for 7%)
+	// Orders from before line-level tax fall back to the order-level rate
 	taxAmount := int64(float64(subtotal-po.DiscountAmount) * (po.TaxRate / 100))
+	if po.Tax != nil {
+		taxAmount = po.Tax.Tax
+	}
 	totalAmount := subtotal - po.DiscountAmount + taxAmount + po.ShippingCost
 
 	// Determine payment status based on actual paid amount
@@ -174,11 +194,15 @@ func (m *Module) poToResponse(po models.PurchaseOrder, supplierName, branchName
 		TaxRate:              po.TaxRate,
 		TaxAmount:            taxAmount,
 		ShippingCost:         po.ShippingCost,
+		AllocationMethod:     string(po.AllocationMethod),
+		TaxRecoverable:       po.TaxRecoverable,
+		LandedCosts:          po.LandedCosts,
 		TotalAmount:          totalAmount,
 		PaidAmount:           po.PaidAmount,
 		DueAmount:            totalAmount - po.PaidAmount,
 		Notes:                po.Note,
 		InternalNotes:        po.InternalNotes,
+		Documents:            po.Documents,
 		CreatedBy:            "",
 		CreatedByName:        "",
 		CreatedAt:            po.CreatedAt.Format(time.RFC3339),
@@ -385,6 +409,8 @@ type createPORequest struct {
 	DiscountAmount       int64                 `json:"discountAmount,omitempty"`
 	TaxRate              float64               `json:"taxRate,omitempty"`
 	ShippingCost         int64                 `json:"shippingCost,omitempty"`
+	AllocationMethod     string                `json:"allocationMethod,omitempty"` // VALUE|QUANTITY|WEIGHT for spreading shipping
+	TaxRecoverable       bool                  `json:"taxRecoverable,omitempty"`
 	ShippingChannel      string                `json:"shippingChannel,omitempty"`
 	Notes                string                `json:"notes,omitempty"`
 	Note                 string                `json:"note,omitempty"` // Alias
@@ -437,6 +463,11 @@ func (m *Module) create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "supplierId, branchId and items are required"})
 		return
 	}
+	allocationMethod, ok := parseLandedCostMethod(req.AllocationMethod)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid allocationMethod"})
+		return
+	}
 
 	if _, err := m.deps.Repo.GetBranchByOrg(c.Request.Context(), orgID, req.BranchID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branchId"})
@@ -494,6 +525,7 @@ func (m *Module) create(c *gin.Context) {
 			Quantity:    qty,
 			UnitCost:    req.Items[i].UnitCost,
 			Discount:    req.Items[i].Discount,
+			TaxClass:    p.TaxClass,
 		})
 	}
 
@@ -522,11 +554,14 @@ func (m *Module) create(c *gin.Context) {
 		DiscountAmount:       req.DiscountAmount,
 		TaxRate:              req.TaxRate,
 		ShippingCost:         req.ShippingCost,
+		AllocationMethod:     allocationMethod,
+		TaxRecoverable:       req.TaxRecoverable,
 		Note:                 note,
 		InternalNotes:        strings.TrimSpace(req.InternalNotes),
 		ShippingChannel:      strings.TrimSpace(req.ShippingChannel),
 		ExpectedDeliveryDate: strings.TrimSpace(req.ExpectedDeliveryDate),
 	}
+	po.Tax = tax.Purchase(po.TaxRate, po.Items, po.DiscountAmount)
 
 	created, err := m.deps.Repo.CreatePurchaseOrder(c.Request.Context(), po)
 	if err != nil {
@@ -571,6 +606,10 @@ type updatePORequest struct {
 	TaxRate        *float64 `json:"taxRate"`
 	ShippingCost   *int64   `json:"shippingCost"`
 
+	// Landed cost allocation
+	AllocationMethod *string `json:"allocationMethod"`
+	TaxRecoverable   *bool   `json:"taxRecoverable"`
+
 	// Notes and shipping
 	Notes           *string `json:"notes"`
 	Note            *string `json:"note"` // Alias
@@ -687,6 +726,17 @@ func (m *Module) update(c *gin.Context) {
 	if req.ShippingCost != nil {
 		patch["shippingCost"] = *req.ShippingCost
 	}
+	if req.AllocationMethod != nil {
+		method, ok := parseLandedCostMethod(*req.AllocationMethod)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid allocationMethod"})
+			return
+		}
+		patch["allocationMethod"] = method
+	}
+	if req.TaxRecoverable != nil {
+		patch["taxRecoverable"] = *req.TaxRecoverable
+	}
 
 	// Handle shipping and notes
 	if req.ShippingChannel != nil {
@@ -737,12 +787,29 @@ func (m *Module) update(c *gin.Context) {
 				Quantity:    qty,
 				UnitCost:    req.Items[i].UnitCost,
 				Discount:    req.Items[i].Discount,
+				TaxClass:    p.TaxClass,
 			})
 		}
 		patch["items"] = modelItems
 		patch["totalCost"] = total
 	}
 
+	// Input VAT follows the lines, the order discount and the rate
+	if len(req.Items) > 0 || req.DiscountAmount != nil || req.TaxRate != nil {
+		taxed := existingPO
+		if items, ok := patch["items"].([]models.PurchaseOrderItem); ok {
+			taxed.Items = items
+		}
+		if req.DiscountAmount != nil {
+			taxed.DiscountAmount = *req.DiscountAmount
+		}
+		if req.TaxRate != nil {
+			taxed.TaxRate = *req.TaxRate
+		}
+		patch["tax"] = tax.Purchase(taxed.TaxRate, taxed.Items, taxed.DiscountAmount)
+		patch["items"] = taxed.Items
+	}
+
 	if len(patch) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
 		return
@@ -836,18 +903,27 @@ func (m *Module) receive(c *gin.Context) {
 
 	receivedAt := time.Now().UTC()
 
+	// Spread discount, shipping and non-recoverable tax into each line's unit cost.
+	landed := costing.LandedLineCosts(po, products)
+	receivedItems := make([]models.PurchaseOrderItem, len(po.Items))
+
 	type appliedLot struct {
 		productID string
 		qty       int
 		lotID     string
 	}
 	applied := make([]appliedLot, 0, len(po.Items))
+	varianceIDs := make([]string, 0, len(po.Items))
+	movements := make([]models.StockMovement, 0, len(po.Items))
 
 	rollback := func() {
 		for _, a := range applied {
 			_, _ = m.deps.Repo.AdjustStock(c.Request.Context(), orgID, po.BranchID, a.productID, -a.qty)
 			_ = m.deps.Repo.DeleteInventoryLot(c.Request.Context(), a.lotID)
 		}
+		for _, id := range varianceIDs {
+			_ = m.deps.Repo.DeleteCostVarianceByOrg(c.Request.Context(), orgID, id)
+		}
 		_, _ = m.deps.Mongo.Collection(repo.ColPurchaseOrders).UpdateOne(
 			c.Request.Context(),
 			bson.M{"_id": po.ID, "orgId": orgID},
@@ -856,10 +932,26 @@ func (m *Module) receive(c *gin.Context) {
 	}
 
 	// Apply stock changes.
-	for _, item := range po.Items {
+	costingSvc := costing.New(m.deps.Repo)
+	for i, item := range po.Items {
+		unitCost := costing.UnitCostOf(landed[i], item.Quantity)
+		item.LandedUnitCost = unitCost
+		receivedItems[i] = item
+
+		// Standard costed stock is carried at standard; the difference is recorded as variance.
+		lotCost, varianceID, err := costingSvc.ReceiveAtStandard(c.Request.Context(), orgID, po, products[item.ProductID], item.Quantity, unitCost, u.ID)
+		if err != nil {
+			rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record purchase price variance"})
+			return
+		}
+		if varianceID != "" {
+			varianceIDs = append(varianceIDs, varianceID)
+		}
+
 		// Create FIFO lot for this received quantity.
 		lotID := primitive.NewObjectID().Hex()
-		_, err := m.deps.Repo.CreateInventoryLot(c.Request.Context(), models.InventoryLot{
+		_, err = m.deps.Repo.CreateInventoryLot(c.Request.Context(), models.InventoryLot{
 			ID:              lotID,
 			OrgID:           orgID,
 			BranchID:        po.BranchID,
@@ -867,7 +959,7 @@ func (m *Module) receive(c *gin.Context) {
 			Source:          "PO",
 			PurchaseOrderID: po.ID,
 			ReferenceNo:     po.ReferenceNo,
-			UnitCost:        item.UnitCost,
+			UnitCost:        lotCost,
 			QtyReceived:     item.Quantity,
 			QtyRemaining:    item.Quantity,
 			ReceivedAt:      receivedAt,
@@ -878,7 +970,7 @@ func (m *Module) receive(c *gin.Context) {
 			return
 		}
 
-		_, err = m.deps.Repo.AdjustStock(c.Request.Context(), orgID, po.BranchID, item.ProductID, item.Quantity)
+		level, err := m.deps.Repo.AdjustStock(c.Request.Context(), orgID, po.BranchID, item.ProductID, item.Quantity)
 		if err != nil {
 			_ = m.deps.Repo.DeleteInventoryLot(c.Request.Context(), lotID)
 			rollback()
@@ -887,19 +979,36 @@ func (m *Module) receive(c *gin.Context) {
 		}
 
 		applied = append(applied, appliedLot{productID: item.ProductID, qty: item.Quantity, lotID: lotID})
+		movements = append(movements, models.StockMovement{
+			ID:               "MV-" + primitive.NewObjectID().Hex(),
+			OrgID:            orgID,
+			BranchID:         po.BranchID,
+			ProductID:        item.ProductID,
+			Type:             "PURCHASE_IN",
+			Quantity:         item.Quantity,
+			PreviousQuantity: level.Quantity - item.Quantity,
+			NewQuantity:      level.Quantity,
+			UnitCost:         lotCost,
+			TotalCost:        lotCost * int64(item.Quantity),
+			ReferenceType:    "PURCHASE_ORDER",
+			ReferenceID:      po.ID,
+			ReferenceNumber:  po.ReferenceNo,
+			LotID:            lotID,
+			CreatedBy:        u.ID,
+		})
 
 		// Update product's last purchase cost for convenience (derived from PO).
-		_, _ = m.deps.Repo.UpdateProductByOrg(c.Request.Context(), orgID, item.ProductID, bson.M{"cost": item.UnitCost})
+		_, _ = m.deps.Repo.UpdateProductByOrg(c.Request.Context(), orgID, item.ProductID, bson.M{"cost": unitCost})
 
 		// Update moving average cost if product uses that costing method
-		costingSvc := costing.New(m.deps.Repo)
-		_ = costingSvc.UpdateMovingAverageOnReceive(c.Request.Context(), orgID, po.BranchID, item.ProductID, item.Quantity, item.UnitCost)
+		_ = costingSvc.UpdateMovingAverageOnReceive(c.Request.Context(), orgID, po.BranchID, item.ProductID, item.Quantity, unitCost)
 	}
 
 	receivedDate := receivedAt.Format(time.RFC3339)
 	updatedPO, err := m.deps.Repo.UpdatePurchaseOrderByOrg(c.Request.Context(), orgID, po.ID, bson.M{
 		"status":       "RECEIVED",
 		"receivedDate": receivedDate,
+		"items":        receivedItems,
 	})
 	if err != nil {
 		rollback()
@@ -907,9 +1016,14 @@ func (m *Module) receive(c *gin.Context) {
 		return
 	}
 
+	// Record the receipt on each product's stock card.
+	for _, mv := range movements {
+		m.deps.Repo.CreateStockMovement(c.Request.Context(), mv)
+	}
+
 	// Create stock-in transaction.
 	items := make([]models.TransactionItem, 0, len(po.Items))
-	for _, item := range po.Items {
+	for _, item := range receivedItems {
 		prod, ok := products[item.ProductID]
 		if !ok {
 			continue
@@ -921,29 +1035,41 @@ func (m *Module) receive(c *gin.Context) {
 			Category: prod.Category,
 			Image:    prod.Image,
 			Price:    prod.Price,
-			Cost:     item.UnitCost,
-			LineCost: int64(item.Quantity) * item.UnitCost,
+			Cost:     item.LandedUnitCost,
+			LineCost: int64(item.Quantity) * item.LandedUnitCost,
 			Quantity: item.Quantity,
 		})
 	}
 	txn := models.Transaction{
-		ID:               "TXN-PO-" + primitive.NewObjectID().Hex(),
-		OrgID:            orgID,
-		BranchID:         po.BranchID,
-		Date:             receivedDate,
-		Channel:          "POS",
-		Type:             "STOCK_IN",
-		Status:           "COMPLETED",
+		ID:                "TXN-PO-" + primitive.NewObjectID().Hex(),
+		OrgID:             orgID,
+		BranchID:          po.BranchID,
+		Date:              receivedDate,
+		Channel:           "POS",
+		Type:              "STOCK_IN",
+		Status:            "COMPLETED",
 		FulfillmentStatus: "DELIVERED",
-		Items:            items,
-		Total:            -po.TotalCost,
-		UserID:           u.ID,
-		RecipientName:    "Purchase Order",
-		Note:             "Received PO: " + po.ReferenceNo,
-		ReferenceID:      po.ID,
+		Items:             items,
+		Total:             -po.TotalCost,
+		UserID:            u.ID,
+		RecipientName:     "Purchase Order",
+		Note:              "Received PO: " + po.ReferenceNo,
+		ReferenceID:       po.ID,
 	}
 	_, _ = m.deps.Repo.CreateTransaction(c.Request.Context(), txn)
 
+	// Fill backordered sales from what just arrived, oldest order first
+	received := make([]string, 0, len(receivedItems))
+	for _, item := range receivedItems {
+		if item.Quantity > 0 {
+			received = append(received, item.ProductID)
+		}
+	}
+	src := orderevents.Source{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if _, err := backorders.New(m.deps.Repo).Allocate(c.Request.Context(), *u, orgID, po.BranchID, received, "PO "+po.ReferenceNo, src); err != nil {
+		log.Printf("purchase orders: allocate backorders for %s: %v", po.ID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": updatedPO})
 }
 
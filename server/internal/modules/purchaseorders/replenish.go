@@ -0,0 +1,128 @@
+package purchaseordersmodule
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/replenishment"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+type replenishRequest struct {
+	BranchID   string   `json:"branchId"`
+	ProductIDs []string `json:"productIds,omitempty"` // Empty means every low-stock product in the branch
+	DryRun     bool     `json:"dryRun,omitempty"`     // Return the plan without creating purchase orders
+}
+
+// replenish creates one draft purchase order per preferred supplier for low-stock products
+func (m *Module) replenish(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req replenishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	branchID := strings.TrimSpace(req.BranchID)
+	if branchID == "" {
+		branchID = auth.GetBranchIDForRequest(c, u)
+	}
+	if branchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branchId is required"})
+		return
+	}
+	branch, err := m.deps.Repo.GetBranchByOrg(c.Request.Context(), orgID, branchID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branchId"})
+		return
+	}
+
+	plan, unassigned, err := replenishment.New(m.deps.Repo).PlanPurchaseOrders(c.Request.Context(), orgID, branchID, req.ProductIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to plan replenishment"})
+		return
+	}
+
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{
+			"data": plan,
+			"meta": gin.H{"unassigned": unassigned},
+		})
+		return
+	}
+
+	created := make([]POResponse, 0, len(plan))
+	skipped := make([]string, 0)
+	for _, group := range plan {
+		supplier, err := m.deps.Repo.GetSupplierByOrg(c.Request.Context(), orgID, group.SupplierID)
+		if err != nil {
+			// Preferred supplier was removed; leave these lines for manual ordering.
+			skipped = append(skipped, group.SupplierID)
+			continue
+		}
+
+		seq, err := m.deps.Repo.NextCounter(c.Request.Context(), "po:"+orgID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate reference"})
+			return
+		}
+
+		var total int64
+		items := make([]models.PurchaseOrderItem, 0, len(group.Lines))
+		for _, line := range group.Lines {
+			total += int64(line.Quantity) * line.UnitCost
+			items = append(items, models.PurchaseOrderItem{
+				ProductID:   line.ProductID,
+				ProductName: line.ProductName,
+				ProductSKU:  line.ProductSku,
+				Quantity:    line.Quantity,
+				UnitCost:    line.UnitCost,
+			})
+		}
+
+		orderDate := time.Now().UTC()
+		po := models.PurchaseOrder{
+			ID:            "po-" + primitive.NewObjectID().Hex(),
+			OrgID:         orgID,
+			BranchID:      branchID,
+			ReferenceNo:   repo.FormatPurchaseOrderReference(seq),
+			Date:          orderDate.Format(time.RFC3339),
+			SupplierID:    supplier.ID,
+			Status:        "OPEN",
+			Items:         items,
+			TotalCost:     total,
+			InternalNotes: "Generated from low stock replenishment",
+		}
+		if supplier.LeadTimeDays > 0 {
+			po.ExpectedDeliveryDate = orderDate.AddDate(0, 0, supplier.LeadTimeDays).Format(time.RFC3339)
+		}
+
+		saved, err := m.deps.Repo.CreatePurchaseOrder(c.Request.Context(), po)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create purchase order"})
+			return
+		}
+		created = append(created, m.poToResponse(saved, supplier.Name, branch.Name))
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": created,
+		"meta": gin.H{
+			"created":          len(created),
+			"unassigned":       unassigned,
+			"skippedSuppliers": skipped,
+		},
+	})
+}
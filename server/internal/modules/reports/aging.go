@@ -0,0 +1,337 @@
+package reportsmodule
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/costing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// defaultAgingBounds are the upper day limits of each bucket; the last bucket is open ended
+var defaultAgingBounds = []int{30, 60, 90, 180}
+
+type agingBucketDef struct {
+	Label   string `json:"label"`
+	MinDays int    `json:"minDays"`
+	MaxDays int    `json:"maxDays,omitempty"` // 0 for the open ended bucket
+}
+
+// parseAgingBounds reads ?buckets=30,60,90,180 into ascending upper bounds
+func parseAgingBounds(raw string) ([]int, error) {
+	if strings.TrimSpace(raw) == "" {
+		return defaultAgingBounds, nil
+	}
+	parts := strings.Split(raw, ",")
+	bounds := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid bucket %q", p)
+		}
+		if len(bounds) > 0 && n <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("buckets must be ascending")
+		}
+		bounds = append(bounds, n)
+	}
+	return bounds, nil
+}
+
+func agingBucketDefs(bounds []int) []agingBucketDef {
+	defs := make([]agingBucketDef, 0, len(bounds)+1)
+	lower := 0
+	for _, b := range bounds {
+		defs = append(defs, agingBucketDef{Label: fmt.Sprintf("%d-%d", lower, b), MinDays: lower, MaxDays: b})
+		lower = b + 1
+	}
+	return append(defs, agingBucketDef{Label: fmt.Sprintf("%d+", bounds[len(bounds)-1]), MinDays: lower})
+}
+
+// agingBucketIndex returns the bucket a lot of the given age falls into
+func agingBucketIndex(bounds []int, ageDays int) int {
+	for i, b := range bounds {
+		if ageDays <= b {
+			return i
+		}
+	}
+	return len(bounds)
+}
+
+type agingCell struct {
+	Quantity int   `json:"quantity"`
+	Value    int64 `json:"value"`
+}
+
+type agingRow struct {
+	Key      string      `json:"key"`
+	Label    string      `json:"label,omitempty"`
+	SKU      string      `json:"sku,omitempty"`
+	Buckets  []agingCell `json:"buckets"`
+	Quantity int         `json:"quantity"`
+	Value    int64       `json:"value"`
+}
+
+func addAging(m map[string]*agingRow, key string, buckets, idx, qty int, value int64) *agingRow {
+	r, ok := m[key]
+	if !ok {
+		r = &agingRow{Key: key, Buckets: make([]agingCell, buckets)}
+		m[key] = r
+	}
+	r.Buckets[idx].Quantity += qty
+	r.Buckets[idx].Value += value
+	r.Quantity += qty
+	r.Value += value
+	return r
+}
+
+func sortedAging(m map[string]*agingRow) []agingRow {
+	out := make([]agingRow, 0, len(m))
+	for _, r := range m {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Value > out[j].Value
+	})
+	return out
+}
+
+// agingLot is an open lot with its age, for drilldown
+type agingLot struct {
+	models.InventoryLot
+	AgeDays int    `json:"ageDays"`
+	Bucket  string `json:"bucket"`
+	Value   int64  `json:"value"`
+}
+
+// loadAgingLots returns open owned lots matching the request filters, aged as of now.
+// Lots are capped at what is on hand, and products not costed FIFO are valued at the
+// unit cost the valuation report gives them rather than at each lot's receipt cost.
+func (m *Module) loadAgingLots(c *gin.Context, orgID string, bounds []int) ([]agingLot, error) {
+	filter := bson.M{
+		"qtyRemaining": bson.M{"$gt": 0},
+		"ownerId":      bson.M{"$in": bson.A{nil, ""}}, // Consigned stock is not our money
+	}
+	if branchID := c.Query("branchId"); branchID != "" {
+		filter["branchId"] = branchID
+	}
+	if productID := c.Query("productId"); productID != "" {
+		filter["productId"] = productID
+	}
+
+	ctx := c.Request.Context()
+	lots, _, err := m.deps.Repo.ListInventoryLotsByOrg(ctx, orgID, filter, 1, 1000000)
+	if err != nil {
+		return nil, err
+	}
+	products, err := m.deps.Repo.ListProductsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := m.deps.Repo.ListStockLevelsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	lots = costing.OnHandLots(levels, lots)
+
+	unitCosts := make(map[string]int64)
+	for _, line := range costing.ValueStock(products, levels, nil) {
+		if line.Method != models.CostingMethodFIFO {
+			unitCosts[repo.StockLevelID(line.BranchID, line.ProductID)] = line.UnitCost
+		}
+	}
+
+	defs := agingBucketDefs(bounds)
+	now := time.Now().UTC()
+	out := make([]agingLot, 0, len(lots))
+	for _, l := range lots {
+		age := int(now.Sub(l.ReceivedAt).Hours() / 24)
+		if age < 0 {
+			age = 0
+		}
+		unitCost := l.UnitCost
+		if cost, ok := unitCosts[repo.StockLevelID(l.BranchID, l.ProductID)]; ok {
+			unitCost = cost
+		}
+		out = append(out, agingLot{
+			InventoryLot: l,
+			AgeDays:      age,
+			Bucket:       defs[agingBucketIndex(bounds, age)].Label,
+			Value:        int64(l.QtyRemaining) * unitCost,
+		})
+	}
+	return out, nil
+}
+
+// inventoryAging buckets the quantity and value of open lots by age (days since receipt)
+// per product, category and branch. ?format=csv exports the rows for ?groupBy.
+func (m *Module) inventoryAging(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	bounds, err := parseAgingBounds(c.Query("buckets"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defs := agingBucketDefs(bounds)
+
+	ctx := c.Request.Context()
+	lots, err := m.loadAgingLots(c, orgID, bounds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list lots"})
+		return
+	}
+
+	products, _ := m.deps.Repo.ListProductsByOrg(ctx, orgID)
+	productMap := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+	branches, _ := m.deps.Repo.ListBranchesByOrg(ctx, orgID)
+	branchNames := make(map[string]string, len(branches))
+	for _, b := range branches {
+		branchNames[b.ID] = b.Name
+	}
+
+	category := c.Query("category")
+	byProduct := make(map[string]*agingRow)
+	byCategory := make(map[string]*agingRow)
+	byBranch := make(map[string]*agingRow)
+	totals := make([]agingCell, len(defs))
+	for _, l := range lots {
+		p := productMap[l.ProductID]
+		cat := p.Category
+		if cat == "" {
+			cat = "Uncategorized"
+		}
+		if category != "" && cat != category {
+			continue
+		}
+
+		idx := agingBucketIndex(bounds, l.AgeDays)
+		r := addAging(byProduct, l.ProductID, len(defs), idx, l.QtyRemaining, l.Value)
+		r.Label, r.SKU = p.Name, p.SKU
+		addAging(byCategory, cat, len(defs), idx, l.QtyRemaining, l.Value)
+		addAging(byBranch, l.BranchID, len(defs), idx, l.QtyRemaining, l.Value).Label = branchNames[l.BranchID]
+		totals[idx].Quantity += l.QtyRemaining
+		totals[idx].Value += l.Value
+	}
+
+	if wantsCSV(c) {
+		rows := byProduct
+		groupBy := c.DefaultQuery("groupBy", "product")
+		switch groupBy {
+		case "category":
+			rows = byCategory
+		case "branch":
+			rows = byBranch
+		}
+		header := []string{groupBy, "name", "sku"}
+		for _, d := range defs {
+			header = append(header, d.Label+" qty", d.Label+" value")
+		}
+		header = append(header, "total qty", "total value")
+
+		records := make([][]string, 0, len(rows))
+		for _, r := range sortedAging(rows) {
+			rec := []string{r.Key, r.Label, r.SKU}
+			for _, cell := range r.Buckets {
+				rec = append(rec, strconv.Itoa(cell.Quantity), formatSatang(cell.Value))
+			}
+			rec = append(rec, strconv.Itoa(r.Quantity), formatSatang(r.Value))
+			records = append(records, rec)
+		}
+		writeCSV(c, "inventory-aging-"+groupBy+".csv", header, records)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"buckets":    defs,
+			"byProduct":  sortedAging(byProduct),
+			"byCategory": sortedAging(byCategory),
+			"byBranch":   sortedAging(byBranch),
+			"totals":     totals,
+		},
+		"meta": gin.H{
+			"asOf": time.Now().UTC().Format("2006-01-02"),
+			"lots": len(lots),
+		},
+	})
+}
+
+// inventoryAgingLots drills down to the individual open lots behind the aging report,
+// optionally limited to one bucket (?bucket=61-90)
+func (m *Module) inventoryAgingLots(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	bounds, err := parseAgingBounds(c.Query("buckets"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lots, err := m.loadAgingLots(c, orgID, bounds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list lots"})
+		return
+	}
+
+	if bucket := c.Query("bucket"); bucket != "" {
+		filtered := make([]agingLot, 0, len(lots))
+		for _, l := range lots {
+			if l.Bucket == bucket {
+				filtered = append(filtered, l)
+			}
+		}
+		lots = filtered
+	}
+
+	// Oldest first
+	sort.Slice(lots, func(i, j int) bool {
+		return lots[i].AgeDays > lots[j].AgeDays
+	})
+
+	if wantsCSV(c) {
+		records := make([][]string, 0, len(lots))
+		for _, l := range lots {
+			records = append(records, []string{
+				l.ID, l.BranchID, l.ProductID, l.ReferenceNo, l.ReceivedAt.Format("2006-01-02"),
+				strconv.Itoa(l.AgeDays), l.Bucket, strconv.Itoa(l.QtyRemaining),
+				formatSatang(l.UnitCost), formatSatang(l.Value),
+			})
+		}
+		writeCSV(c, "inventory-aging-lots.csv", []string{
+			"lot", "branch", "product", "reference", "received", "age days", "bucket", "qty remaining", "unit cost", "value",
+		}, records)
+		return
+	}
+
+	var value int64
+	for _, l := range lots {
+		value += l.Value
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": lots,
+		"meta": gin.H{"total": len(lots), "value": value},
+	})
+}
@@ -0,0 +1,175 @@
+package reportsmodule
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultCODAgingBounds age outstanding COD in days; couriers usually remit weekly
+var defaultCODAgingBounds = []int{7, 14, 30, 60}
+
+// codOutstanding is one COD order the courier still owes cash for
+type codOutstanding struct {
+	OrderID        string `json:"orderId"`
+	BranchID       string `json:"branchId"`
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"trackingNumber"`
+	CustomerName   string `json:"customerName"`
+	State          string `json:"state"` // IN_TRANSIT, DELIVERED or SHORT (remitted short)
+	Expected       int64  `json:"expected"`
+	Outstanding    int64  `json:"outstanding"`
+	Since          string `json:"since"` // Shipped, or delivered once known
+	AgeDays        int    `json:"ageDays"`
+	Bucket         string `json:"bucket"`
+}
+
+type codCarrierRow struct {
+	Carrier     string      `json:"carrier"`
+	Count       int         `json:"count"`
+	Outstanding int64       `json:"outstanding"`
+	Buckets     []agingCell `json:"buckets"` // Quantity counts orders
+}
+
+// codOutstandingReport lists cash on delivery the couriers have not remitted, by carrier
+// and age: parcels shipped or delivered but not on a remittance statement, and
+// statements that paid short. Age runs from delivery, or from shipping while the parcel
+// is on its way. ?carrier, ?branchId, ?buckets=7,14,30,60; ?format=csv exports the orders.
+func (m *Module) codOutstandingReport(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+	bounds := defaultCODAgingBounds
+	if raw := c.Query("buckets"); raw != "" {
+		var err error
+		if bounds, err = parseAgingBounds(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	defs := agingBucketDefs(bounds)
+
+	transactions, err := m.deps.Repo.ListTransactionsByOrg(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list orders"})
+		return
+	}
+
+	carrierFilter := strings.TrimSpace(c.Query("carrier"))
+	branchID := c.Query("branchId")
+	now := time.Now().UTC()
+	orders := make([]codOutstanding, 0)
+	byCarrier := make(map[string]*codCarrierRow)
+	totals := make([]agingCell, len(defs))
+	var total int64
+	for _, t := range transactions {
+		if t.COD == nil || t.ShippingInfo == nil || t.Status == "CANCELLED" || t.Status == "REFUNDED" {
+			continue
+		}
+		if branchID != "" && t.BranchID != branchID {
+			continue
+		}
+		s := t.ShippingInfo
+		if carrierFilter != "" && !strings.EqualFold(s.Carrier, carrierFilter) {
+			continue
+		}
+
+		row := codOutstanding{
+			OrderID:        t.ID,
+			BranchID:       t.BranchID,
+			Carrier:        s.Carrier,
+			TrackingNumber: s.TrackingNumber,
+			CustomerName:   t.RecipientName,
+			Expected:       t.COD.Expected,
+			Outstanding:    t.COD.Expected,
+			Since:          s.ShippedDate,
+		}
+		switch {
+		case t.COD.RemittanceID != "":
+			if t.COD.Shortfall <= 0 {
+				continue
+			}
+			row.State, row.Outstanding = "SHORT", t.COD.Shortfall
+			if s.DeliveredDate != "" {
+				row.Since = s.DeliveredDate
+			}
+		case t.FulfillmentStatus == "DELIVERED":
+			row.State = "DELIVERED"
+			if s.DeliveredDate != "" {
+				row.Since = s.DeliveredDate
+			}
+		case t.FulfillmentStatus == "SHIPPED":
+			row.State = "IN_TRANSIT"
+		default:
+			continue // Not yet with the courier, or returned with nothing collected
+		}
+		if since, err := time.Parse(time.RFC3339, row.Since); err == nil {
+			row.AgeDays = int(now.Sub(since).Hours() / 24)
+		}
+		if row.AgeDays < 0 {
+			row.AgeDays = 0
+		}
+		idx := agingBucketIndex(bounds, row.AgeDays)
+		row.Bucket = defs[idx].Label
+		orders = append(orders, row)
+
+		key := row.Carrier
+		if key == "" {
+			key = "Unknown"
+		}
+		cr, ok := byCarrier[key]
+		if !ok {
+			cr = &codCarrierRow{Carrier: key, Buckets: make([]agingCell, len(defs))}
+			byCarrier[key] = cr
+		}
+		cr.Count++
+		cr.Outstanding += row.Outstanding
+		cr.Buckets[idx].Quantity++
+		cr.Buckets[idx].Value += row.Outstanding
+		totals[idx].Quantity++
+		totals[idx].Value += row.Outstanding
+		total += row.Outstanding
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].AgeDays > orders[j].AgeDays })
+	carriers := make([]codCarrierRow, 0, len(byCarrier))
+	for _, r := range byCarrier {
+		carriers = append(carriers, *r)
+	}
+	sort.Slice(carriers, func(i, j int) bool { return carriers[i].Outstanding > carriers[j].Outstanding })
+
+	if wantsCSV(c) {
+		header := []string{"order", "carrier", "tracking number", "customer", "state", "expected", "outstanding", "since", "age days", "bucket"}
+		records := make([][]string, 0, len(orders))
+		for _, o := range orders {
+			records = append(records, []string{
+				o.OrderID, o.Carrier, o.TrackingNumber, o.CustomerName, o.State,
+				formatSatang(o.Expected), formatSatang(o.Outstanding), o.Since, strconv.Itoa(o.AgeDays), o.Bucket,
+			})
+		}
+		writeCSV(c, "cod-outstanding.csv", header, records)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"buckets":   defs,
+			"byCarrier": carriers,
+			"orders":    orders,
+			"totals":    totals,
+		},
+		"meta": gin.H{
+			"asOf":        now.Format("2006-01-02"),
+			"orders":      len(orders),
+			"outstanding": total,
+		},
+	})
+}
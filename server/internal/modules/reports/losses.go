@@ -0,0 +1,133 @@
+package reportsmodule
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type lossBucket struct {
+	Key      string `json:"key"`
+	Label    string `json:"label,omitempty"`
+	Count    int    `json:"count"` // Write-off lines
+	Quantity int    `json:"quantity"`
+	Value    int64  `json:"value"`
+}
+
+func addLoss(m map[string]*lossBucket, key string, qty int, value int64) *lossBucket {
+	b, ok := m[key]
+	if !ok {
+		b = &lossBucket{Key: key}
+		m[key] = b
+	}
+	b.Count++
+	b.Quantity += qty
+	b.Value += value
+	return b
+}
+
+func sortedLosses(m map[string]*lossBucket, byKey bool) []lossBucket {
+	out := make([]lossBucket, 0, len(m))
+	for _, b := range m {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if byKey {
+			return out[i].Key < out[j].Key
+		}
+		return out[i].Value > out[j].Value
+	})
+	return out
+}
+
+// losses breaks down posted write-offs (shrinkage) by reason, branch and period
+func (m *Module) losses(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Get date range (default: last 30 days)
+	endDate := time.Now().UTC()
+	startDate := endDate.AddDate(0, 0, -30)
+	if from := c.Query("from"); from != "" {
+		if t, err := time.Parse("2006-01-02", from); err == nil {
+			startDate = t
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if t, err := time.Parse("2006-01-02", to); err == nil {
+			endDate = t.Add(24*time.Hour - time.Second)
+		}
+	}
+
+	periodFormat := "2006-01"
+	if c.Query("groupBy") == "day" {
+		periodFormat = "2006-01-02"
+	}
+
+	filter := bson.M{
+		"status":   models.WriteOffStatusPosted,
+		"postedAt": bson.M{"$gte": startDate, "$lte": endDate},
+	}
+	if branchID := c.Query("branchId"); branchID != "" {
+		filter["branchId"] = branchID
+	}
+
+	writeOffs, _, err := m.deps.Repo.ListWriteOffsByOrg(ctx, orgID, filter, 1, 100000)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list write-offs"})
+		return
+	}
+
+	branches, _ := m.deps.Repo.ListBranchesByOrg(ctx, orgID)
+	branchNames := make(map[string]string, len(branches))
+	for _, b := range branches {
+		branchNames[b.ID] = b.Name
+	}
+
+	byReason := make(map[string]*lossBucket)
+	byBranch := make(map[string]*lossBucket)
+	byPeriod := make(map[string]*lossBucket)
+	var totalQty int
+	var totalValue int64
+	for _, w := range writeOffs {
+		period := w.PostedAt.Format(periodFormat)
+		for _, it := range w.Items {
+			addLoss(byReason, string(it.Reason), it.Quantity, it.TotalCost)
+			addLoss(byBranch, w.BranchID, it.Quantity, it.TotalCost).Label = branchNames[w.BranchID]
+			addLoss(byPeriod, period, it.Quantity, it.TotalCost)
+			totalQty += it.Quantity
+			totalValue += it.TotalCost
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"byReason": sortedLosses(byReason, false),
+			"byBranch": sortedLosses(byBranch, false),
+			"byPeriod": sortedLosses(byPeriod, true),
+			"totals": gin.H{
+				"documents": len(writeOffs),
+				"quantity":  totalQty,
+				"value":     totalValue,
+			},
+		},
+		"meta": gin.H{
+			"period": gin.H{
+				"from": startDate.Format("2006-01-02"),
+				"to":   endDate.Format("2006-01-02"),
+			},
+		},
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"stockflows/server/internal/auth"
 	"stockflows/server/internal/deps"
 	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/costing"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,7 +33,19 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 	g.GET("/sales/by-customer", m.salesByCustomer)
 	g.GET("/sales/by-date", m.salesByDate)
 	g.GET("/inventory/value", m.inventoryValue)
+	g.GET("/inventory/valuation", m.inventoryValuation)
+	g.GET("/inventory/aging", m.inventoryAging)
+	g.GET("/inventory/aging/lots", m.inventoryAgingLots)
+	g.GET("/inventory/slow-movers", m.slowMovers)
+	g.GET("/inventory/clearance-suggestions", m.clearanceSuggestions)
 	g.GET("/inventory/low-stock", m.lowStock)
+	g.GET("/inventory/backorders", m.backorderReport)
+	g.GET("/inventory/losses", m.losses)
+	g.GET("/costing/variances", m.costVariances)
+	g.GET("/payments/daily", m.dailyPayments)
+	g.GET("/payments/cod-outstanding", m.codOutstandingReport)
+	g.GET("/promotions", m.promotionsReport)
+	g.GET("/vat", m.vatReport)
 	g.GET("/customers/summary", m.customersSummary)
 }
 
@@ -82,25 +96,24 @@ func (m *Module) dashboard(c *gin.Context) {
 			if t.FulfillmentStatus == "PENDING" {
 				pendingOrders++
 			}
+		} else if t.Type == "COGS_ADJUSTMENT" {
+			// Landed costs attached after the goods were already sold
+			totalCost += t.COGS
+			totalProfit += t.Profit
 		}
 	}
 
-	// Calculate total inventory value
+	// Calculate total inventory value per costing method (consigned stock belongs to the consignor)
 	var inventoryValue int64
-	productCostMap := make(map[string]int64)
-	for _, p := range products {
-		productCostMap[p.ID] = p.Cost
-	}
-	for _, sl := range stockLevels {
-		cost := productCostMap[sl.ProductID]
-		inventoryValue += int64(sl.Quantity) * cost
+	valuation, _ := costing.New(m.deps.Repo).Valuation(ctx, orgID, products, stockLevels)
+	for _, line := range valuation {
+		inventoryValue += line.Value
 	}
 
-	// Calculate low stock count
+	// Calculate low stock count against each stock level's reorder point
 	lowStockCount := 0
-	lowStockThreshold := 10
 	for _, sl := range stockLevels {
-		if sl.Quantity <= lowStockThreshold && sl.Quantity > 0 {
+		if sl.Quantity <= sl.MinStock && sl.Quantity > 0 {
 			lowStockCount++
 		}
 	}
@@ -174,6 +187,9 @@ func (m *Module) salesSummary(c *gin.Context) {
 			for _, item := range t.Items {
 				itemsSold += item.Quantity
 			}
+		} else if t.Type == "COGS_ADJUSTMENT" {
+			totalCost += t.COGS
+			totalProfit += t.Profit
 		}
 	}
 
@@ -505,6 +521,16 @@ func (m *Module) inventoryValue(c *gin.Context) {
 		branchMap[b.ID] = b
 	}
 
+	valuation, err := costing.New(m.deps.Repo).Valuation(ctx, orgID, products, stockLevels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to value inventory"})
+		return
+	}
+	values := make(map[string]int64, len(valuation))
+	for _, line := range valuation {
+		values[repo.StockLevelID(line.BranchID, line.ProductID)] = line.Value
+	}
+
 	// Group by branch
 	branchStats := make(map[string]*branchInventoryValue)
 	for _, sl := range stockLevels {
@@ -531,7 +557,8 @@ func (m *Module) inventoryValue(c *gin.Context) {
 			branchStats[branchID] = bs
 		}
 
-		value := int64(sl.Quantity) * p.Cost
+		// Consigned units are excluded from our valuation
+		value := values[repo.StockLevelID(sl.BranchID, sl.ProductID)]
 		bs.TotalProducts++
 		bs.TotalQuantity += sl.Quantity
 		bs.TotalValue += value
@@ -572,10 +599,9 @@ func (m *Module) lowStock(c *gin.Context) {
 		productMap[p.ID] = p
 	}
 
-	threshold := 10
 	items := make([]inventoryItem, 0)
 	for _, sl := range stockLevels {
-		if sl.Quantity > threshold {
+		if sl.Quantity > sl.MinStock {
 			continue
 		}
 		p, ok := productMap[sl.ProductID]
@@ -601,8 +627,7 @@ func (m *Module) lowStock(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"data": items,
 		"meta": gin.H{
-			"threshold": threshold,
-			"total":     len(items),
+			"total": len(items),
 		},
 	})
 }
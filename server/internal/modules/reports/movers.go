@@ -0,0 +1,116 @@
+package reportsmodule
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/services/analysis"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moverPolicyFromQuery reads optional windowDays, sellThrough and noSaleDays overrides
+func moverPolicyFromQuery(c *gin.Context) analysis.MoverPolicy {
+	p := analysis.DefaultMoverPolicy()
+	if v, err := strconv.Atoi(c.Query("windowDays")); err == nil {
+		p.WindowDays = v
+	}
+	if v, err := strconv.ParseFloat(c.Query("sellThrough"), 64); err == nil {
+		p.SellThroughBelow = v
+	}
+	if v, err := strconv.Atoi(c.Query("noSaleDays")); err == nil {
+		p.NoSaleDays = v
+	}
+	return p
+}
+
+func isMoverPolicyError(err error) bool {
+	return err == analysis.ErrInvalidWindow || err == analysis.ErrInvalidSellThrough || err == analysis.ErrInvalidNoSaleDays
+}
+
+// slowMovers flags products with low sell-through or no recent sale (?flag=DEAD_STOCK|SLOW_MOVER)
+func (m *Module) slowMovers(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	policy := moverPolicyFromQuery(c)
+	movers, err := analysis.New(m.deps.Repo).Movers(c.Request.Context(), orgID, strings.TrimSpace(c.Query("branchId")), policy, time.Now().UTC())
+	if err != nil {
+		if isMoverPolicyError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to analyse stock"})
+		return
+	}
+
+	if flag := strings.ToUpper(c.Query("flag")); flag != "" {
+		filtered := make([]analysis.Mover, 0, len(movers))
+		for _, mv := range movers {
+			if mv.HasFlag(analysis.MoverFlag(flag)) {
+				filtered = append(filtered, mv)
+			}
+		}
+		movers = filtered
+	}
+
+	var tiedUp int64
+	var dead, slow int
+	for _, mv := range movers {
+		tiedUp += mv.TiedUpValue
+		if mv.HasFlag(analysis.MoverDead) {
+			dead++
+		}
+		if mv.HasFlag(analysis.MoverSlow) {
+			slow++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": movers,
+		"meta": gin.H{
+			"total":       len(movers),
+			"deadStock":   dead,
+			"slowMovers":  slow,
+			"tiedUpValue": tiedUp,
+			"policy":      policy,
+		},
+	})
+}
+
+// clearanceSuggestions turns dead stock and slow movers into a markdown / promotion list
+func (m *Module) clearanceSuggestions(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	policy := moverPolicyFromQuery(c)
+	movers, err := analysis.New(m.deps.Repo).Movers(c.Request.Context(), orgID, strings.TrimSpace(c.Query("branchId")), policy, time.Now().UTC())
+	if err != nil {
+		if isMoverPolicyError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to analyse stock"})
+		return
+	}
+
+	suggestions := analysis.SuggestClearance(movers, policy)
+	c.JSON(http.StatusOK, gin.H{
+		"data": suggestions,
+		"meta": gin.H{
+			"total":  len(suggestions),
+			"policy": policy,
+		},
+	})
+}
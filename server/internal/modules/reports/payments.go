@@ -0,0 +1,153 @@
+package reportsmodule
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// paymentTotals sums ledger entries for one method (or all methods) on one day
+type paymentTotals struct {
+	Method   string `json:"method,omitempty"`
+	Count    int    `json:"count"`    // Active payments
+	Received int64  `json:"received"` // Active payments
+	Refunds  int    `json:"refunds"`  // Active refunds
+	Refunded int64  `json:"refunded"`
+	Net      int64  `json:"net"`
+	Voided   int    `json:"voided"` // Entries voided, excluded from the amounts
+}
+
+func (t *paymentTotals) add(p models.Payment) {
+	if p.Status == models.PaymentEntryVoided {
+		t.Voided++
+		return
+	}
+	if p.Type == models.PaymentTypeRefund {
+		t.Refunds++
+		t.Refunded += p.Amount
+		t.Net -= p.Amount
+		return
+	}
+	t.Count++
+	t.Received += p.Amount
+	t.Net += p.Amount
+}
+
+type paymentDay struct {
+	Date     string          `json:"date"`
+	ByMethod []paymentTotals `json:"byMethod"`
+	Total    paymentTotals   `json:"total"`
+}
+
+// dailyPayments totals the payment ledger per day and method (?from, ?to, ?branchId).
+// ?format=csv exports one row per day and method.
+func (m *Module) dailyPayments(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	// Get date range (default: last 30 days)
+	endDate := time.Now().UTC()
+	startDate := endDate.AddDate(0, 0, -30)
+	if from := c.Query("from"); from != "" {
+		if t, err := time.Parse("2006-01-02", from); err == nil {
+			startDate = t
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if t, err := time.Parse("2006-01-02", to); err == nil {
+			endDate = t.Add(24*time.Hour - time.Second)
+		}
+	}
+
+	filter := bson.M{"createdAt": bson.M{"$gte": startDate, "$lte": endDate}}
+	if branchID := c.Query("branchId"); branchID != "" {
+		filter["branchId"] = branchID
+	}
+	payments, err := m.deps.Repo.ListPaymentsByOrg(c.Request.Context(), orgID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list payments"})
+		return
+	}
+
+	days := make(map[string]map[string]*paymentTotals)
+	methods := make(map[string]*paymentTotals)
+	var total paymentTotals
+	for _, p := range payments {
+		day := p.CreatedAt.UTC().Format("2006-01-02")
+		if days[day] == nil {
+			days[day] = make(map[string]*paymentTotals)
+		}
+		if days[day][p.Method] == nil {
+			days[day][p.Method] = &paymentTotals{Method: p.Method}
+		}
+		days[day][p.Method].add(p)
+		if methods[p.Method] == nil {
+			methods[p.Method] = &paymentTotals{Method: p.Method}
+		}
+		methods[p.Method].add(p)
+		total.add(p)
+	}
+
+	sortedMethods := func(m map[string]*paymentTotals) []paymentTotals {
+		out := make([]paymentTotals, 0, len(m))
+		for _, t := range m {
+			out = append(out, *t)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Method < out[j].Method })
+		return out
+	}
+
+	rows := make([]paymentDay, 0, len(days))
+	for day, byMethod := range days {
+		d := paymentDay{Date: day, ByMethod: sortedMethods(byMethod)}
+		for _, t := range d.ByMethod {
+			d.Total.Count += t.Count
+			d.Total.Received += t.Received
+			d.Total.Refunds += t.Refunds
+			d.Total.Refunded += t.Refunded
+			d.Total.Net += t.Net
+			d.Total.Voided += t.Voided
+		}
+		rows = append(rows, d)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Date < rows[j].Date })
+
+	if wantsCSV(c) {
+		records := make([][]string, 0)
+		for _, d := range rows {
+			for _, t := range d.ByMethod {
+				records = append(records, []string{
+					d.Date, t.Method, strconv.Itoa(t.Count), formatSatang(t.Received),
+					strconv.Itoa(t.Refunds), formatSatang(t.Refunded), formatSatang(t.Net), strconv.Itoa(t.Voided),
+				})
+			}
+		}
+		writeCSV(c, "payments-daily.csv", []string{
+			"date", "method", "payments", "received", "refunds", "refunded", "net", "voided",
+		}, records)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"days":     rows,
+			"byMethod": sortedMethods(methods),
+			"total":    total,
+		},
+		"meta": gin.H{
+			"from": startDate.Format("2006-01-02"),
+			"to":   endDate.Format("2006-01-02"),
+		},
+	})
+}
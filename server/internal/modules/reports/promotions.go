@@ -0,0 +1,122 @@
+package reportsmodule
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// promotionUsage totals one promotion across sales
+type promotionUsage struct {
+	PromotionID string               `json:"promotionId"`
+	Name        string               `json:"name"`
+	Type        models.PromotionType `json:"type"`
+	CouponCode  string               `json:"couponCode,omitempty"`
+	Orders      int                  `json:"orders"`
+	Units       int                  `json:"units"`    // Units the promotion acted on
+	Discount    int64                `json:"discount"` // Given by this promotion
+	Revenue     int64                `json:"revenue"`  // Order totals of the orders it fired on
+}
+
+// promotionsReport shows how often each promotion fired and what it cost (?from, ?to, ?branchId).
+// ?format=csv exports one row per promotion.
+func (m *Module) promotionsReport(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	// Get date range (default: last 30 days)
+	endDate := time.Now().UTC()
+	startDate := endDate.AddDate(0, 0, -30)
+	if from := c.Query("from"); from != "" {
+		if t, err := time.Parse("2006-01-02", from); err == nil {
+			startDate = t
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if t, err := time.Parse("2006-01-02", to); err == nil {
+			endDate = t.Add(24*time.Hour - time.Second)
+		}
+	}
+	branchID := c.Query("branchId")
+
+	transactions, _ := m.deps.Repo.ListTransactionsByOrg(c.Request.Context(), orgID)
+
+	byPromo := make(map[string]*promotionUsage)
+	var discount, revenue int64
+	var orders, promoted int
+	for _, t := range transactions {
+		if strings.ToUpper(t.Type) != "SALE" || t.Status == "CANCELLED" || t.Status == "REFUNDED" {
+			continue
+		}
+		if branchID != "" && t.BranchID != branchID {
+			continue
+		}
+		txnTime, _ := time.Parse(time.RFC3339, t.Date)
+		if txnTime.Before(startDate) || txnTime.After(endDate) {
+			continue
+		}
+		orders++
+		if len(t.Promotions) == 0 {
+			continue
+		}
+		promoted++
+		revenue += t.Total
+		for _, a := range t.Promotions {
+			p := byPromo[a.PromotionID]
+			if p == nil {
+				p = &promotionUsage{PromotionID: a.PromotionID, Name: a.Name, Type: a.Type, CouponCode: a.CouponCode}
+				byPromo[a.PromotionID] = p
+			}
+			p.Orders++
+			p.Discount += a.Amount
+			p.Revenue += t.Total
+			for _, l := range a.Lines {
+				p.Units += l.Quantity
+			}
+			discount += a.Amount
+		}
+	}
+
+	rows := make([]promotionUsage, 0, len(byPromo))
+	for _, p := range byPromo {
+		rows = append(rows, *p)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Discount > rows[j].Discount })
+
+	if wantsCSV(c) {
+		records := make([][]string, 0, len(rows))
+		for _, p := range rows {
+			records = append(records, []string{
+				p.PromotionID, p.Name, string(p.Type), p.CouponCode, strconv.Itoa(p.Orders),
+				strconv.Itoa(p.Units), formatSatang(p.Discount), formatSatang(p.Revenue),
+			})
+		}
+		writeCSV(c, "promotions.csv", []string{
+			"promotion id", "name", "type", "coupon code", "orders", "units", "discount", "revenue",
+		}, records)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": rows,
+		"meta": gin.H{
+			"from":           startDate.Format("2006-01-02"),
+			"to":             endDate.Format("2006-01-02"),
+			"orders":         orders,
+			"promotedOrders": promoted,
+			"discount":       discount,
+			"revenue":        revenue,
+		},
+	})
+}
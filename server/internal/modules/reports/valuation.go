@@ -0,0 +1,125 @@
+package reportsmodule
+
+import (
+	"net/http"
+	"sort"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/costing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type valuationBucket struct {
+	Key           string `json:"key"`
+	Label         string `json:"label,omitempty"`
+	Products      int    `json:"products"` // Stock level rows
+	Quantity      int    `json:"quantity"`
+	Value         int64  `json:"value"`
+	LastCostValue int64  `json:"lastCostValue"`
+	Difference    int64  `json:"difference"`
+}
+
+func addValuation(m map[string]*valuationBucket, key string, line costing.ValuationLine) *valuationBucket {
+	b, ok := m[key]
+	if !ok {
+		b = &valuationBucket{Key: key}
+		m[key] = b
+	}
+	b.Products++
+	b.Quantity += line.Quantity
+	b.Value += line.Value
+	b.LastCostValue += line.LastCostValue
+	b.Difference += line.Difference
+	return b
+}
+
+func sortedValuation(m map[string]*valuationBucket) []valuationBucket {
+	out := make([]valuationBucket, 0, len(m))
+	for _, b := range m {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Value > out[j].Value
+	})
+	return out
+}
+
+// inventoryValuation values owned stock per costing method (FIFO lots, moving average,
+// standard) by branch, category and product, and reconciles it against the last-cost estimate.
+func (m *Module) inventoryValuation(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	products, _ := m.deps.Repo.ListProductsByOrg(ctx, orgID)
+	stockLevels, _ := m.deps.Repo.ListStockLevelsByOrg(ctx, orgID)
+	branches, _ := m.deps.Repo.ListBranchesByOrg(ctx, orgID)
+
+	if branchID := c.Query("branchId"); branchID != "" {
+		filtered := make([]models.StockLevel, 0, len(stockLevels))
+		for _, sl := range stockLevels {
+			if sl.BranchID == branchID {
+				filtered = append(filtered, sl)
+			}
+		}
+		stockLevels = filtered
+	}
+
+	lines, err := costing.New(m.deps.Repo).Valuation(ctx, orgID, products, stockLevels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to value inventory"})
+		return
+	}
+
+	branchNames := make(map[string]string, len(branches))
+	for _, b := range branches {
+		branchNames[b.ID] = b.Name
+	}
+
+	byBranch := make(map[string]*valuationBucket)
+	byCategory := make(map[string]*valuationBucket)
+	byProduct := make(map[string]*valuationBucket)
+	byMethod := make(map[string]*valuationBucket)
+	var total, lastCostTotal int64
+	var unlotted int
+	for _, line := range lines {
+		addValuation(byBranch, line.BranchID, line).Label = branchNames[line.BranchID]
+		category := line.Category
+		if category == "" {
+			category = "Uncategorized"
+		}
+		addValuation(byCategory, category, line)
+		addValuation(byProduct, line.ProductID, line).Label = line.ProductName
+		addValuation(byMethod, string(line.Method), line)
+		total += line.Value
+		lastCostTotal += line.LastCostValue
+		unlotted += line.UnlottedQty
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"byBranch":   sortedValuation(byBranch),
+			"byCategory": sortedValuation(byCategory),
+			"byProduct":  sortedValuation(byProduct),
+			"byMethod":   sortedValuation(byMethod),
+			"lines":      lines,
+			"totals": gin.H{
+				"value": total,
+			},
+			// How far the old quantity x last purchase price estimate is from the costed value
+			"reconciliation": gin.H{
+				"lastCostValue": lastCostTotal,
+				"costedValue":   total,
+				"difference":    total - lastCostTotal,
+				"unlottedQty":   unlotted,
+			},
+		},
+	})
+}
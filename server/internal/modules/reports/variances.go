@@ -0,0 +1,149 @@
+package reportsmodule
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type varianceBucket struct {
+	Key         string `json:"key"`
+	Label       string `json:"label,omitempty"`
+	SKU         string `json:"sku,omitempty"`
+	Quantity    int    `json:"quantity"` // Units received against standard
+	Purchase    int64  `json:"purchasePriceVariance"`
+	Revaluation int64  `json:"revaluation"`
+	Total       int64  `json:"total"`
+}
+
+func addVariance(m map[string]*varianceBucket, key string, v models.CostVariance) *varianceBucket {
+	b, ok := m[key]
+	if !ok {
+		b = &varianceBucket{Key: key}
+		m[key] = b
+	}
+	switch v.Type {
+	case models.CostVariancePurchasePrice:
+		b.Purchase += v.Amount
+		b.Quantity += v.Quantity
+	case models.CostVarianceRevaluation:
+		b.Revaluation += v.Amount
+	}
+	b.Total += v.Amount
+	return b
+}
+
+func sortedVariances(m map[string]*varianceBucket) []varianceBucket {
+	out := make([]varianceBucket, 0, len(m))
+	for _, b := range m {
+		out = append(out, *b)
+	}
+	// Largest absolute variance first
+	abs := func(v int64) int64 {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return abs(out[i].Total) > abs(out[j].Total)
+	})
+	return out
+}
+
+// costVariances reports purchase price variance and standard cost revaluations by product
+// and supplier. Positive amounts are unfavourable (paid above standard).
+func (m *Module) costVariances(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Get date range (default: last 30 days)
+	endDate := time.Now().UTC()
+	startDate := endDate.AddDate(0, 0, -30)
+	if from := c.Query("from"); from != "" {
+		if t, err := time.Parse("2006-01-02", from); err == nil {
+			startDate = t
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if t, err := time.Parse("2006-01-02", to); err == nil {
+			endDate = t.Add(24*time.Hour - time.Second)
+		}
+	}
+
+	filter := bson.M{"createdAt": bson.M{"$gte": startDate, "$lte": endDate}}
+	if branchID := c.Query("branchId"); branchID != "" {
+		filter["branchId"] = branchID
+	}
+	if productID := c.Query("productId"); productID != "" {
+		filter["productId"] = productID
+	}
+	if supplierID := c.Query("supplierId"); supplierID != "" {
+		filter["supplierId"] = supplierID
+	}
+
+	variances, err := m.deps.Repo.ListCostVariancesByOrg(ctx, orgID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list variances"})
+		return
+	}
+
+	products, _ := m.deps.Repo.ListProductsByOrg(ctx, orgID)
+	productMap := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+	suppliers, _ := m.deps.Repo.ListSuppliersByOrg(ctx, orgID)
+	supplierNames := make(map[string]string, len(suppliers))
+	for _, s := range suppliers {
+		supplierNames[s.ID] = s.Name
+	}
+
+	byProduct := make(map[string]*varianceBucket)
+	bySupplier := make(map[string]*varianceBucket)
+	var totalPurchase, totalRevaluation int64
+	for _, v := range variances {
+		b := addVariance(byProduct, v.ProductID, v)
+		b.Label = productMap[v.ProductID].Name
+		b.SKU = productMap[v.ProductID].SKU
+
+		// Revaluations are not tied to a supplier
+		if v.Type == models.CostVariancePurchasePrice {
+			addVariance(bySupplier, v.SupplierID, v).Label = supplierNames[v.SupplierID]
+			totalPurchase += v.Amount
+		} else {
+			totalRevaluation += v.Amount
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"byProduct":  sortedVariances(byProduct),
+			"bySupplier": sortedVariances(bySupplier),
+			"entries":    variances,
+			"totals": gin.H{
+				"purchasePriceVariance": totalPurchase,
+				"revaluation":           totalRevaluation,
+				"total":                 totalPurchase + totalRevaluation,
+			},
+		},
+		"meta": gin.H{
+			"period": gin.H{
+				"from": startDate.Format("2006-01-02"),
+				"to":   endDate.Format("2006-01-02"),
+			},
+		},
+	})
+}
@@ -0,0 +1,253 @@
+package reportsmodule
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// vatTotals sums tax bases and VAT for one side of the return
+type vatTotals struct {
+	Documents int   `json:"documents"`
+	Standard  int64 `json:"standard"`
+	ZeroRated int64 `json:"zeroRated"`
+	Exempt    int64 `json:"exempt"`
+	Tax       int64 `json:"tax"`
+}
+
+// add adds a document's summary; sign is -1 for returns and credit notes
+func (t *vatTotals) add(s models.TaxSummary, sign int64) {
+	t.Documents++
+	t.Standard += sign * s.Standard
+	t.ZeroRated += sign * s.ZeroRated
+	t.Exempt += sign * s.Exempt
+	t.Tax += sign * s.Tax
+}
+
+// refundedTax is the part of a sale's tax summary returned by a refund of amount, in
+// proportion to the order total
+func refundedTax(s models.TaxSummary, amount, total int64) models.TaxSummary {
+	if total <= 0 || amount >= total {
+		return s
+	}
+	s.Standard = s.Standard * amount / total
+	s.ZeroRated = s.ZeroRated * amount / total
+	s.Exempt = s.Exempt * amount / total
+	s.Tax = s.Tax * amount / total
+	return s
+}
+
+type vatPeriod struct {
+	Period string    `json:"period"` // YYYY-MM
+	Output vatTotals `json:"output"` // Sales less refunds and customer returns
+	Input  vatTotals `json:"input"`  // Received purchases less supplier returns
+	Net    int64     `json:"net"`    // Output less input tax; negative is a refund due
+}
+
+// vatReport summarizes output and input VAT per month (?from, ?to, ?branchId).
+// Only documents that carry a tax summary are included. ?format=csv exports one row per month.
+func (m *Module) vatReport(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	// Get date range (default: last 30 days)
+	endDate := time.Now().UTC()
+	startDate := endDate.AddDate(0, 0, -30)
+	if from := c.Query("from"); from != "" {
+		if t, err := time.Parse("2006-01-02", from); err == nil {
+			startDate = t
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if t, err := time.Parse("2006-01-02", to); err == nil {
+			endDate = t.Add(24*time.Hour - time.Second)
+		}
+	}
+	branchID := c.Query("branchId")
+
+	periods := make(map[string]*vatPeriod)
+	periodFor := func(at time.Time) *vatPeriod {
+		if at.Before(startDate) || at.After(endDate) {
+			return nil
+		}
+		key := at.UTC().Format("2006-01")
+		if periods[key] == nil {
+			periods[key] = &vatPeriod{Period: key}
+		}
+		return periods[key]
+	}
+
+	transactions, err := m.deps.Repo.ListTransactionsByOrg(ctx, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list transactions"})
+		return
+	}
+	refunds, err := m.deps.Repo.ListPaymentsByOrg(ctx, orgID, bson.M{
+		"type":   models.PaymentTypeRefund,
+		"status": models.PaymentEntryActive,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list payments"})
+		return
+	}
+	refundsByOrder := make(map[string][]models.Payment)
+	for _, r := range refunds {
+		refundsByOrder[r.TransactionID] = append(refundsByOrder[r.TransactionID], r)
+	}
+
+	for _, t := range transactions {
+		if t.Tax == nil || strings.ToUpper(t.Type) != "SALE" {
+			continue
+		}
+		// Only confirmed sales are filed; drafts and unconfirmed orders never were
+		s := strings.ToUpper(t.Status)
+		if s == "DRAFT" || s == "PENDING" || s == "CANCELLED" {
+			continue
+		}
+		if branchID != "" && t.BranchID != branchID {
+			continue
+		}
+		// A refunded sale stays in the month it was filed; the refund reduces output tax
+		// in the month the money went back
+		if p := periodFor(t.CreatedAt); p != nil {
+			p.Output.add(*t.Tax, 1)
+		}
+		orderRefunds := refundsByOrder[t.ID]
+		if len(orderRefunds) == 0 && s == "REFUNDED" {
+			if p := periodFor(t.UpdatedAt); p != nil {
+				p.Output.add(*t.Tax, -1)
+			}
+			continue
+		}
+		for _, r := range orderRefunds {
+			if p := periodFor(r.CreatedAt); p != nil {
+				p.Output.add(refundedTax(*t.Tax, r.Amount, t.Total), -1)
+			}
+		}
+	}
+
+	pos, err := m.deps.Repo.ListPurchaseOrdersByOrg(ctx, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list purchase orders"})
+		return
+	}
+	for _, po := range pos {
+		if po.Tax == nil || po.Status != "RECEIVED" {
+			continue
+		}
+		if branchID != "" && po.BranchID != branchID {
+			continue
+		}
+		// Input tax is claimed when the goods and the supplier's invoice arrive
+		at := po.UpdatedAt
+		if t, err := time.Parse(time.RFC3339, po.ReceivedDate); err == nil {
+			at = t
+		}
+		if p := periodFor(at); p != nil {
+			p.Input.add(*po.Tax, 1)
+		}
+	}
+
+	filter := bson.M{
+		"tax":    bson.M{"$exists": true},
+		"status": bson.M{"$in": []models.ReturnStatus{models.ReturnStatusReceived, models.ReturnStatusShipped, models.ReturnStatusCompleted}},
+	}
+	if branchID != "" {
+		filter["branchId"] = branchID
+	}
+	returns, _, err := m.deps.Repo.ListReturnsByOrg(ctx, orgID, filter, 1, 100000)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list returns"})
+		return
+	}
+	for _, r := range returns {
+		if r.Tax == nil {
+			continue
+		}
+		if r.Type == models.ReturnTypeCustomer {
+			at := r.ReceivedAt
+			if at.IsZero() {
+				at = r.UpdatedAt
+			}
+			if p := periodFor(at); p != nil {
+				p.Output.add(*r.Tax, -1)
+			}
+			continue
+		}
+		at := r.ShippedAt
+		if at.IsZero() {
+			at = r.UpdatedAt
+		}
+		if p := periodFor(at); p != nil {
+			p.Input.add(*r.Tax, -1)
+		}
+	}
+
+	rows := make([]vatPeriod, 0, len(periods))
+	var total vatPeriod
+	for _, p := range periods {
+		p.Net = p.Output.Tax - p.Input.Tax
+		rows = append(rows, *p)
+		total.Output.Documents += p.Output.Documents
+		total.Output.Standard += p.Output.Standard
+		total.Output.ZeroRated += p.Output.ZeroRated
+		total.Output.Exempt += p.Output.Exempt
+		total.Output.Tax += p.Output.Tax
+		total.Input.Documents += p.Input.Documents
+		total.Input.Standard += p.Input.Standard
+		total.Input.ZeroRated += p.Input.ZeroRated
+		total.Input.Exempt += p.Input.Exempt
+		total.Input.Tax += p.Input.Tax
+		total.Net += p.Net
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Period < rows[j].Period })
+
+	if wantsCSV(c) {
+		records := make([][]string, 0, len(rows))
+		for _, p := range rows {
+			records = append(records, []string{
+				p.Period,
+				strconv.Itoa(p.Output.Documents), formatSatang(p.Output.Standard), formatSatang(p.Output.ZeroRated),
+				formatSatang(p.Output.Exempt), formatSatang(p.Output.Tax),
+				strconv.Itoa(p.Input.Documents), formatSatang(p.Input.Standard), formatSatang(p.Input.ZeroRated),
+				formatSatang(p.Input.Exempt), formatSatang(p.Input.Tax),
+				formatSatang(p.Net),
+			})
+		}
+		writeCSV(c, "vat.csv", []string{
+			"period",
+			"output_documents", "output_standard", "output_zero_rated", "output_exempt", "output_tax",
+			"input_documents", "input_standard", "input_zero_rated", "input_exempt", "input_tax",
+			"net_payable",
+		}, records)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"periods": rows,
+			"total": gin.H{
+				"output": total.Output,
+				"input":  total.Input,
+				"net":    total.Net,
+			},
+		},
+		"meta": gin.H{
+			"from": startDate.Format("2006-01-02"),
+			"to":   endDate.Format("2006-01-02"),
+		},
+	})
+}
@@ -0,0 +1,57 @@
+package returnsmodule
+
+import (
+	"errors"
+	"net/http"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/audit"
+	"stockflows/server/internal/services/documents"
+
+	"github.com/gin-gonic/gin"
+)
+
+// issueCreditNote renders the credit note for a received customer return. It is issued
+// once; asking again returns the stored document.
+func (m *Module) issueCreditNote(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	ret, err := m.deps.Repo.GetReturnByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "return not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get return"})
+		return
+	}
+
+	doc, created, err := documents.New(m.deps.Repo, m.deps.MinIO, m.deps.Config).ForReturn(ctx, *u, ret)
+	if err != nil {
+		switch {
+		case errors.Is(err, documents.ErrStorageNotConfigured):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		case errors.Is(err, documents.ErrNotIssuable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "credit notes are issued for received customer returns"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue credit note"})
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Document", doc.ID, models.AuditActionCreate,
+			nil, doc, c.ClientIP(), c.Request.UserAgent(), "Credit note "+doc.Number+" for return "+ret.ReferenceNo)
+	}
+	c.JSON(status, gin.H{"data": doc, "meta": gin.H{"created": created}})
+}
@@ -0,0 +1,33 @@
+package returnsmodule
+
+import (
+	"log"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/orderevents"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordOrderEvent adds a change made through a return to the original order's history.
+// The return is already saved, so a failure is logged rather than failing the request.
+func (m *Module) recordOrderEvent(c *gin.Context, actor models.User, ret models.Return, ch orderevents.Change) {
+	if ret.OriginalOrderID == "" {
+		return
+	}
+	ctx := c.Request.Context()
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, ret.OrgID, ret.OriginalOrderID)
+	if err != nil {
+		log.Printf("returns: load order %s for %s: %v", ret.OriginalOrderID, ch.Type, err)
+		return
+	}
+	if ch.Payload == nil {
+		ch.Payload = map[string]interface{}{}
+	}
+	ch.Payload["returnId"] = ret.ID
+	ch.Payload["referenceNo"] = ret.ReferenceNo
+	src := orderevents.Source{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if _, err := orderevents.New(m.deps.Repo).Record(ctx, actor, txn, ch, src); err != nil {
+		log.Printf("returns: record %s for %s: %v", ch.Type, txn.ID, err)
+	}
+}
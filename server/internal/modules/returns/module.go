@@ -10,6 +10,9 @@ import (
 	"stockflows/server/internal/deps"
 	"stockflows/server/internal/models"
 	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/consignment"
+	"stockflows/server/internal/services/orderevents"
+	"stockflows/server/internal/services/tax"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -47,6 +50,7 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 	g.POST("/:id/ship", manager, m.ship)        // For supplier returns
 	g.POST("/:id/complete", manager, m.complete)
 	g.POST("/:id/cancel", manager, m.cancel)
+	g.POST("/:id/credit-note", manager, m.issueCreditNote) // For received customer returns
 
 	// Lookup returns by original document
 	g.GET("/by-order/:orderId", m.listByOrder)
@@ -262,12 +266,20 @@ func (m *Module) create(c *gin.Context) {
 				Condition:   models.ItemCondition(strings.ToUpper(ri.Condition)),
 				Notes:       strings.TrimSpace(ri.Notes),
 				Restockable: ri.Restockable,
+				TaxClass:    found.TaxClass,
+				TaxAmount:   tax.Share(found.TaxAmount, ri.Quantity, found.Quantity),
+				NetAmount:   tax.Share(found.NetAmount, ri.Quantity, found.Quantity),
 			}
 			items = append(items, item)
 			totalValue += int64(ri.Quantity) * found.Price
 		}
 		ret.Items = items
 		ret.TotalValue = totalValue
+		if txn.Tax != nil {
+			// Output VAT reversed by the credit note, at the rates of the original sale
+			sum := returnTax(*txn.Tax, items)
+			ret.Tax = &sum
+		}
 
 	} else {
 		// Supplier return - validate PO exists and is received
@@ -327,6 +339,9 @@ func (m *Module) create(c *gin.Context) {
 				Condition:   models.ItemCondition(strings.ToUpper(ri.Condition)),
 				Notes:       strings.TrimSpace(ri.Notes),
 				Restockable: ri.Restockable,
+				TaxClass:    found.TaxClass,
+				TaxAmount:   tax.Share(found.TaxAmount, ri.Quantity, found.Quantity),
+				NetAmount:   tax.Share(found.NetAmount, ri.Quantity, found.Quantity),
 			}
 			items = append(items, item)
 			totalValue += int64(ri.Quantity) * found.UnitCost
@@ -334,6 +349,12 @@ func (m *Module) create(c *gin.Context) {
 		ret.Items = items
 		ret.TotalValue = totalValue
 		ret.CreditAmount = totalValue // Expected credit from supplier
+		if po.Tax != nil {
+			// Input VAT reversed; the supplier credits it along with the goods
+			sum := returnTax(*po.Tax, items)
+			ret.Tax = &sum
+			ret.CreditAmount += sum.Tax
+		}
 	}
 
 	// Generate reference number
@@ -349,6 +370,13 @@ func (m *Module) create(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create return"})
 		return
 	}
+	if created.Type == models.ReturnTypeCustomer {
+		m.recordOrderEvent(c, *u, created, orderevents.Change{
+			Type:    models.OrderEventReturnOpened,
+			Message: "Return " + created.ReferenceNo + " requested",
+			Payload: map[string]interface{}{"items": len(created.Items), "totalValue": created.TotalValue, "resolution": created.Resolution},
+		})
+	}
 
 	c.JSON(http.StatusCreated, gin.H{"data": created})
 }
@@ -598,8 +626,9 @@ func (m *Module) receive(c *gin.Context) {
 				updatedItems[idx].Condition = models.ItemCondition(strings.ToUpper(ri.Condition))
 				updatedItems[idx].Restockable = ri.Restockable
 
-				// If restockable, create inventory lot and adjust stock
-				if ri.Restockable && ri.QtyReceived > 0 {
+				// If restockable, create inventory lot and adjust stock. Parcels returned
+				// to sender never left stock, so there is nothing to put back.
+				if ri.Restockable && ri.QtyReceived > 0 && !ret.ReturnedToSender {
 					lotID := "lot-" + primitive.NewObjectID().Hex()
 					_, err := m.deps.Repo.CreateInventoryLot(ctx, models.InventoryLot{
 						ID:          lotID,
@@ -619,13 +648,30 @@ func (m *Module) receive(c *gin.Context) {
 					}
 
 					// Increment stock level
-					_, err = m.deps.Repo.AdjustStock(ctx, orgID, ret.BranchID, ri.ProductID, ri.QtyReceived)
+					level, err := m.deps.Repo.AdjustStock(ctx, orgID, ret.BranchID, ri.ProductID, ri.QtyReceived)
 					if err != nil {
 						// Rollback lot creation
 						_ = m.deps.Repo.DeleteInventoryLot(ctx, lotID)
 						c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to adjust stock"})
 						return
 					}
+					m.deps.Repo.CreateStockMovement(ctx, models.StockMovement{
+						ID:               "MV-" + primitive.NewObjectID().Hex(),
+						OrgID:            orgID,
+						BranchID:         ret.BranchID,
+						ProductID:        ri.ProductID,
+						Type:             "RETURN_IN",
+						Quantity:         ri.QtyReceived,
+						PreviousQuantity: level.Quantity - ri.QtyReceived,
+						NewQuantity:      level.Quantity,
+						UnitCost:         item.UnitCost,
+						TotalCost:        item.UnitCost * int64(ri.QtyReceived),
+						ReferenceType:    "RETURN",
+						ReferenceID:      ret.ID,
+						ReferenceNumber:  ret.ReferenceNo,
+						LotID:            lotID,
+						CreatedBy:        u.ID,
+					})
 
 					updatedItems[idx].LotID = lotID
 				}
@@ -634,6 +680,13 @@ func (m *Module) receive(c *gin.Context) {
 		}
 	}
 
+	if ret.ReturnedToSender {
+		if err := m.settleReturnToSender(c, *u, ret); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to release reserved stock"})
+			return
+		}
+	}
+
 	// Update return status
 	patch := bson.M{
 		"status":     models.ReturnStatusReceived,
@@ -650,6 +703,15 @@ func (m *Module) receive(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update return"})
 		return
 	}
+	received := 0
+	for _, it := range updated.Items {
+		received += it.QtyReceived
+	}
+	m.recordOrderEvent(c, *u, updated, orderevents.Change{
+		Type:    models.OrderEventReturnReceived,
+		Message: "Return " + updated.ReferenceNo + " received",
+		Payload: map[string]interface{}{"qtyReceived": received, "returnedToSender": updated.ReturnedToSender},
+	})
 
 	c.JSON(http.StatusOK, gin.H{"data": updated})
 }
@@ -702,14 +764,38 @@ func (m *Module) ship(c *gin.Context) {
 		}
 
 		// Deduct from stock
-		_, err := m.deps.Repo.AdjustStock(ctx, orgID, ret.BranchID, item.ProductID, -item.Quantity)
+		level, err := m.deps.Repo.AdjustStock(ctx, orgID, ret.BranchID, item.ProductID, -item.Quantity)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to deduct stock", "productId": item.ProductID})
 			return
 		}
 
 		// Consume from FIFO lots
-		_, _, _ = m.deps.Repo.ConsumeLotsFIFO(ctx, orgID, ret.BranchID, item.ProductID, item.Quantity)
+		cost := item.UnitCost * int64(item.Quantity)
+		lines, _, err := m.deps.Repo.ConsumeLotsFIFO(ctx, orgID, ret.BranchID, item.ProductID, item.Quantity)
+		if err == nil {
+			consignment.New(m.deps.Repo).ReleaseLines(ctx, orgID, ret.BranchID, lines)
+			cost = 0
+			for _, l := range lines {
+				cost += l.Amount
+			}
+		}
+		m.deps.Repo.CreateStockMovement(ctx, models.StockMovement{
+			ID:               "MV-" + primitive.NewObjectID().Hex(),
+			OrgID:            orgID,
+			BranchID:         ret.BranchID,
+			ProductID:        item.ProductID,
+			Type:             "RETURN_OUT",
+			Quantity:         item.Quantity,
+			PreviousQuantity: level.Quantity + item.Quantity,
+			NewQuantity:      level.Quantity,
+			UnitCost:         cost / int64(item.Quantity),
+			TotalCost:        cost,
+			ReferenceType:    "RETURN",
+			ReferenceID:      ret.ID,
+			ReferenceNumber:  ret.ReferenceNo,
+			CreatedBy:        u.ID,
+		})
 	}
 
 	// Update return with shipping info
@@ -879,3 +965,12 @@ func (m *Module) listByPO(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"data": returns})
 }
+
+// returnTax sums the VAT reversed by returned items at the original document's rates
+func returnTax(original models.TaxSummary, items []models.ReturnItem) models.TaxSummary {
+	lines := make([]tax.LineTax, 0, len(items))
+	for _, it := range items {
+		lines = append(lines, tax.LineTax{Class: it.TaxClass, Tax: it.TaxAmount, Net: it.NetAmount})
+	}
+	return tax.Sum(original.Rate, original.PricesIncludeTax, lines)
+}
@@ -0,0 +1,51 @@
+package returnsmodule
+
+import (
+	"log"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/orderevents"
+	"stockflows/server/internal/services/promotions"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// settleReturnToSender closes out an order whose parcel came back undelivered. The sale's
+// stock was reserved but never committed, so the reservation is released and the order
+// cancelled; units that came back damaged stay on hand until they are written off.
+// Orders cancelled while the parcel was on its way already released their reservation.
+func (m *Module) settleReturnToSender(c *gin.Context, actor models.User, ret models.Return) error {
+	ctx, orgID := c.Request.Context(), ret.OrgID
+	txn, err := m.deps.Repo.GetTransactionByOrg(ctx, orgID, ret.OriginalOrderID)
+	if err != nil {
+		return err
+	}
+	if txn.Status == "CANCELLED" || txn.Status == "REFUNDED" || txn.StockCommitted {
+		return nil
+	}
+	for _, it := range txn.Items {
+		_, _ = m.deps.Repo.ReleaseReservedStock(ctx, orgID, txn.BranchID, it.ID, it.Quantity)
+	}
+	reason := "Returned to sender (" + ret.ReferenceNo + ")"
+	updated, err := m.deps.Repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{
+		"status":                "CANCELLED",
+		"cancellationReason":    reason,
+		"stockCommitInProgress": false,
+	})
+	if err != nil {
+		return err
+	}
+	promotions.New(m.deps.Repo).Release(ctx, orgID, txn.CustomerID, txn.Promotions)
+	src := orderevents.Source{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if _, err := orderevents.New(m.deps.Repo).Record(ctx, actor, updated, orderevents.Change{
+		Type:    models.OrderEventCancelled,
+		Message: "Order cancelled: " + reason,
+		Payload: map[string]interface{}{"reason": reason, "returnId": ret.ID, "returnedToSender": true},
+		Before:  txn,
+		After:   updated,
+	}, src); err != nil {
+		log.Printf("returns: record %s for %s: %v", models.OrderEventCancelled, txn.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package shippingmodule
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/carriers"
+	"stockflows/server/internal/deps"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Module struct {
+	deps deps.Dependencies
+}
+
+func New(deps deps.Dependencies) *Module { return &Module{deps: deps} }
+
+func (m *Module) Name() string { return "shipping" }
+
+func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/carriers")
+	g.Use(auth.RequireUser())
+	g.GET("", m.list)
+	g.POST("/rates", m.rates)
+}
+
+type carrierResponse struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// list returns the carriers shipments can be booked with
+func (m *Module) list(c *gin.Context) {
+	out := make([]carrierResponse, 0)
+	for _, cr := range m.deps.Carriers.List() {
+		out = append(out, carrierResponse{Code: cr.Code(), Name: cr.Name()})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+type ratesRequest struct {
+	Carrier   string           `json:"carrier"` // Empty quotes every carrier
+	Sender    carriers.Address `json:"sender"`
+	Recipient carriers.Address `json:"recipient"`
+	Parcel    carriers.Parcel  `json:"parcel"`
+}
+
+// rates quotes a parcel with one or all carriers. Carriers without a rate API are left
+// out; failures are reported per carrier in meta.
+func (m *Module) rates(c *gin.Context) {
+	var req ratesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	list := m.deps.Carriers.List()
+	if strings.TrimSpace(req.Carrier) != "" {
+		cr, err := m.deps.Carriers.Get(req.Carrier)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown carrier"})
+			return
+		}
+		list = []carriers.Carrier{cr}
+	}
+
+	sr := carriers.ShipmentRequest{Sender: req.Sender, Recipient: req.Recipient, Parcel: req.Parcel}
+	rates := make([]carriers.Rate, 0)
+	failed := gin.H{}
+	for _, cr := range list {
+		r, err := cr.Rates(c.Request.Context(), sr)
+		if errors.Is(err, carriers.ErrUnsupported) {
+			continue
+		}
+		if err != nil {
+			failed[cr.Code()] = err.Error()
+			continue
+		}
+		rates = append(rates, r...)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rates, "meta": gin.H{"errors": failed}})
+}
@@ -0,0 +1,51 @@
+package stockmodule
+
+import (
+	"net/http"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/costing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// decreaseWithinLimit holds stock taken out by an adjustment to the org's write-off approval
+// threshold, so an adjustment cannot post a loss a write-off would need approval for. Org
+// admins adjust freely; anyone else removing more value is refused and pointed to a
+// write-off document, which waits for an org admin. decreases maps product IDs to units
+// removed. It writes the error response and returns false when the adjustment is refused.
+func (m *Module) decreaseWithinLimit(c *gin.Context, u *models.User, orgID, branchID string, decreases map[string]int) bool {
+	if u.Role == models.RolePlatformAdmin || u.Role == models.RoleOrgAdmin {
+		return true
+	}
+	ctx := c.Request.Context()
+	svc := costing.New(m.deps.Repo)
+	var value int64
+	for productID, qty := range decreases {
+		if qty <= 0 {
+			continue
+		}
+		product, err := m.deps.Repo.GetProductByOrg(ctx, orgID, productID)
+		if err != nil {
+			continue
+		}
+		value += svc.EstimateUnitCost(ctx, orgID, branchID, product) * int64(qty)
+	}
+	if value == 0 {
+		return true
+	}
+
+	threshold := models.DefaultWriteOffApprovalThreshold
+	if org, err := m.deps.Repo.GetOrg(ctx, orgID); err == nil {
+		threshold = org.Settings.ApprovalThreshold()
+	}
+	if value <= threshold {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":     "stock removed is worth more than the write-off approval threshold; record it as a write-off for approval",
+		"value":     value,
+		"threshold": threshold,
+	})
+	return false
+}
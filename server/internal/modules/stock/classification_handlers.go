@@ -0,0 +1,207 @@
+package stockmodule
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/analysis"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// ABC / XYZ Classification
+// ============================================================================
+
+// classificationPolicy starts from the org's settings and applies query overrides
+func (m *Module) classificationPolicy(c *gin.Context, orgID string) models.ClassificationPolicy {
+	var p models.ClassificationPolicy
+	if org, err := m.deps.Repo.GetOrg(c.Request.Context(), orgID); err == nil {
+		p = org.Settings.Classification
+	}
+	if v := strings.ToUpper(strings.TrimSpace(c.Query("scope"))); v != "" {
+		p.Scope = v
+	}
+	if v := strings.ToUpper(strings.TrimSpace(c.Query("basis"))); v != "" {
+		p.Basis = v
+	}
+	if v, err := strconv.Atoi(c.Query("windowDays")); err == nil {
+		p.WindowDays = v
+	}
+	return p.WithDefaults()
+}
+
+// previewClassification computes ABC / XYZ classes without storing them
+func (m *Module) previewClassification(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	policy := m.classificationPolicy(c, orgID)
+	classes, err := analysis.New(m.deps.Repo).Classify(c.Request.Context(), orgID, strings.TrimSpace(c.Query("branchId")), policy, time.Now().UTC())
+	if err != nil {
+		if err == analysis.ErrInvalidClassification {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to classify stock"})
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, cls := range classes {
+		counts[cls.Class]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": classes,
+		"meta": gin.H{
+			"total":  len(classes),
+			"counts": counts,
+			"policy": policy,
+		},
+	})
+}
+
+// recomputeClassification classifies and stores the result on the stock levels now,
+// instead of waiting for the scheduled run
+func (m *Module) recomputeClassification(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	now := time.Now().UTC()
+	svc := analysis.New(m.deps.Repo)
+	policy := m.classificationPolicy(c, orgID)
+	classes, err := svc.Classify(c.Request.Context(), orgID, strings.TrimSpace(c.Query("branchId")), policy, now)
+	if err != nil {
+		if err == analysis.ErrInvalidClassification {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to classify stock"})
+		return
+	}
+
+	saved, err := svc.SaveClassification(c.Request.Context(), orgID, classes, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save classification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{"updated": saved, "classifiedAt": now},
+		"meta": gin.H{"policy": policy},
+	})
+}
+
+// cycleCountIntervals are the default days between counts per ABC class
+var cycleCountIntervals = map[string]int{"A": 30, "B": 90, "C": 180}
+
+type cycleCountItem struct {
+	models.StockLevel
+	ProductName  string     `json:"productName"`
+	ProductSku   string     `json:"productSku"`
+	Class        string     `json:"class"`        // ABC class used for the interval (unclassified counts as C)
+	DueAt        *time.Time `json:"dueAt"`        // nil when never counted
+	OverdueDays  int        `json:"overdueDays"`  // Negative when due in the future
+	IntervalDays int        `json:"intervalDays"` // Days between counts for the class
+}
+
+// cycleCountPlan lists stock levels due for counting within ?horizonDays, A items most often.
+// Intervals per class can be overridden with ?aDays, ?bDays and ?cDays.
+func (m *Module) cycleCountPlan(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	intervals := make(map[string]int, len(cycleCountIntervals))
+	for k, v := range cycleCountIntervals {
+		intervals[k] = v
+		if n, err := strconv.Atoi(c.Query(strings.ToLower(k) + "Days")); err == nil && n > 0 {
+			intervals[k] = n
+		}
+	}
+	horizon := 7
+	if n, err := strconv.Atoi(c.Query("horizonDays")); err == nil && n >= 0 {
+		horizon = n
+	}
+	branchID := strings.TrimSpace(c.Query("branchId"))
+	if branchID == "" {
+		branchID = auth.GetBranchIDForRequest(c, u)
+	}
+
+	all, err := m.deps.Repo.ListStockLevelsByOrg(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list stock"})
+		return
+	}
+	products, _ := m.deps.Repo.ListProductsByOrg(c.Request.Context(), orgID)
+	productMap := make(map[string]models.Product)
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+
+	now := time.Now().UTC()
+	cutoff := now.AddDate(0, 0, horizon)
+	plan := make([]cycleCountItem, 0)
+	for _, s := range all {
+		if branchID != "" && s.BranchID != branchID {
+			continue
+		}
+		class := s.ABCClass
+		if class == "" {
+			class = "C"
+		}
+		item := cycleCountItem{
+			StockLevel:   s,
+			ProductName:  productMap[s.ProductID].Name,
+			ProductSku:   productMap[s.ProductID].SKU,
+			Class:        class,
+			IntervalDays: intervals[class],
+		}
+		if !s.LastCountedAt.IsZero() {
+			due := s.LastCountedAt.AddDate(0, 0, intervals[class])
+			if due.After(cutoff) {
+				continue
+			}
+			item.DueAt = &due
+			item.OverdueDays = int(now.Sub(due).Hours() / 24)
+		}
+		plan = append(plan, item)
+	}
+
+	// Never counted first, then by class and how overdue
+	sort.SliceStable(plan, func(i, j int) bool {
+		if (plan[i].DueAt == nil) != (plan[j].DueAt == nil) {
+			return plan[i].DueAt == nil
+		}
+		if plan[i].Class != plan[j].Class {
+			return plan[i].Class < plan[j].Class
+		}
+		return plan[i].OverdueDays > plan[j].OverdueDays
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": plan,
+		"meta": gin.H{
+			"total":       len(plan),
+			"horizonDays": horizon,
+			"intervals":   intervals,
+		},
+	})
+}
@@ -1,6 +1,8 @@
 package stockmodule
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -8,6 +10,10 @@ import (
 
 	"stockflows/server/internal/auth"
 	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/backorders"
+	"stockflows/server/internal/services/costing"
+	"stockflows/server/internal/services/orderevents"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -44,6 +50,8 @@ func (m *Module) listInventoryStockLevels(c *gin.Context) {
 	search := strings.ToLower(strings.TrimSpace(c.Query("search")))
 	lowStockOnly := c.Query("lowStockOnly") == "true"
 	outOfStockOnly := c.Query("outOfStockOnly") == "true"
+	abcClasses := classFilter(c.Query("abcClass"))
+	xyzClasses := classFilter(c.Query("xyzClass"))
 
 	type enrichedStock struct {
 		models.StockLevel
@@ -62,6 +70,12 @@ func (m *Module) listInventoryStockLevels(c *gin.Context) {
 		if productID != "" && s.ProductID != productID {
 			continue
 		}
+		if len(abcClasses) > 0 && !abcClasses[s.ABCClass] {
+			continue
+		}
+		if len(xyzClasses) > 0 && !xyzClasses[s.XYZClass] {
+			continue
+		}
 
 		// Get product info for search matching
 		var productName, productSku string
@@ -112,6 +126,17 @@ func (m *Module) listInventoryStockLevels(c *gin.Context) {
 	})
 }
 
+// classFilter parses a comma separated class list such as "A,B"
+func classFilter(raw string) map[string]bool {
+	out := make(map[string]bool)
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			out[v] = true
+		}
+	}
+	return out
+}
+
 func (m *Module) getInventoryStockLevel(c *gin.Context) {
 	u := auth.CurrentUser(c)
 	orgID := auth.GetOrgIDForRequest(c, u)
@@ -150,11 +175,15 @@ func (m *Module) getLowStock(c *gin.Context) {
 	}
 
 	branchID := c.Query("branchId")
+	abcClasses := classFilter(c.Query("abcClass"))
 	result := make([]models.StockLevel, 0)
 	for _, s := range all {
 		if branchID != "" && s.BranchID != branchID {
 			continue
 		}
+		if len(abcClasses) > 0 && !abcClasses[s.ABCClass] {
+			continue
+		}
 		if s.Quantity > 0 && s.Quantity <= s.MinStock {
 			result = append(result, s)
 		}
@@ -380,6 +409,9 @@ func (m *Module) createAdjustment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type"})
 		return
 	}
+	if delta < 0 && !m.decreaseWithinLimit(c, u, orgID, branchID, map[string]int{req.ProductID: -delta}) {
+		return
+	}
 
 	// Apply adjustment
 	newStock, err := m.deps.Repo.AdjustStock(c.Request.Context(), orgID, branchID, req.ProductID, delta)
@@ -408,6 +440,11 @@ func (m *Module) createAdjustment(c *gin.Context) {
 	}
 	m.deps.Repo.CreateStockMovement(c.Request.Context(), movement)
 
+	// Setting an absolute quantity is a physical count
+	if strings.ToUpper(req.Type) == "SET" {
+		_, _ = m.deps.Repo.PatchStockLevel(c.Request.Context(), orgID, branchID, req.ProductID, bson.M{"lastCountedAt": time.Now().UTC()})
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": movement})
 }
 
@@ -447,6 +484,23 @@ func (m *Module) bulkAdjustment(c *gin.Context) {
 		return
 	}
 
+	// The whole batch counts against the write-off approval threshold
+	decreases := make(map[string]int)
+	for _, item := range req.Items {
+		switch strings.ToUpper(item.Type) {
+		case "REMOVE":
+			decreases[item.ProductID] += item.Quantity
+		case "SET":
+			currentStock, _ := m.deps.Repo.GetStockLevel(c.Request.Context(), orgID, branchID, item.ProductID)
+			if item.Quantity < currentStock.Quantity {
+				decreases[item.ProductID] += currentStock.Quantity - item.Quantity
+			}
+		}
+	}
+	if !m.decreaseWithinLimit(c, u, orgID, branchID, decreases) {
+		return
+	}
+
 	movements := make([]models.StockMovement, 0, len(req.Items))
 	for _, item := range req.Items {
 		currentStock, _ := m.deps.Repo.GetStockLevel(c.Request.Context(), orgID, branchID, item.ProductID)
@@ -490,6 +544,9 @@ func (m *Module) bulkAdjustment(c *gin.Context) {
 			CreatedBy:        u.ID,
 		}
 		m.deps.Repo.CreateStockMovement(c.Request.Context(), movement)
+		if strings.ToUpper(item.Type) == "SET" {
+			_, _ = m.deps.Repo.PatchStockLevel(c.Request.Context(), orgID, branchID, item.ProductID, bson.M{"lastCountedAt": time.Now().UTC()})
+		}
 		movements = append(movements, movement)
 	}
 
@@ -620,7 +677,24 @@ func (m *Module) createLot(c *gin.Context) {
 	}
 
 	// Also adjust stock level
-	m.deps.Repo.AdjustStock(c.Request.Context(), orgID, branchID, req.ProductID, req.Quantity)
+	if newStock, err := m.deps.Repo.AdjustStock(c.Request.Context(), orgID, branchID, req.ProductID, req.Quantity); err == nil {
+		m.deps.Repo.CreateStockMovement(c.Request.Context(), models.StockMovement{
+			ID:               "MV-" + primitive.NewObjectID().Hex(),
+			OrgID:            orgID,
+			BranchID:         branchID,
+			ProductID:        req.ProductID,
+			Type:             "STOCK_IN",
+			Quantity:         req.Quantity,
+			PreviousQuantity: newStock.Quantity - req.Quantity,
+			NewQuantity:      newStock.Quantity,
+			UnitCost:         req.UnitCost,
+			TotalCost:        req.UnitCost * int64(req.Quantity),
+			ReferenceType:    "ADJUSTMENT",
+			LotID:            created.ID,
+			Notes:            req.Notes,
+			CreatedBy:        u.ID,
+		})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"data": created})
 }
@@ -805,10 +879,6 @@ func (m *Module) createTransfer(c *gin.Context) {
 		return
 	}
 
-	// Get next transfer number
-	nextNum, _ := m.deps.Repo.NextCounter(c.Request.Context(), orgID+":transfer")
-	transferNumber := "TRF-" + padNumber(nextNum, 6)
-
 	// Build items with product info
 	items := make([]models.StockTransferItem, 0, len(req.Items))
 	for _, item := range req.Items {
@@ -825,25 +895,33 @@ func (m *Module) createTransfer(c *gin.Context) {
 		})
 	}
 
+	created, err := m.createDraftTransfer(c.Request.Context(), orgID, u.ID, req.FromBranchID, req.ToBranchID, items, req.Notes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create transfer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": created})
+}
+
+// createDraftTransfer numbers and stores a new DRAFT transfer
+func (m *Module) createDraftTransfer(ctx context.Context, orgID, userID, fromBranchID, toBranchID string, items []models.StockTransferItem, notes string) (models.StockTransfer, error) {
+	// Get next transfer number
+	nextNum, _ := m.deps.Repo.NextCounter(ctx, orgID+":transfer")
+	transferNumber := "TRF-" + padNumber(nextNum, 6)
+
 	transfer := models.StockTransfer{
 		ID:             "TRF-" + primitive.NewObjectID().Hex(),
 		OrgID:          orgID,
 		TransferNumber: transferNumber,
-		FromBranchID:   req.FromBranchID,
-		ToBranchID:     req.ToBranchID,
+		FromBranchID:   fromBranchID,
+		ToBranchID:     toBranchID,
 		Status:         "DRAFT",
 		Items:          items,
-		Notes:          req.Notes,
-		CreatedBy:      u.ID,
-	}
-
-	created, err := m.deps.Repo.CreateStockTransfer(c.Request.Context(), transfer)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create transfer"})
-		return
+		Notes:          notes,
+		CreatedBy:      userID,
 	}
-
-	c.JSON(http.StatusOK, gin.H{"data": created})
+	return m.deps.Repo.CreateStockTransfer(ctx, transfer)
 }
 
 func (m *Module) updateTransfer(c *gin.Context) {
@@ -1050,6 +1128,18 @@ func (m *Module) receiveTransfer(c *gin.Context) {
 		return
 	}
 
+	// Fill backordered sales at the destination, oldest order first
+	received := make([]string, 0, len(updatedItems))
+	for _, item := range updatedItems {
+		if item.ReceivedQuantity > 0 {
+			received = append(received, item.ProductID)
+		}
+	}
+	src := orderevents.Source{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if _, err := backorders.New(m.deps.Repo).Allocate(c.Request.Context(), *u, orgID, transfer.ToBranchID, received, "transfer "+transfer.TransferNumber, src); err != nil {
+		log.Printf("stock: allocate backorders for transfer %s: %v", transfer.ID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": updated})
 }
 
@@ -1081,7 +1171,25 @@ func (m *Module) cancelTransfer(c *gin.Context) {
 	// If in-transit, restore stock to source branch
 	if transfer.Status == "IN_TRANSIT" {
 		for _, item := range transfer.Items {
-			m.deps.Repo.AdjustStock(c.Request.Context(), orgID, transfer.FromBranchID, item.ProductID, item.Quantity)
+			newStock, err := m.deps.Repo.AdjustStock(c.Request.Context(), orgID, transfer.FromBranchID, item.ProductID, item.Quantity)
+			if err != nil {
+				continue
+			}
+			m.deps.Repo.CreateStockMovement(c.Request.Context(), models.StockMovement{
+				ID:               "MV-" + primitive.NewObjectID().Hex(),
+				OrgID:            orgID,
+				BranchID:         transfer.FromBranchID,
+				ProductID:        item.ProductID,
+				Type:             "TRANSFER_IN",
+				Quantity:         item.Quantity,
+				PreviousQuantity: newStock.Quantity - item.Quantity,
+				NewQuantity:      newStock.Quantity,
+				ReferenceType:    "TRANSFER",
+				ReferenceID:      transfer.ID,
+				ReferenceNumber:  transfer.TransferNumber,
+				Reason:           "transfer cancelled",
+				CreatedBy:        u.ID,
+			})
 		}
 	}
 
@@ -1121,9 +1229,13 @@ func (m *Module) getSummary(c *gin.Context) {
 	}
 
 	products, _ := m.deps.Repo.ListProductsByOrg(c.Request.Context(), orgID)
-	productMap := make(map[string]models.Product)
-	for _, p := range products {
-		productMap[p.ID] = p
+
+	// Value owned stock per costing method
+	values := make(map[string]int64)
+	if valuation, err := costing.New(m.deps.Repo).Valuation(c.Request.Context(), orgID, products, all); err == nil {
+		for _, line := range valuation {
+			values[repo.StockLevelID(line.BranchID, line.ProductID)] = line.Value
+		}
 	}
 
 	var totalProducts, lowStockCount, outOfStockCount int
@@ -1138,9 +1250,7 @@ func (m *Module) getSummary(c *gin.Context) {
 		} else if s.Quantity <= s.MinStock {
 			lowStockCount++
 		}
-		if p, ok := productMap[s.ProductID]; ok {
-			totalValue += p.Cost * int64(s.Quantity)
-		}
+		totalValue += values[repo.StockLevelID(s.BranchID, s.ProductID)]
 	}
 
 	c.JSON(http.StatusOK, gin.H{
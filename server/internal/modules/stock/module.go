@@ -44,6 +44,7 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 		inv.GET("/movements", m.listMovements)
 		inv.GET("/movements/:id", m.getMovement)
 		inv.GET("/products/:productId/movements", m.getProductMovements)
+		inv.GET("/products/:productId/stock-card", m.getStockCard)
 
 		// Adjustments
 		inv.POST("/adjustments", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.createAdjustment)
@@ -57,6 +58,15 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 		inv.GET("/products/:productId/lots", m.getProductLots)
 		inv.PATCH("/products/:productId/reorder-point", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.setReorderPoint)
 
+		// Reorder recommendations
+		inv.GET("/reorder-recommendations", m.previewReorderRecommendations)
+		inv.POST("/reorder-recommendations/apply", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.applyReorderRecommendations)
+
+		// ABC / XYZ classification and cycle counts
+		inv.GET("/classification", m.previewClassification)
+		inv.POST("/classification/recompute", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.recomputeClassification)
+		inv.GET("/cycle-count-plan", m.cycleCountPlan)
+
 		// Transfers
 		inv.GET("/transfers", m.listTransfers)
 		inv.GET("/transfers/:id", m.getTransfer)
@@ -66,6 +76,10 @@ func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
 		inv.POST("/transfers/:id/receive", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.receiveTransfer)
 		inv.POST("/transfers/:id/cancel", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.cancelTransfer)
 
+		// Rebalancing
+		inv.GET("/rebalancing/suggestions", m.suggestRebalancing)
+		inv.POST("/rebalancing/apply", auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager), m.applyRebalancing)
+
 		// Summary
 		inv.GET("/summary", m.getSummary)
 	}
@@ -103,6 +117,8 @@ func (m *Module) listStockLevels(c *gin.Context) {
 type patchStockRequest struct {
 	BranchID    string `json:"branchId"`
 	MinStock    *int   `json:"minStock"`
+	MaxStock    *int   `json:"maxStock"`
+	ReorderQty  *int   `json:"reorderQty"`
 	BinLocation *string `json:"binLocation"`
 }
 
@@ -134,6 +150,12 @@ func (m *Module) patchStockLevel(c *gin.Context) {
 	if req.MinStock != nil {
 		patch["minStock"] = *req.MinStock
 	}
+	if req.MaxStock != nil {
+		patch["maxStock"] = *req.MaxStock
+	}
+	if req.ReorderQty != nil {
+		patch["reorderQty"] = *req.ReorderQty
+	}
 	if req.BinLocation != nil {
 		patch["binLocation"] = strings.TrimSpace(*req.BinLocation)
 	}
@@ -212,12 +234,41 @@ func (m *Module) adjustStock(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid productId"})
 		return
 	}
+	if delta < 0 && !m.decreaseWithinLimit(c, u, orgID, branchID, map[string]int{req.ProductID: -delta}) {
+		return
+	}
 
 	stock, err := m.deps.Repo.AdjustStock(c.Request.Context(), orgID, branchID, req.ProductID, delta)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to adjust stock"})
 		return
 	}
+	movementType := action
+	if action == "ADJUSTMENT" {
+		movementType = "ADJUSTMENT_IN"
+		if delta < 0 {
+			movementType = "ADJUSTMENT_OUT"
+		}
+	}
+	qty := delta
+	if qty < 0 {
+		qty = -qty
+	}
+	movement := models.StockMovement{
+		ID:               "MV-" + primitive.NewObjectID().Hex(),
+		OrgID:            orgID,
+		BranchID:         branchID,
+		ProductID:        req.ProductID,
+		Type:             movementType,
+		Quantity:         qty,
+		PreviousQuantity: stock.Quantity - delta,
+		NewQuantity:      stock.Quantity,
+		UnitCost:         product.Cost,
+		TotalCost:        product.Cost * int64(qty),
+		ReferenceType:    "ADJUSTMENT",
+		Notes:            strings.TrimSpace(req.Note),
+		CreatedBy:        u.ID,
+	}
 
 	// Create a transaction record.
 	total := int64(0)
@@ -261,6 +312,8 @@ func (m *Module) adjustStock(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record transaction"})
 		return
 	}
+	movement.ReferenceID = createdTxn.ID
+	m.deps.Repo.CreateStockMovement(c.Request.Context(), movement)
 
 	c.JSON(http.StatusOK, gin.H{
 		"stockLevel":  stock,
@@ -0,0 +1,335 @@
+package stockmodule
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/services/audit"
+	"stockflows/server/internal/services/replenishment"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ============================================================================
+// Reorder Recommendations
+// ============================================================================
+
+// policyFromQuery reads optional serviceLevel, windowDays and reviewDays overrides
+func policyFromQuery(c *gin.Context) replenishment.Policy {
+	p := replenishment.DefaultPolicy()
+	if v, err := strconv.ParseFloat(c.Query("serviceLevel"), 64); err == nil {
+		p.ServiceLevel = v
+	}
+	if v, err := strconv.Atoi(c.Query("windowDays")); err == nil {
+		p.WindowDays = v
+	}
+	if v, err := strconv.Atoi(c.Query("reviewDays")); err == nil && v > 0 {
+		p.ReviewDays = v
+	}
+	if v, err := strconv.Atoi(c.Query("defaultLeadTimeDays")); err == nil && v > 0 {
+		p.DefaultLeadTimeDays = v
+	}
+	return p
+}
+
+func isReorderPolicyError(err error) bool {
+	return err == replenishment.ErrInvalidServiceLevel || err == replenishment.ErrInvalidWindow ||
+		err == replenishment.ErrInvalidReviewDays || err == replenishment.ErrInvalidLeadTime
+}
+
+func (m *Module) previewReorderRecommendations(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	branchID := strings.TrimSpace(c.Query("branchId"))
+	policy := policyFromQuery(c)
+
+	recs, err := replenishment.New(m.deps.Repo).Recommend(c.Request.Context(), orgID, branchID, policy)
+	if err != nil {
+		if isReorderPolicyError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute recommendations"})
+		return
+	}
+
+	if c.Query("changedOnly") == "true" {
+		filtered := make([]replenishment.Recommendation, 0, len(recs))
+		for _, r := range recs {
+			if r.Changed {
+				filtered = append(filtered, r)
+			}
+		}
+		recs = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": recs,
+		"meta": gin.H{
+			"total":  len(recs),
+			"policy": policy,
+		},
+	})
+}
+
+type applyReorderRequest struct {
+	BranchID            string   `json:"branchId"`
+	ProductIDs          []string `json:"productIds"` // Empty applies every changed recommendation
+	ServiceLevel        float64  `json:"serviceLevel"`
+	WindowDays          int      `json:"windowDays"`
+	ReviewDays          int      `json:"reviewDays"`
+	DefaultLeadTimeDays int      `json:"defaultLeadTimeDays"`
+}
+
+func (m *Module) applyReorderRecommendations(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req applyReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	branchID := strings.TrimSpace(req.BranchID)
+	if branchID == "" {
+		branchID = auth.GetBranchIDForRequest(c, u)
+	}
+	if branchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branchId required"})
+		return
+	}
+
+	policy := replenishment.DefaultPolicy()
+	if req.ServiceLevel > 0 {
+		policy.ServiceLevel = req.ServiceLevel
+	}
+	if req.WindowDays > 0 {
+		policy.WindowDays = req.WindowDays
+	}
+	if req.ReviewDays > 0 {
+		policy.ReviewDays = req.ReviewDays
+	}
+	if req.DefaultLeadTimeDays > 0 {
+		policy.DefaultLeadTimeDays = req.DefaultLeadTimeDays
+	}
+
+	// Recompute server-side so clients cannot write arbitrary values through this endpoint.
+	recs, err := replenishment.New(m.deps.Repo).Recommend(c.Request.Context(), orgID, branchID, policy)
+	if err != nil {
+		if isReorderPolicyError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute recommendations"})
+		return
+	}
+
+	selected := make(map[string]bool, len(req.ProductIDs))
+	for _, id := range req.ProductIDs {
+		selected[strings.TrimSpace(id)] = true
+	}
+
+	auditSvc := audit.New(m.deps.Repo)
+	reason := fmt.Sprintf("reorder recommendation (service level %.1f%%, %d-day window)", policy.ServiceLevel*100, policy.WindowDays)
+
+	applied := make([]models.StockLevel, 0)
+	failed := make([]string, 0)
+	for _, rec := range recs {
+		if !rec.Changed {
+			continue
+		}
+		if len(selected) > 0 && !selected[rec.ProductID] {
+			continue
+		}
+
+		before, err := m.deps.Repo.GetStockLevel(c.Request.Context(), orgID, rec.BranchID, rec.ProductID)
+		if err != nil {
+			log.Printf("stock: reorder recommendation for %s: %v", rec.ProductID, err)
+			failed = append(failed, rec.ProductID)
+			continue
+		}
+		after, err := m.deps.Repo.PatchStockLevel(c.Request.Context(), orgID, rec.BranchID, rec.ProductID, bson.M{
+			"minStock":    rec.MinStock,
+			"safetyStock": rec.SafetyStock,
+			"reorderQty":  rec.ReorderQty,
+		})
+		if err != nil {
+			log.Printf("stock: reorder recommendation for %s: %v", rec.ProductID, err)
+			failed = append(failed, rec.ProductID)
+			continue
+		}
+		if err := auditSvc.RecordWithContext(c.Request.Context(), *u, "StockLevel", after.ID, models.AuditActionUpdate,
+			before, after, c.ClientIP(), c.Request.UserAgent(), reason); err != nil {
+			log.Printf("stock: audit reorder recommendation for %s: %v", rec.ProductID, err)
+		}
+		applied = append(applied, after)
+	}
+
+	status := http.StatusOK
+	if len(failed) > 0 && len(applied) == 0 {
+		status = http.StatusInternalServerError
+	}
+	c.JSON(status, gin.H{
+		"data": applied,
+		"meta": gin.H{
+			"applied": len(applied),
+			"failed":  failed,
+			"policy":  policy,
+		},
+	})
+}
+
+// ============================================================================
+// Branch Rebalancing
+// ============================================================================
+
+func (m *Module) suggestRebalancing(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	policy := replenishment.DefaultRebalancePolicy()
+	if v, err := strconv.Atoi(c.Query("windowDays")); err == nil {
+		policy.WindowDays = v
+	}
+	if v, err := strconv.Atoi(c.Query("coverDays")); err == nil && v >= 0 {
+		policy.CoverDays = v
+	}
+	if v, err := strconv.Atoi(c.Query("minMoveQty")); err == nil {
+		policy.MinMoveQty = v
+	}
+
+	suggestions, err := replenishment.New(m.deps.Repo).SuggestTransfers(c.Request.Context(), orgID, strings.TrimSpace(c.Query("productId")), policy)
+	if err != nil {
+		if err == replenishment.ErrInvalidWindow {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute rebalancing suggestions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": suggestions,
+		"meta": gin.H{
+			"total":  len(suggestions),
+			"policy": policy,
+		},
+	})
+}
+
+type applyRebalancingRequest struct {
+	Suggestions []struct {
+		ProductID    string `json:"productId"`
+		FromBranchID string `json:"fromBranchId"`
+		ToBranchID   string `json:"toBranchId"`
+		Quantity     int    `json:"quantity"`
+	} `json:"suggestions"`
+	Notes string `json:"notes"`
+}
+
+// applyRebalancing turns selected suggestions into DRAFT transfers, one per branch pair
+func (m *Module) applyRebalancing(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req applyRebalancingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	if len(req.Suggestions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "suggestions required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	branches := make(map[string]bool)
+	type route struct{ from, to string }
+	grouped := make(map[route][]models.StockTransferItem)
+	order := make([]route, 0)
+	requested := make(map[string]int)
+
+	for _, s := range req.Suggestions {
+		if s.ProductID == "" || s.FromBranchID == "" || s.ToBranchID == "" || s.FromBranchID == s.ToBranchID || s.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid suggestion", "productId": s.ProductID})
+			return
+		}
+		for _, branchID := range []string{s.FromBranchID, s.ToBranchID} {
+			if branches[branchID] {
+				continue
+			}
+			if _, err := m.deps.Repo.GetBranchByOrg(ctx, orgID, branchID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branchId", "branchId": branchID})
+				return
+			}
+			branches[branchID] = true
+		}
+		product, err := m.deps.Repo.GetProductByOrg(ctx, orgID, s.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid productId", "productId": s.ProductID})
+			return
+		}
+		// Several suggestions may draw the same product from one branch.
+		requested[s.FromBranchID+":"+s.ProductID] += s.Quantity
+		source, err := m.deps.Repo.GetStockLevel(ctx, orgID, s.FromBranchID, s.ProductID)
+		if err != nil || source.Quantity-source.Reserved < requested[s.FromBranchID+":"+s.ProductID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient stock at source branch", "productId": s.ProductID})
+			return
+		}
+
+		key := route{from: s.FromBranchID, to: s.ToBranchID}
+		if _, ok := grouped[key]; !ok {
+			order = append(order, key)
+		}
+		grouped[key] = append(grouped[key], models.StockTransferItem{
+			ProductID:   product.ID,
+			ProductName: product.Name,
+			ProductSKU:  product.SKU,
+			Quantity:    s.Quantity,
+		})
+	}
+
+	notes := strings.TrimSpace(req.Notes)
+	if notes == "" {
+		notes = "Generated from rebalancing suggestions"
+	}
+
+	created := make([]models.StockTransfer, 0, len(order))
+	for _, key := range order {
+		transfer, err := m.createDraftTransfer(ctx, orgID, u.ID, key.from, key.to, grouped[key], notes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create transfer"})
+			return
+		}
+		created = append(created, transfer)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": created,
+		"meta": gin.H{"created": len(created)},
+	})
+}
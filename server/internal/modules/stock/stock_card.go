@@ -0,0 +1,341 @@
+package stockmodule
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/models"
+	"stockflows/server/platform/pdf"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Stock Card (Kardex)
+// ============================================================================
+
+// stockCardSource links a stock card line to the document that caused it
+type stockCardSource struct {
+	Type   string `json:"type"` // ORDER, PURCHASE_ORDER, TRANSFER, WRITE_OFF, CONSIGNMENT, RETURN, ADJUSTMENT
+	ID     string `json:"id,omitempty"`
+	Number string `json:"number,omitempty"`
+	Path   string `json:"path,omitempty"` // API path of the source document
+}
+
+type stockCardLine struct {
+	Date       time.Time       `json:"date"`
+	MovementID string          `json:"movementId"`
+	Type       string          `json:"type"`
+	In         int             `json:"in"`
+	Out        int             `json:"out"`
+	UnitCost   int64           `json:"unitCost"` // Cost per unit moved
+	Value      int64           `json:"value"`    // Signed value moved
+	Balance    int             `json:"balance"`
+	BalanceVal int64           `json:"balanceValue"`
+	AvgCost    int64           `json:"averageCost"` // Balance value / balance quantity
+	Source     stockCardSource `json:"source"`
+	LotID      string          `json:"lotId,omitempty"`
+	Reason     string          `json:"reason,omitempty"`
+}
+
+// movementDirection returns +1 for stock coming in and -1 for stock going out.
+// Older movements carry a signed quantity instead of a directional type.
+func movementDirection(mv models.StockMovement) int {
+	if mv.Quantity < 0 {
+		return -1
+	}
+	switch strings.ToUpper(mv.Type) {
+	case "SALE", "SALE_OUT", "STOCK_OUT", "TRANSFER_OUT", "ADJUSTMENT_OUT", "WRITE_OFF", "RETURN_OUT":
+		return -1
+	}
+	return 1
+}
+
+func movementSource(mv models.StockMovement) stockCardSource {
+	s := stockCardSource{Type: mv.ReferenceType, ID: mv.ReferenceID, Number: mv.ReferenceNumber}
+	switch mv.ReferenceType {
+	case "ORDER":
+		s.Path = "/orders/" + mv.ReferenceID
+	case "PURCHASE_ORDER":
+		s.Path = "/purchase-orders/" + mv.ReferenceID
+	case "TRANSFER":
+		s.Path = "/inventory/transfers/" + mv.ReferenceID
+	case "WRITE_OFF":
+		s.Path = "/write-offs/" + mv.ReferenceID
+	case "CONSIGNMENT":
+		s.Path = "/suppliers/" + mv.ReferenceID
+	case "RETURN":
+		s.Path = "/returns/" + mv.ReferenceID
+	default:
+		if s.Type == "" {
+			s.Type = "ADJUSTMENT"
+		}
+		s.Path = "/inventory/movements/" + mv.ID
+	}
+	return s
+}
+
+// stockCardBalance is the running quantity and value of a stock card
+type stockCardBalance struct {
+	Quantity int   `json:"quantity"`
+	Value    int64 `json:"value"`
+}
+
+// apply moves the balance by one movement and returns its line. Movements without a
+// recorded cost are valued at the running average, falling back to fallbackCost.
+func (b *stockCardBalance) apply(mv models.StockMovement, fallbackCost int64) stockCardLine {
+	qty := mv.Quantity
+	if qty < 0 {
+		qty = -qty
+	}
+	avg := fallbackCost
+	if b.Quantity > 0 {
+		avg = b.Value / int64(b.Quantity)
+	}
+
+	line := stockCardLine{
+		Date:       mv.CreatedAt,
+		MovementID: mv.ID,
+		Type:       mv.Type,
+		Source:     movementSource(mv),
+		LotID:      mv.LotID,
+		Reason:     mv.Reason,
+	}
+
+	cost := mv.TotalCost
+	if cost <= 0 && mv.UnitCost > 0 {
+		cost = mv.UnitCost * int64(qty)
+	}
+	if movementDirection(mv) > 0 {
+		if cost <= 0 {
+			cost = avg * int64(qty)
+		}
+		line.In = qty
+		b.Quantity += qty
+		b.Value += cost
+		line.Value = cost
+	} else {
+		if cost <= 0 {
+			cost = avg * int64(qty)
+		}
+		line.Out = qty
+		b.Quantity -= qty
+		if b.Quantity == 0 {
+			// The last unit out takes whatever value is left so rounding does not linger
+			cost = b.Value
+		}
+		b.Value -= cost
+		line.Value = -cost
+	}
+	if qty > 0 {
+		line.UnitCost = cost / int64(qty)
+	}
+
+	line.Balance = b.Quantity
+	line.BalanceVal = b.Value
+	if b.Quantity > 0 {
+		line.AvgCost = b.Value / int64(b.Quantity)
+	}
+	return line
+}
+
+// getStockCard lists every in/out movement of a product at a branch with running quantity
+// and value. ?from and ?to (YYYY-MM-DD) limit the lines; earlier movements form the
+// opening balance. ?format=csv or ?format=pdf exports the card.
+func (m *Module) getStockCard(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	productID := c.Param("productId")
+	branchID := strings.TrimSpace(c.Query("branchId"))
+	if branchID == "" {
+		branchID = auth.GetBranchIDForRequest(c, u)
+	}
+	if branchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branchId required"})
+		return
+	}
+
+	var from, until time.Time
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+		until = t.AddDate(0, 0, 1)
+	}
+
+	ctx := c.Request.Context()
+	product, err := m.deps.Repo.GetProductByOrg(ctx, orgID, productID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	branch, err := m.deps.Repo.GetBranchByOrg(ctx, orgID, branchID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "branch not found"})
+		return
+	}
+
+	movements, err := m.deps.Repo.ListStockCardMovements(ctx, orgID, branchID, productID, until)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list movements"})
+		return
+	}
+
+	var balance stockCardBalance
+	var opening stockCardBalance
+	lines := make([]stockCardLine, 0, len(movements))
+	var totalIn, totalOut int
+	for _, mv := range movements {
+		line := balance.apply(mv, product.Cost)
+		if !from.IsZero() && mv.CreatedAt.Before(from) {
+			opening = balance
+			continue
+		}
+		totalIn += line.In
+		totalOut += line.Out
+		lines = append(lines, line)
+	}
+
+	// The card should end where the stock level is; a gap means stock moved without a movement.
+	var onHand *int
+	if level, err := m.deps.Repo.GetStockLevel(ctx, orgID, branchID, productID); err == nil {
+		onHand = &level.Quantity
+	}
+	reconciled := true
+	if onHand != nil && until.IsZero() {
+		reconciled = *onHand == balance.Quantity
+	}
+
+	title := fmt.Sprintf("Stock card - %s (%s)", product.Name, product.SKU)
+	period := "All movements"
+	if !from.IsZero() || !until.IsZero() {
+		period = "Period: " + c.DefaultQuery("from", "beginning") + " to " + c.DefaultQuery("to", "today")
+	}
+
+	switch c.Query("format") {
+	case "csv":
+		writeStockCardCSV(c, product, opening, lines)
+		return
+	case "pdf":
+		doc := pdf.New(pdf.A4Landscape)
+		doc.AddPage()
+		doc.Heading(title, 14)
+		doc.Paragraph("Branch: "+branch.Name+"    "+period, 9)
+		doc.Paragraph(fmt.Sprintf("Opening balance: %d units, %s    Closing balance: %d units, %s",
+			opening.Quantity, satang(opening.Value), balance.Quantity, satang(balance.Value)), 9)
+		doc.Space(6)
+		doc.Table([]pdf.Column{
+			{Header: "Date", Width: 90},
+			{Header: "Type", Width: 85},
+			{Header: "Source", Width: 150},
+			{Header: "In", Width: 45, Right: true},
+			{Header: "Out", Width: 45, Right: true},
+			{Header: "Unit cost", Width: 65, Right: true},
+			{Header: "Value", Width: 75, Right: true},
+			{Header: "Balance", Width: 55, Right: true},
+			{Header: "Balance value", Width: 85, Right: true},
+			{Header: "Avg cost", Width: 70, Right: true},
+		}, stockCardRecords(lines, false), 8)
+		doc.Space(6)
+		doc.Paragraph(fmt.Sprintf("Total in: %d    Total out: %d    Generated %s", totalIn, totalOut, time.Now().UTC().Format("2006-01-02 15:04 UTC")), 8)
+
+		c.Header("Content-Disposition", "attachment; filename=stock-card-"+product.SKU+".pdf")
+		c.Data(http.StatusOK, "application/pdf", doc.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": lines,
+		"meta": gin.H{
+			"productId":   product.ID,
+			"productName": product.Name,
+			"productSku":  product.SKU,
+			"branchId":    branch.ID,
+			"branchName":  branch.Name,
+			"opening":     opening,
+			"closing":     balance,
+			"totalIn":     totalIn,
+			"totalOut":    totalOut,
+			"onHand":      onHand,
+			"reconciled":  reconciled,
+		},
+	})
+}
+
+// stockCardRecords formats lines for export; CSV keeps full identifiers and plain numbers
+func stockCardRecords(lines []stockCardLine, forCSV bool) [][]string {
+	out := make([][]string, 0, len(lines))
+	for _, l := range lines {
+		source := l.Source.Type
+		if l.Source.Number != "" {
+			source += " " + l.Source.Number
+		}
+		in, outQty := "", ""
+		if l.In > 0 {
+			in = strconv.Itoa(l.In)
+		}
+		if l.Out > 0 {
+			outQty = strconv.Itoa(l.Out)
+		}
+		date := l.Date.Format("2006-01-02 15:04")
+		if forCSV {
+			date = l.Date.Format(time.RFC3339)
+			out = append(out, []string{
+				date, l.Type, l.Source.Type, l.Source.ID, l.Source.Number, in, outQty,
+				satang(l.UnitCost), satang(l.Value), strconv.Itoa(l.Balance), satang(l.BalanceVal), satang(l.AvgCost),
+				l.LotID, l.MovementID,
+			})
+			continue
+		}
+		out = append(out, []string{
+			date, l.Type, source, in, outQty,
+			satang(l.UnitCost), satang(l.Value), strconv.Itoa(l.Balance), satang(l.BalanceVal), satang(l.AvgCost),
+		})
+	}
+	return out
+}
+
+func writeStockCardCSV(c *gin.Context, product models.Product, opening stockCardBalance, lines []stockCardLine) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename=stock-card-"+product.SKU+".csv")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{
+		"date", "type", "source type", "source id", "source number", "in", "out",
+		"unit cost", "value", "balance", "balance value", "average cost", "lot", "movement",
+	})
+	_ = w.Write([]string{"", "OPENING", "", "", "", "", "", "", "", strconv.Itoa(opening.Quantity), satang(opening.Value), "", "", ""})
+	_ = w.WriteAll(stockCardRecords(lines, true))
+	w.Flush()
+}
+
+// satang formats an amount in satang as baht with two decimals
+func satang(v int64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
@@ -96,12 +96,13 @@ func (m *Module) get(c *gin.Context) {
 }
 
 type createSupplierRequest struct {
-	Name        string `json:"name"`
-	ContactName string `json:"contactName"`
-	Phone       string `json:"phone"`
-	Email       string `json:"email"`
-	Address     string `json:"address"`
-	TaxID       string `json:"taxId"`
+	Name         string `json:"name"`
+	ContactName  string `json:"contactName"`
+	Phone        string `json:"phone"`
+	Email        string `json:"email"`
+	Address      string `json:"address"`
+	TaxID        string `json:"taxId"`
+	LeadTimeDays int    `json:"leadTimeDays"`
 }
 
 func (m *Module) create(c *gin.Context) {
@@ -127,16 +128,21 @@ func (m *Module) create(c *gin.Context) {
 	if req.ContactName == "" {
 		req.ContactName = "-"
 	}
+	if req.LeadTimeDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "leadTimeDays must be >= 0"})
+		return
+	}
 
 	supplier := models.Supplier{
-		ID:          primitive.NewObjectID().Hex(),
-		OrgID:       orgID,
-		Name:        req.Name,
-		ContactName: req.ContactName,
-		Phone:       req.Phone,
-		Email:       strings.TrimSpace(req.Email),
-		Address:     strings.TrimSpace(req.Address),
-		TaxID:       strings.TrimSpace(req.TaxID),
+		ID:           primitive.NewObjectID().Hex(),
+		OrgID:        orgID,
+		Name:         req.Name,
+		ContactName:  req.ContactName,
+		Phone:        req.Phone,
+		Email:        strings.TrimSpace(req.Email),
+		Address:      strings.TrimSpace(req.Address),
+		TaxID:        strings.TrimSpace(req.TaxID),
+		LeadTimeDays: req.LeadTimeDays,
 	}
 
 	created, err := m.deps.Repo.CreateSupplier(c.Request.Context(), supplier)
@@ -148,12 +154,13 @@ func (m *Module) create(c *gin.Context) {
 }
 
 type updateSupplierRequest struct {
-	Name        *string `json:"name"`
-	ContactName *string `json:"contactName"`
-	Phone       *string `json:"phone"`
-	Email       *string `json:"email"`
-	Address     *string `json:"address"`
-	TaxID       *string `json:"taxId"`
+	Name         *string `json:"name"`
+	ContactName  *string `json:"contactName"`
+	Phone        *string `json:"phone"`
+	Email        *string `json:"email"`
+	Address      *string `json:"address"`
+	TaxID        *string `json:"taxId"`
+	LeadTimeDays *int    `json:"leadTimeDays"`
 }
 
 func (m *Module) update(c *gin.Context) {
@@ -190,6 +197,13 @@ func (m *Module) update(c *gin.Context) {
 	if req.TaxID != nil {
 		patch["taxId"] = strings.TrimSpace(*req.TaxID)
 	}
+	if req.LeadTimeDays != nil {
+		if *req.LeadTimeDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "leadTimeDays must be >= 0"})
+			return
+		}
+		patch["leadTimeDays"] = *req.LeadTimeDays
+	}
 
 	if len(patch) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes"})
@@ -0,0 +1,367 @@
+package webhooksmodule
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/deps"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/audit"
+	"stockflows/server/internal/services/orderevents"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxEvents caps one page of the event feed
+const maxEvents = 500
+
+type Module struct {
+	deps deps.Dependencies
+}
+
+func New(deps deps.Dependencies) *Module { return &Module{deps: deps} }
+
+func (m *Module) Name() string { return "webhooks" }
+
+func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/webhooks")
+	g.Use(auth.RequireUser(), auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin))
+
+	g.GET("", m.list)
+	g.POST("", m.create)
+	g.GET("/events", m.events)
+	g.PATCH("/:id", m.update)
+	g.DELETE("/:id", m.delete)
+	g.GET("/:id/deliveries", m.deliveries)
+	g.POST("/:id/test", m.test)
+	g.POST("/:id/rotate-secret", m.rotateSecret)
+}
+
+// newSecret returns a signing secret for a subscription
+func newSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// eventTypes normalizes and checks the event types a subscription asks for
+func eventTypes(in []string) ([]models.OrderEventType, bool) {
+	out := make([]models.OrderEventType, 0, len(in))
+	for _, v := range in {
+		t := models.OrderEventType(strings.ToUpper(strings.TrimSpace(v)))
+		if t == "" {
+			continue
+		}
+		known := false
+		for _, k := range models.OrderEventTypes {
+			if k == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, false
+		}
+		out = append(out, t)
+	}
+	return out, true
+}
+
+// redact hides the signing secret, which is only shown when it is made
+func redact(w models.WebhookSubscription) models.WebhookSubscription {
+	w.Secret = ""
+	return w
+}
+
+func (m *Module) list(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	subs, err := m.deps.Repo.ListWebhooksByOrg(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhooks"})
+		return
+	}
+	for i := range subs {
+		subs[i] = redact(subs[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"data": subs, "meta": gin.H{"total": len(subs), "eventTypes": models.OrderEventTypes}})
+}
+
+type webhookRequest struct {
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+	Events      []string `json:"events"` // Empty for every event
+	Active      *bool    `json:"active"`
+}
+
+func (m *Module) create(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.URL == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+	w := models.WebhookSubscription{
+		ID:        "WHK-" + primitive.NewObjectID().Hex(),
+		OrgID:     orgID,
+		URL:       strings.TrimSpace(*req.URL),
+		Secret:    newSecret(),
+		Active:    req.Active == nil || *req.Active,
+		CreatedBy: u.ID,
+	}
+	if err := orderevents.CheckEndpoint(c.Request.Context(), w.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Description != nil {
+		w.Description = strings.TrimSpace(*req.Description)
+	}
+	var ok bool
+	if w.Events, ok = eventTypes(req.Events); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event type"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	created, err := m.deps.Repo.CreateWebhook(ctx, w)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create webhook"})
+		return
+	}
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Webhook", created.ID, models.AuditActionCreate,
+		nil, redact(created), c.ClientIP(), c.Request.UserAgent(), "")
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+func (m *Module) update(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	before, err := m.deps.Repo.GetWebhookByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+
+	patch := bson.M{}
+	if req.URL != nil {
+		v := strings.TrimSpace(*req.URL)
+		if err := orderevents.CheckEndpoint(ctx, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		patch["url"] = v
+	}
+	if req.Description != nil {
+		patch["description"] = strings.TrimSpace(*req.Description)
+	}
+	if req.Events != nil {
+		events, ok := eventTypes(req.Events)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event type"})
+			return
+		}
+		patch["events"] = events
+	}
+	if req.Active != nil {
+		patch["active"] = *req.Active
+		if *req.Active {
+			patch["failures"] = 0
+		}
+	}
+
+	updated, err := m.deps.Repo.UpdateWebhookByOrg(ctx, orgID, before.ID, patch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update webhook"})
+		return
+	}
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Webhook", updated.ID, models.AuditActionUpdate,
+		redact(before), redact(updated), c.ClientIP(), c.Request.UserAgent(), "")
+	c.JSON(http.StatusOK, gin.H{"data": redact(updated)})
+}
+
+func (m *Module) delete(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	before, err := m.deps.Repo.GetWebhookByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	if err := m.deps.Repo.DeleteWebhookByOrg(ctx, orgID, before.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete webhook"})
+		return
+	}
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Webhook", before.ID, models.AuditActionDelete,
+		redact(before), nil, c.ClientIP(), c.Request.UserAgent(), "")
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"deleted": true}})
+}
+
+// deliveries lists a subscription's recent deliveries with their attempts and outcome
+func (m *Module) deliveries(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	w, err := m.deps.Repo.GetWebhookByOrg(ctx, orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	limit := int64(100)
+	if v, err := strconv.ParseInt(c.Query("limit"), 10, 64); err == nil && v > 0 {
+		limit = v
+	}
+	if limit > maxEvents {
+		limit = maxEvents
+	}
+	list, err := m.deps.Repo.ListWebhookDeliveriesByWebhook(ctx, orgID, w.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list deliveries"})
+		return
+	}
+	if list == nil {
+		list = []models.WebhookDelivery{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "meta": gin.H{"total": len(list)}})
+}
+
+// test sends a PING event to the endpoint and reports what it answered
+func (m *Module) test(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	w, err := m.deps.Repo.GetWebhookByOrg(c.Request.Context(), orgID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	status, err := orderevents.New(m.deps.Repo).Ping(c.Request.Context(), w)
+	res := gin.H{"delivered": err == nil, "status": status}
+	if err != nil {
+		res["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, gin.H{"data": res})
+}
+
+func (m *Module) rotateSecret(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	updated, err := m.deps.Repo.UpdateWebhookByOrg(ctx, orgID, c.Param("id"), bson.M{"secret": newSecret()})
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rotate secret"})
+		return
+	}
+	_ = audit.New(m.deps.Repo).RecordWithContext(ctx, *u, "Webhook", updated.ID, models.AuditActionUpdate,
+		nil, nil, c.ClientIP(), c.Request.UserAgent(), "Signing secret rotated")
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+// events is the feed integrations read to catch up on deliveries they missed.
+// ?since=RFC3339 (exclusive), ?types=SHIPPED,DELIVERED, ?limit (max 500).
+func (m *Module) events(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -1)
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be RFC3339"})
+			return
+		}
+		since = t
+	}
+	var types []models.OrderEventType
+	if v := c.Query("types"); v != "" {
+		var ok bool
+		if types, ok = eventTypes(strings.Split(v, ",")); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event type"})
+			return
+		}
+	}
+	limit := int64(100)
+	if v, err := strconv.ParseInt(c.Query("limit"), 10, 64); err == nil && v > 0 {
+		limit = v
+	}
+	if limit > maxEvents {
+		limit = maxEvents
+	}
+
+	events, err := m.deps.Repo.ListOrderEventsByOrg(c.Request.Context(), orgID, since, types, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list events"})
+		return
+	}
+	meta := gin.H{"hasMore": int64(len(events)) == limit}
+	if len(events) > 0 {
+		meta["next"] = events[len(events)-1].CreatedAt.Format(time.RFC3339Nano)
+	}
+	// Staff-only notes are never sent out, here or to webhooks
+	public := make([]models.OrderEvent, 0, len(events))
+	for _, ev := range events {
+		if !orderevents.Internal(ev) {
+			public = append(public, ev)
+		}
+	}
+	meta["total"] = len(public)
+	c.JSON(http.StatusOK, gin.H{"data": public, "meta": meta})
+}
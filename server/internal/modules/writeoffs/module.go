@@ -0,0 +1,452 @@
+package writeoffsmodule
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/auth"
+	"stockflows/server/internal/deps"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Module struct {
+	deps deps.Dependencies
+}
+
+func New(deps deps.Dependencies) *Module { return &Module{deps: deps} }
+
+func (m *Module) Name() string { return "write_offs" }
+
+func (m *Module) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/write-offs")
+	g.Use(auth.RequireUser(), auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin, models.RoleBranchManager))
+
+	g.GET("", m.list)
+	g.GET("/reasons", m.reasons)
+	g.GET("/:id", m.get)
+	g.POST("", m.create)
+	g.POST("/:id/cancel", m.cancel)
+
+	// Approval of write-offs above the org threshold is reserved for org admins
+	approver := auth.RequireRoles(models.RolePlatformAdmin, models.RoleOrgAdmin)
+	g.POST("/:id/approve", approver, m.approve)
+	g.POST("/:id/reject", approver, m.reject)
+}
+
+var validReasons = map[models.WriteOffReason]bool{
+	models.WriteOffReasonDamaged: true,
+	models.WriteOffReasonExpired: true,
+	models.WriteOffReasonTheft:   true,
+	models.WriteOffReasonSample:  true,
+}
+
+func (m *Module) reasons(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": []models.WriteOffReason{
+		models.WriteOffReasonDamaged,
+		models.WriteOffReasonExpired,
+		models.WriteOffReasonTheft,
+		models.WriteOffReasonSample,
+	}})
+}
+
+func (m *Module) list(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	filter := bson.M{}
+	if s := c.Query("status"); s != "" {
+		filter["status"] = strings.ToUpper(s)
+	}
+	if branchID := c.Query("branchId"); branchID != "" {
+		filter["branchId"] = branchID
+	}
+	if reason := c.Query("reason"); reason != "" {
+		filter["items.reason"] = strings.ToUpper(reason)
+	}
+
+	writeOffs, total, err := m.deps.Repo.ListWriteOffsByOrg(c.Request.Context(), orgID, filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list write-offs"})
+		return
+	}
+
+	if limit < 1 {
+		limit = 20
+	}
+	totalPages := int(total) / limit
+	if int(total)%limit > 0 {
+		totalPages++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": writeOffs,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"totalPages": totalPages,
+		},
+	})
+}
+
+func (m *Module) get(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	w, err := m.deps.Repo.GetWriteOffByOrg(c.Request.Context(), orgID, c.Param("id"))
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "write-off not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get write-off"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": w})
+}
+
+type createItemRequest struct {
+	ProductID string `json:"productId"`
+	LotID     string `json:"lotId"`
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+	Notes     string `json:"notes"`
+}
+
+type createRequest struct {
+	BranchID string              `json:"branchId"`
+	Items    []createItemRequest `json:"items"`
+	Photos   []string            `json:"photos"` // Keys returned by POST /uploads
+	Notes    string              `json:"notes"`
+}
+
+// approvalWindow is how far back write-offs posted without approval count towards the
+// threshold, so a large write-off cannot be split into documents that each stay under it
+const approvalWindow = 24 * time.Hour
+
+// needsApproval reports whether a write-off of estimated value is over the threshold on
+// its own, or for any product together with that product's write-offs posted without
+// approval within approvalWindow
+func (m *Module) needsApproval(ctx context.Context, orgID string, items []models.WriteOffItem, estimated, threshold int64) (bool, error) {
+	if estimated > threshold {
+		return true, nil
+	}
+
+	byProduct := make(map[string]int64, len(items))
+	ids := make(bson.A, 0, len(items))
+	for _, it := range items {
+		if _, ok := byProduct[it.ProductID]; !ok {
+			ids = append(ids, it.ProductID)
+		}
+		byProduct[it.ProductID] += it.EstimatedCost
+	}
+	recent, _, err := m.deps.Repo.ListWriteOffsByOrg(ctx, orgID, bson.M{
+		"status":          models.WriteOffStatusPosted,
+		"requireApproval": false,
+		"postedAt":        bson.M{"$gte": time.Now().UTC().Add(-approvalWindow)},
+		"items.productId": bson.M{"$in": ids},
+	}, 1, 1000000)
+	if err != nil {
+		return false, err
+	}
+	for _, w := range recent {
+		for _, it := range w.Items {
+			if _, ok := byProduct[it.ProductID]; !ok {
+				continue
+			}
+			// Posted lines carry their actual cost
+			cost := it.TotalCost
+			if cost == 0 {
+				cost = it.EstimatedCost
+			}
+			byProduct[it.ProductID] += cost
+		}
+	}
+	for _, v := range byProduct {
+		if v > threshold {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// create records a write-off. Documents within the org's approval threshold are posted
+// immediately; larger ones, and those that take a product's recent unapproved write-offs
+// over it, wait for an org admin.
+func (m *Module) create(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req createRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		return
+	}
+	branchID := strings.TrimSpace(req.BranchID)
+	if branchID == "" {
+		branchID = auth.GetBranchIDForRequest(c, u)
+	}
+	if branchID == "" || len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branchId and items are required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := m.deps.Repo.GetBranchByOrg(ctx, orgID, branchID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branchId"})
+		return
+	}
+
+	items := make([]models.WriteOffItem, 0, len(req.Items))
+	var estimated int64
+	for _, it := range req.Items {
+		reason := models.WriteOffReason(strings.ToUpper(strings.TrimSpace(it.Reason)))
+		if !validReasons[reason] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reason", "reason": it.Reason})
+			return
+		}
+		if it.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quantity must be positive", "productId": it.ProductID})
+			return
+		}
+		product, err := m.deps.Repo.GetProductByOrg(ctx, orgID, strings.TrimSpace(it.ProductID))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid productId", "productId": it.ProductID})
+			return
+		}
+
+		unitCost, err := m.estimateUnitCost(c, orgID, branchID, product, strings.TrimSpace(it.LotID), it.Quantity)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "productId": product.ID})
+			return
+		}
+		cost := unitCost * int64(it.Quantity)
+		estimated += cost
+
+		items = append(items, models.WriteOffItem{
+			ProductID:     product.ID,
+			ProductName:   product.Name,
+			ProductSKU:    product.SKU,
+			LotID:         strings.TrimSpace(it.LotID),
+			Quantity:      it.Quantity,
+			Reason:        reason,
+			Notes:         strings.TrimSpace(it.Notes),
+			EstimatedCost: cost,
+		})
+	}
+
+	threshold := models.DefaultWriteOffApprovalThreshold
+	if org, err := m.deps.Repo.GetOrg(ctx, orgID); err == nil {
+		threshold = org.Settings.ApprovalThreshold()
+	}
+	requireApproval, err := m.needsApproval(ctx, orgID, items, estimated, threshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check approval threshold"})
+		return
+	}
+
+	seq, err := m.deps.Repo.NextCounter(ctx, "writeoff:"+orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate reference"})
+		return
+	}
+
+	photos := make([]string, 0, len(req.Photos))
+	for _, p := range req.Photos {
+		if p = strings.TrimSpace(p); p != "" {
+			photos = append(photos, p)
+		}
+	}
+
+	w := models.WriteOff{
+		ID:              "WO-" + primitive.NewObjectID().Hex(),
+		OrgID:           orgID,
+		BranchID:        branchID,
+		ReferenceNo:     repo.FormatWriteOffReference(seq),
+		Status:          models.WriteOffStatusPending,
+		Items:           items,
+		Photos:          photos,
+		Notes:           strings.TrimSpace(req.Notes),
+		EstimatedValue:  estimated,
+		RequireApproval: requireApproval,
+		RequestedBy:     u.ID,
+	}
+
+	if w.RequireApproval {
+		created, err := m.deps.Repo.CreateWriteOff(ctx, w)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create write-off"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"data": created})
+		return
+	}
+
+	// Within threshold: consume stock first so a failed post never leaves a POSTED document behind.
+	p, err := m.consume(c, orgID, w)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	w.Items = p.items
+	w.TotalValue = p.total
+	w.Status = models.WriteOffStatusPosted
+	w.PostedAt = time.Now().UTC()
+
+	created, err := m.deps.Repo.CreateWriteOff(ctx, w)
+	if err != nil {
+		p.undo()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create write-off"})
+		return
+	}
+	m.record(c, orgID, u.ID, created, p)
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+type decisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (m *Module) approve(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	w, err := m.deps.Repo.GetWriteOffByOrg(ctx, orgID, id)
+	if err != nil {
+		if err == repo.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "write-off not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get write-off"})
+		return
+	}
+	if w.Status != models.WriteOffStatusPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "can only approve PENDING_APPROVAL write-offs"})
+		return
+	}
+
+	// Claim the document before consuming stock so it cannot be posted twice.
+	approvedAt := time.Now().UTC()
+	w, err = m.deps.Repo.TransitionWriteOff(ctx, orgID, id, models.WriteOffStatusPending, bson.M{
+		"status":     models.WriteOffStatusPosted,
+		"approvedBy": u.ID,
+		"approvedAt": approvedAt,
+		"postedAt":   approvedAt,
+	})
+	if err != nil {
+		if err == repo.ErrConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": "write-off was already processed"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to approve write-off"})
+		return
+	}
+
+	unclaim := func() {
+		_, _ = m.deps.Repo.UpdateWriteOffByOrg(ctx, orgID, id, bson.M{
+			"status":     models.WriteOffStatusPending,
+			"approvedBy": "",
+			"approvedAt": time.Time{},
+			"postedAt":   time.Time{},
+		})
+	}
+	p, err := m.consume(c, orgID, w)
+	if err != nil {
+		unclaim()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := m.deps.Repo.UpdateWriteOffByOrg(ctx, orgID, id, bson.M{
+		"items":      p.items,
+		"totalValue": p.total,
+	})
+	if err != nil {
+		p.undo()
+		unclaim()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update write-off"})
+		return
+	}
+	m.record(c, orgID, u.ID, updated, p)
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+func (m *Module) reject(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	var req decisionRequest
+	_ = c.ShouldBindJSON(&req)
+
+	updated, err := m.deps.Repo.TransitionWriteOff(c.Request.Context(), orgID, c.Param("id"), models.WriteOffStatusPending, bson.M{
+		"status":          models.WriteOffStatusRejected,
+		"approvedBy":      u.ID,
+		"approvedAt":      time.Now().UTC(),
+		"rejectionReason": strings.TrimSpace(req.Reason),
+	})
+	if err != nil {
+		if err == repo.ErrConflict {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "can only reject PENDING_APPROVAL write-offs"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reject write-off"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+func (m *Module) cancel(c *gin.Context) {
+	u := auth.CurrentUser(c)
+	orgID := auth.GetOrgIDForRequest(c, u)
+	if orgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "org context required"})
+		return
+	}
+
+	updated, err := m.deps.Repo.TransitionWriteOff(c.Request.Context(), orgID, c.Param("id"), models.WriteOffStatusPending, bson.M{
+		"status": models.WriteOffStatusCancelled,
+	})
+	if err != nil {
+		if err == repo.ErrConflict {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "can only cancel PENDING_APPROVAL write-offs"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel write-off"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
@@ -0,0 +1,189 @@
+package writeoffsmodule
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/consignment"
+	"stockflows/server/internal/services/costing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// estimateUnitCost values a write-off line before it is posted, for the approval check
+func (m *Module) estimateUnitCost(c *gin.Context, orgID, branchID string, product models.Product, lotID string, qty int) (int64, error) {
+	ctx := c.Request.Context()
+	if lotID != "" {
+		lot, err := m.deps.Repo.GetInventoryLot(ctx, orgID, lotID)
+		if err != nil || lot.BranchID != branchID || lot.ProductID != product.ID {
+			return 0, errors.New("invalid lotId")
+		}
+		if lot.QtyRemaining < qty {
+			return 0, errors.New("lot has insufficient quantity")
+		}
+		return lot.UnitCost, nil
+	}
+	return costing.New(m.deps.Repo).EstimateUnitCost(ctx, orgID, branchID, product), nil
+}
+
+// posting is the stock side of a write-off that has been taken out but not yet recorded
+type posting struct {
+	items []models.WriteOffItem
+	total int64
+	prev  []int
+	next  []int
+	undo  func()
+}
+
+// consume removes the write-off quantities from stock and lots and returns the items with
+// their actual cost. Nothing else is written yet: the caller saves the document, calls undo
+// if that fails, and then calls record. On failure, lots and stock already taken are put back.
+func (m *Module) consume(c *gin.Context, orgID string, w models.WriteOff) (*posting, error) {
+	ctx := c.Request.Context()
+	costingSvc := costing.New(m.deps.Repo)
+
+	type applied struct {
+		productID string
+		qty       int
+		lines     []models.CostLine
+	}
+	done := make([]applied, 0, len(w.Items))
+	releaseLots := func(lines []models.CostLine) {
+		for _, l := range lines {
+			if l.LotID != "" && l.LotID != "AVERAGE" {
+				_ = m.deps.Repo.IncrementLotRemaining(ctx, l.LotID, l.Quantity)
+			}
+		}
+	}
+	rollback := func() {
+		for _, a := range done {
+			releaseLots(a.lines)
+			_, _ = m.deps.Repo.AdjustStock(ctx, orgID, w.BranchID, a.productID, a.qty)
+		}
+	}
+
+	p := &posting{
+		items: make([]models.WriteOffItem, 0, len(w.Items)),
+		prev:  make([]int, 0, len(w.Items)),
+		next:  make([]int, 0, len(w.Items)),
+		undo:  rollback,
+	}
+	for _, it := range w.Items {
+		sl, err := m.deps.Repo.GetStockLevel(ctx, orgID, w.BranchID, it.ProductID)
+		if err != nil || sl.Quantity-sl.Reserved < it.Quantity {
+			rollback()
+			return nil, fmt.Errorf("insufficient stock for %s", it.ProductSKU)
+		}
+		product, err := m.deps.Repo.GetProductByOrg(ctx, orgID, it.ProductID)
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("product %s not found", it.ProductID)
+		}
+
+		var lines []models.CostLine
+		if it.LotID != "" {
+			// A specific lot is written off at its own cost.
+			lot, ok, err := m.deps.Repo.DecrementLotRemaining(ctx, it.LotID, it.Quantity)
+			if err != nil || !ok {
+				rollback()
+				return nil, fmt.Errorf("lot %s has insufficient quantity", it.LotID)
+			}
+			lines = []models.CostLine{{
+				ProductID: it.ProductID,
+				LotID:     lot.ID,
+				Quantity:  it.Quantity,
+				UnitCost:  lot.UnitCost,
+				Amount:    lot.UnitCost * int64(it.Quantity),
+				OwnerID:   lot.OwnerID,
+			}}
+		} else {
+			result, err := costingSvc.ComputeCOGS(ctx, orgID, w.BranchID, product, it.Quantity)
+			switch {
+			case err == nil:
+				lines = result.CostLines
+			case errors.Is(err, repo.ErrInsufficientLots) || errors.Is(err, costing.ErrNoCostData):
+				// Stock without lot history is written off at the product's last cost.
+				lines = []models.CostLine{{
+					ProductID: it.ProductID,
+					Quantity:  it.Quantity,
+					UnitCost:  product.Cost,
+					Amount:    product.Cost * int64(it.Quantity),
+				}}
+			default:
+				rollback()
+				return nil, err
+			}
+		}
+
+		newStock, err := m.deps.Repo.AdjustStock(ctx, orgID, w.BranchID, it.ProductID, -it.Quantity)
+		if err != nil {
+			releaseLots(lines)
+			rollback()
+			return nil, errors.New("failed to adjust stock")
+		}
+		done = append(done, applied{productID: it.ProductID, qty: it.Quantity, lines: lines})
+
+		var cost int64
+		for _, l := range lines {
+			cost += l.Amount
+		}
+		it.CostLines = lines
+		it.TotalCost = cost
+		p.total += cost
+		p.items = append(p.items, it)
+		p.prev = append(p.prev, sl.Quantity)
+		p.next = append(p.next, newStock.Quantity)
+	}
+	return p, nil
+}
+
+// record writes what follows from a saved write-off: stock movements, payables to the
+// consignor for consigned goods lost, and the moving average. Failures are logged, the
+// stock has already left.
+func (m *Module) record(c *gin.Context, orgID, userID string, w models.WriteOff, p *posting) {
+	ctx := c.Request.Context()
+	costingSvc := costing.New(m.deps.Repo)
+
+	var lines []models.CostLine
+	for i, it := range p.items {
+		var unitCost int64
+		if it.Quantity > 0 {
+			unitCost = it.TotalCost / int64(it.Quantity)
+		}
+		if _, err := m.deps.Repo.CreateStockMovement(ctx, models.StockMovement{
+			ID:               "MV-" + primitive.NewObjectID().Hex(),
+			OrgID:            orgID,
+			BranchID:         w.BranchID,
+			ProductID:        it.ProductID,
+			Type:             "WRITE_OFF",
+			Quantity:         it.Quantity,
+			PreviousQuantity: p.prev[i],
+			NewQuantity:      p.next[i],
+			UnitCost:         unitCost,
+			TotalCost:        it.TotalCost,
+			ReferenceType:    "WRITE_OFF",
+			ReferenceID:      w.ID,
+			ReferenceNumber:  w.ReferenceNo,
+			LotID:            it.LotID,
+			Reason:           string(it.Reason),
+			Notes:            it.Notes,
+			CreatedBy:        userID,
+		}); err != nil {
+			log.Printf("writeoffs: movement for %s %s: %v", w.ReferenceNo, it.ProductID, err)
+		}
+		if err := costingSvc.UpdateMovingAverageOnSale(ctx, orgID, it.ProductID, it.Quantity); err != nil {
+			log.Printf("writeoffs: moving average for %s: %v", it.ProductID, err)
+		}
+		lines = append(lines, it.CostLines...)
+	}
+
+	w.Items = p.items
+	if _, err := consignment.New(m.deps.Repo).RecordWriteOff(ctx, orgID, w, lines); err != nil {
+		log.Printf("writeoffs: consignor payables for %s: %v", w.ReferenceNo, err)
+	}
+}
@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"context"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListBackorderedTransactions returns open sales with units waiting for stock, oldest order
+// first. An empty branchID covers every branch; productIDs, when given, narrows to orders
+// waiting on any of them.
+func (r *Repo) ListBackorderedTransactions(ctx context.Context, orgID, branchID string, productIDs []string) ([]models.Transaction, error) {
+	match := bson.M{"qtyBackordered": bson.M{"$gt": 0}}
+	if len(productIDs) > 0 {
+		match["id"] = bson.M{"$in": productIDs}
+	}
+	filter := bson.M{
+		"orgId":          orgID,
+		"type":           "SALE",
+		"status":         bson.M{"$nin": bson.A{"DRAFT", "CANCELLED", "REFUNDED"}},
+		"items":          bson.M{"$elemMatch": match},
+		"stockCommitted": bson.M{"$ne": true},
+	}
+	if branchID != "" {
+		filter["branchId"] = branchID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "createdAt", Value: 1}})
+	cur, err := r.col(ColTransactions).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Transaction
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"context"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- COD remittances ---
+
+func (r *Repo) CreateCODRemittance(ctx context.Context, rem models.CODRemittance) (models.CODRemittance, error) {
+	rem.CreatedAt = now()
+	_, err := r.col(ColCODRemittances).InsertOne(ctx, rem)
+	return rem, err
+}
+
+func (r *Repo) GetCODRemittanceByOrg(ctx context.Context, orgID, id string) (models.CODRemittance, error) {
+	var rem models.CODRemittance
+	err := r.col(ColCODRemittances).FindOne(ctx, bson.M{"_id": id, "orgId": orgID}).Decode(&rem)
+	if err == mongo.ErrNoDocuments {
+		return models.CODRemittance{}, ErrNotFound
+	}
+	return rem, err
+}
+
+// ListCODRemittancesByOrg returns imported statements newest first, without their lines
+func (r *Repo) ListCODRemittancesByOrg(ctx context.Context, orgID string, filter bson.M) ([]models.CODRemittance, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["orgId"] = orgID
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetProjection(bson.M{"lines": 0})
+	cur, err := r.col(ColCODRemittances).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.CODRemittance
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListTransactionsByTrackingNumbers returns an org's orders shipped under any of the
+// tracking numbers, whole or as one of their shipments
+func (r *Repo) ListTransactionsByTrackingNumbers(ctx context.Context, orgID string, trackingNumbers []string) ([]models.Transaction, error) {
+	cur, err := r.col(ColTransactions).Find(ctx, bson.M{
+		"orgId": orgID,
+		"$or": bson.A{
+			bson.M{"shippingInfo.trackingNumber": bson.M{"$in": trackingNumbers}},
+			bson.M{"shipments.trackingNumber": bson.M{"$in": trackingNumbers}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Transaction
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateCODRemittanceByOrg patches an imported statement
+func (r *Repo) UpdateCODRemittanceByOrg(ctx context.Context, orgID, id string, patch bson.M) error {
+	res, err := r.col(ColCODRemittances).UpdateOne(ctx, bson.M{"_id": id, "orgId": orgID}, bson.M{"$set": patch})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimCODRemittance marks a COD order as remitted on a statement, only if no statement
+// has claimed it yet. It returns ErrConflict when one has, so two uploads of the same
+// parcel cannot both record a payment.
+func (r *Repo) ClaimCODRemittance(ctx context.Context, orgID, transactionID, remittanceID string) error {
+	res, err := r.col(ColTransactions).UpdateOne(ctx, bson.M{
+		"_id":              transactionID,
+		"orgId":            orgID,
+		"cod":              bson.M{"$ne": nil},
+		"cod.remittanceId": bson.M{"$in": bson.A{nil, ""}},
+	}, bson.M{"$set": bson.M{"cod.remittanceId": remittanceID, "updatedAt": now()}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// ReleaseCODRemittance undoes a claim that could not be completed
+func (r *Repo) ReleaseCODRemittance(ctx context.Context, orgID, transactionID, remittanceID string) error {
+	_, err := r.col(ColTransactions).UpdateOne(ctx, bson.M{
+		"_id":              transactionID,
+		"orgId":            orgID,
+		"cod.remittanceId": remittanceID,
+	}, bson.M{"$unset": bson.M{"cod.remittanceId": ""}, "$set": bson.M{"updatedAt": now()}})
+	return err
+}
+
+// ClaimShipmentCODRemittance marks one parcel of an order shipped in parts as remitted on a
+// statement and adds what it remitted to the order's COD. It returns ErrConflict when the
+// parcel was already claimed.
+func (r *Repo) ClaimShipmentCODRemittance(ctx context.Context, orgID, transactionID, shipmentID, remittanceID string, remitted, shortfall int64, remittedDate string) error {
+	res, err := r.col(ColTransactions).UpdateOne(ctx, bson.M{
+		"_id":   transactionID,
+		"orgId": orgID,
+		"cod":   bson.M{"$ne": nil},
+		"shipments": bson.M{"$elemMatch": bson.M{
+			"id":           shipmentID,
+			"remittanceId": bson.M{"$in": bson.A{nil, ""}},
+		}},
+	}, bson.M{
+		"$set": bson.M{
+			"shipments.$.remittanceId": remittanceID,
+			"shipments.$.remitted":     remitted,
+			"cod.remittedDate":         remittedDate,
+			"updatedAt":                now(),
+		},
+		"$inc": bson.M{"cod.remitted": remitted, "cod.shortfall": shortfall},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// ReleaseShipmentCODRemittance undoes a parcel claim that could not be completed
+func (r *Repo) ReleaseShipmentCODRemittance(ctx context.Context, orgID, transactionID, shipmentID, remittanceID string, remitted, shortfall int64) error {
+	_, err := r.col(ColTransactions).UpdateOne(ctx, bson.M{
+		"_id":   transactionID,
+		"orgId": orgID,
+		"shipments": bson.M{"$elemMatch": bson.M{
+			"id":           shipmentID,
+			"remittanceId": remittanceID,
+		}},
+	}, bson.M{
+		"$unset": bson.M{"shipments.$.remittanceId": "", "shipments.$.remitted": ""},
+		"$inc":   bson.M{"cod.remitted": -remitted, "cod.shortfall": -shortfall},
+		"$set":   bson.M{"updatedAt": now()},
+	})
+	return err
+}
@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"context"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AdjustConsignedQty moves the consigned portion of a stock level by delta.
+func (r *Repo) AdjustConsignedQty(ctx context.Context, orgID, branchID, productID string, delta int) error {
+	_, err := r.col(ColStockLevels).UpdateOne(
+		ctx,
+		bson.M{"_id": StockLevelID(branchID, productID), "orgId": orgID},
+		bson.M{
+			"$inc": bson.M{"consignedQty": delta, "version": 1},
+			"$set": bson.M{"updatedAt": now()},
+		},
+	)
+	return err
+}
+
+// --- Consignment Payables ---
+
+func (r *Repo) CreateConsignmentPayable(ctx context.Context, p models.ConsignmentPayable) (models.ConsignmentPayable, error) {
+	p.CreatedAt = now()
+	p.UpdatedAt = p.CreatedAt
+	if p.SoldAt.IsZero() {
+		p.SoldAt = p.CreatedAt
+	}
+	_, err := r.col(ColConsignmentPayables).InsertOne(ctx, p)
+	return p, err
+}
+
+func (r *Repo) ListConsignmentPayablesByOrg(ctx context.Context, orgID string, filter bson.M) ([]models.ConsignmentPayable, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["orgId"] = orgID
+
+	cur, err := r.col(ColConsignmentPayables).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "soldAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.ConsignmentPayable
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateConsignmentPayablesStatus applies patch to payables in ids that are currently in status from.
+func (r *Repo) UpdateConsignmentPayablesStatus(ctx context.Context, orgID string, ids []string, from models.ConsignmentPayableStatus, patch bson.M) (int64, error) {
+	patch["updatedAt"] = now()
+	res, err := r.col(ColConsignmentPayables).UpdateMany(
+		ctx,
+		bson.M{"orgId": orgID, "_id": bson.M{"$in": ids}, "status": from},
+		bson.M{"$set": patch},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
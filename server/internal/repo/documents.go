@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"context"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Documents ---
+
+func (r *Repo) CreateDocument(ctx context.Context, d models.Document) (models.Document, error) {
+	d.CreatedAt = now()
+	d.UpdatedAt = d.CreatedAt
+	if d.IssuedAt.IsZero() {
+		d.IssuedAt = d.CreatedAt
+	}
+	_, err := r.col(ColDocuments).InsertOne(ctx, d)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Document{}, ErrConflict
+	}
+	return d, err
+}
+
+func (r *Repo) GetDocumentByOrg(ctx context.Context, orgID, id string) (models.Document, error) {
+	var d models.Document
+	err := r.col(ColDocuments).FindOne(ctx, bson.M{"_id": id, "orgId": orgID}).Decode(&d)
+	if err == mongo.ErrNoDocuments {
+		return models.Document{}, ErrNotFound
+	}
+	return d, err
+}
+
+// FindDocumentBySource returns the document of a type already issued for a source
+func (r *Repo) FindDocumentBySource(ctx context.Context, orgID, sourceType, sourceID string, typ models.DocumentType) (models.Document, error) {
+	var d models.Document
+	err := r.col(ColDocuments).FindOne(ctx, bson.M{
+		"orgId":      orgID,
+		"sourceType": sourceType,
+		"sourceId":   sourceID,
+		"type":       typ,
+	}).Decode(&d)
+	if err == mongo.ErrNoDocuments {
+		return models.Document{}, ErrNotFound
+	}
+	return d, err
+}
+
+// ListDocumentsByOrg returns documents newest first
+func (r *Repo) ListDocumentsByOrg(ctx context.Context, orgID string, filter bson.M, page, limit int) ([]models.Document, int64, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["orgId"] = orgID
+
+	total, err := r.col(ColDocuments).CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "issuedAt", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cur, err := r.col(ColDocuments).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Document
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+func (r *Repo) UpdateDocumentByOrg(ctx context.Context, orgID, id string, patch bson.M) (models.Document, error) {
+	patch["updatedAt"] = now()
+	res := r.col(ColDocuments).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID},
+		bson.M{"$set": patch},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.Document
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		return models.Document{}, ErrNotFound
+	}
+	return out, err
+}
+
+// LinkDocument adds a document reference to the order, return or purchase order it was issued for
+func (r *Repo) LinkDocument(ctx context.Context, orgID, sourceType, sourceID string, ref models.DocumentRef) error {
+	col := ColTransactions
+	switch sourceType {
+	case models.DocumentSourceReturn:
+		col = ColReturns
+	case models.DocumentSourcePurchaseOrder:
+		col = ColPurchaseOrders
+	}
+	res, err := r.col(col).UpdateOne(ctx,
+		bson.M{"_id": sourceID, "orgId": orgID},
+		bson.M{"$addToSet": bson.M{"documents": ref}, "$set": bson.M{"updatedAt": now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -38,6 +38,28 @@ func (r *Repo) EnsureIndexes(ctx context.Context) error {
 		{col: ColPurchaseOrders, name: "po_orgId", keys: bson.D{{Key: "orgId", Value: 1}}, opts: options.Index()},
 		{col: ColPurchaseOrders, name: "po_orgId_ref_unique", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "referenceNo", Value: 1}}, opts: options.Index().SetUnique(true)},
 		{col: ColTransactions, name: "txn_orgId_date", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "date", Value: -1}}, opts: options.Index()},
+		{col: ColConsignmentPayables, name: "consignment_payables_org_supplier", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "supplierId", Value: 1}, {Key: "soldAt", Value: -1}}, opts: options.Index()},
+		{col: ColWriteOffs, name: "write_offs_orgId_ref_unique", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "referenceNo", Value: 1}}, opts: options.Index().SetUnique(true)},
+		{col: ColCostVariances, name: "cost_variances_org_created", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "createdAt", Value: -1}}, opts: options.Index()},
+		{col: ColConsignmentPayables, name: "consignment_payables_org_txn", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "transactionId", Value: 1}}, opts: options.Index()},
+		{col: ColPayments, name: "payments_org_txn", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "transactionId", Value: 1}}, opts: options.Index()},
+		{col: ColPayments, name: "payments_org_created", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "createdAt", Value: -1}}, opts: options.Index()},
+		{col: ColPromotions, name: "promotions_org_coupon", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "couponCode", Value: 1}}, opts: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"couponCode": bson.M{"$type": "string"}})},
+		{col: ColTransactions, name: "transactions_org_customer_promotion", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "customerId", Value: 1}, {Key: "promotions.promotionId", Value: 1}}, opts: options.Index()},
+		{col: ColTransactions, name: "transactions_tracking_number", keys: bson.D{{Key: "shippingInfo.trackingNumber", Value: 1}}, opts: options.Index().SetSparse(true)},
+		{col: ColTransactions, name: "transactions_shipment_tracking_number", keys: bson.D{{Key: "shipments.trackingNumber", Value: 1}}, opts: options.Index().SetSparse(true)},
+		{col: ColTransactions, name: "transactions_org_backordered", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "items.qtyBackordered", Value: 1}, {Key: "date", Value: 1}}, opts: options.Index().SetPartialFilterExpression(bson.M{"items.qtyBackordered": bson.M{"$gt": 0}})},
+		{col: ColCODRemittances, name: "cod_remittances_org_created", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "createdAt", Value: -1}}, opts: options.Index()},
+		{col: ColOrderEvents, name: "order_events_org_order_created", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "orderId", Value: 1}, {Key: "createdAt", Value: 1}}, opts: options.Index()},
+		{col: ColOrderEvents, name: "order_events_org_created", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "createdAt", Value: 1}}, opts: options.Index()},
+		{col: ColWebhooks, name: "webhook_subscriptions_org", keys: bson.D{{Key: "orgId", Value: 1}}, opts: options.Index()},
+		{col: ColWebhookDeliveries, name: "webhook_deliveries_due", keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}, opts: options.Index()},
+		{col: ColWebhookDeliveries, name: "webhook_deliveries_org_webhook_created", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "webhookId", Value: 1}, {Key: "createdAt", Value: -1}}, opts: options.Index()},
+		// Pending documents have no number yet, so only numbered ones must be unique
+		{col: ColDocuments, name: "documents_org_type_number_unique", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "type", Value: 1}, {Key: "number", Value: 1}}, opts: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"number": bson.M{"$gt": ""}})},
+		// One document of each type per source, so concurrent requests cannot issue two invoices
+		{col: ColDocuments, name: "documents_org_source_type_unique", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "sourceType", Value: 1}, {Key: "sourceId", Value: 1}, {Key: "type", Value: 1}}, opts: options.Index().SetUnique(true)},
+		{col: ColStockMovements, name: "stock_movements_org_branch_product_created", keys: bson.D{{Key: "orgId", Value: 1}, {Key: "branchId", Value: 1}, {Key: "productId", Value: 1}, {Key: "createdAt", Value: 1}}, opts: options.Index()},
 	}
 
 	for _, idx := range indexes {
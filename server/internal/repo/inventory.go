@@ -144,12 +144,16 @@ func (r *Repo) UpsertStockLevel(ctx context.Context, s models.StockLevel) (model
 		bson.M{"_id": s.ID, "orgId": s.OrgID},
 		bson.M{
 			"$set": bson.M{
-				"quantity":    s.Quantity,
-				"reserved":    s.Reserved,
-				"minStock":    s.MinStock,
-				"binLocation": s.BinLocation,
-				"averageCost": s.AverageCost,
-				"updatedAt":   s.UpdatedAt,
+				"quantity":     s.Quantity,
+				"reserved":     s.Reserved,
+				"minStock":     s.MinStock,
+				"binLocation":  s.BinLocation,
+				"safetyStock":  s.SafetyStock,
+				"reorderQty":   s.ReorderQty,
+				"maxStock":     s.MaxStock,
+				"consignedQty": s.ConsignedQty,
+				"averageCost":  s.AverageCost,
+				"updatedAt":    s.UpdatedAt,
 			},
 			"$inc": bson.M{"version": 1},
 			"$setOnInsert": bson.M{
@@ -143,6 +143,7 @@ func (r *Repo) ConsumeLotsFIFO(ctx context.Context, orgID, branchID, productID s
 			Quantity:  consume,
 			UnitCost:  lot.UnitCost,
 			Amount:    amount,
+			OwnerID:   lot.OwnerID,
 		})
 		total += amount
 		remaining -= consume
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"stockflows/server/internal/models"
 
@@ -60,6 +61,28 @@ func (r *Repo) ListProductMovements(ctx context.Context, orgID, productID string
 	return r.ListStockMovementsByOrg(ctx, orgID, filter, page, limit)
 }
 
+// ListStockCardMovements returns every movement of a product at a branch up to (and excluding)
+// until, oldest first. A zero until means no upper bound.
+func (r *Repo) ListStockCardMovements(ctx context.Context, orgID, branchID, productID string, until time.Time) ([]models.StockMovement, error) {
+	filter := bson.M{"orgId": orgID, "branchId": branchID, "productId": productID}
+	if !until.IsZero() {
+		filter["createdAt"] = bson.M{"$lt": until}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cur, err := r.col(ColStockMovements).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.StockMovement
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // --- Stock Transfers ---
 
 func (r *Repo) CreateStockTransfer(ctx context.Context, t models.StockTransfer) (models.StockTransfer, error) {
@@ -0,0 +1,204 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Order events ---
+
+// CreateOrderEvent appends to an order's history. Events are never updated.
+func (r *Repo) CreateOrderEvent(ctx context.Context, e models.OrderEvent) (models.OrderEvent, error) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = now()
+	}
+	_, err := r.col(ColOrderEvents).InsertOne(ctx, e)
+	return e, err
+}
+
+// ListOrderEventsByOrder returns an order's history oldest first
+func (r *Repo) ListOrderEventsByOrder(ctx context.Context, orgID, orderID string) ([]models.OrderEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cur, err := r.col(ColOrderEvents).Find(ctx, bson.M{"orgId": orgID, "orderId": orderID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.OrderEvent
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListOrderEventsByOrg returns an org's events after since, oldest first, so integrations
+// can catch up on what their webhooks missed
+func (r *Repo) ListOrderEventsByOrg(ctx context.Context, orgID string, since time.Time, types []models.OrderEventType, limit int64) ([]models.OrderEvent, error) {
+	filter := bson.M{"orgId": orgID, "createdAt": bson.M{"$gt": since}}
+	if len(types) > 0 {
+		filter["type"] = bson.M{"$in": types}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(limit)
+	cur, err := r.col(ColOrderEvents).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.OrderEvent
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// --- Webhook subscriptions ---
+
+func (r *Repo) CreateWebhook(ctx context.Context, w models.WebhookSubscription) (models.WebhookSubscription, error) {
+	w.CreatedAt = now()
+	w.UpdatedAt = w.CreatedAt
+	_, err := r.col(ColWebhooks).InsertOne(ctx, w)
+	return w, err
+}
+
+func (r *Repo) ListWebhooksByOrg(ctx context.Context, orgID string) ([]models.WebhookSubscription, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cur, err := r.col(ColWebhooks).Find(ctx, bson.M{"orgId": orgID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.WebhookSubscription
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Repo) GetWebhookByOrg(ctx context.Context, orgID, id string) (models.WebhookSubscription, error) {
+	var w models.WebhookSubscription
+	err := r.col(ColWebhooks).FindOne(ctx, bson.M{"_id": id, "orgId": orgID}).Decode(&w)
+	if err == mongo.ErrNoDocuments {
+		return models.WebhookSubscription{}, ErrNotFound
+	}
+	return w, err
+}
+
+func (r *Repo) UpdateWebhookByOrg(ctx context.Context, orgID, id string, patch bson.M) (models.WebhookSubscription, error) {
+	patch["updatedAt"] = now()
+	res := r.col(ColWebhooks).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID},
+		bson.M{"$set": patch},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.WebhookSubscription
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		return models.WebhookSubscription{}, ErrNotFound
+	}
+	return out, err
+}
+
+func (r *Repo) DeleteWebhookByOrg(ctx context.Context, orgID, id string) error {
+	res, err := r.col(ColWebhooks).DeleteOne(ctx, bson.M{"_id": id, "orgId": orgID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordWebhookDelivery stores the outcome of a delivery; failures count up until one
+// succeeds
+func (r *Repo) RecordWebhookDelivery(ctx context.Context, orgID, id string, status int, deliveryErr string) error {
+	at := now()
+	update := bson.M{"$set": bson.M{"lastStatus": status, "lastError": deliveryErr, "lastDeliveryAt": at}}
+	if deliveryErr == "" {
+		update["$set"].(bson.M)["failures"] = 0
+	} else {
+		update["$inc"] = bson.M{"failures": 1}
+	}
+	_, err := r.col(ColWebhooks).UpdateOne(ctx, bson.M{"_id": id, "orgId": orgID}, update)
+	return err
+}
+
+// --- Webhook deliveries ---
+
+func (r *Repo) CreateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) (models.WebhookDelivery, error) {
+	d.CreatedAt = now()
+	d.UpdatedAt = d.CreatedAt
+	_, err := r.col(ColWebhookDeliveries).InsertOne(ctx, d)
+	return d, err
+}
+
+// ListDueWebhookDeliveries returns pending deliveries whose next attempt is due, oldest first
+func (r *Repo) ListDueWebhookDeliveries(ctx context.Context, at time.Time, limit int64) ([]models.WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).SetLimit(limit)
+	cur, err := r.col(ColWebhookDeliveries).Find(ctx, bson.M{
+		"status":        models.WebhookDeliveryPending,
+		"nextAttemptAt": bson.M{"$lte": at},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.WebhookDelivery
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListWebhookDeliveriesByWebhook returns a subscription's most recent deliveries
+func (r *Repo) ListWebhookDeliveriesByWebhook(ctx context.Context, orgID, webhookID string, limit int64) ([]models.WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cur, err := r.col(ColWebhookDeliveries).Find(ctx, bson.M{"orgId": orgID, "webhookId": webhookID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.WebhookDelivery
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClaimWebhookDelivery takes a due delivery for one attempt, pushing its next attempt out
+// to until so no other worker sends it meanwhile. It returns ErrConflict when the delivery
+// was already taken or finished.
+func (r *Repo) ClaimWebhookDelivery(ctx context.Context, d models.WebhookDelivery, until time.Time) (models.WebhookDelivery, error) {
+	res := r.col(ColWebhookDeliveries).FindOneAndUpdate(ctx,
+		bson.M{"_id": d.ID, "status": models.WebhookDeliveryPending, "attempts": d.Attempts},
+		bson.M{"$set": bson.M{"nextAttemptAt": until, "updatedAt": now()}, "$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.WebhookDelivery
+	if err := res.Decode(&out); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return models.WebhookDelivery{}, ErrConflict
+		}
+		return models.WebhookDelivery{}, err
+	}
+	return out, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt
+func (r *Repo) UpdateWebhookDelivery(ctx context.Context, id string, patch bson.M) error {
+	patch["updatedAt"] = now()
+	_, err := r.col(ColWebhookDeliveries).UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": patch})
+	return err
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"context"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Payments ---
+
+func (r *Repo) CreatePayment(ctx context.Context, p models.Payment) (models.Payment, error) {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = now()
+	}
+	if p.Status == "" {
+		p.Status = models.PaymentEntryActive
+	}
+	_, err := r.col(ColPayments).InsertOne(ctx, p)
+	return p, err
+}
+
+func (r *Repo) GetPaymentByOrg(ctx context.Context, orgID, id string) (models.Payment, error) {
+	var p models.Payment
+	err := r.col(ColPayments).FindOne(ctx, bson.M{"_id": id, "orgId": orgID}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return models.Payment{}, ErrNotFound
+	}
+	return p, err
+}
+
+// ListPaymentsByTransaction returns an order's ledger, oldest first
+func (r *Repo) ListPaymentsByTransaction(ctx context.Context, orgID, transactionID string) ([]models.Payment, error) {
+	return r.ListPaymentsByOrg(ctx, orgID, bson.M{"transactionId": transactionID})
+}
+
+func (r *Repo) ListPaymentsByOrg(ctx context.Context, orgID string, filter bson.M) ([]models.Payment, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["orgId"] = orgID
+
+	cur, err := r.col(ColPayments).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Payment
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// VoidPayment marks an active entry as voided. Returns ErrConflict if it was already voided.
+func (r *Repo) VoidPayment(ctx context.Context, orgID, id, userID, reason string) (models.Payment, error) {
+	res := r.col(ColPayments).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID, "status": models.PaymentEntryActive},
+		bson.M{"$set": bson.M{
+			"status":     models.PaymentEntryVoided,
+			"voidedBy":   userID,
+			"voidedAt":   now(),
+			"voidReason": reason,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.Payment
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		if _, getErr := r.GetPaymentByOrg(ctx, orgID, id); getErr == nil {
+			return models.Payment{}, ErrConflict
+		}
+		return models.Payment{}, ErrNotFound
+	}
+	return out, err
+}
+
+// LockPaymentForRefund holds an active payment while a refund is taken from it, so two
+// refunds cannot both see the same amount left. Returns ErrConflict if it is already held
+// or no longer active.
+func (r *Repo) LockPaymentForRefund(ctx context.Context, orgID, id string) (models.Payment, error) {
+	res := r.col(ColPayments).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID, "status": models.PaymentEntryActive, "refundInProgress": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"refundInProgress": true}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.Payment
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		return models.Payment{}, ErrConflict
+	}
+	return out, err
+}
+
+func (r *Repo) UnlockPaymentRefund(ctx context.Context, orgID, id string) error {
+	_, err := r.col(ColPayments).UpdateOne(ctx, bson.M{"_id": id, "orgId": orgID}, bson.M{"$unset": bson.M{"refundInProgress": ""}})
+	return err
+}
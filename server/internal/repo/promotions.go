@@ -0,0 +1,181 @@
+package repo
+
+import (
+	"context"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Promotions ---
+
+func (r *Repo) CreatePromotion(ctx context.Context, p models.Promotion) (models.Promotion, error) {
+	p.CreatedAt = now()
+	p.UpdatedAt = p.CreatedAt
+	_, err := r.col(ColPromotions).InsertOne(ctx, p)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Promotion{}, ErrConflict
+	}
+	return p, err
+}
+
+// ListPromotionsByOrg returns promotions in evaluation order (priority, then oldest first)
+func (r *Repo) ListPromotionsByOrg(ctx context.Context, orgID string, filter bson.M) ([]models.Promotion, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["orgId"] = orgID
+
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "createdAt", Value: 1}})
+	cur, err := r.col(ColPromotions).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Promotion
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *Repo) GetPromotionByOrg(ctx context.Context, orgID, id string) (models.Promotion, error) {
+	var p models.Promotion
+	err := r.col(ColPromotions).FindOne(ctx, bson.M{"_id": id, "orgId": orgID}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return models.Promotion{}, ErrNotFound
+	}
+	return p, err
+}
+
+func (r *Repo) UpdatePromotionByOrg(ctx context.Context, orgID, id string, patch bson.M) (models.Promotion, error) {
+	patch["updatedAt"] = now()
+	res := r.col(ColPromotions).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID},
+		bson.M{"$set": patch},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.Promotion
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		return models.Promotion{}, ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Promotion{}, ErrConflict
+	}
+	return out, err
+}
+
+func (r *Repo) DeletePromotionByOrg(ctx context.Context, orgID, id string) error {
+	res, err := r.col(ColPromotions).DeleteOne(ctx, bson.M{"_id": id, "orgId": orgID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// IncrementPromotionUsage counts one redemption. Returns ErrConflict if the usage limit
+// has already been reached, so two tills cannot both take the last use.
+func (r *Repo) IncrementPromotionUsage(ctx context.Context, orgID, id string) error {
+	filter := bson.M{
+		"_id":   id,
+		"orgId": orgID,
+		"$or": bson.A{
+			bson.M{"usageLimit": bson.M{"$exists": false}},
+			bson.M{"usageLimit": 0},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$usedCount", "$usageLimit"}}},
+		},
+	}
+	res, err := r.col(ColPromotions).UpdateOne(ctx, filter, bson.M{
+		"$inc": bson.M{"usedCount": 1},
+		"$set": bson.M{"updatedAt": now()},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, getErr := r.GetPromotionByOrg(ctx, orgID, id); getErr == nil {
+			return ErrConflict
+		}
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DecrementPromotionUsage gives back a redemption, e.g. when the order could not be saved
+func (r *Repo) DecrementPromotionUsage(ctx context.Context, orgID, id string) error {
+	_, err := r.col(ColPromotions).UpdateOne(ctx,
+		bson.M{"_id": id, "orgId": orgID, "usedCount": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"usedCount": -1}, "$set": bson.M{"updatedAt": now()}},
+	)
+	return err
+}
+
+// IncrementPromotionCustomerUsage counts one redemption by a customer. Returns ErrConflict
+// if the customer has already used the promotion limit times, so two orders from the same
+// customer cannot both take their last use.
+func (r *Repo) IncrementPromotionCustomerUsage(ctx context.Context, orgID, promotionID, customerID string, limit int) error {
+	_, err := r.col(ColPromotionCustomerUses).UpdateOne(ctx,
+		bson.M{"_id": promotionID + ":" + customerID, "orgId": orgID, "count": bson.M{"$lt": limit}},
+		bson.M{
+			"$inc":         bson.M{"count": 1},
+			"$set":         bson.M{"updatedAt": now()},
+			"$setOnInsert": bson.M{"promotionId": promotionID, "customerId": customerID},
+		},
+		options.Update().SetUpsert(true),
+	)
+	// A customer at the limit fails the filter, and the upsert then collides with their
+	// existing counter
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// DecrementPromotionCustomerUsage gives back a customer's redemption
+func (r *Repo) DecrementPromotionCustomerUsage(ctx context.Context, orgID, promotionID, customerID string) error {
+	_, err := r.col(ColPromotionCustomerUses).UpdateOne(ctx,
+		bson.M{"_id": promotionID + ":" + customerID, "orgId": orgID, "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}, "$set": bson.M{"updatedAt": now()}},
+	)
+	return err
+}
+
+// CountPromotionUsesByCustomer counts the customer's non-cancelled orders that used the
+// promotion, leaving out excludeID when it is set
+func (r *Repo) CountPromotionUsesByCustomer(ctx context.Context, orgID, promotionID, customerID, excludeID string) (int64, error) {
+	filter := bson.M{
+		"orgId":                  orgID,
+		"customerId":             customerID,
+		"promotions.promotionId": promotionID,
+		"status":                 bson.M{"$ne": "CANCELLED"},
+	}
+	if excludeID != "" {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+	return r.col(ColTransactions).CountDocuments(ctx, filter)
+}
+
+// ClearPromotionCoupon turns a coupon promotion into an automatic one
+func (r *Repo) ClearPromotionCoupon(ctx context.Context, orgID, id string) (models.Promotion, error) {
+	res := r.col(ColPromotions).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID},
+		bson.M{"$unset": bson.M{"couponCode": ""}, "$set": bson.M{"updatedAt": now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.Promotion
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		return models.Promotion{}, ErrNotFound
+	}
+	return out, err
+}
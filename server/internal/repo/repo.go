@@ -31,6 +31,17 @@ const (
 	ColCounters        = "counters"
 	ColReturns         = "returns"
 	ColAuditLogs       = "audit_logs"
+	ColConsignmentPayables = "consignment_payables"
+	ColWriteOffs       = "write_offs"
+	ColCostVariances   = "cost_variances"
+	ColPayments        = "payments"
+	ColPromotions      = "promotions"
+	ColDocuments       = "documents"
+	ColCODRemittances  = "cod_remittances"
+	ColOrderEvents     = "order_events"
+	ColWebhooks        = "webhook_subscriptions"
+	ColWebhookDeliveries = "webhook_deliveries"
+	ColPromotionCustomerUses = "promotion_customer_uses"
 )
 
 type Repo struct {
@@ -51,6 +51,26 @@ func (r *Repo) GetTransactionByOrg(ctx context.Context, orgID, id string) (model
 	return t, err
 }
 
+// ListTransactionsByTracking finds orders shipped under a tracking number in any org, for
+// carrier webhooks that know nothing but the parcel. The caller checks the carrier.
+func (r *Repo) ListTransactionsByTracking(ctx context.Context, trackingNumber string) ([]models.Transaction, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}}).SetLimit(20)
+	cur, err := r.col(ColTransactions).Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"shippingInfo.trackingNumber": trackingNumber},
+		bson.M{"shipments.trackingNumber": trackingNumber},
+	}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.Transaction
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (r *Repo) UpdateTransaction(ctx context.Context, id string, patch bson.M) (models.Transaction, error) {
 	patch["updatedAt"] = now()
 	res := r.col(ColTransactions).FindOneAndUpdate(
@@ -103,6 +123,27 @@ func (r *Repo) LockTransactionForStockCommit(ctx context.Context, orgID, id stri
 	return out, err
 }
 
+// CancelTransactionByOrg applies a cancellation patch unless the order is already cancelled
+// or refunded, so a repeated cancel cannot release or restock the order's stock twice.
+func (r *Repo) CancelTransactionByOrg(ctx context.Context, orgID, id string, patch bson.M) (models.Transaction, error) {
+	patch["updatedAt"] = now()
+	res := r.col(ColTransactions).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID, "status": bson.M{"$nin": bson.A{"CANCELLED", "REFUNDED"}}},
+		bson.M{"$set": patch},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.Transaction
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		if _, getErr := r.GetTransactionByOrg(ctx, orgID, id); getErr != nil {
+			return models.Transaction{}, getErr
+		}
+		return models.Transaction{}, ErrConflict
+	}
+	return out, err
+}
+
 func (r *Repo) UnlockTransactionStockCommit(ctx context.Context, orgID, id string) error {
 	_, err := r.col(ColTransactions).UpdateOne(
 		ctx,
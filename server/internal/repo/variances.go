@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// --- Cost Variances ---
+
+func (r *Repo) CreateCostVariance(ctx context.Context, v models.CostVariance) (models.CostVariance, error) {
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = now()
+	}
+	_, err := r.col(ColCostVariances).InsertOne(ctx, v)
+	return v, err
+}
+
+func (r *Repo) DeleteCostVarianceByOrg(ctx context.Context, orgID, id string) error {
+	res, err := r.col(ColCostVariances).DeleteOne(ctx, bson.M{"_id": id, "orgId": orgID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repo) ListCostVariancesByOrg(ctx context.Context, orgID string, filter bson.M) ([]models.CostVariance, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["orgId"] = orgID
+
+	cur, err := r.col(ColCostVariances).Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.CostVariance
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FormatWriteOffReference generates write-off reference number
+func FormatWriteOffReference(seq int64) string {
+	return fmt.Sprintf("WO-%06d", seq)
+}
+
+// --- Write-offs ---
+
+func (r *Repo) CreateWriteOff(ctx context.Context, w models.WriteOff) (models.WriteOff, error) {
+	w.CreatedAt = now()
+	w.UpdatedAt = w.CreatedAt
+	_, err := r.col(ColWriteOffs).InsertOne(ctx, w)
+	return w, err
+}
+
+func (r *Repo) ListWriteOffsByOrg(ctx context.Context, orgID string, filter bson.M, page, limit int) ([]models.WriteOff, int64, error) {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["orgId"] = orgID
+
+	total, err := r.col(ColWriteOffs).CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	skip := (page - 1) * limit
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+
+	cur, err := r.col(ColWriteOffs).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	var out []models.WriteOff
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+func (r *Repo) GetWriteOffByOrg(ctx context.Context, orgID, id string) (models.WriteOff, error) {
+	var w models.WriteOff
+	err := r.col(ColWriteOffs).FindOne(ctx, bson.M{"_id": id, "orgId": orgID}).Decode(&w)
+	if err == mongo.ErrNoDocuments {
+		return models.WriteOff{}, ErrNotFound
+	}
+	return w, err
+}
+
+// TransitionWriteOff applies patch only if the write-off is still in status from, so
+// concurrent approvals cannot post the same document twice.
+func (r *Repo) TransitionWriteOff(ctx context.Context, orgID, id string, from models.WriteOffStatus, patch bson.M) (models.WriteOff, error) {
+	patch["updatedAt"] = now()
+	res := r.col(ColWriteOffs).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID, "status": from},
+		bson.M{"$set": patch},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.WriteOff
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		return models.WriteOff{}, ErrConflict
+	}
+	return out, err
+}
+
+func (r *Repo) UpdateWriteOffByOrg(ctx context.Context, orgID, id string, patch bson.M) (models.WriteOff, error) {
+	patch["updatedAt"] = now()
+	res := r.col(ColWriteOffs).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "orgId": orgID},
+		bson.M{"$set": patch},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	var out models.WriteOff
+	err := res.Decode(&out)
+	if err == mongo.ErrNoDocuments {
+		return models.WriteOff{}, ErrNotFound
+	}
+	return out, err
+}
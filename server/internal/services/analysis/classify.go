@@ -0,0 +1,318 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidClassification = errors.New("invalid classification policy")
+
+// Classification is the ABC / XYZ class of one product at one branch
+type Classification struct {
+	BranchID    string `json:"branchId"`
+	ProductID   string `json:"productId"`
+	ProductName string `json:"productName"`
+	SKU         string `json:"sku"`
+
+	ABC   string `json:"abc"`   // A|B|C
+	XYZ   string `json:"xyz"`   // X|Y|Z
+	Class string `json:"class"` // e.g. "AX"
+
+	Contribution    int64   `json:"contribution"`    // Revenue or margin over the window, in the ranking scope
+	Share           float64 `json:"share"`           // Of the scope total
+	CumulativeShare float64 `json:"cumulativeShare"` // Including this item
+	Sold            int     `json:"sold"`
+	CV              float64 `json:"cv"` // Weekly demand coefficient of variation
+}
+
+// ValidateClassification checks a policy after defaults have been applied
+func ValidateClassification(p models.ClassificationPolicy) error {
+	if p.Scope != "BRANCH" && p.Scope != "ORG" {
+		return ErrInvalidClassification
+	}
+	if p.Basis != "REVENUE" && p.Basis != "MARGIN" {
+		return ErrInvalidClassification
+	}
+	if p.WindowDays < 7 || p.WindowDays > 730 || p.AShare >= p.BShare || p.BShare > 1 || p.XMaxCV >= p.YMaxCV {
+		return ErrInvalidClassification
+	}
+	return nil
+}
+
+// ABCClass returns the class for an item whose predecessors (ranked by contribution) already
+// cover cumulativeBefore of the total
+func ABCClass(cumulativeBefore float64, p models.ClassificationPolicy) string {
+	switch {
+	case cumulativeBefore < p.AShare:
+		return "A"
+	case cumulativeBefore < p.BShare:
+		return "B"
+	default:
+		return "C"
+	}
+}
+
+// XYZClass classifies demand by the coefficient of variation of per-period quantities.
+// Items that never sold are Z.
+func XYZClass(periods []int, p models.ClassificationPolicy) (string, float64) {
+	if len(periods) == 0 {
+		return "Z", 0
+	}
+	var sum float64
+	for _, q := range periods {
+		sum += float64(q)
+	}
+	mean := sum / float64(len(periods))
+	if mean == 0 {
+		return "Z", 0
+	}
+	var sq float64
+	for _, q := range periods {
+		d := float64(q) - mean
+		sq += d * d
+	}
+	cv := math.Sqrt(sq/float64(len(periods))) / mean
+	cv = math.Round(cv*100) / 100
+	switch {
+	case cv <= p.XMaxCV:
+		return "X", cv
+	case cv <= p.YMaxCV:
+		return "Y", cv
+	default:
+		return "Z", cv
+	}
+}
+
+type demand struct {
+	contribution int64
+	sold         int
+	weeks        []int
+}
+
+// lineRevenue is what a line brought in after line and order discounts, before VAT
+func lineRevenue(it models.TransactionItem, qty int) int64 {
+	if it.NetAmount > 0 {
+		return it.NetAmount
+	}
+	discount := it.Discount
+	if it.Quantity > 0 {
+		discount = discount * int64(qty) / int64(it.Quantity)
+	}
+	return it.Price*int64(qty) - discount
+}
+
+// Classify ranks every stock level (in the branch, or org when branchID is empty) by sales
+// contribution over the policy window and measures its demand variability.
+func (s *Service) Classify(ctx context.Context, orgID, branchID string, p models.ClassificationPolicy, now time.Time) ([]Classification, error) {
+	p = p.WithDefaults()
+	if err := ValidateClassification(p); err != nil {
+		return nil, err
+	}
+
+	levels, err := s.repo.ListStockLevelsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	products, err := s.repo.ListProductsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	txns, err := s.repo.ListTransactionsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Demand is keyed by stock level, or by product when ranking org-wide.
+	keyOf := func(branch, productID string) string {
+		if p.Scope == "ORG" {
+			return productID
+		}
+		return repo.StockLevelID(branch, productID)
+	}
+
+	// Weekly buckets count back from now over whole weeks only; a partial week would look
+	// like a demand drop and inflate the coefficient of variation.
+	weeks := p.WindowDays / 7
+	start := now.AddDate(0, 0, -p.WindowDays)
+	weeksStart := now.AddDate(0, 0, -weeks*7)
+	demands := make(map[string]*demand)
+	for _, t := range txns {
+		if strings.ToUpper(t.Type) != "SALE" {
+			continue
+		}
+		status := strings.ToUpper(t.Status)
+		if status == "CANCELLED" || status == "REFUNDED" || status == "DRAFT" {
+			continue
+		}
+		if p.Scope == "BRANCH" && branchID != "" && t.BranchID != branchID {
+			continue
+		}
+		txnTime, err := time.Parse(time.RFC3339, t.Date)
+		if err != nil || txnTime.Before(start) || !txnTime.Before(now) {
+			continue
+		}
+		week := -1
+		if !txnTime.Before(weeksStart) {
+			week = int(txnTime.Sub(weeksStart).Hours() / 24 / 7)
+			if week >= weeks {
+				week = weeks - 1
+			}
+		}
+		for _, it := range t.Items {
+			key := keyOf(t.BranchID, it.ID)
+			d, ok := demands[key]
+			if !ok {
+				d = &demand{weeks: make([]int, weeks)}
+				demands[key] = d
+			}
+			qty := it.Kept()
+			revenue := lineRevenue(it, qty)
+			if p.Basis == "MARGIN" {
+				// Cost is only known once the line has taken its stock
+				if t.StockCommitted {
+					d.contribution += revenue - it.LineCost
+				}
+			} else {
+				d.contribution += revenue
+			}
+			d.sold += qty
+			if week >= 0 {
+				d.weeks[week] += qty
+			}
+		}
+	}
+
+	// Rank within each scope group (one per branch, or a single org-wide group).
+	groups := make(map[string][]string)
+	for _, sl := range levels {
+		if p.Scope == "BRANCH" && branchID != "" && sl.BranchID != branchID {
+			continue
+		}
+		group := sl.BranchID
+		if p.Scope == "ORG" {
+			group = ""
+		}
+		groups[group] = append(groups[group], keyOf(sl.BranchID, sl.ProductID))
+	}
+
+	classes := make(map[string]Classification)
+	for _, keys := range groups {
+		keys = uniqueStrings(keys)
+		var total int64
+		for _, k := range keys {
+			if d := demands[k]; d != nil && d.contribution > 0 {
+				total += d.contribution
+			}
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return contributionOf(demands[keys[i]]) > contributionOf(demands[keys[j]])
+		})
+
+		var cumulative int64
+		for _, k := range keys {
+			d := demands[k]
+			c := contributionOf(d)
+			cls := Classification{Contribution: c, ABC: "C"}
+			if total > 0 && c > 0 {
+				cls.ABC = ABCClass(float64(cumulative)/float64(total), p)
+				cumulative += c
+				cls.Share = round4(float64(c) / float64(total))
+				cls.CumulativeShare = round4(float64(cumulative) / float64(total))
+			}
+			var periods []int
+			if d != nil {
+				periods = d.weeks
+				cls.Sold = d.sold
+			}
+			cls.XYZ, cls.CV = XYZClass(periods, p)
+			cls.Class = cls.ABC + cls.XYZ
+			classes[k] = cls
+		}
+	}
+
+	productMap := make(map[string]models.Product, len(products))
+	for _, pr := range products {
+		productMap[pr.ID] = pr
+	}
+
+	out := make([]Classification, 0, len(levels))
+	for _, sl := range levels {
+		if branchID != "" && sl.BranchID != branchID {
+			continue
+		}
+		cls := classes[keyOf(sl.BranchID, sl.ProductID)]
+		cls.BranchID = sl.BranchID
+		cls.ProductID = sl.ProductID
+		cls.ProductName = productMap[sl.ProductID].Name
+		cls.SKU = productMap[sl.ProductID].SKU
+		out = append(out, cls)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Class != out[j].Class {
+			return out[i].Class < out[j].Class
+		}
+		return out[i].Contribution > out[j].Contribution
+	})
+	return out, nil
+}
+
+// SaveClassification stores classes on their stock levels
+func (s *Service) SaveClassification(ctx context.Context, orgID string, classes []Classification, at time.Time) (int, error) {
+	saved := 0
+	for _, cls := range classes {
+		_, err := s.repo.PatchStockLevel(ctx, orgID, cls.BranchID, cls.ProductID, bson.M{
+			"abcClass":     cls.ABC,
+			"xyzClass":     cls.XYZ,
+			"classifiedAt": at,
+		})
+		if err != nil {
+			if errors.Is(err, repo.ErrNotFound) {
+				continue
+			}
+			return saved, err
+		}
+		saved++
+	}
+	return saved, nil
+}
+
+// Reclassify computes and stores the classification for a whole org using its settings
+func (s *Service) Reclassify(ctx context.Context, org models.Organization, now time.Time) (int, error) {
+	classes, err := s.Classify(ctx, org.ID, "", org.Settings.Classification, now)
+	if err != nil {
+		return 0, err
+	}
+	return s.SaveClassification(ctx, org.ID, classes, now)
+}
+
+func contributionOf(d *demand) int64 {
+	if d == nil || d.contribution < 0 {
+		return 0
+	}
+	return d.contribution
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := in[:0]
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func round4(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
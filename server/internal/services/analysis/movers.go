@@ -0,0 +1,297 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/costing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrInvalidWindow      = errors.New("window must be between 7 and 365 days")
+	ErrInvalidSellThrough = errors.New("sell-through threshold must be between 0 and 1")
+	ErrInvalidNoSaleDays  = errors.New("no-sale days must be between 1 and 730")
+)
+
+// Service analyses stock against sales history
+type Service struct {
+	repo *repo.Repo
+}
+
+// New creates a new analysis service
+func New(r *repo.Repo) *Service {
+	return &Service{repo: r}
+}
+
+// MoverPolicy controls when a stock level is flagged as slow moving or dead
+type MoverPolicy struct {
+	WindowDays       int     // Days of sales used to measure sell-through
+	SellThroughBelow float64 // Flag as slow when sold / (sold + on hand) over the window is below this
+	NoSaleDays       int     // Flag as dead when stock has not sold for this many days
+}
+
+// DefaultMoverPolicy returns the policy used when the caller does not override it
+func DefaultMoverPolicy() MoverPolicy {
+	return MoverPolicy{
+		WindowDays:       90,
+		SellThroughBelow: 0.2,
+		NoSaleDays:       60,
+	}
+}
+
+// Validate checks that the policy values are usable
+func (p MoverPolicy) Validate() error {
+	if p.WindowDays < 7 || p.WindowDays > 365 {
+		return ErrInvalidWindow
+	}
+	if p.SellThroughBelow < 0 || p.SellThroughBelow > 1 {
+		return ErrInvalidSellThrough
+	}
+	if p.NoSaleDays < 1 || p.NoSaleDays > 730 {
+		return ErrInvalidNoSaleDays
+	}
+	return nil
+}
+
+// MoverFlag marks why a stock level was reported
+type MoverFlag string
+
+const (
+	MoverSlow MoverFlag = "SLOW_MOVER" // Sell-through below threshold
+	MoverDead MoverFlag = "DEAD_STOCK" // No sale in NoSaleDays
+)
+
+// Mover is one flagged product at one branch
+type Mover struct {
+	BranchID    string `json:"branchId"`
+	ProductID   string `json:"productId"`
+	ProductName string `json:"productName"`
+	SKU         string `json:"sku"`
+	Category    string `json:"category"`
+
+	OnHand        int        `json:"onHand"`
+	SoldInWindow  int        `json:"soldInWindow"`
+	SellThrough   float64    `json:"sellThrough"`           // 0..1
+	AvgDailySales float64    `json:"avgDailySales"`         // Over the window
+	DaysOfCover   *float64   `json:"daysOfCover"`           // nil when nothing sold in the window
+	TiedUpValue   int64      `json:"tiedUpValue"`           // Costed value of owned stock on hand
+	LastSaleAt    *time.Time `json:"lastSaleAt"`            // nil when never sold
+	DaysIdle      int        `json:"daysIdle"`              // Days since last sale, or since oldest open lot when never sold
+	OldestLotAt   *time.Time `json:"oldestLotAt,omitempty"` // Receipt date of the oldest open lot
+
+	Flags []MoverFlag `json:"flags"`
+}
+
+// HasFlag reports whether the mover carries flag
+func (m Mover) HasFlag(flag MoverFlag) bool {
+	for _, f := range m.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// salesHistory returns the most recent sale that left stock per stock level key and window
+// quantities. Orders shipped in parts count the units shipped so far.
+func (s *Service) salesHistory(ctx context.Context, orgID string, since time.Time) (last map[string]time.Time, sold map[string]int, err error) {
+	txns, err := s.repo.ListTransactionsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last = make(map[string]time.Time)
+	sold = make(map[string]int)
+	for _, t := range txns {
+		if strings.ToUpper(t.Type) != "SALE" {
+			continue
+		}
+		split := len(t.Shipments) > 0
+		if !split && strings.ToUpper(t.FulfillmentStatus) != "DELIVERED" {
+			continue
+		}
+		status := strings.ToUpper(t.Status)
+		if status == "CANCELLED" || status == "REFUNDED" {
+			continue
+		}
+		txnTime, err := time.Parse(time.RFC3339, t.Date)
+		if err != nil {
+			continue
+		}
+		for _, it := range t.Items {
+			qty := it.Kept()
+			if split {
+				qty = it.QtyShipped
+			}
+			if qty <= 0 {
+				continue
+			}
+			key := repo.StockLevelID(t.BranchID, it.ID)
+			if txnTime.After(last[key]) {
+				last[key] = txnTime
+			}
+			if !txnTime.Before(since) {
+				sold[key] += qty
+			}
+		}
+	}
+	return last, sold, nil
+}
+
+// Movers flags stock levels in the branch (or org when branchID is empty) that are slow
+// moving or dead, most tied-up value first.
+func (s *Service) Movers(ctx context.Context, orgID, branchID string, p MoverPolicy, now time.Time) ([]Mover, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	products, err := s.repo.ListProductsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := s.repo.ListStockLevelsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if branchID != "" {
+		filtered := make([]models.StockLevel, 0, len(levels))
+		for _, sl := range levels {
+			if sl.BranchID == branchID {
+				filtered = append(filtered, sl)
+			}
+		}
+		levels = filtered
+	}
+
+	lots, _, err := s.repo.ListInventoryLotsByOrg(ctx, orgID, bson.M{
+		"qtyRemaining": bson.M{"$gt": 0},
+		"ownerId":      bson.M{"$in": bson.A{nil, ""}},
+	}, 1, 1000000)
+	if err != nil {
+		return nil, err
+	}
+	// Capped at on hand: lots of moving average products are never drawn down by sales
+	oldest := make(map[string]time.Time)
+	for _, l := range costing.OnHandLots(levels, lots) {
+		key := repo.StockLevelID(l.BranchID, l.ProductID)
+		if t, ok := oldest[key]; !ok || l.ReceivedAt.Before(t) {
+			oldest[key] = l.ReceivedAt
+		}
+	}
+
+	values := make(map[string]int64)
+	for _, line := range costing.ValueStock(products, levels, lots) {
+		values[repo.StockLevelID(line.BranchID, line.ProductID)] = line.Value
+	}
+
+	last, sold, err := s.salesHistory(ctx, orgID, now.AddDate(0, 0, -p.WindowDays))
+	if err != nil {
+		return nil, err
+	}
+
+	productMap := make(map[string]models.Product, len(products))
+	for _, pr := range products {
+		productMap[pr.ID] = pr
+	}
+
+	out := make([]Mover, 0)
+	for _, sl := range levels {
+		pr, ok := productMap[sl.ProductID]
+		if !ok || sl.Quantity <= 0 {
+			continue
+		}
+		key := repo.StockLevelID(sl.BranchID, sl.ProductID)
+
+		m := Mover{
+			BranchID:     sl.BranchID,
+			ProductID:    pr.ID,
+			ProductName:  pr.Name,
+			SKU:          pr.SKU,
+			Category:     pr.Category,
+			OnHand:       sl.Quantity,
+			SoldInWindow: sold[key],
+			TiedUpValue:  values[key],
+		}
+		m.SellThrough = float64(m.SoldInWindow) / float64(m.SoldInWindow+m.OnHand)
+		m.AvgDailySales = float64(m.SoldInWindow) / float64(p.WindowDays)
+		if m.AvgDailySales > 0 {
+			cover := math.Round(float64(m.OnHand)/m.AvgDailySales*10) / 10
+			m.DaysOfCover = &cover
+		}
+		if t, ok := oldest[key]; ok {
+			m.OldestLotAt = &t
+		}
+
+		// Idle since the last sale; never-sold stock is idle since it arrived.
+		switch {
+		case !last[key].IsZero():
+			t := last[key]
+			m.LastSaleAt = &t
+			m.DaysIdle = int(now.Sub(t).Hours() / 24)
+		case m.OldestLotAt != nil:
+			m.DaysIdle = int(now.Sub(*m.OldestLotAt).Hours() / 24)
+		default:
+			m.DaysIdle = int(now.Sub(sl.UpdatedAt).Hours() / 24)
+		}
+
+		if m.DaysIdle >= p.NoSaleDays {
+			m.Flags = append(m.Flags, MoverDead)
+		}
+		if m.SellThrough < p.SellThroughBelow {
+			m.Flags = append(m.Flags, MoverSlow)
+		}
+		if len(m.Flags) == 0 {
+			continue
+		}
+		out = append(out, m)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].TiedUpValue > out[j].TiedUpValue
+	})
+	return out, nil
+}
+
+// ClearanceSuggestion proposes a markdown or promotion for a flagged stock level
+type ClearanceSuggestion struct {
+	Mover
+	Action          string `json:"action"`          // MARKDOWN|PROMOTION
+	DiscountPercent int    `json:"discountPercent"` // Suggested price reduction
+	Reason          string `json:"reason"`
+}
+
+// SuggestClearance turns flagged movers into a markdown or promotion list. Dead stock is
+// marked down, deeper the longer it has been idle; slow movers get a lighter promotion.
+func SuggestClearance(movers []Mover, p MoverPolicy) []ClearanceSuggestion {
+	out := make([]ClearanceSuggestion, 0, len(movers))
+	for _, m := range movers {
+		s := ClearanceSuggestion{Mover: m}
+		if m.HasFlag(MoverDead) {
+			s.Action = "MARKDOWN"
+			switch {
+			case m.DaysIdle >= p.NoSaleDays*3:
+				s.DiscountPercent = 50
+			case m.DaysIdle >= p.NoSaleDays*2:
+				s.DiscountPercent = 30
+			default:
+				s.DiscountPercent = 20
+			}
+			s.Reason = "no sale in " + strconv.Itoa(m.DaysIdle) + " days"
+		} else {
+			s.Action = "PROMOTION"
+			s.DiscountPercent = 10
+			s.Reason = "sell-through " + strconv.Itoa(int(math.Round(m.SellThrough*100))) + "% over the window"
+		}
+		out = append(out, s)
+	}
+	return out
+}
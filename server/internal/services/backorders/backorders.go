@@ -0,0 +1,178 @@
+// Package backorders fills the backordered units of sales orders as stock comes in. Orders
+// are served oldest order date first; each takes what it needs before a newer order gets any.
+package backorders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/orderevents"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Service allocates incoming stock to backorders
+type Service struct {
+	repo *repo.Repo
+}
+
+// New creates a new backorder service
+func New(r *repo.Repo) *Service {
+	return &Service{repo: r}
+}
+
+// Allocation is stock reserved for one order's backordered units of a product
+type Allocation struct {
+	OrderID   string `json:"orderId"`
+	BranchID  string `json:"branchId"`
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+	Remaining int    `json:"remaining"` // Still backordered on the order
+}
+
+// Allocate reserves the branch's available stock of the products for backordered orders.
+// An empty branchID covers every branch and no productIDs covers every product. reference
+// names what brought the stock in, for the orders' history. An order being updated
+// elsewhere is waited on briefly; if it stays locked its products are held back from
+// newer orders, so stock never jumps the queue, and the next allocation picks them up.
+func (s *Service) Allocate(ctx context.Context, actor models.User, orgID, branchID string, productIDs []string, reference string, src orderevents.Source) ([]Allocation, error) {
+	orders, err := s.repo.ListBackorderedTransactions(ctx, orgID, branchID, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	only := make(map[string]bool, len(productIDs))
+	for _, id := range productIDs {
+		only[id] = true
+	}
+
+	out := make([]Allocation, 0)
+	exhausted := make(map[string]bool) // Branch and product with nothing left to give
+	for _, o := range orders {
+		txn, err := s.lock(ctx, orgID, o.ID)
+		if err != nil {
+			if !errors.Is(err, repo.ErrConflict) {
+				log.Printf("backorders: lock %s: %v", o.ID, err)
+			}
+			for _, it := range o.Items {
+				if it.QtyBackordered > 0 {
+					exhausted[o.BranchID+"/"+it.ID] = true
+				}
+			}
+			continue
+		}
+		// The order may have been cancelled, committed or edited since it was listed
+		if txn.Status == "DRAFT" || txn.Status == "CANCELLED" || txn.Status == "REFUNDED" || txn.StockCommitted {
+			_ = s.repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID)
+			continue
+		}
+
+		items := append([]models.TransactionItem(nil), txn.Items...)
+		filled := make(map[string]int)
+		for i := range items {
+			it := &items[i]
+			key := txn.BranchID + "/" + it.ID
+			if it.QtyBackordered <= 0 || exhausted[key] || (len(only) > 0 && !only[it.ID]) {
+				continue
+			}
+			take := s.reserveAvailable(ctx, orgID, txn.BranchID, it.ID, it.QtyBackordered)
+			if take < it.QtyBackordered {
+				exhausted[key] = true
+			}
+			if take == 0 {
+				continue
+			}
+			it.QtyBackordered -= take
+			it.Preorder = it.Preorder && it.QtyBackordered > 0
+			filled[it.ID] += take
+		}
+		if len(filled) == 0 {
+			_ = s.repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID)
+			continue
+		}
+
+		updated, err := s.repo.UpdateTransactionByOrg(ctx, orgID, txn.ID, bson.M{"items": items, "stockCommitInProgress": false})
+		if err != nil {
+			log.Printf("backorders: update %s: %v", txn.ID, err)
+			for id, qty := range filled {
+				_, _ = s.repo.ReleaseReservedStock(ctx, orgID, txn.BranchID, id, qty)
+			}
+			_ = s.repo.UnlockTransactionStockCommit(ctx, orgID, txn.ID)
+			continue
+		}
+
+		remaining := make(map[string]int)
+		units := 0
+		for _, it := range updated.Items {
+			if it.QtyBackordered > 0 {
+				remaining[it.ID] += it.QtyBackordered
+			}
+		}
+		for id, qty := range filled {
+			units += qty
+			out = append(out, Allocation{OrderID: txn.ID, BranchID: txn.BranchID, ProductID: id, Quantity: qty, Remaining: remaining[id]})
+		}
+
+		msg := fmt.Sprintf("%d backordered units allocated", units)
+		if len(remaining) == 0 {
+			msg = fmt.Sprintf("%d backordered units allocated; order is ready to fulfil", units)
+		}
+		if reference != "" {
+			msg += " from " + reference
+		}
+		ch := orderevents.Change{
+			Type:    models.OrderEventStockAllocated,
+			Message: msg,
+			Payload: map[string]interface{}{"allocated": filled, "backordered": remaining, "reference": reference},
+		}
+		if _, err := orderevents.New(s.repo).Record(ctx, actor, updated, ch, src); err != nil {
+			log.Printf("backorders: record %s for %s: %v", ch.Type, updated.ID, err)
+		}
+	}
+	return out, nil
+}
+
+// lockAttempts and lockWait bound how long Allocate waits on an order being updated
+const (
+	lockAttempts = 3
+	lockWait     = 200 * time.Millisecond
+)
+
+// lock takes an order's stock lock, retrying briefly while another update holds it
+func (s *Service) lock(ctx context.Context, orgID, id string) (models.Transaction, error) {
+	for attempt := 1; ; attempt++ {
+		txn, err := s.repo.LockTransactionForStockCommit(ctx, orgID, id)
+		if err == nil || !errors.Is(err, repo.ErrConflict) || attempt == lockAttempts {
+			return txn, err
+		}
+		select {
+		case <-ctx.Done():
+			return models.Transaction{}, ctx.Err()
+		case <-time.After(lockWait * time.Duration(attempt)):
+		}
+	}
+}
+
+// reserveAvailable reserves up to qty of what the branch has not yet promised, returning
+// how much it reserved
+func (s *Service) reserveAvailable(ctx context.Context, orgID, branchID, productID string, qty int) int {
+	level, err := s.repo.GetStockLevel(ctx, orgID, branchID, productID)
+	if err != nil {
+		return 0
+	}
+	take := level.Quantity - level.Reserved
+	if take > qty {
+		take = qty
+	}
+	if take <= 0 {
+		return 0
+	}
+	if _, err := s.repo.ReserveStock(ctx, orgID, branchID, productID, take); err != nil {
+		return 0
+	}
+	return take
+}
@@ -0,0 +1,695 @@
+// Package chatparse pulls an order out of a chat message pasted from LINE or Facebook:
+// the recipient's name, phone and address, and the products asked for. It works by rules
+// only; every field carries a confidence so staff know what to check before saving.
+package chatparse
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"stockflows/server/internal/models"
+)
+
+// MaxText caps the message length; a chat order is a few lines long
+const MaxText = 10000
+
+// Field is an extracted value and how sure the parser is of it, from 0 to 1. Confidence
+// is 0 when nothing was found.
+type Field struct {
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Item is a product the message mentions
+type Item struct {
+	ProductID      string  `json:"productId"`
+	SKU            string  `json:"sku"`
+	Name           string  `json:"name"`
+	Quantity       int     `json:"quantity"`
+	UnitPrice      int64   `json:"unitPrice"`
+	MatchedOn      string  `json:"matchedOn"`      // "sku" or "name"
+	QuantityStated bool    `json:"quantityStated"` // False when the quantity defaulted to 1
+	Text           string  `json:"text"`           // The line the product was found on
+	Confidence     float64 `json:"confidence"`
+}
+
+// Result is everything found in a message
+type Result struct {
+	Name       Field    `json:"name"`
+	Phone      Field    `json:"phone"`
+	Address    Field    `json:"address"` // Without the province and postal code, which have their own fields
+	Province   Field    `json:"province"`
+	PostalCode Field    `json:"postalCode"`
+	Phones     []string `json:"phones"` // Every phone number found, the chosen one first
+	Items      []Item   `json:"items"`
+	Unmatched  []string `json:"unmatched"` // Lines none of the rules used
+}
+
+type label int
+
+const (
+	labelNone label = iota
+	labelName
+	labelPhone
+	labelAddress
+	labelItems
+)
+
+var (
+	// Longer labels come first; alternation takes the first that matches
+	labelRe = regexp.MustCompile(`(?i)^(ชื่อผู้รับ|ชื่อ-นามสกุล|ชื่อ-สกุล|ชื่อ|ผู้รับ|recipient|name|ที่อยู่จัดส่ง|ที่อยู่|ส่งที่|address|เบอร์โทรศัพท์|เบอร์โทร|เบอร์|โทรศัพท์|มือถือ|โทร|tel|phone|mobile|รายการสินค้า|สินค้า|รายการ|order)\s*[:：.\-]?\s*`)
+
+	// Mobiles are 0 then 6, 8 or 9 and eight more digits; landlines 0 then 2-7 and seven
+	// more. +66 may replace the 0, and people group the digits with spaces, dots or dashes.
+	phoneRe = regexp.MustCompile(`(?:^|[^\d+])((?:\+?66|0)[\s.-]?(?:[689](?:[\s.-]?\d){8}|[2-7](?:[\s.-]?\d){7}))`)
+
+	postalRe   = regexp.MustCompile(`(?:^|\D)([1-9]\d{4})(?:\D|$)`)
+	moneyAfter = regexp.MustCompile(`(?i)^\s*(?:บาท|baht|thb|-\.-|\.-)`)
+
+	// Words that only turn up in addresses
+	addressRe = regexp.MustCompile(`(?i)(?:\d+/\d+|เลขที่|บ้านเลขที่|หมู่บ้าน|หมู่|ม\.\s*\d|ซ\.|ซอย|ถ\.|ถนน|ต\.|ตำบล|แขวง|อ\.|อำเภอ|เขต|จ\.|จังหวัด|คอนโด|อาคาร|ชั้น|ห้อง|\bsoi\b|\broad\b|\brd\.|\bmoo\b|\btambon\b|\bamphoe\b|\bdistrict\b|\bbuilding\b|\bfloor\b)`)
+
+	phoneLabelRe = regexp.MustCompile(`(?i)(เบอร์โทรศัพท์|เบอร์โทร|เบอร์|โทรศัพท์|มือถือ|โทร\.?|tel\.?|phone|mobile)\s*[:：.]?\s*$`)
+	honorificRe  = regexp.MustCompile(`(?i)^(?:คุณ|k\.\s*|khun\s+)`)
+	greetingRe   = regexp.MustCompile(`(?i)(สวัสดี|ขอบคุณ|รบกวน|ต้องการสั่ง|สั่งซื้อ|สั่งของ|โอนแล้ว|ครับ$|ค่ะ$|คะ$|นะคะ$|นะครับ$|^hi\b|^hello\b|^thank)`)
+
+	qtyAfterRe  = regexp.MustCompile(`(?i)(?:[x×*]\s*(\d{1,4})\b|(\d{1,4})\s*(?:ชิ้น|อัน|ตัว|กล่อง|ขวด|ชุด|แพ็ค|แพค|คู่|เล่ม|ถุง|ซอง|หลอด|กระปุก|ใบ|เครื่อง|แผ่น|ม้วน|ก้อน|โหล|pcs|pc|ea|units?|sets?)|จำนวน\s*(\d{1,4}))`)
+	qtyBeforeRe = regexp.MustCompile(`(?i)(?:^|\s)(\d{1,4})\s*(?:[x×*]|ชิ้น|อัน|ตัว|กล่อง|ขวด|ชุด|ใบ|เครื่อง)?\s*$`)
+)
+
+type line struct {
+	text  string // Without its label
+	label label
+	used  bool
+}
+
+// Parse extracts an order from a chat message, matching products against the catalog
+func Parse(text string, catalog []models.Product) Result {
+	res := Result{Phones: []string{}, Items: []Item{}, Unmatched: []string{}}
+	lines := splitLines(normalize(text))
+
+	phoneLine := res.findPhones(lines)
+	res.findItems(lines, catalog)
+	addrLines := res.findAddress(lines)
+	res.findName(lines, phoneLine, addrLines)
+
+	for _, l := range lines {
+		if !l.used && l.text != "" {
+			res.Unmatched = append(res.Unmatched, l.text)
+		}
+	}
+	return res
+}
+
+// normalize turns Thai digits into ASCII and evens out the whitespace chat apps add
+func normalize(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r >= '๐' && r <= '๙':
+			b.WriteRune('0' + (r - '๐'))
+		case r == '\r':
+		case r == '\u00a0' || r == '\u200b' || r == '\t':
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func splitLines(text string) []line {
+	lines := make([]line, 0)
+	for _, raw := range strings.Split(text, "\n") {
+		raw = strings.Join(strings.Fields(raw), " ")
+		if raw == "" {
+			continue
+		}
+		l := line{text: raw}
+		if m := labelRe.FindStringSubmatchIndex(raw); m != nil {
+			switch strings.ToLower(raw[m[2]:m[3]]) {
+			case "ชื่อผู้รับ", "ชื่อ-นามสกุล", "ชื่อ-สกุล", "ชื่อ", "ผู้รับ", "recipient", "name":
+				l.label = labelName
+			case "ที่อยู่จัดส่ง", "ที่อยู่", "ส่งที่", "address":
+				l.label = labelAddress
+			case "รายการสินค้า", "สินค้า", "รายการ", "order":
+				l.label = labelItems
+			default:
+				l.label = labelPhone
+			}
+			l.text = strings.TrimSpace(raw[m[1]:])
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// phoneSpans returns the phone numbers in s with their byte ranges
+func phoneSpans(s string) (numbers []string, spans [][2]int) {
+	for _, m := range phoneRe.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[2], m[3]
+		if r, _ := utf8.DecodeRuneInString(s[end:]); end < len(s) && unicode.IsDigit(r) {
+			continue // Part of a longer number, such as an account or order number
+		}
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, s[start:end])
+		if strings.HasPrefix(digits, "66") {
+			digits = "0" + digits[2:]
+		}
+		numbers = append(numbers, digits)
+		spans = append(spans, [2]int{start, end})
+	}
+	return numbers, spans
+}
+
+// withoutPhones removes phone numbers and any phone label next to them
+func withoutPhones(s string) string {
+	_, spans := phoneSpans(s)
+	for i := len(spans) - 1; i >= 0; i-- {
+		s = s[:spans[i][0]] + " " + s[spans[i][1]:]
+	}
+	s = phoneLabelRe.ReplaceAllString(strings.TrimSpace(s), "")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func isMobile(n string) bool { return len(n) == 10 }
+
+// findPhones collects every phone number and picks the recipient's: a labelled one, else
+// the first mobile, else the first landline. It returns the line the chosen number is on.
+func (res *Result) findPhones(lines []line) int {
+	chosen, chosenLine, score := "", -1, 0.0
+	for i := range lines {
+		numbers, _ := phoneSpans(lines[i].text)
+		for _, n := range numbers {
+			if !contains(res.Phones, n) {
+				res.Phones = append(res.Phones, n)
+			}
+			s := 0.8
+			if isMobile(n) {
+				s = 0.9
+			}
+			if lines[i].label == labelPhone {
+				s = 0.98
+			}
+			if s > score {
+				chosen, chosenLine, score = n, i, s
+			}
+		}
+		if numbers != nil && withoutPhones(lines[i].text) == "" {
+			lines[i].used = true
+		}
+		if lines[i].label == labelPhone {
+			lines[i].used = true
+		}
+	}
+	if chosen == "" {
+		return -1
+	}
+	// Put the chosen number first; several numbers make the choice less certain
+	phones := []string{chosen}
+	for _, n := range res.Phones {
+		if n != chosen {
+			phones = append(phones, n)
+		}
+	}
+	res.Phones = phones
+	if len(phones) > 1 && score < 0.98 {
+		score *= 0.8
+	}
+	res.Phone = Field{Value: chosen, Confidence: round(score)}
+	return chosenLine
+}
+
+// catalogEntry is a product and the lowercase text it is matched on
+type catalogEntry struct {
+	product models.Product
+	key     string
+	bySKU   bool
+}
+
+type match struct {
+	start, end int
+	entry      catalogEntry
+}
+
+// findItems matches products by SKU, then by name, longest first so "Tee Shirt Black"
+// wins over "Tee Shirt". The quantity is read next to each match.
+func (res *Result) findItems(lines []line, catalog []models.Product) {
+	entries := make([]catalogEntry, 0, len(catalog)*2)
+	for _, p := range catalog {
+		if sku := strings.ToLower(strings.TrimSpace(p.SKU)); utf8.RuneCountInString(sku) >= 3 {
+			entries = append(entries, catalogEntry{product: p, key: sku, bySKU: true})
+		}
+		if name := strings.ToLower(strings.Join(strings.Fields(p.Name), " ")); utf8.RuneCountInString(name) >= 3 {
+			entries = append(entries, catalogEntry{product: p, key: name})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].bySKU != entries[j].bySKU {
+			return entries[i].bySKU
+		}
+		return len(entries[i].key) > len(entries[j].key)
+	})
+
+	index := map[string]int{}
+	for i := range lines {
+		l := &lines[i]
+		if l.label == labelName || l.label == labelAddress || l.label == labelPhone {
+			continue
+		}
+		text := withoutPhones(l.text)
+		matches := matchProducts(strings.ToLower(text), entries)
+		if len(matches) == 0 {
+			continue
+		}
+		l.used = true
+		from := 0 // Text before a match that an earlier quantity has not taken
+		for k, m := range matches {
+			to := len(text)
+			if k+1 < len(matches) {
+				to = matches[k+1].start
+			}
+			qty, stated, took := quantityNear(text[from:m.start], text[m.end:to])
+			from = m.end + took
+
+			conf := 0.85
+			matchedOn := "name"
+			if m.entry.bySKU {
+				conf, matchedOn = 0.95, "sku"
+			}
+			if !stated {
+				conf -= 0.15
+			}
+			p := m.entry.product
+			if at, ok := index[p.ID]; ok {
+				// Mentioned again: add up, keeping the more certain match
+				it := &res.Items[at]
+				it.Quantity += qty
+				it.QuantityStated = it.QuantityStated && stated
+				if conf < it.Confidence {
+					it.Confidence = round(conf)
+				}
+				continue
+			}
+			index[p.ID] = len(res.Items)
+			res.Items = append(res.Items, Item{
+				ProductID:      p.ID,
+				SKU:            p.SKU,
+				Name:           p.Name,
+				Quantity:       qty,
+				UnitPrice:      p.Price,
+				MatchedOn:      matchedOn,
+				QuantityStated: stated,
+				Text:           l.text,
+				Confidence:     round(conf),
+			})
+		}
+	}
+}
+
+// matchProducts finds non-overlapping product mentions in a lowercased line, in order
+func matchProducts(lower string, entries []catalogEntry) []match {
+	found := make([]match, 0)
+	for _, e := range entries {
+		for from := 0; from < len(lower); {
+			at := strings.Index(lower[from:], e.key)
+			if at < 0 {
+				break
+			}
+			start, end := from+at, from+at+len(e.key)
+			from = end
+			if e.bySKU && !(boundary(lower, start-1) && boundary(lower, end)) {
+				continue
+			}
+			overlaps := false
+			for _, f := range found {
+				if start < f.end && end > f.start {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				found = append(found, match{start: start, end: end, entry: e})
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].start < found[j].start })
+	return found
+}
+
+// boundary reports whether the byte at i ends a SKU: the string's edge or anything but
+// a letter, digit or dash
+func boundary(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return true
+	}
+	c := s[i]
+	return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_')
+}
+
+// quantityNear reads a quantity written after a product ("x2", "2 ชิ้น", "จำนวน 2") or
+// before it ("2 x", "2 "). It defaults to 1. took is how much of after the quantity
+// used, so the next product does not read it again.
+func quantityNear(before, after string) (qty int, stated bool, took int) {
+	if m := qtyAfterRe.FindStringSubmatchIndex(after); m != nil {
+		for g := 2; g < len(m); g += 2 {
+			if m[g] < 0 {
+				continue
+			}
+			if n, err := strconv.Atoi(after[m[g]:m[g+1]]); err == nil && n > 0 {
+				return n, true, m[1]
+			}
+		}
+	}
+	if m := qtyBeforeRe.FindStringSubmatch(before); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			return n, true, 0
+		}
+	}
+	return 1, false, 0
+}
+
+// postalCode finds the last plausible postal code in s, skipping prices
+func postalCode(s string) (string, [2]int, bool) {
+	code, span, ok := "", [2]int{}, false
+	for _, m := range postalRe.FindAllStringSubmatchIndex(s, -1) {
+		c := s[m[2]:m[3]]
+		if provinceForPostalCode(c) == nil || moneyAfter.MatchString(s[m[3]:]) || strings.HasSuffix(s[:m[2]], "฿") {
+			continue
+		}
+		code, span, ok = c, [2]int{m[2], m[3]}, true
+	}
+	return code, span, ok
+}
+
+// findAddress takes the labelled address, with the lines under an empty label, or else
+// the run of address-like lines around the postal code. Province and postal code are
+// split out of it. It returns the lines used.
+func (res *Result) findAddress(lines []line) []int {
+	used := make([]int, 0)
+	labelled := false
+	for i := range lines {
+		if lines[i].label != labelAddress {
+			continue
+		}
+		labelled = true
+		used = append(used, i)
+		if lines[i].text != "" {
+			break
+		}
+		for j := i + 1; j < len(lines) && lines[j].label == labelNone && !lines[j].used; j++ {
+			used = append(used, j)
+		}
+		break
+	}
+
+	if !labelled {
+		looksLike := func(l line) bool {
+			if l.used || l.label != labelNone {
+				return false
+			}
+			text := withoutPhones(l.text)
+			_, _, hasCode := postalCode(text)
+			return addressRe.MatchString(text) || hasCode
+		}
+		// Prefer the block holding a postal code; else the first address-like block
+		first, withCode := -1, -1
+		for i := range lines {
+			if !looksLike(lines[i]) {
+				continue
+			}
+			if first < 0 {
+				first = i
+			}
+			if _, _, ok := postalCode(withoutPhones(lines[i].text)); ok && withCode < 0 {
+				withCode = i
+			}
+		}
+		anchor := withCode
+		if anchor < 0 {
+			anchor = first
+		}
+		if anchor < 0 {
+			return used
+		}
+		start, end := anchor, anchor
+		for start > 0 && looksLike(lines[start-1]) {
+			start--
+		}
+		for end+1 < len(lines) && looksLike(lines[end+1]) {
+			end++
+		}
+		for i := start; i <= end; i++ {
+			used = append(used, i)
+		}
+	}
+
+	parts := make([]string, 0, len(used))
+	for k, i := range used {
+		lines[i].used = true
+		text := lines[i].text
+		if k == 0 && !labelled {
+			// "Somchai 081... 12 Soi ..." puts the name before the address
+			if name, rest, ok := leadingName(text); ok {
+				res.Name = Field{Value: name, Confidence: 0.75}
+				text = rest
+			}
+		}
+		if t := withoutPhones(text); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	address := strings.Join(parts, " ")
+	if address == "" {
+		return used
+	}
+
+	code, span, hasCode := postalCode(address)
+	if hasCode {
+		address = address[:span[0]] + " " + address[span[1]:]
+	}
+	var fromCode *province
+	if hasCode {
+		fromCode = provinceForPostalCode(code)
+	}
+	prov, provSpan, marked := findProvince(address, fromCode)
+	if prov != nil {
+		address = address[:provSpan[0]] + " " + address[provSpan[1]:]
+	}
+	address = strings.Trim(strings.Join(strings.Fields(address), " "), " ,.-")
+
+	conf := 0.5
+	switch {
+	case labelled && hasCode:
+		conf = 0.95
+	case labelled:
+		conf = 0.8
+	case hasCode:
+		conf = 0.8
+	}
+	res.Address = Field{Value: address, Confidence: conf}
+
+	if hasCode {
+		c := 0.9
+		if prov != nil && prov.Prefix == code[:2] {
+			c = 0.95
+		}
+		res.PostalCode = Field{Value: code, Confidence: c}
+	}
+	switch {
+	case prov != nil && fromCode != nil && prov.Prefix == fromCode.Prefix:
+		res.Province = Field{Value: prov.Name, Confidence: 0.95}
+	case prov != nil && fromCode != nil:
+		// The text and the postal code disagree; one of them is a typo
+		res.Province = Field{Value: prov.Name, Confidence: 0.5}
+	case prov != nil && marked:
+		res.Province = Field{Value: prov.Name, Confidence: 0.9}
+	case prov != nil:
+		res.Province = Field{Value: prov.Name, Confidence: 0.75}
+	case fromCode != nil:
+		res.Province = Field{Value: fromCode.Name, Confidence: 0.8}
+	}
+	return used
+}
+
+// leadingName splits a name off the front of an address line: the words before a phone
+// number in the middle of the line, or a "คุณ ..." up to the first digit
+func leadingName(text string) (string, string, bool) {
+	cut := -1
+	if _, spans := phoneSpans(text); len(spans) > 0 && strings.TrimSpace(text[:spans[0][0]]) != "" {
+		cut = spans[0][0]
+	} else if honorificRe.MatchString(text) {
+		cut = strings.IndexFunc(text, unicode.IsDigit)
+	}
+	if cut <= 0 {
+		return "", text, false
+	}
+	head := strings.TrimSpace(text[:cut])
+	if strings.ContainsAny(head, "0123456789") || addressRe.MatchString(head) || len(strings.Fields(head)) > 4 {
+		return "", text, false
+	}
+	name := cleanName(head)
+	if name == "" {
+		return "", text, false
+	}
+	return name, text[cut:], true
+}
+
+// findProvince finds the province written in an address, with its จ./จังหวัด marker when
+// there is one. Names that are everyday words need the marker or a postal code of theirs.
+// The last mention wins since addresses end with the province.
+func findProvince(address string, fromCode *province) (*province, [2]int, bool) {
+	lower, offsets := lowerWithOffsets(address)
+	var best *province
+	var bestSpan [2]int
+	bestAt, bestMarked := -1, false
+	for i := range provinces {
+		p := &provinces[i]
+		names := append([]string{p.Name, strings.ToLower(p.English)}, p.Aliases...)
+		for _, name := range names {
+			at := strings.LastIndex(lower, name)
+			if at < 0 {
+				continue
+			}
+			end := at + len(name)
+			if isASCII(name) && !(boundary(lower, at-1) && boundary(lower, end)) {
+				continue
+			}
+			start, marked := at, false
+			for _, marker := range []string{"จังหวัด", "จ."} {
+				if strings.HasSuffix(strings.TrimRight(lower[:at], " "), marker) {
+					start = strings.LastIndex(lower[:at], marker)
+					marked = true
+					break
+				}
+			}
+			if p.Common && !marked && (fromCode == nil || fromCode.Prefix != p.Prefix) {
+				continue
+			}
+			if at > bestAt || (at == bestAt && end > bestSpan[1]) {
+				best, bestSpan, bestAt, bestMarked = p, [2]int{start, end}, at, marked
+			}
+			break
+		}
+	}
+	if best != nil {
+		bestSpan = [2]int{offsets[bestSpan[0]], offsets[bestSpan[1]]}
+	}
+	return best, bestSpan, bestMarked
+}
+
+// lowerWithOffsets lower cases s and maps each byte of the result back to the byte in s
+// it came from, since lower casing can change a rune's encoded length (e.g. "İ")
+func lowerWithOffsets(s string) (string, []int) {
+	var b strings.Builder
+	b.Grow(len(s))
+	offsets := make([]int, 0, len(s)+1)
+	for i, r := range s {
+		n := b.Len()
+		b.WriteRune(unicode.ToLower(r))
+		for j := n; j < b.Len(); j++ {
+			offsets = append(offsets, i)
+		}
+	}
+	return b.String(), append(offsets, len(s))
+}
+
+// findName takes the labelled name, else a "คุณ ..." line, else a short line without
+// digits next to the phone number or just above the address
+func (res *Result) findName(lines []line, phoneLine int, addrLines []int) {
+	for i := range lines {
+		if lines[i].label != labelName {
+			continue
+		}
+		lines[i].used = true
+		if name := cleanName(lines[i].text); name != "" {
+			res.Name = Field{Value: name, Confidence: 0.95}
+			return
+		}
+	}
+
+	if res.Name.Value != "" {
+		return // Found on the address line
+	}
+
+	candidate := func(i int) (string, bool) {
+		if i < 0 || i >= len(lines) || lines[i].label != labelNone {
+			return "", false
+		}
+		if lines[i].used && i != phoneLine {
+			return "", false
+		}
+		text := withoutPhones(lines[i].text)
+		if text == "" || strings.ContainsAny(text, "0123456789") || greetingRe.MatchString(text) {
+			return "", false
+		}
+		if utf8.RuneCountInString(text) > 40 || len(strings.Fields(text)) > 4 {
+			return "", false
+		}
+		return cleanName(text), true
+	}
+
+	for i := range lines {
+		if lines[i].label == labelNone && !lines[i].used && honorificRe.MatchString(lines[i].text) {
+			if name, ok := candidate(i); ok && name != "" {
+				lines[i].used = true
+				res.Name = Field{Value: name, Confidence: 0.8}
+				return
+			}
+		}
+	}
+
+	tries := []int{phoneLine, phoneLine - 1, phoneLine + 1}
+	if len(addrLines) > 0 {
+		tries = append(tries, addrLines[0]-1)
+	}
+	for k, i := range tries {
+		if phoneLine < 0 && k < 3 {
+			continue
+		}
+		if name, ok := candidate(i); ok && name != "" {
+			lines[i].used = true
+			conf := 0.65
+			if k == 3 {
+				conf = 0.55
+			}
+			res.Name = Field{Value: name, Confidence: conf}
+			return
+		}
+	}
+}
+
+// cleanName drops a phone number and the polite prefix chat names start with
+func cleanName(s string) string {
+	s = withoutPhones(s)
+	s = honorificRe.ReplaceAllString(s, "")
+	return strings.Trim(strings.TrimSpace(s), ",.-")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func round(f float64) float64 { return float64(int(f*100+0.5)) / 100 }
@@ -0,0 +1,196 @@
+package chatparse
+
+import (
+	"reflect"
+	"testing"
+
+	"stockflows/server/internal/models"
+)
+
+var testCatalog = []models.Product{
+	{ID: "p1", SKU: "TS-BLK-M", Name: "Tee Shirt Black", Price: 25000},
+	{ID: "p2", SKU: "TS-WHT-M", Name: "Tee Shirt", Price: 20000},
+	{ID: "p3", SKU: "MUG-01", Name: "แก้วมัค", Price: 15000},
+}
+
+func TestPhones(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		phones []string
+	}{
+		{"mobile", "โทร 0812345678", "0812345678", []string{"0812345678"}},
+		{"grouped with dashes", "081-234-5678", "0812345678", []string{"0812345678"}},
+		{"grouped with spaces and dots", "081 234.5678", "0812345678", []string{"0812345678"}},
+		{"country code", "+66 81 234 5678", "0812345678", []string{"0812345678"}},
+		{"thai digits", "๐๘๑๒๓๔๕๖๗๘", "0812345678", []string{"0812345678"}},
+		{"landline", "02-123-4567", "021234567", []string{"021234567"}},
+		{"mobile wins over landline", "02-123-4567\n089 876 5432", "0898765432", []string{"0898765432", "021234567"}},
+		{"labelled wins over first mobile", "0891111111\nเบอร์: 0822222222", "0822222222", []string{"0822222222", "0891111111"}},
+		{"longer number is not a phone", "order 08123456789", "", []string{}},
+		{"none", "สวัสดีค่ะ", "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Parse(tt.text, nil)
+			if res.Phone.Value != tt.want {
+				t.Errorf("phone = %q, want %q", res.Phone.Value, tt.want)
+			}
+			if !reflect.DeepEqual(res.Phones, tt.phones) {
+				t.Errorf("phones = %v, want %v", res.Phones, tt.phones)
+			}
+			if tt.want == "" && res.Phone.Confidence != 0 {
+				t.Errorf("confidence = %v, want 0 without a phone", res.Phone.Confidence)
+			}
+		})
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		address    string
+		province   string
+		postalCode string
+	}{
+		{
+			name:       "labelled with postal code",
+			text:       "ที่อยู่: 99/1 ซอยสุขุมวิท 21 แขวงคลองเตยเหนือ เขตวัฒนา กรุงเทพฯ 10110",
+			address:    "99/1 ซอยสุขุมวิท 21 แขวงคลองเตยเหนือ เขตวัฒนา",
+			province:   "กรุงเทพมหานคร",
+			postalCode: "10110",
+		},
+		{
+			name:       "unlabelled across lines",
+			text:       "สมชาย ใจดี\n12/3 หมู่ 4 ต.สุเทพ\nอ.เมือง จ.เชียงใหม่ 50200",
+			address:    "12/3 หมู่ 4 ต.สุเทพ อ.เมือง",
+			province:   "เชียงใหม่",
+			postalCode: "50200",
+		},
+		{
+			name:       "province from postal code only",
+			text:       "ที่อยู่ 45 ถนนงามวงศ์วาน 11000",
+			address:    "45 ถนนงามวงศ์วาน",
+			province:   "นนทบุรี",
+			postalCode: "11000",
+		},
+		{
+			name:       "price is not a postal code",
+			text:       "ที่อยู่ 7 ซอย 5 ถนนพหลโยธิน 10400 บาท",
+			address:    "7 ซอย 5 ถนนพหลโยธิน 10400 บาท",
+			province:   "",
+			postalCode: "",
+		},
+		{
+			name:       "english province",
+			text:       "address: 88 Moo 2 Chiang Mai 50100",
+			address:    "88 Moo 2",
+			province:   "เชียงใหม่",
+			postalCode: "50100",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Parse(tt.text, nil)
+			if res.Address.Value != tt.address {
+				t.Errorf("address = %q, want %q", res.Address.Value, tt.address)
+			}
+			if res.Province.Value != tt.province {
+				t.Errorf("province = %q, want %q", res.Province.Value, tt.province)
+			}
+			if res.PostalCode.Value != tt.postalCode {
+				t.Errorf("postal code = %q, want %q", res.PostalCode.Value, tt.postalCode)
+			}
+		})
+	}
+}
+
+// "İ" lower cases to three bytes from two, so the province span found in the lowered
+// text has to be mapped back before it is cut out of the original
+func TestProvinceAfterMultibyteLowerCase(t *testing.T) {
+	address := "12 İİİ Road Chiang Mai"
+	p, span, _ := findProvince(address, nil)
+	if p == nil || p.English != "Chiang Mai" {
+		t.Fatalf("province = %v, want Chiang Mai", p)
+	}
+	if got := address[span[0]:span[1]]; got != "Chiang Mai" {
+		t.Errorf("span covers %q, want %q", got, "Chiang Mai")
+	}
+
+	res := Parse("address: 12 İİİ Road Chiang Mai 50200", nil)
+	if res.Address.Value != "12 İİİ Road" {
+		t.Errorf("address = %q, want %q", res.Address.Value, "12 İİİ Road")
+	}
+	if res.Province.Value != "เชียงใหม่" {
+		t.Errorf("province = %q, want เชียงใหม่", res.Province.Value)
+	}
+}
+
+func TestItems(t *testing.T) {
+	type want struct {
+		id     string
+		qty    int
+		stated bool
+	}
+	tests := []struct {
+		name string
+		text string
+		want []want
+	}{
+		{"x after", "Tee Shirt Black x2", []want{{"p1", 2, true}}},
+		{"unit after", "แก้วมัค 3 ชิ้น", []want{{"p3", 3, true}}},
+		{"จำนวน after", "แก้วมัค จำนวน 4", []want{{"p3", 4, true}}},
+		{"number before", "2 x Tee Shirt Black", []want{{"p1", 2, true}}},
+		{"defaults to one", "Tee Shirt Black", []want{{"p1", 1, false}}},
+		{"longest name wins", "Tee Shirt Black x1 Tee Shirt x2", []want{{"p1", 1, true}, {"p2", 2, true}}},
+		{"by sku", "ts-wht-m *5", []want{{"p2", 5, true}}},
+		{"sku inside a word is not matched", "xts-wht-mx", nil},
+		{"repeated mentions add up", "แก้วมัค x1\nแก้วมัค x2", []want{{"p3", 3, true}}},
+		{"quantity is not read twice", "Tee Shirt Black 2 ชิ้น แก้วมัค", []want{{"p1", 2, true}, {"p3", 1, false}}},
+		{"phone digits are not a quantity", "แก้วมัค 0812345678", []want{{"p3", 1, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Parse(tt.text, testCatalog)
+			if len(res.Items) != len(tt.want) {
+				t.Fatalf("items = %+v, want %d", res.Items, len(tt.want))
+			}
+			for i, w := range tt.want {
+				it := res.Items[i]
+				if it.ProductID != w.id || it.Quantity != w.qty || it.QuantityStated != w.stated {
+					t.Errorf("item %d = %s x%d (stated %v), want %s x%d (stated %v)",
+						i, it.ProductID, it.Quantity, it.QuantityStated, w.id, w.qty, w.stated)
+				}
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"labelled", "ชื่อ: คุณสมหญิง รักดี\n0812345678", "สมหญิง รักดี"},
+		{"honorific line", "สวัสดีค่ะ\nคุณมานี มีนา\nที่อยู่ 1 ซอย 2 10110", "มานี มีนา"},
+		{"next to the phone", "วิชัย ชัยวัฒน์ 0812345678", "วิชัย ชัยวัฒน์"},
+		{"greeting is not a name", "สวัสดีครับ\n0812345678", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.text, nil).Name.Value; got != tt.want {
+				t.Errorf("name = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmatched(t *testing.T) {
+	res := Parse("สวัสดีค่ะ\nTee Shirt x1\n0812345678", testCatalog)
+	if want := []string{"สวัสดีค่ะ"}; !reflect.DeepEqual(res.Unmatched, want) {
+		t.Errorf("unmatched = %v, want %v", res.Unmatched, want)
+	}
+}
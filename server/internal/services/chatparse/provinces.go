@@ -0,0 +1,113 @@
+package chatparse
+
+// province is one of Thailand's 77 provinces with the names customers write it under.
+// Prefix is the first two digits of its postal codes.
+type province struct {
+	Name    string // Official Thai name, used in the draft
+	English string
+	Aliases []string // Common short forms
+	Prefix  string
+	Common  bool // The bare name is an everyday word, so it needs จ./จังหวัด or a matching postal code
+}
+
+var provinces = []province{
+	{Name: "กรุงเทพมหานคร", English: "Bangkok", Aliases: []string{"กรุงเทพฯ", "กรุงเทพ", "กทม.", "กทม", "bkk"}, Prefix: "10"},
+	{Name: "สมุทรปราการ", English: "Samut Prakan", Prefix: "10"},
+	{Name: "นนทบุรี", English: "Nonthaburi", Prefix: "11"},
+	{Name: "ปทุมธานี", English: "Pathum Thani", Prefix: "12"},
+	{Name: "พระนครศรีอยุธยา", English: "Phra Nakhon Si Ayutthaya", Aliases: []string{"อยุธยา", "ayutthaya"}, Prefix: "13"},
+	{Name: "อ่างทอง", English: "Ang Thong", Prefix: "14"},
+	{Name: "ลพบุรี", English: "Lop Buri", Aliases: []string{"lopburi"}, Prefix: "15"},
+	{Name: "สิงห์บุรี", English: "Sing Buri", Aliases: []string{"singburi"}, Prefix: "16"},
+	{Name: "ชัยนาท", English: "Chai Nat", Aliases: []string{"chainat"}, Prefix: "17"},
+	{Name: "สระบุรี", English: "Saraburi", Prefix: "18"},
+	{Name: "ชลบุรี", English: "Chon Buri", Aliases: []string{"chonburi"}, Prefix: "20"},
+	{Name: "ระยอง", English: "Rayong", Prefix: "21"},
+	{Name: "จันทบุรี", English: "Chanthaburi", Prefix: "22"},
+	{Name: "ตราด", English: "Trat", Prefix: "23", Common: true},
+	{Name: "ฉะเชิงเทรา", English: "Chachoengsao", Prefix: "24"},
+	{Name: "ปราจีนบุรี", English: "Prachin Buri", Aliases: []string{"prachinburi"}, Prefix: "25"},
+	{Name: "นครนายก", English: "Nakhon Nayok", Prefix: "26"},
+	{Name: "สระแก้ว", English: "Sa Kaeo", Prefix: "27"},
+	{Name: "นครราชสีมา", English: "Nakhon Ratchasima", Aliases: []string{"โคราช", "korat"}, Prefix: "30"},
+	{Name: "บุรีรัมย์", English: "Buri Ram", Aliases: []string{"buriram"}, Prefix: "31"},
+	{Name: "สุรินทร์", English: "Surin", Prefix: "32"},
+	{Name: "ศรีสะเกษ", English: "Si Sa Ket", Aliases: []string{"sisaket"}, Prefix: "33"},
+	{Name: "อุบลราชธานี", English: "Ubon Ratchathani", Aliases: []string{"อุบลฯ", "อุบล"}, Prefix: "34"},
+	{Name: "ยโสธร", English: "Yasothon", Prefix: "35"},
+	{Name: "ชัยภูมิ", English: "Chaiyaphum", Prefix: "36"},
+	{Name: "อำนาจเจริญ", English: "Amnat Charoen", Prefix: "37"},
+	{Name: "บึงกาฬ", English: "Bueng Kan", Prefix: "38"},
+	{Name: "หนองบัวลำภู", English: "Nong Bua Lam Phu", Prefix: "39"},
+	{Name: "ขอนแก่น", English: "Khon Kaen", Prefix: "40"},
+	{Name: "อุดรธานี", English: "Udon Thani", Aliases: []string{"อุดรฯ", "อุดร"}, Prefix: "41"},
+	{Name: "เลย", English: "Loei", Prefix: "42", Common: true},
+	{Name: "หนองคาย", English: "Nong Khai", Prefix: "43"},
+	{Name: "มหาสารคาม", English: "Maha Sarakham", Prefix: "44"},
+	{Name: "ร้อยเอ็ด", English: "Roi Et", Prefix: "45"},
+	{Name: "กาฬสินธุ์", English: "Kalasin", Prefix: "46"},
+	{Name: "สกลนคร", English: "Sakon Nakhon", Prefix: "47"},
+	{Name: "นครพนม", English: "Nakhon Phanom", Prefix: "48"},
+	{Name: "มุกดาหาร", English: "Mukdahan", Prefix: "49"},
+	{Name: "เชียงใหม่", English: "Chiang Mai", Aliases: []string{"chiangmai"}, Prefix: "50"},
+	{Name: "ลำพูน", English: "Lamphun", Prefix: "51"},
+	{Name: "ลำปาง", English: "Lampang", Prefix: "52"},
+	{Name: "อุตรดิตถ์", English: "Uttaradit", Prefix: "53"},
+	{Name: "แพร่", English: "Phrae", Prefix: "54", Common: true},
+	{Name: "น่าน", English: "Nan", Prefix: "55", Common: true},
+	{Name: "พะเยา", English: "Phayao", Prefix: "56"},
+	{Name: "เชียงราย", English: "Chiang Rai", Aliases: []string{"chiangrai"}, Prefix: "57"},
+	{Name: "แม่ฮ่องสอน", English: "Mae Hong Son", Prefix: "58"},
+	{Name: "นครสวรรค์", English: "Nakhon Sawan", Prefix: "60"},
+	{Name: "อุทัยธานี", English: "Uthai Thani", Prefix: "61"},
+	{Name: "กำแพงเพชร", English: "Kamphaeng Phet", Prefix: "62"},
+	{Name: "ตาก", English: "Tak", Prefix: "63", Common: true},
+	{Name: "สุโขทัย", English: "Sukhothai", Prefix: "64"},
+	{Name: "พิษณุโลก", English: "Phitsanulok", Prefix: "65"},
+	{Name: "พิจิตร", English: "Phichit", Prefix: "66"},
+	{Name: "เพชรบูรณ์", English: "Phetchabun", Prefix: "67"},
+	{Name: "ราชบุรี", English: "Ratchaburi", Prefix: "70"},
+	{Name: "กาญจนบุรี", English: "Kanchanaburi", Prefix: "71"},
+	{Name: "สุพรรณบุรี", English: "Suphan Buri", Aliases: []string{"suphanburi"}, Prefix: "72"},
+	{Name: "นครปฐม", English: "Nakhon Pathom", Prefix: "73"},
+	{Name: "สมุทรสาคร", English: "Samut Sakhon", Prefix: "74"},
+	{Name: "สมุทรสงคราม", English: "Samut Songkhram", Prefix: "75"},
+	{Name: "เพชรบุรี", English: "Phetchaburi", Prefix: "76"},
+	{Name: "ประจวบคีรีขันธ์", English: "Prachuap Khiri Khan", Prefix: "77"},
+	{Name: "นครศรีธรรมราช", English: "Nakhon Si Thammarat", Prefix: "80"},
+	{Name: "กระบี่", English: "Krabi", Prefix: "81"},
+	{Name: "พังงา", English: "Phang Nga", Prefix: "82"},
+	{Name: "ภูเก็ต", English: "Phuket", Prefix: "83"},
+	{Name: "สุราษฎร์ธานี", English: "Surat Thani", Prefix: "84"},
+	{Name: "ระนอง", English: "Ranong", Prefix: "85"},
+	{Name: "ชุมพร", English: "Chumphon", Prefix: "86"},
+	{Name: "สงขลา", English: "Songkhla", Prefix: "90"},
+	{Name: "สตูล", English: "Satun", Prefix: "91"},
+	{Name: "ตรัง", English: "Trang", Prefix: "92", Common: true},
+	{Name: "พัทลุง", English: "Phatthalung", Prefix: "93"},
+	{Name: "ปัตตานี", English: "Pattani", Prefix: "94"},
+	{Name: "ยะลา", English: "Yala", Prefix: "95", Common: true},
+	{Name: "นราธิวาส", English: "Narathiwat", Prefix: "96"},
+}
+
+// samutPrakanPostalCodes share Bangkok's 10 prefix
+var samutPrakanPostalCodes = map[string]bool{
+	"10130": true, "10270": true, "10280": true, "10290": true, "10540": true, "10550": true, "10560": true,
+}
+
+// provinceForPostalCode returns the province a postal code belongs to, or nil when the
+// code is not a Thai one
+func provinceForPostalCode(code string) *province {
+	if len(code) != 5 {
+		return nil
+	}
+	if samutPrakanPostalCodes[code] {
+		return &provinces[1]
+	}
+	for i := range provinces {
+		if provinces[i].Prefix == code[:2] {
+			return &provinces[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package consignment
+
+import (
+	"context"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Service keeps consigned stock and consignor payables in step with stock consumption
+type Service struct {
+	repo *repo.Repo
+}
+
+// New creates a new consignment service
+func New(r *repo.Repo) *Service {
+	return &Service{repo: r}
+}
+
+// ReleaseLines reduces the consigned quantity for cost lines drawn from consigned lots.
+// Use it when consigned goods leave stock without being sold (e.g. returned to the consignor).
+func (s *Service) ReleaseLines(ctx context.Context, orgID, branchID string, lines []models.CostLine) {
+	for _, l := range lines {
+		if l.OwnerID == "" {
+			continue
+		}
+		_ = s.repo.AdjustConsignedQty(ctx, orgID, branchID, l.ProductID, -l.Quantity)
+	}
+}
+
+// RecordSale creates a payable to the consignor for every cost line drawn from a consigned lot
+func (s *Service) RecordSale(ctx context.Context, orgID string, txn models.Transaction, lines []models.CostLine) ([]models.ConsignmentPayable, error) {
+	items := make(map[string]models.TransactionItem, len(txn.Items))
+	for _, it := range txn.Items {
+		items[it.ID] = it
+	}
+
+	soldAt := time.Now().UTC()
+	out := make([]models.ConsignmentPayable, 0)
+	for _, l := range lines {
+		if l.OwnerID == "" {
+			continue
+		}
+		item := items[l.ProductID]
+		p, err := s.repo.CreateConsignmentPayable(ctx, models.ConsignmentPayable{
+			ID:            "CSP-" + primitive.NewObjectID().Hex(),
+			OrgID:         orgID,
+			BranchID:      txn.BranchID,
+			SupplierID:    l.OwnerID,
+			TransactionID: txn.ID,
+			ProductID:     l.ProductID,
+			ProductName:   item.Name,
+			ProductSKU:    item.SKU,
+			LotID:         l.LotID,
+			Quantity:      l.Quantity,
+			UnitCost:      l.UnitCost,
+			Amount:        l.Amount,
+			Status:        models.ConsignmentPayableOpen,
+			SoldAt:        soldAt,
+		})
+		if err != nil {
+			return out, err
+		}
+		_ = s.repo.AdjustConsignedQty(ctx, orgID, txn.BranchID, l.ProductID, -l.Quantity)
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// RecordWriteOff creates a payable to the consignor for consigned goods written off. The
+// org carries the loss of goods in its care, so they are owed as if sold.
+func (s *Service) RecordWriteOff(ctx context.Context, orgID string, w models.WriteOff, lines []models.CostLine) ([]models.ConsignmentPayable, error) {
+	items := make(map[string]models.WriteOffItem, len(w.Items))
+	for _, it := range w.Items {
+		items[it.ProductID] = it
+	}
+
+	lostAt := time.Now().UTC()
+	out := make([]models.ConsignmentPayable, 0)
+	for _, l := range lines {
+		if l.OwnerID == "" {
+			continue
+		}
+		item := items[l.ProductID]
+		p, err := s.repo.CreateConsignmentPayable(ctx, models.ConsignmentPayable{
+			ID:          "CSP-" + primitive.NewObjectID().Hex(),
+			OrgID:       orgID,
+			BranchID:    w.BranchID,
+			SupplierID:  l.OwnerID,
+			WriteOffID:  w.ID,
+			ProductID:   l.ProductID,
+			ProductName: item.ProductName,
+			ProductSKU:  item.ProductSKU,
+			LotID:       l.LotID,
+			Quantity:    l.Quantity,
+			UnitCost:    l.UnitCost,
+			Amount:      l.Amount,
+			Status:      models.ConsignmentPayableOpen,
+			SoldAt:      lostAt,
+		})
+		if err != nil {
+			return out, err
+		}
+		_ = s.repo.AdjustConsignedQty(ctx, orgID, w.BranchID, l.ProductID, -l.Quantity)
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Restored describes consigned goods put back into stock when a sale is reversed
+type Restored struct {
+	Quantity int
+	Cost     int64
+}
+
+// ReverseSale takes consigned goods of a cancelled sale back into the consignor's lots and
+// voids their unpaid payables. Goods that are not restocked have left for good, so their
+// payables stay open: the org still owes the consignor for them. Each payable is voided only
+// once its lot exists, and the restored quantities are returned per product so the caller
+// only restocks the remainder as owned stock. Payables already paid stay as they are: those
+// goods now belong to the org.
+func (s *Service) ReverseSale(ctx context.Context, orgID string, txn models.Transaction, restock bool) (map[string]Restored, error) {
+	restored := make(map[string]Restored)
+	if !restock {
+		return restored, nil
+	}
+	payables, err := s.repo.ListConsignmentPayablesByOrg(ctx, orgID, bson.M{
+		"transactionId": txn.ID,
+		"status":        models.ConsignmentPayableOpen,
+	})
+	if err != nil {
+		return restored, err
+	}
+
+	for _, p := range payables {
+		lot, err := s.repo.CreateInventoryLot(ctx, models.InventoryLot{
+			ID:           primitive.NewObjectID().Hex(),
+			OrgID:        orgID,
+			BranchID:     p.BranchID,
+			ProductID:    p.ProductID,
+			Source:       "RETURN",
+			OwnerID:      p.SupplierID,
+			UnitCost:     p.UnitCost,
+			QtyReceived:  p.Quantity,
+			QtyRemaining: p.Quantity,
+			ReceivedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return restored, err
+		}
+		// A payable settled in the meantime keeps its goods with the org
+		n, err := s.repo.UpdateConsignmentPayablesStatus(ctx, orgID, []string{p.ID}, models.ConsignmentPayableOpen, bson.M{
+			"status": models.ConsignmentPayableVoid,
+		})
+		if err != nil || n == 0 {
+			_ = s.repo.DeleteInventoryLot(ctx, lot.ID)
+			if err != nil {
+				return restored, err
+			}
+			continue
+		}
+		_ = s.repo.AdjustConsignedQty(ctx, orgID, p.BranchID, p.ProductID, p.Quantity)
+		r := restored[p.ProductID]
+		r.Quantity += p.Quantity
+		r.Cost += p.Amount
+		restored[p.ProductID] = r
+	}
+	return restored, nil
+}
@@ -0,0 +1,121 @@
+package consignment
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StatementLine summarises one product for a consignor over a period
+type StatementLine struct {
+	ProductID   string `json:"productId"`
+	ProductName string `json:"productName"`
+	ProductSku  string `json:"productSku"`
+
+	ReceivedQty   int   `json:"receivedQty"`
+	ReceivedValue int64 `json:"receivedValue"`
+	SoldQty       int   `json:"soldQty"`
+	SoldValue     int64 `json:"soldValue"`
+	HeldQty       int   `json:"heldQty"` // Currently on hand, not yet sold
+	HeldValue     int64 `json:"heldValue"`
+	OwedAmount    int64 `json:"owedAmount"` // Unpaid payables for sales in the period
+}
+
+// Statement is a consignor statement for a period
+type Statement struct {
+	SupplierID string          `json:"supplierId"`
+	From       time.Time       `json:"from"`
+	To         time.Time       `json:"to"`
+	Lines      []StatementLine `json:"lines"`
+
+	TotalReceivedValue int64 `json:"totalReceivedValue"`
+	TotalSoldValue     int64 `json:"totalSoldValue"`
+	TotalHeldValue     int64 `json:"totalHeldValue"`
+	TotalOwed          int64 `json:"totalOwed"`   // Unpaid payables for sales in the period
+	TotalPaid          int64 `json:"totalPaid"`   // Payments made during the period
+	Outstanding        int64 `json:"outstanding"` // Every unpaid payable regardless of period
+}
+
+// Statement builds the consignor statement for [from, to)
+func (s *Service) Statement(ctx context.Context, orgID, supplierID string, from, to time.Time) (Statement, error) {
+	st := Statement{SupplierID: supplierID, From: from, To: to}
+
+	products, err := s.repo.ListProductsByOrg(ctx, orgID)
+	if err != nil {
+		return st, err
+	}
+	productMap := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+
+	lines := make(map[string]*StatementLine)
+	line := func(productID string) *StatementLine {
+		l, ok := lines[productID]
+		if !ok {
+			p := productMap[productID]
+			l = &StatementLine{ProductID: productID, ProductName: p.Name, ProductSku: p.SKU}
+			lines[productID] = l
+		}
+		return l
+	}
+
+	lots, _, err := s.repo.ListInventoryLotsByOrg(ctx, orgID, bson.M{"ownerId": supplierID}, 1, 100000)
+	if err != nil {
+		return st, err
+	}
+	for _, lot := range lots {
+		l := line(lot.ProductID)
+		if lot.Source == "CONSIGNMENT" && !lot.ReceivedAt.Before(from) && lot.ReceivedAt.Before(to) {
+			l.ReceivedQty += lot.QtyReceived
+			l.ReceivedValue += int64(lot.QtyReceived) * lot.UnitCost
+		}
+		if lot.QtyRemaining > 0 {
+			l.HeldQty += lot.QtyRemaining
+			l.HeldValue += int64(lot.QtyRemaining) * lot.UnitCost
+		}
+	}
+
+	payables, err := s.repo.ListConsignmentPayablesByOrg(ctx, orgID, bson.M{"supplierId": supplierID})
+	if err != nil {
+		return st, err
+	}
+	for _, p := range payables {
+		if p.Status == models.ConsignmentPayableVoid {
+			continue
+		}
+		if p.Status == models.ConsignmentPayableOpen {
+			st.Outstanding += p.Amount
+		}
+		if p.Status == models.ConsignmentPayablePaid && !p.PaidAt.Before(from) && p.PaidAt.Before(to) {
+			st.TotalPaid += p.Amount
+		}
+		if p.SoldAt.Before(from) || !p.SoldAt.Before(to) {
+			continue
+		}
+		l := line(p.ProductID)
+		l.SoldQty += p.Quantity
+		l.SoldValue += p.Amount
+		if p.Status == models.ConsignmentPayableOpen {
+			l.OwedAmount += p.Amount
+		}
+	}
+
+	st.Lines = make([]StatementLine, 0, len(lines))
+	for _, l := range lines {
+		if l.ReceivedQty == 0 && l.SoldQty == 0 && l.HeldQty == 0 {
+			continue
+		}
+		st.TotalReceivedValue += l.ReceivedValue
+		st.TotalSoldValue += l.SoldValue
+		st.TotalHeldValue += l.HeldValue
+		st.TotalOwed += l.OwedAmount
+		st.Lines = append(st.Lines, *l)
+	}
+	sort.Slice(st.Lines, func(i, j int) bool { return st.Lines[i].ProductSku < st.Lines[j].ProductSku })
+	return st, nil
+}
@@ -58,6 +58,8 @@ func (s *Service) ComputeCOGS(ctx context.Context, orgID, branchID string, produ
 	switch method {
 	case models.CostingMethodMovingAverage:
 		return s.computeMovingAverageCOGS(ctx, orgID, branchID, product, qty)
+	case models.CostingMethodStandard:
+		return s.computeStandardCOGS(ctx, orgID, branchID, product, qty)
 	default:
 		return s.computeFIFOCOGS(ctx, orgID, branchID, product.ID, qty)
 	}
@@ -205,6 +207,22 @@ func (s *Service) UpdateMovingAverageOnSale(ctx context.Context, orgID, productI
 	return err
 }
 
+// EstimateUnitCost values a unit of the product in the branch before any stock is taken:
+// the moving average or standard cost where the product uses one, else the oldest open
+// lot's cost, else the product's last cost
+func (s *Service) EstimateUnitCost(ctx context.Context, orgID, branchID string, product models.Product) int64 {
+	if product.CostingMethod == models.CostingMethodMovingAverage && product.AverageCost > 0 {
+		return product.AverageCost
+	}
+	if IsStandard(product) {
+		return product.StandardCost
+	}
+	if lot, err := s.repo.FindOldestOpenLot(ctx, orgID, branchID, product.ID); err == nil {
+		return lot.UnitCost
+	}
+	return product.Cost
+}
+
 // MigrateToMovingAverage calculates initial average from existing FIFO lots
 // This should be called when switching a product from FIFO to Moving Average
 func (s *Service) MigrateToMovingAverage(ctx context.Context, orgID, branchID, productID string) (int64, error) {
@@ -0,0 +1,118 @@
+package costing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"stockflows/server/internal/models"
+)
+
+func TestCalculateMovingAverage(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldQty  int
+		oldAvg  int64
+		newQty  int
+		newCost int64
+		want    int64
+	}{
+		{"first receipt", 0, 0, 10, 1000, 1000},
+		{"weighted", 10, 1000, 10, 2000, 1500},
+		{"uneven", 30, 1000, 10, 2000, 1250},
+		{"nothing on hand afterwards", 0, 0, 0, 900, 900},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateMovingAverage(tt.oldQty, tt.oldAvg, tt.newQty, tt.newCost); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		basis  []int64
+		want   []int64
+	}{
+		{"proportional", 300, []int64{100, 200}, []int64{100, 200}},
+		{"largest remainder", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"negative", -300, []int64{100, 200}, []int64{-100, -200}},
+		{"even split without basis", 10, []int64{0, 0}, []int64{5, 5}},
+		{"nothing to split", 0, []int64{1, 2}, []int64{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Allocate(tt.amount, tt.basis)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func day(n int) time.Time { return time.Date(2026, 1, n, 0, 0, 0, 0, time.UTC) }
+
+func TestValueStock(t *testing.T) {
+	products := []models.Product{
+		{ID: "fifo", Cost: 500},
+		{ID: "avg", Cost: 500, AverageCost: 700, CostingMethod: models.CostingMethodMovingAverage},
+		{ID: "std", Cost: 500, StandardCost: 600, CostingMethod: models.CostingMethodStandard},
+	}
+	levels := []models.StockLevel{
+		{BranchID: "b1", ProductID: "fifo", Quantity: 12},
+		{BranchID: "b1", ProductID: "avg", Quantity: 10, AverageCost: 800},
+		{BranchID: "b1", ProductID: "std", Quantity: 5, ConsignedQty: 1},
+	}
+	lots := []models.InventoryLot{
+		{BranchID: "b1", ProductID: "fifo", QtyRemaining: 5, UnitCost: 100, ReceivedAt: day(1)},
+		{BranchID: "b1", ProductID: "fifo", QtyRemaining: 5, UnitCost: 200, ReceivedAt: day(2)},
+		{BranchID: "b1", ProductID: "fifo", QtyRemaining: 5, UnitCost: 300, ReceivedAt: day(3), OwnerID: "consignor"},
+		{BranchID: "b1", ProductID: "avg", QtyRemaining: 50, UnitCost: 100, ReceivedAt: day(1)},
+	}
+
+	got := make(map[string]ValuationLine)
+	for _, l := range ValueStock(products, levels, lots) {
+		got[l.ProductID] = l
+	}
+
+	// Newest owned lots first, the rest at last cost
+	if l := got["fifo"]; l.Value != 5*200+5*100+2*500 || l.UnlottedQty != 2 {
+		t.Errorf("fifo = %+v, want value 2500 with 2 unlotted", l)
+	}
+	// Branch average wins over the product's and ignores the lots
+	if l := got["avg"]; l.Value != 10*800 {
+		t.Errorf("moving average = %+v, want value 8000", l)
+	}
+	// Consigned units are not ours
+	if l := got["std"]; l.Quantity != 4 || l.Value != 4*600 {
+		t.Errorf("standard = %+v, want 4 units worth 2400", l)
+	}
+}
+
+func TestOnHandLots(t *testing.T) {
+	levels := []models.StockLevel{
+		{BranchID: "b1", ProductID: "p1", Quantity: 7},
+		{BranchID: "b2", ProductID: "p1", Quantity: 10, ConsignedQty: 10},
+	}
+	lots := []models.InventoryLot{
+		{ID: "old", BranchID: "b1", ProductID: "p1", QtyRemaining: 10, ReceivedAt: day(1)},
+		{ID: "mid", BranchID: "b1", ProductID: "p1", QtyRemaining: 4, ReceivedAt: day(2)},
+		{ID: "new", BranchID: "b1", ProductID: "p1", QtyRemaining: 2, ReceivedAt: day(3)},
+		{ID: "consigned", BranchID: "b1", ProductID: "p1", QtyRemaining: 5, ReceivedAt: day(4), OwnerID: "consignor"},
+		{ID: "b2", BranchID: "b2", ProductID: "p1", QtyRemaining: 3, ReceivedAt: day(1)},
+		{ID: "nolevel", BranchID: "b3", ProductID: "p1", QtyRemaining: 3, ReceivedAt: day(1)},
+	}
+
+	got := make(map[string]int)
+	for _, l := range OnHandLots(levels, lots) {
+		got[l.ID] = l.QtyRemaining
+	}
+	want := map[string]int{"new": 2, "mid": 4, "old": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
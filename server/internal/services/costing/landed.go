@@ -0,0 +1,223 @@
+package costing
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// AllocationBasis returns the weight of each purchase order line under an allocation method.
+// Lines whose basis is zero for the chosen method fall back to value so no line is skipped.
+func AllocationBasis(items []models.PurchaseOrderItem, products map[string]models.Product, method models.LandedCostMethod) []int64 {
+	basis := make([]int64, len(items))
+	var total int64
+	for i, it := range items {
+		switch method {
+		case models.LandedCostByQuantity:
+			basis[i] = int64(it.Quantity)
+		case models.LandedCostByWeight:
+			basis[i] = int64(it.Quantity) * int64(products[it.ProductID].WeightGram)
+		default:
+			basis[i] = int64(it.Quantity)*it.UnitCost - it.Discount
+		}
+		if basis[i] < 0 {
+			basis[i] = 0
+		}
+		total += basis[i]
+	}
+	if total == 0 && method != models.LandedCostByValue {
+		return AllocationBasis(items, products, models.LandedCostByValue)
+	}
+	return basis
+}
+
+// Allocate splits amount across lines in proportion to basis. Rounding uses the largest
+// remainder so the parts always add back up to amount. Amount may be negative (discounts).
+func Allocate(amount int64, basis []int64) []int64 {
+	out := make([]int64, len(basis))
+	if amount == 0 || len(basis) == 0 {
+		return out
+	}
+
+	var total int64
+	for _, b := range basis {
+		total += b
+	}
+	if total == 0 {
+		// Nothing to weigh by: split evenly.
+		basis = make([]int64, len(out))
+		for i := range basis {
+			basis[i] = 1
+		}
+		total = int64(len(basis))
+	}
+
+	sign := int64(1)
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+
+	type rem struct {
+		idx  int
+		frac float64
+	}
+	rems := make([]rem, len(basis))
+	var allocated int64
+	for i, b := range basis {
+		exact := float64(amount) * float64(b) / float64(total)
+		out[i] = int64(math.Floor(exact))
+		allocated += out[i]
+		rems[i] = rem{idx: i, frac: exact - float64(out[i])}
+	}
+	// Hand out the rounding leftovers to the largest fractional parts.
+	for left := amount - allocated; left > 0; left-- {
+		best := 0
+		for j := range rems {
+			if rems[j].frac > rems[best].frac {
+				best = j
+			}
+		}
+		out[rems[best].idx]++
+		rems[best].frac = -1
+	}
+
+	for i := range out {
+		out[i] *= sign
+	}
+	return out
+}
+
+// LandedLineCosts returns the total landed cost of each purchase order line: the line value
+// less its share of the order discount, plus its share of shipping and (unless recoverable) tax.
+// Discount and tax follow value; shipping follows the order's allocation method.
+func LandedLineCosts(po models.PurchaseOrder, products map[string]models.Product) []int64 {
+	valueBasis := AllocationBasis(po.Items, products, models.LandedCostByValue)
+	method := po.AllocationMethod
+	if method == "" {
+		method = models.LandedCostByValue
+	}
+	shippingBasis := AllocationBasis(po.Items, products, method)
+
+	var subtotal int64
+	for _, b := range valueBasis {
+		subtotal += b
+	}
+
+	discounts := Allocate(po.DiscountAmount, valueBasis)
+	shipping := Allocate(po.ShippingCost, shippingBasis)
+	tax := make([]int64, len(po.Items))
+	if !po.TaxRecoverable && po.Tax != nil {
+		// Line-level input VAT already carries each line's share of the discount.
+		for i, it := range po.Items {
+			tax[i] = it.TaxAmount
+		}
+	} else if !po.TaxRecoverable && po.TaxRate > 0 {
+		// Same formula the purchase order totals use (rate stored as a percentage).
+		taxAmount := int64(float64(subtotal-po.DiscountAmount) * (po.TaxRate / 100))
+		tax = Allocate(taxAmount, valueBasis)
+	}
+
+	out := make([]int64, len(po.Items))
+	for i := range po.Items {
+		out[i] = valueBasis[i] - discounts[i] + shipping[i] + tax[i]
+		if out[i] < 0 {
+			out[i] = 0
+		}
+	}
+	return out
+}
+
+// UnitCostOf divides a line total by quantity, rounding to the nearest unit
+func UnitCostOf(lineTotal int64, qty int) int64 {
+	if qty <= 0 {
+		return 0
+	}
+	return int64(math.Round(float64(lineTotal) / float64(qty)))
+}
+
+// ApplyLandedCost books one purchase order line's share of a cost attached after receipt.
+// For standard costed products it is recorded as purchase price variance. Otherwise the
+// part belonging to units still on hand is added to the receipt's lots (and to the moving
+// average for MA products); the part belonging to units already sold is returned as a
+// COGS adjustment. A failure leaves the line as it was; a negative amount reverses a share
+// booked earlier.
+func (s *Service) ApplyLandedCost(ctx context.Context, orgID string, po models.PurchaseOrder, item models.PurchaseOrderItem, product models.Product, amount int64) (models.LandedCostAllocation, error) {
+	out := models.LandedCostAllocation{ProductID: item.ProductID, Amount: amount}
+	if amount == 0 || item.Quantity <= 0 {
+		return out, nil
+	}
+
+	// Standard costed stock stays at standard; the whole share is purchase price variance.
+	if IsStandard(product) {
+		return out, s.RecordPurchaseVariance(ctx, orgID, po, item, product, amount, "Landed cost after receipt")
+	}
+
+	lots, _, err := s.repo.ListInventoryLotsByOrg(ctx, orgID, bson.M{
+		"purchaseOrderId": po.ID,
+		"productId":       item.ProductID,
+	}, 1, 1000)
+	if err != nil {
+		return out, err
+	}
+
+	perUnit := UnitCostOf(amount, item.Quantity)
+	restoreAverage := func() {}
+
+	if product.CostingMethod == models.CostingMethodMovingAverage {
+		// Moving average does not consume lots, so what is left of the receipt is
+		// at most what the branch still holds.
+		sl, err := s.repo.GetStockLevel(ctx, orgID, po.BranchID, item.ProductID)
+		if err != nil && !errors.Is(err, repo.ErrNotFound) {
+			return out, err
+		}
+		remaining := item.Quantity
+		if sl.Quantity < remaining {
+			remaining = sl.Quantity
+		}
+		if remaining > 0 {
+			out.RevaluedAmount = perUnit * int64(remaining)
+			avg := product.AverageCost
+			if sl.AverageCost > 0 {
+				avg = sl.AverageCost
+			}
+			newAvg := avg + UnitCostOf(out.RevaluedAmount, sl.Quantity)
+			if _, err := s.repo.UpdateProductByOrg(ctx, orgID, item.ProductID, bson.M{"averageCost": newAvg}); err != nil {
+				return out, err
+			}
+			if _, err := s.repo.PatchStockLevel(ctx, orgID, po.BranchID, item.ProductID, bson.M{"averageCost": newAvg}); err != nil {
+				_, _ = s.repo.UpdateProductByOrg(ctx, orgID, item.ProductID, bson.M{"averageCost": product.AverageCost})
+				return out, err
+			}
+			restoreAverage = func() {
+				_, _ = s.repo.UpdateProductByOrg(ctx, orgID, item.ProductID, bson.M{"averageCost": product.AverageCost})
+				_, _ = s.repo.PatchStockLevel(ctx, orgID, po.BranchID, item.ProductID, bson.M{"averageCost": sl.AverageCost})
+			}
+		}
+	} else {
+		for _, l := range lots {
+			if l.QtyRemaining <= 0 {
+				continue
+			}
+			out.RevaluedAmount += perUnit * int64(l.QtyRemaining)
+		}
+	}
+
+	// Lots carry the full landed cost either way, so later reports see the same figure.
+	for i, l := range lots {
+		if _, err := s.repo.UpdateInventoryLot(ctx, orgID, l.ID, bson.M{"unitCost": l.UnitCost + perUnit}); err != nil {
+			for _, done := range lots[:i] {
+				_, _ = s.repo.UpdateInventoryLot(ctx, orgID, done.ID, bson.M{"unitCost": done.UnitCost})
+			}
+			restoreAverage()
+			return out, err
+		}
+	}
+
+	out.COGSAdjustment = amount - out.RevaluedAmount
+	return out, nil
+}
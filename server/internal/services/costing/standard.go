@@ -0,0 +1,252 @@
+package costing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"stockflows/server/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IsStandard reports whether a product is valued at a standard cost
+func IsStandard(p models.Product) bool {
+	return p.CostingMethod == models.CostingMethodStandard && p.StandardCost > 0
+}
+
+// computeStandardCOGS consumes lots in FIFO order so quantities stay in step, but prices
+// owned stock at the standard. Consigned lots keep the cost agreed with the consignor.
+func (s *Service) computeStandardCOGS(ctx context.Context, orgID, branchID string, product models.Product, qty int) (COGSResult, error) {
+	if product.StandardCost <= 0 {
+		return s.computeFIFOCOGS(ctx, orgID, branchID, product.ID, qty)
+	}
+
+	lines, _, err := s.repo.ConsumeLotsFIFO(ctx, orgID, branchID, product.ID, qty)
+	if err != nil {
+		return COGSResult{}, err
+	}
+
+	var cogs int64
+	for i := range lines {
+		if lines[i].OwnerID == "" {
+			lines[i].UnitCost = product.StandardCost
+			lines[i].Amount = product.StandardCost * int64(lines[i].Quantity)
+		}
+		cogs += lines[i].Amount
+	}
+
+	return COGSResult{
+		CostLines: lines,
+		TotalCOGS: cogs,
+		UnitCost:  cogs / int64(qty),
+	}, nil
+}
+
+// ReceiveAtStandard returns the unit cost a receipt should be booked at. Standard costed
+// products are booked at standard and the difference to the actual cost is recorded as
+// purchase price variance; other products are booked at actual cost. The ID of any
+// variance recorded is returned so callers can remove it if the receipt is rolled back.
+func (s *Service) ReceiveAtStandard(ctx context.Context, orgID string, po models.PurchaseOrder, product models.Product, qty int, actualUnitCost int64, userID string) (int64, string, error) {
+	if !IsStandard(product) {
+		return actualUnitCost, "", nil
+	}
+	if actualUnitCost == product.StandardCost {
+		return product.StandardCost, "", nil
+	}
+	v, err := s.repo.CreateCostVariance(ctx, models.CostVariance{
+		ID:              "VAR-" + primitive.NewObjectID().Hex(),
+		OrgID:           orgID,
+		BranchID:        po.BranchID,
+		ProductID:       product.ID,
+		Type:            models.CostVariancePurchasePrice,
+		SupplierID:      po.SupplierID,
+		PurchaseOrderID: po.ID,
+		ReferenceNo:     po.ReferenceNo,
+		Quantity:        qty,
+		StandardCost:    product.StandardCost,
+		ActualCost:      actualUnitCost,
+		Amount:          (actualUnitCost - product.StandardCost) * int64(qty),
+		CreatedBy:       userID,
+	})
+	if err != nil {
+		return product.StandardCost, "", err
+	}
+	return product.StandardCost, v.ID, nil
+}
+
+// RecordPurchaseVariance books an amount that arrived after receipt (e.g. a freight invoice)
+// straight to purchase price variance, leaving standard costed stock at standard.
+func (s *Service) RecordPurchaseVariance(ctx context.Context, orgID string, po models.PurchaseOrder, item models.PurchaseOrderItem, product models.Product, amount int64, notes string) error {
+	_, err := s.repo.CreateCostVariance(ctx, models.CostVariance{
+		ID:              "VAR-" + primitive.NewObjectID().Hex(),
+		OrgID:           orgID,
+		BranchID:        po.BranchID,
+		ProductID:       product.ID,
+		Type:            models.CostVariancePurchasePrice,
+		SupplierID:      po.SupplierID,
+		PurchaseOrderID: po.ID,
+		ReferenceNo:     po.ReferenceNo,
+		Quantity:        item.Quantity,
+		StandardCost:    product.StandardCost,
+		ActualCost:      product.StandardCost + UnitCostOf(amount, item.Quantity),
+		Amount:          amount,
+		Notes:           notes,
+	})
+	return err
+}
+
+// currentUnitValue is what one owned unit at a branch is carried at before a standard change
+func (s *Service) currentUnitValue(product models.Product, sl models.StockLevel, lots []models.InventoryLot) int64 {
+	switch product.CostingMethod {
+	case models.CostingMethodStandard:
+		if product.StandardCost > 0 {
+			return product.StandardCost
+		}
+	case models.CostingMethodMovingAverage:
+		if sl.AverageCost > 0 {
+			return sl.AverageCost
+		}
+		if product.AverageCost > 0 {
+			return product.AverageCost
+		}
+	}
+
+	var value int64
+	var qty int
+	for _, l := range lots {
+		value += int64(l.QtyRemaining) * l.UnitCost
+		qty += l.QtyRemaining
+	}
+	if qty > 0 {
+		return value / int64(qty)
+	}
+	return product.Cost
+}
+
+// SetStandardCost moves a product to standard costing at newCost. Owned stock on hand in every
+// branch is revalued to the new standard and a revaluation entry is recorded per branch. The
+// product is switched first so sales costed meanwhile already use the standard; if any branch
+// fails, every change is undone and the product keeps its old costing. Moving average stock
+// never consumed its lots, so its lots are replaced by one lot per branch holding what is on hand.
+func (s *Service) SetStandardCost(ctx context.Context, orgID string, product models.Product, newCost int64, userID, notes string) ([]models.CostVariance, error) {
+	if newCost <= 0 {
+		return nil, errors.New("standard cost must be positive")
+	}
+
+	levels, err := s.repo.ListStockLevelsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.UpdateProductByOrg(ctx, orgID, product.ID, bson.M{
+		"costingMethod": models.CostingMethodStandard,
+		"standardCost":  newCost,
+	}); err != nil {
+		return nil, err
+	}
+
+	type lotChange struct {
+		id      string
+		restore bson.M
+	}
+	var changed []lotChange
+	var createdLots []string
+	entries := make([]models.CostVariance, 0)
+	undo := func() {
+		for _, v := range entries {
+			_ = s.repo.DeleteCostVarianceByOrg(ctx, orgID, v.ID)
+		}
+		for _, id := range createdLots {
+			_ = s.repo.DeleteInventoryLot(ctx, id)
+		}
+		for _, l := range changed {
+			_, _ = s.repo.UpdateInventoryLot(ctx, orgID, l.id, l.restore)
+		}
+		_, _ = s.repo.UpdateProductByOrg(ctx, orgID, product.ID, bson.M{
+			"costingMethod": product.CostingMethod,
+			"standardCost":  product.StandardCost,
+		})
+	}
+
+	at := time.Now().UTC()
+	for _, sl := range levels {
+		if sl.ProductID != product.ID {
+			continue
+		}
+
+		lots, _, err := s.repo.ListInventoryLotsByOrg(ctx, orgID, bson.M{
+			"branchId":     sl.BranchID,
+			"productId":    product.ID,
+			"qtyRemaining": bson.M{"$gt": 0},
+			"ownerId":      bson.M{"$in": bson.A{nil, ""}},
+		}, 1, 10000)
+		if err != nil {
+			undo()
+			return nil, err
+		}
+
+		oldCost := s.currentUnitValue(product, sl, lots)
+		onHand := sl.Quantity - sl.ConsignedQty
+		if product.CostingMethod == models.CostingMethodMovingAverage {
+			for _, l := range lots {
+				if _, err := s.repo.UpdateInventoryLot(ctx, orgID, l.ID, bson.M{"qtyRemaining": 0}); err != nil {
+					undo()
+					return nil, err
+				}
+				changed = append(changed, lotChange{id: l.ID, restore: bson.M{"qtyRemaining": l.QtyRemaining}})
+			}
+			if onHand > 0 {
+				lot, err := s.repo.CreateInventoryLot(ctx, models.InventoryLot{
+					ID:           primitive.NewObjectID().Hex(),
+					OrgID:        orgID,
+					BranchID:     sl.BranchID,
+					ProductID:    product.ID,
+					Source:       "ADJUSTMENT",
+					UnitCost:     newCost,
+					QtyReceived:  onHand,
+					QtyRemaining: onHand,
+					ReceivedAt:   at,
+				})
+				if err != nil {
+					undo()
+					return nil, err
+				}
+				createdLots = append(createdLots, lot.ID)
+			}
+		} else {
+			for _, l := range lots {
+				if _, err := s.repo.UpdateInventoryLot(ctx, orgID, l.ID, bson.M{"unitCost": newCost}); err != nil {
+					undo()
+					return nil, err
+				}
+				changed = append(changed, lotChange{id: l.ID, restore: bson.M{"unitCost": l.UnitCost}})
+			}
+		}
+
+		if onHand <= 0 || oldCost == newCost {
+			continue
+		}
+		v, err := s.repo.CreateCostVariance(ctx, models.CostVariance{
+			ID:           "VAR-" + primitive.NewObjectID().Hex(),
+			OrgID:        orgID,
+			BranchID:     sl.BranchID,
+			ProductID:    product.ID,
+			Type:         models.CostVarianceRevaluation,
+			Quantity:     onHand,
+			StandardCost: oldCost,
+			ActualCost:   newCost,
+			Amount:       (newCost - oldCost) * int64(onHand),
+			Notes:        notes,
+			CreatedBy:    userID,
+			CreatedAt:    at,
+		})
+		if err != nil {
+			undo()
+			return nil, err
+		}
+		entries = append(entries, v)
+	}
+	return entries, nil
+}
@@ -0,0 +1,164 @@
+package costing
+
+import (
+	"context"
+	"sort"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ValuationLine is the value of one product's owned stock at one branch
+type ValuationLine struct {
+	BranchID    string               `json:"branchId"`
+	ProductID   string               `json:"productId"`
+	ProductName string               `json:"productName"`
+	SKU         string               `json:"sku"`
+	Category    string               `json:"category"`
+	Method      models.CostingMethod `json:"method"`
+
+	Quantity    int   `json:"quantity"`              // Owned units; consigned stock is excluded
+	UnlottedQty int   `json:"unlottedQty,omitempty"` // FIFO units without an open lot, valued at last cost
+	UnitCost    int64 `json:"unitCost"`              // Value / Quantity
+	Value       int64 `json:"value"`
+
+	LastCost      int64 `json:"lastCost"`
+	LastCostValue int64 `json:"lastCostValue"` // Quantity * Product.Cost, the old estimate
+	Difference    int64 `json:"difference"`    // Value - LastCostValue
+}
+
+// ValueStock values owned stock per branch and product according to each product's
+// costing method: open lots for FIFO, the branch average for moving average and the
+// standard for standard cost. lots must be the org's open, owned lots.
+func ValueStock(products []models.Product, levels []models.StockLevel, lots []models.InventoryLot) []ValuationLine {
+	productMap := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+
+	// Newest lots first: FIFO consumes the oldest, so what is on hand is the newest.
+	byLevel := make(map[string][]models.InventoryLot)
+	for _, l := range lots {
+		if l.QtyRemaining <= 0 || l.OwnerID != "" {
+			continue
+		}
+		key := repo.StockLevelID(l.BranchID, l.ProductID)
+		byLevel[key] = append(byLevel[key], l)
+	}
+	for key := range byLevel {
+		ls := byLevel[key]
+		sort.SliceStable(ls, func(i, j int) bool { return ls[i].ReceivedAt.After(ls[j].ReceivedAt) })
+	}
+
+	out := make([]ValuationLine, 0, len(levels))
+	for _, sl := range levels {
+		p, ok := productMap[sl.ProductID]
+		if !ok {
+			continue
+		}
+		qty := sl.Quantity - sl.ConsignedQty
+		if qty <= 0 {
+			continue
+		}
+
+		method := p.CostingMethod
+		if method == "" {
+			method = models.CostingMethodFIFO
+		}
+		line := ValuationLine{
+			BranchID:    sl.BranchID,
+			ProductID:   p.ID,
+			ProductName: p.Name,
+			SKU:         p.SKU,
+			Category:    p.Category,
+			Method:      method,
+			Quantity:    qty,
+			LastCost:    p.Cost,
+		}
+
+		switch method {
+		case models.CostingMethodMovingAverage:
+			avg := sl.AverageCost
+			if avg == 0 {
+				avg = p.AverageCost
+			}
+			if avg == 0 {
+				avg = p.Cost
+			}
+			line.Value = avg * int64(qty)
+		case models.CostingMethodStandard:
+			cost := p.StandardCost
+			if cost == 0 {
+				cost = p.Cost
+			}
+			line.Value = cost * int64(qty)
+		default:
+			left := qty
+			for _, l := range byLevel[repo.StockLevelID(sl.BranchID, sl.ProductID)] {
+				if left == 0 {
+					break
+				}
+				take := l.QtyRemaining
+				if take > left {
+					take = left
+				}
+				line.Value += int64(take) * l.UnitCost
+				left -= take
+			}
+			line.UnlottedQty = left
+			line.Value += int64(left) * p.Cost
+		}
+
+		line.UnitCost = line.Value / int64(qty)
+		line.LastCostValue = p.Cost * int64(qty)
+		line.Difference = line.Value - line.LastCostValue
+		out = append(out, line)
+	}
+	return out
+}
+
+// OnHandLots trims open, owned lots to the owned stock on hand at their branch, keeping
+// the newest lots since stock leaves oldest first. Moving average and standard cost sales
+// do not draw lots down, so their lots are only right once capped like this.
+func OnHandLots(levels []models.StockLevel, lots []models.InventoryLot) []models.InventoryLot {
+	byLevel := make(map[string][]models.InventoryLot)
+	for _, l := range lots {
+		if l.QtyRemaining <= 0 || l.OwnerID != "" {
+			continue
+		}
+		key := repo.StockLevelID(l.BranchID, l.ProductID)
+		byLevel[key] = append(byLevel[key], l)
+	}
+
+	out := make([]models.InventoryLot, 0, len(lots))
+	for _, sl := range levels {
+		ls := byLevel[repo.StockLevelID(sl.BranchID, sl.ProductID)]
+		sort.SliceStable(ls, func(i, j int) bool { return ls[i].ReceivedAt.After(ls[j].ReceivedAt) })
+		left := sl.Quantity - sl.ConsignedQty
+		for _, l := range ls {
+			if left <= 0 {
+				break
+			}
+			if l.QtyRemaining > left {
+				l.QtyRemaining = left
+			}
+			left -= l.QtyRemaining
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Valuation loads stock and open lots and values them with ValueStock
+func (s *Service) Valuation(ctx context.Context, orgID string, products []models.Product, levels []models.StockLevel) ([]ValuationLine, error) {
+	lots, _, err := s.repo.ListInventoryLotsByOrg(ctx, orgID, bson.M{
+		"qtyRemaining": bson.M{"$gt": 0},
+		"ownerId":      bson.M{"$in": bson.A{nil, ""}},
+	}, 1, 1000000)
+	if err != nil {
+		return nil, err
+	}
+	return ValueStock(products, levels, lots), nil
+}
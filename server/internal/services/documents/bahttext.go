@@ -0,0 +1,72 @@
+package documents
+
+import "strings"
+
+var (
+	thaiDigits = [...]string{"ศูนย์", "หนึ่ง", "สอง", "สาม", "สี่", "ห้า", "หก", "เจ็ด", "แปด", "เก้า"}
+	thaiPlaces = [...]string{"", "สิบ", "ร้อย", "พัน", "หมื่น", "แสน"}
+)
+
+// BahtText spells out an amount in satang the way Thai tax documents print totals,
+// e.g. 152550 is "หนึ่งพันห้าร้อยยี่สิบห้าบาทห้าสิบสตางค์"
+func BahtText(v int64) string {
+	var b strings.Builder
+	if v < 0 {
+		b.WriteString("ลบ")
+		v = -v
+	}
+	baht, satang := v/100, v%100
+	if baht > 0 || satang == 0 {
+		b.WriteString(thaiNumber(baht))
+		b.WriteString("บาท")
+	}
+	if satang == 0 {
+		b.WriteString("ถ้วน")
+	} else {
+		b.WriteString(thaiNumber(satang))
+		b.WriteString("สตางค์")
+	}
+	return b.String()
+}
+
+// thaiNumber reads a whole number in Thai
+func thaiNumber(n int64) string {
+	if n == 0 {
+		return thaiDigits[0]
+	}
+	if n >= 1000000 {
+		out := thaiNumber(n/1000000) + "ล้าน"
+		if rest := n % 1000000; rest > 0 {
+			out += belowMillion(rest, true)
+		}
+		return out
+	}
+	return belowMillion(n, false)
+}
+
+// belowMillion reads 1..999999; a trailing one is "เอ็ด" after any higher digit
+func belowMillion(n int64, afterMillion bool) string {
+	var b strings.Builder
+	for place := 5; place >= 0; place-- {
+		div := int64(1)
+		for i := 0; i < place; i++ {
+			div *= 10
+		}
+		d := (n / div) % 10
+		if d == 0 {
+			continue
+		}
+		switch {
+		case place == 1 && d == 1:
+			b.WriteString("สิบ")
+		case place == 1 && d == 2:
+			b.WriteString("ยี่สิบ")
+		case place == 0 && d == 1 && (n >= 10 || afterMillion):
+			b.WriteString("เอ็ด")
+		default:
+			b.WriteString(thaiDigits[d])
+			b.WriteString(thaiPlaces[place])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,456 @@
+package documents
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"stockflows/server/internal/appconfig"
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/platform/pdf"
+	"stockflows/server/platform/storage/minio"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrStorageNotConfigured = errors.New("document storage not configured")
+	ErrNotVATRegistered     = errors.New("org is not VAT registered")
+	ErrSellerTaxID          = errors.New("org tax ID is required for tax invoices")
+	ErrBuyerRequired        = errors.New("buyer name and address are required for tax invoices")
+	ErrNotIssuable          = errors.New("document cannot be issued in the current status")
+	ErrPending              = errors.New("document is still being issued")
+)
+
+const contentType = "application/pdf"
+
+// Service renders business documents to PDF, numbers them and stores them in MinIO
+type Service struct {
+	repo   *repo.Repo
+	store  *minio.Client
+	config appconfig.Config
+}
+
+// New creates a new documents service
+func New(r *repo.Repo, store *minio.Client, cfg appconfig.Config) *Service {
+	return &Service{repo: r, store: store, config: cfg}
+}
+
+// numberPrefix per document type; purchase orders print their own reference number
+var numberPrefix = map[models.DocumentType]string{
+	models.DocumentTaxInvoice: "INV",
+	models.DocumentReceipt:    "RC",
+	models.DocumentCreditNote: "CN",
+}
+
+// ForOrder issues a tax invoice, receipt or (for refunded orders) credit note for a
+// confirmed sale. A document already issued is returned as is with created false, so
+// reprints keep their number. buyer overrides the customer's details on a tax invoice.
+func (s *Service) ForOrder(ctx context.Context, u models.User, txn models.Transaction, typ models.DocumentType, buyer *models.DocumentParty) (models.Document, bool, error) {
+	if existing, err := s.repo.FindDocumentBySource(ctx, txn.OrgID, models.DocumentSourceOrder, txn.ID, typ); err == nil && existing.Status != models.DocumentPending {
+		return existing, false, nil
+	} else if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return models.Document{}, false, err
+	}
+	if !s.available() {
+		return models.Document{}, false, ErrStorageNotConfigured
+	}
+
+	status := strings.ToUpper(txn.Status)
+	if strings.ToUpper(txn.Type) != "SALE" || status == "DRAFT" || status == "PENDING" || status == "CANCELLED" {
+		return models.Document{}, false, ErrNotIssuable
+	}
+	if typ == models.DocumentCreditNote && status != "REFUNDED" {
+		return models.Document{}, false, ErrNotIssuable
+	}
+
+	org, err := s.repo.GetOrg(ctx, txn.OrgID)
+	if err != nil {
+		return models.Document{}, false, err
+	}
+	seller := s.seller(ctx, org, txn.BranchID)
+
+	if typ == models.DocumentTaxInvoice {
+		if !org.Settings.Tax.VATRegistered {
+			return models.Document{}, false, ErrNotVATRegistered
+		}
+		if strings.TrimSpace(org.TaxID) == "" {
+			return models.Document{}, false, ErrSellerTaxID
+		}
+		buyer = s.orderBuyer(ctx, txn, buyer)
+		if buyer == nil || buyer.Name == "" || buyer.Address == "" {
+			return models.Document{}, false, ErrBuyerRequired
+		}
+	} else {
+		buyer = s.orderBuyer(ctx, txn, buyer)
+		if buyer != nil && buyer.Name == "" {
+			buyer = nil
+		}
+	}
+
+	doc := models.Document{
+		ID:         "DOC-" + primitive.NewObjectID().Hex(),
+		OrgID:      txn.OrgID,
+		BranchID:   txn.BranchID,
+		Type:       typ,
+		SourceType: models.DocumentSourceOrder,
+		SourceID:   txn.ID,
+		SourceRef:  txn.ID,
+		Party:      buyer,
+		Total:      txn.Total,
+		Tax:        txn.Tax,
+		IssuedBy:   u.ID,
+		IssuedAt:   time.Now().UTC(),
+	}
+	if typ == models.DocumentCreditNote {
+		doc.RefersTo = s.invoiceNumber(ctx, txn)
+	}
+
+	return s.issueNumbered(ctx, doc, func(d models.Document) sheet {
+		return orderSheet(d, seller, txn, org.Settings.Tax.VATRegistered)
+	})
+}
+
+// ForReturn issues the credit note for a received customer return, referring to the
+// original sale's tax invoice or receipt
+func (s *Service) ForReturn(ctx context.Context, u models.User, ret models.Return) (models.Document, bool, error) {
+	if existing, err := s.repo.FindDocumentBySource(ctx, ret.OrgID, models.DocumentSourceReturn, ret.ID, models.DocumentCreditNote); err == nil && existing.Status != models.DocumentPending {
+		return existing, false, nil
+	} else if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return models.Document{}, false, err
+	}
+	if !s.available() {
+		return models.Document{}, false, ErrStorageNotConfigured
+	}
+	if ret.Type != models.ReturnTypeCustomer ||
+		(ret.Status != models.ReturnStatusReceived && ret.Status != models.ReturnStatusCompleted) {
+		return models.Document{}, false, ErrNotIssuable
+	}
+
+	org, err := s.repo.GetOrg(ctx, ret.OrgID)
+	if err != nil {
+		return models.Document{}, false, err
+	}
+	txn, err := s.repo.GetTransactionByOrg(ctx, ret.OrgID, ret.OriginalOrderID)
+	if err != nil {
+		return models.Document{}, false, err
+	}
+
+	doc := models.Document{
+		ID:         "DOC-" + primitive.NewObjectID().Hex(),
+		OrgID:      ret.OrgID,
+		BranchID:   ret.BranchID,
+		Type:       models.DocumentCreditNote,
+		SourceType: models.DocumentSourceReturn,
+		SourceID:   ret.ID,
+		SourceRef:  ret.ReferenceNo,
+		RefersTo:   s.invoiceNumber(ctx, txn),
+		Party:      s.orderBuyer(ctx, txn, nil),
+		Total:      creditTotal(ret),
+		Tax:        ret.Tax,
+		IssuedBy:   u.ID,
+		IssuedAt:   time.Now().UTC(),
+	}
+	if doc.Party != nil && doc.Party.Name == "" {
+		doc.Party = nil
+	}
+
+	seller := s.seller(ctx, org, ret.BranchID)
+	return s.issueNumbered(ctx, doc, func(d models.Document) sheet {
+		return returnSheet(d, seller, ret, txn)
+	})
+}
+
+// ForPurchaseOrder renders the purchase order sent to the supplier. Unlike tax documents
+// it is re-rendered on every call so edits to an open order show up; the number is the
+// order's reference number.
+func (s *Service) ForPurchaseOrder(ctx context.Context, u models.User, po models.PurchaseOrder) (models.Document, error) {
+	if !s.available() {
+		return models.Document{}, ErrStorageNotConfigured
+	}
+	if po.Status == "CANCELLED" {
+		return models.Document{}, ErrNotIssuable
+	}
+	org, err := s.repo.GetOrg(ctx, po.OrgID)
+	if err != nil {
+		return models.Document{}, err
+	}
+	supplier, _ := s.repo.GetSupplierByOrg(ctx, po.OrgID, po.SupplierID)
+
+	doc, err := s.repo.FindDocumentBySource(ctx, po.OrgID, models.DocumentSourcePurchaseOrder, po.ID, models.DocumentPurchaseOrder)
+	existing := err == nil
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return models.Document{}, err
+	}
+	if !existing {
+		doc = models.Document{
+			ID:         "DOC-" + primitive.NewObjectID().Hex(),
+			OrgID:      po.OrgID,
+			BranchID:   po.BranchID,
+			Type:       models.DocumentPurchaseOrder,
+			SourceType: models.DocumentSourcePurchaseOrder,
+			SourceID:   po.ID,
+		}
+	}
+	doc.Number = po.ReferenceNo
+	doc.SourceRef = po.ReferenceNo
+	doc.Party = &models.DocumentParty{
+		Name:    supplier.Name,
+		TaxID:   supplier.TaxID,
+		Address: supplier.Address,
+		Phone:   supplier.Phone,
+	}
+	doc.Total = purchaseOrderTotal(po)
+	doc.Tax = po.Tax
+	doc.IssuedBy = u.ID
+	doc.IssuedAt = time.Now().UTC()
+
+	sh := purchaseOrderSheet(doc, s.seller(ctx, org, po.BranchID), po)
+	if !existing {
+		return s.issue(ctx, doc, sh)
+	}
+
+	data, err := s.render(sh)
+	if err != nil {
+		return models.Document{}, err
+	}
+	if err := s.put(ctx, doc.ObjectKey, data); err != nil {
+		return models.Document{}, err
+	}
+	return s.repo.UpdateDocumentByOrg(ctx, po.OrgID, doc.ID, bson.M{
+		"number":    doc.Number,
+		"sourceRef": doc.SourceRef,
+		"party":     doc.Party,
+		"total":     doc.Total,
+		"tax":       doc.Tax,
+		"size":      int64(len(data)),
+		"issuedBy":  doc.IssuedBy,
+		"issuedAt":  doc.IssuedAt,
+	})
+}
+
+// Open streams a stored document's PDF
+func (s *Service) Open(ctx context.Context, doc models.Document) (io.ReadCloser, error) {
+	if !s.available() {
+		return nil, ErrStorageNotConfigured
+	}
+	if doc.Status == models.DocumentPending {
+		return nil, ErrPending
+	}
+	return s.store.GetObject(ctx, s.config.MinIO.Bucket, doc.ObjectKey)
+}
+
+func (s *Service) available() bool {
+	return s.store != nil && strings.TrimSpace(s.config.MinIO.Endpoint) != ""
+}
+
+// next allocates the next number for a document type
+func (s *Service) next(ctx context.Context, orgID string, typ models.DocumentType) (string, error) {
+	seq, err := s.repo.NextCounter(ctx, "doc:"+string(typ)+":"+orgID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%06d", numberPrefix[typ], seq), nil
+}
+
+// issueNumbered issues a sequentially numbered tax document at most once per source. The
+// source is claimed by a pending document before a number is taken, and the number stays
+// on that document until its PDF is stored, so a failed render or upload is retried under
+// the same number instead of leaving a gap in the sequence. A concurrent request for the
+// same source finishes the pending document rather than issuing a second one.
+func (s *Service) issueNumbered(ctx context.Context, doc models.Document, sheetFor func(models.Document) sheet) (models.Document, bool, error) {
+	doc.Status = models.DocumentPending
+	doc.ObjectKey = doc.OrgID + "/documents/" + doc.ID + ".pdf"
+	doc.ContentType = contentType
+	claimed, err := s.repo.CreateDocument(ctx, doc)
+	if errors.Is(err, repo.ErrConflict) {
+		claimed, err = s.repo.FindDocumentBySource(ctx, doc.OrgID, doc.SourceType, doc.SourceID, doc.Type)
+		if err == nil && claimed.Status != models.DocumentPending {
+			return claimed, false, nil
+		}
+	}
+	if err != nil {
+		return models.Document{}, false, err
+	}
+
+	if claimed.Number == "" {
+		number, err := s.next(ctx, claimed.OrgID, claimed.Type)
+		if err != nil {
+			return models.Document{}, false, err
+		}
+		if claimed, err = s.repo.UpdateDocumentByOrg(ctx, claimed.OrgID, claimed.ID, bson.M{"number": number}); err != nil {
+			return models.Document{}, false, err
+		}
+	}
+
+	data, err := s.render(sheetFor(claimed))
+	if err != nil {
+		return models.Document{}, false, err
+	}
+	if err := s.put(ctx, claimed.ObjectKey, data); err != nil {
+		return models.Document{}, false, err
+	}
+	issued, err := s.repo.UpdateDocumentByOrg(ctx, claimed.OrgID, claimed.ID, bson.M{
+		"status": models.DocumentIssued,
+		"size":   int64(len(data)),
+	})
+	if err != nil {
+		return models.Document{}, false, err
+	}
+	_ = s.repo.LinkDocument(ctx, issued.OrgID, issued.SourceType, issued.SourceID, models.DocumentRef{ID: issued.ID, Type: issued.Type, Number: issued.Number})
+	return issued, true, nil
+}
+
+// issue renders and uploads a new document, saves it and links it from its source
+func (s *Service) issue(ctx context.Context, doc models.Document, sh sheet) (models.Document, error) {
+	data, err := s.render(sh)
+	if err != nil {
+		return models.Document{}, err
+	}
+	doc.ObjectKey = doc.OrgID + "/documents/" + doc.ID + ".pdf"
+	doc.ContentType = contentType
+	doc.Size = int64(len(data))
+	doc.Status = models.DocumentIssued
+	if err := s.put(ctx, doc.ObjectKey, data); err != nil {
+		return models.Document{}, err
+	}
+	doc, err = s.repo.CreateDocument(ctx, doc)
+	if err != nil {
+		return models.Document{}, err
+	}
+	_ = s.repo.LinkDocument(ctx, doc.OrgID, doc.SourceType, doc.SourceID, models.DocumentRef{ID: doc.ID, Type: doc.Type, Number: doc.Number})
+	return doc, nil
+}
+
+func (s *Service) put(ctx context.Context, key string, data []byte) error {
+	_, err := s.store.PutObject(ctx, s.config.MinIO.Bucket, key, bytes.NewReader(data), int64(len(data)), contentType)
+	return err
+}
+
+func (s *Service) render(sh sheet) ([]byte, error) {
+	regular, bold, err := Fonts(s.config.Documents)
+	if err != nil {
+		return nil, err
+	}
+	return render(sh, regular, bold), nil
+}
+
+// fonts caches the configured fonts
+var fonts struct {
+	sync.Mutex
+	key           string
+	regular, bold *pdf.Font
+}
+
+// Fonts returns the configured document fonts, parsed once per path. Both are nil when
+// no font is configured and documents fall back to Helvetica.
+func Fonts(cfg appconfig.DocumentsConfig) (*pdf.Font, *pdf.Font, error) {
+	if strings.TrimSpace(cfg.FontPath) == "" {
+		return nil, nil, nil
+	}
+	fonts.Lock()
+	defer fonts.Unlock()
+	key := cfg.FontPath + "|" + cfg.BoldFontPath
+	if fonts.key == key {
+		return fonts.regular, fonts.bold, nil
+	}
+	regular, err := pdf.LoadFont(cfg.FontPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load document font: %w", err)
+	}
+	var bold *pdf.Font
+	if strings.TrimSpace(cfg.BoldFontPath) != "" {
+		if bold, err = pdf.LoadFont(cfg.BoldFontPath); err != nil {
+			return nil, nil, fmt.Errorf("load document bold font: %w", err)
+		}
+	}
+	fonts.key, fonts.regular, fonts.bold = key, regular, bold
+	return regular, bold, nil
+}
+
+// seller is the org as printed on its documents, with the issuing branch
+func (s *Service) seller(ctx context.Context, org models.Organization, branchID string) models.DocumentParty {
+	p := models.DocumentParty{Name: org.Name, TaxID: org.TaxID, Address: org.Address}
+	if branchID == "" {
+		return p
+	}
+	b, err := s.repo.GetBranchByOrg(ctx, org.ID, branchID)
+	if err != nil {
+		return p
+	}
+	if b.IsMain {
+		p.TaxBranch = "สำนักงานใหญ่ (Head office)"
+	} else {
+		p.TaxBranch = "สาขา (Branch) " + b.Name
+		if b.Address != "" {
+			p.Address = b.Address
+		}
+	}
+	return p
+}
+
+// orderBuyer fills the buyer from the order's customer; fields given in override win
+func (s *Service) orderBuyer(ctx context.Context, txn models.Transaction, override *models.DocumentParty) *models.DocumentParty {
+	p := models.DocumentParty{Name: txn.RecipientName, Address: txn.RecipientAddress, Phone: txn.RecipientPhone}
+	if txn.CustomerID != "" {
+		if cust, err := s.repo.GetCustomerByOrg(ctx, txn.OrgID, txn.CustomerID); err == nil {
+			p.Name, p.TaxID, p.TaxBranch = cust.Name, cust.TaxID, cust.TaxBranch
+			if cust.Address != "" {
+				p.Address = cust.Address
+			}
+			if cust.Phone != "" {
+				p.Phone = cust.Phone
+			}
+		}
+	}
+	if override != nil {
+		if v := strings.TrimSpace(override.Name); v != "" {
+			p.Name = v
+		}
+		if v := strings.TrimSpace(override.TaxID); v != "" {
+			p.TaxID = v
+		}
+		if v := strings.TrimSpace(override.TaxBranch); v != "" {
+			p.TaxBranch = v
+		}
+		if v := strings.TrimSpace(override.Address); v != "" {
+			p.Address = v
+		}
+		if v := strings.TrimSpace(override.Phone); v != "" {
+			p.Phone = v
+		}
+	}
+	if p == (models.DocumentParty{}) {
+		return nil
+	}
+	return &p
+}
+
+// invoiceNumber is the tax document a credit note corrects: the tax invoice, else the
+// receipt, else the order ID
+func (s *Service) invoiceNumber(ctx context.Context, txn models.Transaction) string {
+	for _, typ := range []models.DocumentType{models.DocumentTaxInvoice, models.DocumentReceipt} {
+		if d, err := s.repo.FindDocumentBySource(ctx, txn.OrgID, models.DocumentSourceOrder, txn.ID, typ); err == nil {
+			return d.Number
+		}
+	}
+	return txn.ID
+}
+
+// creditTotal is the amount a return credits the customer including VAT
+func creditTotal(ret models.Return) int64 {
+	if ret.Tax != nil {
+		return ret.Tax.Net() + ret.Tax.Tax
+	}
+	if ret.RefundAmount > 0 {
+		return ret.RefundAmount
+	}
+	return ret.TotalValue
+}
@@ -0,0 +1,238 @@
+package documents
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/platform/pdf"
+)
+
+// label is a caption in Thai and English. Thai is printed only when the document has
+// a font that covers it.
+type label struct {
+	th, en string
+}
+
+// sheetLine is one row of the items table
+type sheetLine struct {
+	Description string
+	Quantity    int
+	UnitPrice   int64
+	Discount    int64
+	Amount      int64
+}
+
+// sheetTotal is one row of the totals block
+type sheetTotal struct {
+	Label  label
+	Amount int64
+	Bold   bool
+}
+
+// sheetRef is a reference printed under the document number, e.g. the order ID
+type sheetRef struct {
+	Label label
+	Value string
+}
+
+// sheet is everything printed on a document, independent of its type
+type sheet struct {
+	Size       pdf.Size
+	Title      label
+	Number     string
+	Date       time.Time
+	Refs       []sheetRef
+	Seller     models.DocumentParty
+	BuyerLabel label
+	Buyer      *models.DocumentParty
+	Lines      []sheetLine
+	Totals     []sheetTotal
+	Total      int64 // Spelled out in Thai under the totals when > 0 and Thai can be printed
+	Notes      []label
+	Signatures []label
+}
+
+// render lays out a sheet. regular may be nil to use Helvetica.
+func render(s sheet, regular, bold *pdf.Font) []byte {
+	d := pdf.New(s.Size)
+	if s.Size.Width < pdf.A4.Width {
+		d.SetMargin(24)
+	}
+	thai := regular != nil && regular.Has("ใบกำกับภาษี")
+	if regular != nil {
+		d.SetFonts(regular, bold)
+	}
+	text := func(l label) string {
+		if thai && l.th != "" {
+			return l.th
+		}
+		return l.en
+	}
+	both := func(l label) string {
+		if thai && l.th != "" {
+			return l.th + " / " + l.en
+		}
+		return l.en
+	}
+
+	small, body := 8.0, 9.0
+	if s.Size.Width < pdf.A4.Width {
+		small, body = 7, 8
+	}
+	m := d.Margin()
+	width := s.Size.Width - 2*m
+	d.AddPage()
+
+	// Title
+	d.Y += 14
+	title := text(s.Title)
+	d.Text(m+(width-d.TextWidth(title, 14, true))/2, d.Y, 14, true, title)
+	if thai {
+		d.Y += 12
+		d.Text(m+(width-d.TextWidth(s.Title.en, body, false))/2, d.Y, body, false, s.Title.en)
+	}
+	d.Y += 10
+
+	// Seller on the left, number, date and references on the right
+	top := d.Y
+	left := width * 0.58
+	d.Y += body + 2
+	d.Text(m, d.Y, body+2, true, s.Seller.Name)
+	for _, ln := range partyLines(d, s.Seller, left, small, text) {
+		d.Y += small * 1.4
+		d.Text(m, d.Y, small, false, ln)
+	}
+	sellerBottom := d.Y
+
+	refs := append([]sheetRef{
+		{Label: label{"เลขที่", "No."}, Value: s.Number},
+		{Label: label{"วันที่", "Date"}, Value: s.Date.Format("02/01/2006")},
+	}, s.Refs...)
+	y := top + body + 2
+	for _, r := range refs {
+		d.TextRight(m+width, y, body, r.Value == s.Number, text(r.Label)+": "+r.Value)
+		y += body * 1.5
+	}
+	if y > sellerBottom {
+		sellerBottom = y
+	}
+	d.Y = sellerBottom + 8
+
+	// Buyer box
+	if s.Buyer != nil {
+		lines := partyLines(d, *s.Buyer, width-12, small, text)
+		boxTop := d.Y
+		h := body + 4 + body*1.4 + small*1.4*float64(len(lines)) + 6
+		d.Rect(m, boxTop, width, h)
+		d.Y += body + 4
+		d.Text(m+6, d.Y, small, true, both(s.BuyerLabel))
+		d.Y += body * 1.4
+		d.Text(m+6, d.Y, body, true, s.Buyer.Name)
+		for _, ln := range lines {
+			d.Y += small * 1.4
+			d.Text(m+6, d.Y, small, false, ln)
+		}
+		d.Y = boxTop + h
+	}
+	d.Space(6)
+
+	// Items
+	cols := []pdf.Column{
+		{Header: text(label{"ลำดับ", "No."}), Width: width * 0.07, Right: true},
+		{Header: text(label{"รายการ", "Description"}), Width: width * 0.41},
+		{Header: text(label{"จำนวน", "Qty"}), Width: width * 0.09, Right: true},
+		{Header: text(label{"ราคาต่อหน่วย", "Unit price"}), Width: width * 0.15, Right: true},
+		{Header: text(label{"ส่วนลด", "Discount"}), Width: width * 0.13, Right: true},
+		{Header: text(label{"จำนวนเงิน", "Amount"}), Width: width * 0.15, Right: true},
+	}
+	rows := make([][]string, len(s.Lines))
+	for i, l := range s.Lines {
+		discount := ""
+		if l.Discount != 0 {
+			discount = Money(l.Discount)
+		}
+		rows[i] = []string{strconv.Itoa(i + 1), l.Description, strconv.Itoa(l.Quantity), Money(l.UnitPrice), discount, Money(l.Amount)}
+	}
+	d.Table(cols, rows, small)
+	d.Line(m, d.Y, m+width, d.Y)
+	d.Space(4)
+
+	// Totals, right aligned
+	for _, t := range s.Totals {
+		d.Y += body * 1.5
+		d.TextRight(m+width*0.82, d.Y, body, t.Bold, text(t.Label))
+		d.TextRight(m+width, d.Y, body, t.Bold, Money(t.Amount))
+	}
+	if thai && s.Total > 0 {
+		d.Y += body * 1.8
+		d.Text(m, d.Y, body, true, "("+BahtText(s.Total)+")")
+	}
+
+	// Notes
+	if len(s.Notes) > 0 {
+		d.Space(body)
+		for _, n := range s.Notes {
+			for _, ln := range d.Wrap(both(n), width, small, false) {
+				d.Y += small * 1.4
+				d.Text(m, d.Y, small, false, ln)
+			}
+		}
+	}
+
+	// Signatures across the bottom
+	if n := len(s.Signatures); n > 0 {
+		sigY := s.Size.Height - m - 10
+		if d.Y+50 > sigY {
+			d.AddPage()
+			sigY = s.Size.Height - m - 10
+		}
+		w := width / float64(n)
+		for i, sig := range s.Signatures {
+			x := m + w*float64(i)
+			d.Line(x+10, sigY-12, x+w-10, sigY-12)
+			caption := text(sig)
+			d.Text(x+(w-d.TextWidth(caption, small, false))/2, sigY, small, false, caption)
+		}
+	}
+
+	return d.Bytes()
+}
+
+// partyLines lists a party's address and tax details wrapped to width
+func partyLines(d *pdf.Document, p models.DocumentParty, width, size float64, text func(label) string) []string {
+	out := make([]string, 0, 4)
+	if p.Address != "" {
+		out = append(out, d.Wrap(p.Address, width, size, false)...)
+	}
+	if p.Phone != "" {
+		out = append(out, text(label{"โทร", "Tel"})+" "+p.Phone)
+	}
+	if p.TaxID != "" {
+		id := text(label{"เลขประจำตัวผู้เสียภาษี", "Tax ID"}) + " " + p.TaxID
+		if p.TaxBranch != "" {
+			id += "  " + p.TaxBranch
+		}
+		out = append(out, id)
+	}
+	return out
+}
+
+// Money formats satang with thousands separators, e.g. 123456 is "1,234.56"
+func Money(v int64) string {
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	whole := strconv.FormatInt(v/100, 10)
+	var b strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return fmt.Sprintf("%s%s.%02d", sign, b.String(), v%100)
+}
@@ -0,0 +1,264 @@
+package documents
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/platform/pdf"
+)
+
+var (
+	signReceivedBy = label{"ผู้รับเงิน", "Received by"}
+	signAuthorized = label{"ผู้มีอำนาจลงนาม", "Authorized signature"}
+)
+
+// orderSheet lays out a tax invoice, receipt or full-refund credit note for a sale
+func orderSheet(doc models.Document, seller models.DocumentParty, txn models.Transaction, vatRegistered bool) sheet {
+	s := sheet{
+		Size:       pdf.A4,
+		Number:     doc.Number,
+		Date:       doc.IssuedAt,
+		Refs:       []sheetRef{{Label: label{"คำสั่งซื้อ", "Order"}, Value: txn.ID}},
+		Seller:     seller,
+		BuyerLabel: label{"ลูกค้า", "Customer"},
+		Buyer:      doc.Party,
+		Lines:      saleLines(txn.Items),
+		Total:      txn.Total,
+		Signatures: []label{signReceivedBy, signAuthorized},
+	}
+
+	switch doc.Type {
+	case models.DocumentTaxInvoice:
+		s.Title = label{"ใบกำกับภาษี", "Tax Invoice"}
+		s.Totals = saleTotals(txn)
+	case models.DocumentReceipt:
+		s.Size = pdf.A5
+		s.Title = label{"ใบเสร็จรับเงิน", "Receipt"}
+		if vatRegistered && txn.Tax != nil {
+			s.Title = label{"ใบเสร็จรับเงิน/ใบกำกับภาษีอย่างย่อ", "Receipt / Abbreviated Tax Invoice"}
+		}
+		s.Totals = saleTotals(txn)
+		s.Signatures = []label{signReceivedBy}
+		if txn.PaymentMethod != "" {
+			s.Notes = append(s.Notes, label{"ชำระโดย " + txn.PaymentMethod, "Paid by " + txn.PaymentMethod})
+		}
+	case models.DocumentCreditNote:
+		s.Title = label{"ใบลดหนี้", "Credit Note"}
+		s.Refs = append(s.Refs, sheetRef{Label: label{"อ้างถึงเอกสารเลขที่", "Refers to"}, Value: doc.RefersTo})
+		net, vat := txn.Total, int64(0)
+		if txn.Tax != nil {
+			net, vat = txn.Tax.Net(), txn.Tax.Tax
+		}
+		s.Totals = creditTotals(net, net, vat, txn.Tax, txn.Total)
+		s.Notes = append(s.Notes, label{"คืนเงินเต็มจำนวนตามคำสั่งซื้อ", "Full refund of the order"})
+	}
+	if txn.Tax != nil && txn.Tax.PricesIncludeTax {
+		s.Notes = append(s.Notes, label{"ราคาสินค้ารวมภาษีมูลค่าเพิ่มแล้ว", "Prices include VAT"})
+	}
+	return s
+}
+
+// returnSheet lays out the credit note for a customer return
+func returnSheet(doc models.Document, seller models.DocumentParty, ret models.Return, txn models.Transaction) sheet {
+	lines := make([]sheetLine, 0, len(ret.Items))
+	for _, it := range ret.Items {
+		gross := it.UnitPrice * int64(it.Quantity)
+		amount := gross
+		if ret.Tax != nil {
+			amount = it.NetAmount
+			if ret.Tax.PricesIncludeTax {
+				amount += it.TaxAmount
+			}
+		}
+		lines = append(lines, sheetLine{
+			Description: describe(it.ProductName, it.ProductSKU),
+			Quantity:    it.Quantity,
+			UnitPrice:   it.UnitPrice,
+			Discount:    gross - amount,
+			Amount:      amount,
+		})
+	}
+
+	original := txn.Total
+	if txn.Tax != nil {
+		original = txn.Tax.Net()
+	}
+	difference, vat := doc.Total, int64(0)
+	if ret.Tax != nil {
+		difference, vat = ret.Tax.Net(), ret.Tax.Tax
+	}
+
+	s := sheet{
+		Size:   pdf.A4,
+		Title:  label{"ใบลดหนี้", "Credit Note"},
+		Number: doc.Number,
+		Date:   doc.IssuedAt,
+		Refs: []sheetRef{
+			{Label: label{"อ้างถึงเอกสารเลขที่", "Refers to"}, Value: doc.RefersTo},
+			{Label: label{"ใบคืนสินค้า", "Return"}, Value: ret.ReferenceNo},
+		},
+		Seller:     seller,
+		BuyerLabel: label{"ลูกค้า", "Customer"},
+		Buyer:      doc.Party,
+		Lines:      lines,
+		Totals:     creditTotals(original, difference, vat, ret.Tax, doc.Total),
+		Total:      doc.Total,
+		Signatures: []label{signAuthorized},
+	}
+	if r := strings.TrimSpace(ret.RequestReason); r != "" {
+		s.Notes = append(s.Notes, label{"เหตุผล: " + r, "Reason: " + r})
+	}
+	return s
+}
+
+// purchaseOrderSheet lays out a purchase order for the supplier
+func purchaseOrderSheet(doc models.Document, buyer models.DocumentParty, po models.PurchaseOrder) sheet {
+	lines := make([]sheetLine, 0, len(po.Items))
+	var subtotal int64
+	for _, it := range po.Items {
+		amount := it.UnitCost*int64(it.Quantity) - it.Discount
+		subtotal += amount
+		lines = append(lines, sheetLine{
+			Description: describe(it.ProductName, it.ProductSKU),
+			Quantity:    it.Quantity,
+			UnitPrice:   it.UnitCost,
+			Discount:    it.Discount,
+			Amount:      amount,
+		})
+	}
+
+	date := po.CreatedAt
+	if t, err := time.Parse(time.RFC3339, po.Date); err == nil {
+		date = t
+	}
+	s := sheet{
+		Size:       pdf.A4,
+		Title:      label{"ใบสั่งซื้อ", "Purchase Order"},
+		Number:     doc.Number,
+		Date:       date,
+		Seller:     buyer,
+		BuyerLabel: label{"ผู้ขาย", "Supplier"},
+		Buyer:      doc.Party,
+		Lines:      lines,
+		Total:      doc.Total,
+		Signatures: []label{{"ผู้สั่งซื้อ", "Ordered by"}, signAuthorized},
+	}
+	if po.ExpectedDeliveryDate != "" {
+		if t, err := time.Parse(time.RFC3339, po.ExpectedDeliveryDate); err == nil {
+			s.Refs = append(s.Refs, sheetRef{Label: label{"กำหนดส่ง", "Delivery"}, Value: t.Format("02/01/2006")})
+		}
+	}
+
+	s.Totals = append(s.Totals, sheetTotal{Label: label{"รวมเงิน", "Subtotal"}, Amount: subtotal})
+	if po.DiscountAmount > 0 {
+		s.Totals = append(s.Totals, sheetTotal{Label: label{"ส่วนลด", "Discount"}, Amount: -po.DiscountAmount})
+	}
+	if po.ShippingCost > 0 {
+		s.Totals = append(s.Totals, sheetTotal{Label: label{"ค่าขนส่ง", "Shipping"}, Amount: po.ShippingCost})
+	}
+	if vat := purchaseOrderTotal(po) - subtotal + po.DiscountAmount - po.ShippingCost; vat != 0 {
+		rate := po.TaxRate
+		if po.Tax != nil {
+			rate = po.Tax.Rate
+		}
+		s.Totals = append(s.Totals, sheetTotal{Label: vatLabel(rate), Amount: vat})
+	}
+	s.Totals = append(s.Totals, sheetTotal{Label: label{"จำนวนเงินรวมทั้งสิ้น", "Grand total"}, Amount: doc.Total, Bold: true})
+	if n := strings.TrimSpace(po.Note); n != "" {
+		s.Notes = append(s.Notes, label{"", n})
+	}
+	return s
+}
+
+// purchaseOrderTotal is what the supplier is paid, as shown on the order
+func purchaseOrderTotal(po models.PurchaseOrder) int64 {
+	var subtotal int64
+	for _, it := range po.Items {
+		subtotal += it.UnitCost*int64(it.Quantity) - it.Discount
+	}
+	// Orders from before line-level tax fall back to the order-level rate
+	vat := int64(float64(subtotal-po.DiscountAmount) * (po.TaxRate / 100))
+	if po.Tax != nil {
+		vat = po.Tax.Tax
+	}
+	return subtotal - po.DiscountAmount + vat + po.ShippingCost
+}
+
+func saleLines(items []models.TransactionItem) []sheetLine {
+	out := make([]sheetLine, 0, len(items))
+	for _, it := range items {
+		gross := it.Price * int64(it.Quantity)
+		out = append(out, sheetLine{
+			Description: describe(it.Name, it.SKU),
+			Quantity:    it.Quantity,
+			UnitPrice:   it.Price,
+			Discount:    it.Discount,
+			Amount:      gross - it.Discount,
+		})
+	}
+	return out
+}
+
+// saleTotals lists subtotal, discounts, shipping, the VAT breakdown and the grand total
+func saleTotals(txn models.Transaction) []sheetTotal {
+	var gross, lineDiscount int64
+	for _, it := range txn.Items {
+		gross += it.Price * int64(it.Quantity)
+		lineDiscount += it.Discount
+	}
+	out := []sheetTotal{{Label: label{"รวมเงิน", "Subtotal"}, Amount: gross - lineDiscount}}
+	if d := txn.DiscountAmount - lineDiscount; d > 0 {
+		out = append(out, sheetTotal{Label: label{"ส่วนลด", "Discount"}, Amount: -d})
+	}
+	if txn.ShippingCost > 0 {
+		out = append(out, sheetTotal{Label: label{"ค่าจัดส่ง", "Shipping"}, Amount: txn.ShippingCost})
+	}
+	if t := txn.Tax; t != nil {
+		out = append(out, taxRows(*t)...)
+	}
+	return append(out, sheetTotal{Label: label{"จำนวนเงินรวมทั้งสิ้น", "Grand total"}, Amount: txn.Total, Bold: true})
+}
+
+// creditTotals lists the values a credit note must show: the original value, the
+// corrected value, the difference and its VAT
+func creditTotals(original, difference, vat int64, t *models.TaxSummary, total int64) []sheetTotal {
+	out := []sheetTotal{
+		{Label: label{"มูลค่าตามเอกสารเดิม", "Original value"}, Amount: original},
+		{Label: label{"มูลค่าที่ถูกต้อง", "Correct value"}, Amount: original - difference},
+		{Label: label{"ผลต่าง", "Difference"}, Amount: difference},
+	}
+	if t != nil {
+		out = append(out, sheetTotal{Label: vatLabel(t.Rate), Amount: vat})
+	}
+	return append(out, sheetTotal{Label: label{"รวมลดหนี้ทั้งสิ้น", "Total credit"}, Amount: total, Bold: true})
+}
+
+// taxRows breaks the ex-tax value down by tax class and shows the VAT
+func taxRows(t models.TaxSummary) []sheetTotal {
+	out := make([]sheetTotal, 0, 4)
+	if t.ZeroRated != 0 {
+		out = append(out, sheetTotal{Label: label{"มูลค่าสินค้าอัตราศูนย์", "Zero-rated value"}, Amount: t.ZeroRated})
+	}
+	if t.Exempt != 0 {
+		out = append(out, sheetTotal{Label: label{"มูลค่าสินค้ายกเว้นภาษี", "VAT-exempt value"}, Amount: t.Exempt})
+	}
+	out = append(out,
+		sheetTotal{Label: label{"มูลค่าที่ต้องเสียภาษี", "Taxable value"}, Amount: t.Standard},
+		sheetTotal{Label: vatLabel(t.Rate), Amount: t.Tax},
+	)
+	return out
+}
+
+func vatLabel(rate float64) label {
+	r := strconv.FormatFloat(rate, 'f', -1, 64)
+	return label{"ภาษีมูลค่าเพิ่ม " + r + "%", "VAT " + r + "%"}
+}
+
+func describe(name, sku string) string {
+	if sku == "" {
+		return name
+	}
+	return name + " (" + sku + ")"
+}
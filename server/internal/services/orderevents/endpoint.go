@@ -0,0 +1,74 @@
+package orderevents
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateEndpoint is returned for webhook URLs that reach the server's own network
+var ErrPrivateEndpoint = errors.New("webhook endpoints must be on a public address")
+
+// blockedIP reports whether an address is loopback, link-local, private (RFC 1918 and
+// unique local) or unspecified. Webhooks may not reach these: an endpoint there would let
+// an org probe the network the server runs in.
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified()
+}
+
+// CheckEndpoint accepts absolute http(s) URLs whose host resolves only to public
+// addresses. The check is repeated when connecting, since DNS may change in between.
+func CheckEndpoint(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedIP(ip) {
+			return ErrPrivateEndpoint
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return errors.New("url host could not be resolved")
+	}
+	for _, a := range addrs {
+		if blockedIP(a.IP) {
+			return ErrPrivateEndpoint
+		}
+	}
+	return nil
+}
+
+// dialer refuses connections to blocked addresses after DNS resolution, so a host that
+// resolves differently at delivery time, or a redirect, cannot reach them either
+var dialer = &net.Dialer{
+	Timeout: 10 * time.Second,
+	Control: func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+			return ErrPrivateEndpoint
+		}
+		return nil
+	},
+}
+
+var client = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
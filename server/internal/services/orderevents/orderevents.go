@@ -0,0 +1,260 @@
+// Package orderevents records what happens to orders. Each change is appended to the
+// order's event log, written to the audit trail and pushed to the org's webhooks.
+package orderevents
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/audit"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// retryDelays space out redelivery of an event an endpoint did not accept; a delivery gets
+// one attempt more than there are delays
+var retryDelays = []time.Duration{10 * time.Second, time.Minute, 10 * time.Minute}
+
+// Service records order events
+type Service struct {
+	repo *repo.Repo
+}
+
+// New creates a new order event service
+func New(r *repo.Repo) *Service {
+	return &Service{repo: r}
+}
+
+// Change describes one change to an order
+type Change struct {
+	Type    models.OrderEventType
+	Message string
+	Payload map[string]interface{}
+
+	// Before and After go to the audit trail; without them it stores the event itself
+	Before interface{}
+	After  interface{}
+}
+
+// Source is where a change was made from, kept on the audit trail
+type Source struct {
+	IPAddress string
+	UserAgent string
+}
+
+// Record appends a change to the order's history, audits it and queues it for the
+// org's webhooks. order is the order as it stands after the change.
+func (s *Service) Record(ctx context.Context, actor models.User, order models.Transaction, ch Change, src Source) (models.OrderEvent, error) {
+	ev := models.OrderEvent{
+		ID:                "EVT-" + primitive.NewObjectID().Hex(),
+		OrgID:             order.OrgID,
+		BranchID:          order.BranchID,
+		OrderID:           order.ID,
+		Type:              ch.Type,
+		Message:           ch.Message,
+		ActorID:           actor.ID,
+		ActorName:         actor.Name,
+		Payload:           ch.Payload,
+		Status:            order.Status,
+		FulfillmentStatus: order.FulfillmentStatus,
+		PaymentStatus:     order.PaymentStatus,
+	}
+	ev, err := s.repo.CreateOrderEvent(ctx, ev)
+	if err != nil {
+		return models.OrderEvent{}, err
+	}
+
+	action := models.AuditActionUpdate
+	switch ch.Type {
+	case models.OrderEventCreated:
+		action = models.AuditActionCreate
+	case models.OrderEventDeleted:
+		action = models.AuditActionDelete
+	}
+	before, after := ch.Before, ch.After
+	if before == nil && after == nil {
+		after = ev
+	}
+	// Platform admins act across orgs; the entry belongs with the order
+	actor.OrgID = order.OrgID
+	_ = audit.New(s.repo).RecordWithContext(ctx, actor, "Order", order.ID, action,
+		before, after, src.IPAddress, src.UserAgent, ch.Message)
+
+	s.publish(ctx, ev)
+	return ev, nil
+}
+
+// envelope is the body POSTed to webhook endpoints
+type envelope struct {
+	ID        string                `json:"id"`
+	Type      models.OrderEventType `json:"type"`
+	CreatedAt time.Time             `json:"createdAt"`
+	Data      interface{}           `json:"data"`
+}
+
+// Internal reports whether an event is for staff only and stays off webhooks and the feed
+func Internal(ev models.OrderEvent) bool {
+	internal, _ := ev.Payload["internal"].(bool)
+	return ev.Type == models.OrderEventNote && internal
+}
+
+// publish queues an event for every active subscription that wants it and makes the first
+// attempt in the background, so the request that made the change is not held up. Attempts
+// that fail are retried from the delivery record by RetryDue.
+func (s *Service) publish(ctx context.Context, ev models.OrderEvent) {
+	if Internal(ev) {
+		return
+	}
+	subs, err := s.repo.ListWebhooksByOrg(ctx, ev.OrgID)
+	if err != nil {
+		log.Printf("order events: list webhooks for org %s: %v", ev.OrgID, err)
+		return
+	}
+	body, err := json.Marshal(envelope{ID: ev.ID, Type: ev.Type, CreatedAt: ev.CreatedAt, Data: ev})
+	if err != nil {
+		return
+	}
+	for _, sub := range subs {
+		if !sub.Active || !sub.Wants(ev.Type) {
+			continue
+		}
+		d, err := s.repo.CreateWebhookDelivery(ctx, models.WebhookDelivery{
+			ID:            "WHD-" + primitive.NewObjectID().Hex(),
+			OrgID:         ev.OrgID,
+			WebhookID:     sub.ID,
+			EventID:       ev.ID,
+			EventType:     ev.Type,
+			Body:          string(body),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("order events: queue %s for webhook %s: %v", ev.ID, sub.ID, err)
+			continue
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			s.attempt(ctx, d)
+		}()
+	}
+}
+
+// RetryDue makes the next attempt at every delivery that is due
+func (s *Service) RetryDue(ctx context.Context) {
+	due, err := s.repo.ListDueWebhookDeliveries(ctx, time.Now().UTC(), 100)
+	if err != nil {
+		log.Printf("order events: list due deliveries: %v", err)
+		return
+	}
+	for _, d := range due {
+		s.attempt(ctx, d)
+	}
+}
+
+// attempt sends a delivery once and records the outcome: delivered, failed for good when
+// the endpoint refuses it or attempts run out, or pending until the next retry
+func (s *Service) attempt(ctx context.Context, d models.WebhookDelivery) {
+	// Held for longer than a send can take, so a crashed attempt is picked up again
+	claimed, err := s.repo.ClaimWebhookDelivery(ctx, d, time.Now().UTC().Add(2*time.Minute))
+	if err != nil {
+		if !errors.Is(err, repo.ErrConflict) {
+			log.Printf("order events: claim delivery %s: %v", d.ID, err)
+		}
+		return
+	}
+	d = claimed
+
+	sub, err := s.repo.GetWebhookByOrg(ctx, d.OrgID, d.WebhookID)
+	if err != nil || !sub.Active {
+		_ = s.repo.UpdateWebhookDelivery(ctx, d.ID, bson.M{
+			"status":    models.WebhookDeliveryFailed,
+			"lastError": "webhook was removed or turned off",
+		})
+		return
+	}
+
+	status, err := s.send(ctx, sub, d.EventID, d.EventType, []byte(d.Body))
+	patch := bson.M{"lastStatus": status, "lastError": ""}
+	switch {
+	case err == nil:
+		at := time.Now().UTC()
+		patch["status"], patch["deliveredAt"] = models.WebhookDeliveryDelivered, at
+	case d.Attempts > len(retryDelays) ||
+		(status >= 400 && status < 500 && status != http.StatusTooManyRequests && status != http.StatusRequestTimeout):
+		// Out of attempts, or the endpoint refused it and sending it again will not help
+		patch["status"], patch["lastError"] = models.WebhookDeliveryFailed, err.Error()
+	default:
+		log.Printf("order events: deliver %s to webhook %s (attempt %d): %v", d.EventID, sub.ID, d.Attempts, err)
+		patch["lastError"] = err.Error()
+		patch["nextAttemptAt"] = time.Now().UTC().Add(retryDelays[d.Attempts-1])
+	}
+	if err := s.repo.UpdateWebhookDelivery(ctx, d.ID, patch); err != nil {
+		log.Printf("order events: record delivery %s: %v", d.ID, err)
+	}
+}
+
+// Ping sends a test event so an org can check its endpoint
+func (s *Service) Ping(ctx context.Context, sub models.WebhookSubscription) (int, error) {
+	id := "EVT-" + primitive.NewObjectID().Hex()
+	body, err := json.Marshal(envelope{ID: id, Type: "PING", CreatedAt: time.Now().UTC(), Data: map[string]string{"webhookId": sub.ID}})
+	if err != nil {
+		return 0, err
+	}
+	return s.send(ctx, sub, id, "PING", body)
+}
+
+// send POSTs one delivery and records its outcome on the subscription. The signature is
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the subscription's secret.
+func (s *Service) send(ctx context.Context, sub models.WebhookSubscription, id string, t models.OrderEventType, body []byte) (int, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "StockFlows-Webhooks/1.0")
+	req.Header.Set("X-StockFlows-Event", string(t))
+	req.Header.Set("X-StockFlows-Delivery", id)
+	req.Header.Set("X-StockFlows-Timestamp", ts)
+	req.Header.Set("X-StockFlows-Signature", "sha256="+Sign(sub.Secret, ts, body))
+
+	status, deliveryErr := 0, ""
+	resp, err := client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		status = resp.StatusCode
+		if status < 200 || status > 299 {
+			err = errors.New("endpoint returned " + resp.Status)
+		}
+	}
+	if err != nil {
+		deliveryErr = err.Error()
+	}
+	if recErr := s.repo.RecordWebhookDelivery(ctx, sub.OrgID, sub.ID, status, deliveryErr); recErr != nil {
+		log.Printf("order events: record delivery for webhook %s: %v", sub.ID, recErr)
+	}
+	return status, err
+}
+
+// Sign is the signature receivers check deliveries against
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,407 @@
+package promotions
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/models"
+)
+
+// Line is one cart line as the engine sees it
+type Line struct {
+	ProductID    string
+	CategoryPath string // Materialized path of the product's category, e.g. "/drinks/tea"
+	UnitPrice    int64
+	Quantity     int
+	Discount     int64 // Manual line discount already given
+}
+
+func (l Line) gross() int64 { return l.UnitPrice * int64(l.Quantity) }
+
+// Cart is what promotions are evaluated against
+type Cart struct {
+	BranchID      string
+	Channel       string
+	CustomerGroup string
+	CouponCodes   []string
+	Lines         []Line
+
+	OrderID string // An order being edited; its own coupon uses do not count against limits
+}
+
+// LineResult is the promotional discount given to one cart line
+type LineResult struct {
+	Discount     int64    `json:"discount"`
+	Explanations []string `json:"explanations"`
+}
+
+// Result is the outcome of evaluating a cart
+type Result struct {
+	Discount int64                     `json:"discount"`
+	Lines    []LineResult              `json:"lines"` // Same order as Cart.Lines
+	Applied  []models.AppliedPromotion `json:"applied"`
+	Rejected []Rejection               `json:"rejected,omitempty"` // Entered coupons that did not apply
+}
+
+// Rejection explains why an entered coupon code did not apply
+type Rejection struct {
+	CouponCode string `json:"couponCode"`
+	Reason     string `json:"reason"`
+}
+
+// NormalizeCode makes coupon codes case and whitespace insensitive
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// lineState tracks what has already been taken off a line during evaluation
+type lineState struct {
+	remaining int64 // Gross less every discount so far
+	promoted  bool  // Some promotion already applied
+	exclusive bool  // A non-stackable promotion applied
+}
+
+// Evaluate applies promotions to the cart in order. Promotions are expected sorted by
+// priority; blocked maps coupon promotion IDs to the reason they cannot be redeemed
+// (e.g. usage limit reached) and may be nil.
+//
+// A line takes at most one non-stackable promotion and never a non-stackable promotion
+// together with a stackable one. No line is discounted below zero.
+func Evaluate(promos []models.Promotion, cart Cart, at time.Time, blocked map[string]string) Result {
+	res := Result{Lines: make([]LineResult, len(cart.Lines)), Applied: make([]models.AppliedPromotion, 0)}
+	states := make([]lineState, len(cart.Lines))
+	for i, l := range cart.Lines {
+		states[i].remaining = l.gross() - l.Discount
+		if states[i].remaining < 0 {
+			states[i].remaining = 0
+		}
+	}
+
+	entered := make(map[string]bool, len(cart.CouponCodes))
+	for _, code := range cart.CouponCodes {
+		if code = NormalizeCode(code); code != "" {
+			entered[code] = true
+		}
+	}
+	used := make(map[string]bool)
+
+	for _, p := range promos {
+		code := NormalizeCode(p.CouponCode)
+		if code != "" {
+			if !entered[code] {
+				continue
+			}
+			used[code] = true
+		}
+		reject := func(reason string) {
+			if code != "" {
+				res.Rejected = append(res.Rejected, Rejection{CouponCode: code, Reason: reason})
+			}
+		}
+
+		if reason := outOfScope(p, cart, at); reason != "" {
+			reject(reason)
+			continue
+		}
+		if reason, ok := blocked[p.ID]; ok {
+			reject(reason)
+			continue
+		}
+
+		eligible := make([]int, 0, len(cart.Lines))
+		var subtotal int64
+		for i, l := range cart.Lines {
+			if !matchesLine(p, l) || l.Quantity <= 0 || states[i].remaining <= 0 {
+				continue
+			}
+			if states[i].exclusive || (!p.Stackable && states[i].promoted) {
+				continue
+			}
+			eligible = append(eligible, i)
+			subtotal += states[i].remaining
+		}
+		if len(eligible) == 0 {
+			reject("no items in the cart qualify")
+			continue
+		}
+		if p.MinSubtotal > 0 && subtotal < p.MinSubtotal {
+			reject(fmt.Sprintf("requires a minimum spend of %s on qualifying items", baht(p.MinSubtotal)))
+			continue
+		}
+
+		amounts, units, explanation := compute(p, cart.Lines, states, eligible)
+
+		applied := models.AppliedPromotion{
+			PromotionID: p.ID,
+			Name:        p.Name,
+			Type:        p.Type,
+			CouponCode:  code,
+			Explanation: explanation,
+			Lines:       make([]models.AppliedPromotionLine, 0),
+		}
+		for _, i := range eligible {
+			amt := amounts[i]
+			if amt > states[i].remaining {
+				amt = states[i].remaining
+			}
+			if amt <= 0 {
+				continue
+			}
+			states[i].remaining -= amt
+			states[i].promoted = true
+			if !p.Stackable {
+				states[i].exclusive = true
+			}
+			applied.Amount += amt
+			applied.Lines = append(applied.Lines, models.AppliedPromotionLine{
+				ProductID: cart.Lines[i].ProductID,
+				Quantity:  units[i],
+				Amount:    amt,
+			})
+			res.Lines[i].Discount += amt
+			res.Lines[i].Explanations = append(res.Lines[i].Explanations,
+				fmt.Sprintf("%s: %s (-%s)", p.Name, explanation, baht(amt)))
+		}
+		if applied.Amount == 0 {
+			reject("no discount applies to the items in the cart")
+			continue
+		}
+		res.Discount += applied.Amount
+		res.Applied = append(res.Applied, applied)
+	}
+
+	for code := range entered {
+		if !used[code] {
+			res.Rejected = append(res.Rejected, Rejection{CouponCode: code, Reason: "unknown coupon code"})
+		}
+	}
+	sort.Slice(res.Rejected, func(i, j int) bool { return res.Rejected[i].CouponCode < res.Rejected[j].CouponCode })
+	return res
+}
+
+// outOfScope returns why a promotion does not apply to the cart as a whole, or ""
+func outOfScope(p models.Promotion, cart Cart, at time.Time) string {
+	switch {
+	case !p.IsActive:
+		return "promotion is not active"
+	case p.StartsAt != nil && at.Before(*p.StartsAt):
+		return "promotion has not started"
+	case p.EndsAt != nil && !at.Before(*p.EndsAt):
+		return "promotion has ended"
+	case len(p.BranchIDs) > 0 && !contains(p.BranchIDs, cart.BranchID):
+		return "not valid at this branch"
+	case len(p.Channels) > 0 && !containsFold(p.Channels, cart.Channel):
+		return "not valid for this sales channel"
+	case len(p.CustomerGroups) > 0 && !containsFold(p.CustomerGroups, cart.CustomerGroup):
+		return "not valid for this customer"
+	}
+	return ""
+}
+
+// matchesLine reports whether a line is in the promotion's product scope. Category scope
+// includes every sub-category through the materialized path.
+func matchesLine(p models.Promotion, l Line) bool {
+	if len(p.ProductIDs) == 0 && len(p.CategoryIDs) == 0 {
+		return true
+	}
+	if contains(p.ProductIDs, l.ProductID) {
+		return true
+	}
+	for _, seg := range strings.Split(l.CategoryPath, "/") {
+		if seg != "" && contains(p.CategoryIDs, seg) {
+			return true
+		}
+	}
+	return false
+}
+
+// compute returns the discount and units acted on per eligible line index
+func compute(p models.Promotion, lines []Line, states []lineState, eligible []int) (map[int]int64, map[int]int, string) {
+	amounts := make(map[int]int64, len(eligible))
+	units := make(map[int]int, len(eligible))
+
+	switch p.Type {
+	case models.PromotionPercentOff:
+		for _, i := range eligible {
+			amounts[i] = percentOf(states[i].remaining, p.Percent)
+			units[i] = lines[i].Quantity
+		}
+		return amounts, units, fmt.Sprintf("%s%% off", trimFloat(p.Percent))
+
+	case models.PromotionFixedOff:
+		weights := make(map[int]int64, len(eligible))
+		var total int64
+		for _, i := range eligible {
+			weights[i] = states[i].remaining
+			total += states[i].remaining
+			units[i] = lines[i].Quantity
+		}
+		off := p.AmountOff
+		if off > total {
+			off = total
+		}
+		for i, amt := range spread(off, eligible, weights) {
+			amounts[i] = amt
+		}
+		return amounts, units, baht(p.AmountOff) + " off"
+
+	case models.PromotionBuyXGetY:
+		pct := p.GetPercent
+		if pct <= 0 || pct > 100 {
+			pct = 100
+		}
+		if p.BuyQty <= 0 || p.GetQty <= 0 {
+			return amounts, units, ""
+		}
+		all := expandUnits(lines, eligible)
+		groups := len(all) / (p.BuyQty + p.GetQty)
+		// The cheapest units in the cart are the ones given away
+		for _, u := range all[len(all)-groups*p.GetQty:] {
+			amounts[u.line] += percentOf(u.price, pct)
+			units[u.line]++
+		}
+		what := "free"
+		if pct < 100 {
+			what = trimFloat(pct) + "% off"
+		}
+		return amounts, units, fmt.Sprintf("buy %d get %d %s", p.BuyQty, p.GetQty, what)
+
+	case models.PromotionBundlePrice:
+		if p.BundleQty <= 0 {
+			return amounts, units, ""
+		}
+		all := expandUnits(lines, eligible)
+		groups := len(all) / p.BundleQty
+		for g := 0; g < groups; g++ {
+			bundle := all[g*p.BundleQty : (g+1)*p.BundleQty]
+			var full int64
+			weights := make(map[int]int64)
+			order := make([]int, 0, len(bundle))
+			for _, u := range bundle {
+				full += u.price
+				if _, ok := weights[u.line]; !ok {
+					order = append(order, u.line)
+				}
+				weights[u.line] += u.price
+				units[u.line]++
+			}
+			if full <= p.BundlePrice {
+				continue
+			}
+			for i, amt := range spread(full-p.BundlePrice, order, weights) {
+				amounts[i] += amt
+			}
+		}
+		return amounts, units, fmt.Sprintf("%d for %s", p.BundleQty, baht(p.BundlePrice))
+
+	case models.PromotionTiered:
+		qty := 0
+		for _, i := range eligible {
+			qty += lines[i].Quantity
+		}
+		var tier *models.PromotionTier
+		for k := range p.Tiers {
+			t := p.Tiers[k]
+			if qty >= t.MinQty && (tier == nil || t.MinQty > tier.MinQty) {
+				tier = &t
+			}
+		}
+		if tier == nil {
+			return amounts, units, ""
+		}
+		for _, i := range eligible {
+			amounts[i] = percentOf(states[i].remaining, tier.Percent)
+			units[i] = lines[i].Quantity
+		}
+		return amounts, units, fmt.Sprintf("%s%% off for %d+ items", trimFloat(tier.Percent), tier.MinQty)
+	}
+	return amounts, units, ""
+}
+
+type unit struct {
+	line  int
+	price int64
+}
+
+// expandUnits lists one entry per unit of the eligible lines, most expensive first
+func expandUnits(lines []Line, eligible []int) []unit {
+	out := make([]unit, 0)
+	for _, i := range eligible {
+		for q := 0; q < lines[i].Quantity; q++ {
+			out = append(out, unit{line: i, price: lines[i].UnitPrice})
+		}
+	}
+	sort.SliceStable(out, func(a, b int) bool { return out[a].price > out[b].price })
+	return out
+}
+
+// spread splits amount across keys in proportion to weights using the largest remainder,
+// so the parts always add up to amount exactly
+func spread(amount int64, keys []int, weights map[int]int64) map[int]int64 {
+	out := make(map[int]int64, len(keys))
+	var total int64
+	for _, k := range keys {
+		total += weights[k]
+	}
+	if total <= 0 || amount <= 0 {
+		return out
+	}
+	type rem struct {
+		key int
+		r   int64
+	}
+	rems := make([]rem, 0, len(keys))
+	var given int64
+	for _, k := range keys {
+		share := amount * weights[k]
+		out[k] = share / total
+		given += out[k]
+		rems = append(rems, rem{key: k, r: share % total})
+	}
+	sort.SliceStable(rems, func(a, b int) bool { return rems[a].r > rems[b].r })
+	for j := 0; given < amount; j++ {
+		out[rems[j%len(rems)].key]++
+		given++
+	}
+	return out
+}
+
+func percentOf(v int64, pct float64) int64 {
+	if pct <= 0 {
+		return 0
+	}
+	if pct > 100 {
+		pct = 100
+	}
+	return int64(math.Round(float64(v) * pct / 100))
+}
+
+func trimFloat(f float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", f), "0"), ".")
+}
+
+// baht formats satang for explanations
+func baht(v int64) string {
+	return fmt.Sprintf("฿%d.%02d", v/100, v%100)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrInvalidPromotion = errors.New("invalid promotion")
+	ErrCouponExhausted  = errors.New("coupon usage limit reached")
+)
+
+// Service loads an org's promotions, evaluates carts and counts coupon redemptions
+type Service struct {
+	repo *repo.Repo
+}
+
+// New creates a new promotions service
+func New(r *repo.Repo) *Service {
+	return &Service{repo: r}
+}
+
+// Validate checks the parameters a promotion's type needs
+func Validate(p models.Promotion) error {
+	if p.Name == "" || p.Priority < 0 || p.MinSubtotal < 0 || p.UsageLimit < 0 || p.PerCustomerLimit < 0 {
+		return ErrInvalidPromotion
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return ErrInvalidPromotion
+	}
+	switch p.Type {
+	case models.PromotionPercentOff:
+		if p.Percent <= 0 || p.Percent > 100 {
+			return ErrInvalidPromotion
+		}
+	case models.PromotionFixedOff:
+		if p.AmountOff <= 0 {
+			return ErrInvalidPromotion
+		}
+	case models.PromotionBuyXGetY:
+		if p.BuyQty <= 0 || p.GetQty <= 0 || p.GetPercent < 0 || p.GetPercent > 100 {
+			return ErrInvalidPromotion
+		}
+	case models.PromotionBundlePrice:
+		if p.BundleQty < 2 || p.BundlePrice <= 0 {
+			return ErrInvalidPromotion
+		}
+	case models.PromotionTiered:
+		if len(p.Tiers) == 0 {
+			return ErrInvalidPromotion
+		}
+		for _, t := range p.Tiers {
+			if t.MinQty <= 0 || t.Percent <= 0 || t.Percent > 100 {
+				return ErrInvalidPromotion
+			}
+		}
+	default:
+		return ErrInvalidPromotion
+	}
+	return nil
+}
+
+// Evaluate applies the org's active promotions to the cart. customerID is used for
+// per-customer coupon limits and may be empty.
+func (s *Service) Evaluate(ctx context.Context, orgID, customerID string, cart Cart) (Result, error) {
+	promos, err := s.repo.ListPromotionsByOrg(ctx, orgID, bson.M{"isActive": true})
+	if err != nil {
+		return Result{}, err
+	}
+
+	blocked := make(map[string]string)
+	for _, p := range promos {
+		if p.CouponCode == "" {
+			continue
+		}
+		if p.UsageLimit > 0 && p.UsedCount >= p.UsageLimit {
+			blocked[p.ID] = "coupon usage limit reached"
+			continue
+		}
+		if p.PerCustomerLimit > 0 {
+			if customerID == "" {
+				blocked[p.ID] = "coupon requires a customer"
+				continue
+			}
+			n, err := s.repo.CountPromotionUsesByCustomer(ctx, orgID, p.ID, customerID, cart.OrderID)
+			if err != nil {
+				return Result{}, err
+			}
+			if n >= int64(p.PerCustomerLimit) {
+				blocked[p.ID] = "customer has already used this coupon"
+			}
+		}
+	}
+
+	return Evaluate(promos, cart, time.Now().UTC(), blocked), nil
+}
+
+// Redeem counts one use of every coupon promotion applied, against the coupon's usage
+// limit and, for coupons with a per-customer limit, against the customer's own. If any
+// coupon has run out in the meantime the uses already counted are given back and
+// ErrCouponExhausted is returned.
+func (s *Service) Redeem(ctx context.Context, orgID, customerID string, applied []models.AppliedPromotion) error {
+	done := make([]models.AppliedPromotion, 0, len(applied))
+	fail := func(err error) error {
+		s.Release(ctx, orgID, customerID, done)
+		if errors.Is(err, repo.ErrConflict) {
+			return ErrCouponExhausted
+		}
+		return err
+	}
+	for _, a := range applied {
+		if a.CouponCode == "" {
+			continue
+		}
+		p, err := s.repo.GetPromotionByOrg(ctx, orgID, a.PromotionID)
+		if err != nil {
+			return fail(err)
+		}
+		if err := s.repo.IncrementPromotionUsage(ctx, orgID, a.PromotionID); err != nil {
+			return fail(err)
+		}
+		if p.PerCustomerLimit > 0 && customerID != "" {
+			if err := s.repo.IncrementPromotionCustomerUsage(ctx, orgID, a.PromotionID, customerID, p.PerCustomerLimit); err != nil {
+				_ = s.repo.DecrementPromotionUsage(ctx, orgID, a.PromotionID)
+				return fail(err)
+			}
+		}
+		done = append(done, a)
+	}
+	return nil
+}
+
+// Release gives back the coupon uses counted by Redeem for the same customer
+func (s *Service) Release(ctx context.Context, orgID, customerID string, applied []models.AppliedPromotion) {
+	for _, a := range applied {
+		if a.CouponCode == "" {
+			continue
+		}
+		_ = s.repo.DecrementPromotionUsage(ctx, orgID, a.PromotionID)
+		if customerID != "" {
+			_ = s.repo.DecrementPromotionCustomerUsage(ctx, orgID, a.PromotionID, customerID)
+		}
+	}
+}
+
+// CartFor builds the cart for transaction items, looking up each product's category path
+// and the customer's group. Item discounts already set are treated as manual discounts.
+func (s *Service) CartFor(ctx context.Context, orgID, branchID, channel, customerID string, codes []string, items []models.TransactionItem) (Cart, error) {
+	cats, err := s.repo.ListCategoriesByOrg(ctx, orgID, nil)
+	if err != nil {
+		return Cart{}, err
+	}
+	paths := make(map[string]string, len(cats))
+	for _, c := range cats {
+		paths[c.ID] = c.Path
+	}
+
+	cart := Cart{BranchID: branchID, Channel: channel, CouponCodes: codes, Lines: make([]Line, 0, len(items))}
+	if customerID != "" {
+		if cust, err := s.repo.GetCustomerByOrg(ctx, orgID, customerID); err == nil {
+			cart.CustomerGroup = cust.Group
+		}
+	}
+	for _, it := range items {
+		line := Line{ProductID: it.ID, UnitPrice: it.Price, Quantity: it.Quantity, Discount: it.Discount}
+		if p, err := s.repo.GetProductByOrg(ctx, orgID, it.ID); err == nil && p.CategoryID != "" {
+			line.CategoryPath = paths[p.CategoryID]
+			if line.CategoryPath == "" {
+				line.CategoryPath = "/" + p.CategoryID
+			}
+		}
+		cart.Lines = append(cart.Lines, line)
+	}
+	return cart, nil
+}
+
+// Apply adds the evaluated discounts and explanations to the items, which must be the
+// items the cart was built from
+func Apply(items []models.TransactionItem, res Result) {
+	for i := range items {
+		if i >= len(res.Lines) {
+			return
+		}
+		items[i].Discount += res.Lines[i].Discount
+		items[i].Promotions = append(items[i].Promotions, res.Lines[i].Explanations...)
+	}
+}
+
+// Codes returns the coupon codes that were applied
+func Codes(applied []models.AppliedPromotion) []string {
+	out := make([]string, 0)
+	for _, a := range applied {
+		if a.CouponCode != "" {
+			out = append(out, a.CouponCode)
+		}
+	}
+	return out
+}
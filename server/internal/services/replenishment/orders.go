@@ -0,0 +1,195 @@
+package replenishment
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"stockflows/server/internal/models"
+)
+
+// openPOStatuses are purchase order statuses whose quantities are still expected to arrive
+var openPOStatuses = map[string]bool{"OPEN": true, "SENT": true, "RECEIVING": true}
+
+// OrderLine is a suggested purchase quantity for one product
+type OrderLine struct {
+	ProductID   string `json:"productId"`
+	ProductName string `json:"productName"`
+	ProductSku  string `json:"productSku"`
+	Quantity    int    `json:"quantity"`
+	OnHand      int    `json:"onHand"`
+	OnOrder     int    `json:"onOrder"`
+	Backordered int    `json:"backordered,omitempty"` // Sold beyond stock and still to be filled
+	MinStock    int    `json:"minStock"`
+	MaxStock    int    `json:"maxStock,omitempty"`
+	UnitCost    int64  `json:"unitCost"`
+}
+
+// SupplierOrder groups suggested lines under the product's preferred supplier
+type SupplierOrder struct {
+	SupplierID string      `json:"supplierId"`
+	Lines      []OrderLine `json:"lines"`
+}
+
+// OrderQuantity returns how many units to order so the stock position recovers above the reorder point.
+// With a max level the position is topped up to it; otherwise the reorder quantity is used,
+// raised if needed to clear the reorder point.
+func OrderQuantity(sl models.StockLevel, onOrder int) int {
+	position := sl.Quantity + onOrder
+	if position > sl.MinStock {
+		return 0
+	}
+	if sl.MaxStock > 0 {
+		return sl.MaxStock - position
+	}
+	shortfall := sl.MinStock - position + 1
+	if sl.ReorderQty > shortfall {
+		return sl.ReorderQty
+	}
+	return shortfall
+}
+
+// OpenPurchaseQuantities sums quantities on purchase orders that have not been received yet, keyed by product
+func (s *Service) OpenPurchaseQuantities(ctx context.Context, orgID, branchID string) (map[string]int, error) {
+	pos, err := s.repo.ListPurchaseOrdersByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int)
+	for _, po := range pos {
+		if po.BranchID != branchID || !openPOStatuses[strings.ToUpper(po.Status)] {
+			continue
+		}
+		for _, it := range po.Items {
+			out[it.ProductID] += it.Quantity
+		}
+	}
+	return out, nil
+}
+
+// BackorderedQuantities sums units sold beyond stock on open orders in a branch, keyed by product
+func (s *Service) BackorderedQuantities(ctx context.Context, orgID, branchID string) (map[string]int, error) {
+	orders, err := s.repo.ListBackorderedTransactions(ctx, orgID, branchID, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int)
+	for _, o := range orders {
+		for _, it := range o.Items {
+			if it.QtyBackordered > 0 {
+				out[it.ID] += it.QtyBackordered
+			}
+		}
+	}
+	return out, nil
+}
+
+// LastPurchaseCosts returns the unit cost from the most recently received purchase order for each product
+func (s *Service) LastPurchaseCosts(ctx context.Context, orgID string) (map[string]int64, error) {
+	pos, err := s.repo.ListPurchaseOrdersByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	received := make([]models.PurchaseOrder, 0, len(pos))
+	for _, po := range pos {
+		if po.Status == "RECEIVED" {
+			received = append(received, po)
+		}
+	}
+	sort.Slice(received, func(i, j int) bool {
+		return received[i].UpdatedAt.Before(received[j].UpdatedAt)
+	})
+
+	out := make(map[string]int64)
+	for _, po := range received {
+		for _, it := range po.Items {
+			out[it.ProductID] = it.UnitCost
+		}
+	}
+	return out, nil
+}
+
+// PlanPurchaseOrders builds supplier-grouped order lines for low-stock products in a branch.
+// Backordered units count against the stock position, so they are bought on top of the
+// usual reorder. When productIDs is non-empty only those products are considered. Lines for
+// products without a preferred supplier are returned separately.
+func (s *Service) PlanPurchaseOrders(ctx context.Context, orgID, branchID string, productIDs []string) ([]SupplierOrder, []OrderLine, error) {
+	levels, err := s.repo.ListStockLevelsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	products, err := s.repo.ListProductsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	onOrder, err := s.OpenPurchaseQuantities(ctx, orgID, branchID)
+	if err != nil {
+		return nil, nil, err
+	}
+	backordered, err := s.BackorderedQuantities(ctx, orgID, branchID)
+	if err != nil {
+		return nil, nil, err
+	}
+	lastCosts, err := s.LastPurchaseCosts(ctx, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	productMap := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+	selected := make(map[string]bool, len(productIDs))
+	for _, id := range productIDs {
+		selected[strings.TrimSpace(id)] = true
+	}
+
+	bySupplier := make(map[string][]OrderLine)
+	unassigned := make([]OrderLine, 0)
+	for _, sl := range levels {
+		if sl.BranchID != branchID {
+			continue
+		}
+		if len(selected) > 0 && !selected[sl.ProductID] {
+			continue
+		}
+		p, ok := productMap[sl.ProductID]
+		if !ok {
+			continue
+		}
+		qty := OrderQuantity(sl, onOrder[sl.ProductID]-backordered[sl.ProductID])
+		if qty <= 0 {
+			continue
+		}
+
+		cost, ok := lastCosts[p.ID]
+		if !ok {
+			cost = p.Cost
+		}
+		line := OrderLine{
+			ProductID:   p.ID,
+			ProductName: p.Name,
+			ProductSku:  p.SKU,
+			Quantity:    qty,
+			OnHand:      sl.Quantity,
+			OnOrder:     onOrder[sl.ProductID],
+			Backordered: backordered[sl.ProductID],
+			MinStock:    sl.MinStock,
+			MaxStock:    sl.MaxStock,
+			UnitCost:    cost,
+		}
+		if p.SupplierID == "" {
+			unassigned = append(unassigned, line)
+			continue
+		}
+		bySupplier[p.SupplierID] = append(bySupplier[p.SupplierID], line)
+	}
+
+	out := make([]SupplierOrder, 0, len(bySupplier))
+	for supplierID, lines := range bySupplier {
+		sort.Slice(lines, func(i, j int) bool { return lines[i].ProductSku < lines[j].ProductSku })
+		out = append(out, SupplierOrder{SupplierID: supplierID, Lines: lines})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SupplierID < out[j].SupplierID })
+	return out, unassigned, nil
+}
@@ -0,0 +1,191 @@
+package replenishment
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RebalancePolicy controls how surplus and shortage are measured across branches
+type RebalancePolicy struct {
+	WindowDays int // Days of sales history used to measure velocity
+	CoverDays  int // Days of demand each branch should hold before it is considered in surplus
+	MinMoveQty int // Suggestions below this quantity are dropped
+}
+
+// DefaultRebalancePolicy returns the policy used when the caller does not override it
+func DefaultRebalancePolicy() RebalancePolicy {
+	return RebalancePolicy{
+		WindowDays: 30,
+		CoverDays:  14,
+		MinMoveQty: 1,
+	}
+}
+
+// TransferSuggestion proposes moving stock of one product between two branches
+type TransferSuggestion struct {
+	ProductID    string `json:"productId"`
+	ProductName  string `json:"productName"`
+	ProductSku   string `json:"productSku"`
+	FromBranchID string `json:"fromBranchId"`
+	ToBranchID   string `json:"toBranchId"`
+	Quantity     int    `json:"quantity"`
+
+	FromAvailable int `json:"fromAvailable"`
+	FromTarget    int `json:"fromTarget"`
+	ToAvailable   int `json:"toAvailable"`
+	ToTarget      int `json:"toTarget"`
+}
+
+// branchPosition is one branch's stock position for a product
+type branchPosition struct {
+	branchID  string
+	available int // On hand minus reserved, adjusted for transfers not yet completed
+	target    int // max(min stock, velocity * cover days)
+	gap       int // Positive = surplus, negative = shortage
+}
+
+// pendingTransferStatuses are transfers whose quantities have not yet reached the destination
+var pendingTransferStatuses = []string{"DRAFT", "PENDING", "IN_TRANSIT"}
+
+// pendingTransferQuantities returns quantities still leaving (not yet sent) and arriving per stock level key
+func (s *Service) pendingTransferQuantities(ctx context.Context, orgID string) (outgoing, incoming map[string]int, err error) {
+	transfers, _, err := s.repo.ListStockTransfersByOrg(ctx, orgID, bson.M{"status": bson.M{"$in": pendingTransferStatuses}}, 1, 10000)
+	if err != nil {
+		return nil, nil, err
+	}
+	outgoing = make(map[string]int)
+	incoming = make(map[string]int)
+	for _, t := range transfers {
+		for _, it := range t.Items {
+			// Sending deducts stock at the source, so only unsent transfers still hold it.
+			if t.Status != "IN_TRANSIT" {
+				outgoing[repo.StockLevelID(t.FromBranchID, it.ProductID)] += it.Quantity
+			}
+			incoming[repo.StockLevelID(t.ToBranchID, it.ProductID)] += it.Quantity
+		}
+	}
+	return outgoing, incoming, nil
+}
+
+// SuggestTransfers proposes transfers that cover branch shortages from branches holding surplus.
+// When productID is non-empty only that product is considered.
+func (s *Service) SuggestTransfers(ctx context.Context, orgID, productID string, p RebalancePolicy) ([]TransferSuggestion, error) {
+	if p.WindowDays < 7 || p.WindowDays > 365 {
+		return nil, ErrInvalidWindow
+	}
+	if p.MinMoveQty < 1 {
+		p.MinMoveQty = 1
+	}
+
+	levels, err := s.repo.ListStockLevelsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	products, err := s.repo.ListProductsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	sales, err := s.DailySales(ctx, orgID, "", time.Now().UTC(), p.WindowDays)
+	if err != nil {
+		return nil, err
+	}
+	outgoing, incoming, err := s.pendingTransferQuantities(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	productMap := make(map[string]models.Product, len(products))
+	for _, prod := range products {
+		productMap[prod.ID] = prod
+	}
+
+	byProduct := make(map[string][]branchPosition)
+	for _, sl := range levels {
+		if productID != "" && sl.ProductID != productID {
+			continue
+		}
+		if _, ok := productMap[sl.ProductID]; !ok {
+			continue
+		}
+		key := repo.StockLevelID(sl.BranchID, sl.ProductID)
+		stats := ComputeDemandStats(sales[key])
+		target := int(math.Ceil(stats.AvgDaily * float64(p.CoverDays)))
+		if sl.MinStock > target {
+			target = sl.MinStock
+		}
+		available := sl.Quantity - sl.Reserved - outgoing[key] + incoming[key]
+		byProduct[sl.ProductID] = append(byProduct[sl.ProductID], branchPosition{
+			branchID:  sl.BranchID,
+			available: available,
+			target:    target,
+			gap:       available - target,
+		})
+	}
+
+	out := make([]TransferSuggestion, 0)
+	for pid, positions := range byProduct {
+		if len(positions) < 2 {
+			continue
+		}
+		prod := productMap[pid]
+
+		surplus := make([]*branchPosition, 0)
+		shortage := make([]*branchPosition, 0)
+		for i := range positions {
+			switch {
+			case positions[i].gap > 0:
+				surplus = append(surplus, &positions[i])
+			case positions[i].gap < 0:
+				shortage = append(shortage, &positions[i])
+			}
+		}
+		// Fill the largest shortages from the largest surpluses first.
+		sort.Slice(surplus, func(i, j int) bool { return surplus[i].gap > surplus[j].gap })
+		sort.Slice(shortage, func(i, j int) bool { return shortage[i].gap < shortage[j].gap })
+
+		for _, dst := range shortage {
+			for _, src := range surplus {
+				need := -dst.gap
+				if need <= 0 {
+					break
+				}
+				qty := src.gap
+				if need < qty {
+					qty = need
+				}
+				if qty < p.MinMoveQty {
+					continue
+				}
+				out = append(out, TransferSuggestion{
+					ProductID:     pid,
+					ProductName:   prod.Name,
+					ProductSku:    prod.SKU,
+					FromBranchID:  src.branchID,
+					ToBranchID:    dst.branchID,
+					Quantity:      qty,
+					FromAvailable: src.available,
+					FromTarget:    src.target,
+					ToAvailable:   dst.available,
+					ToTarget:      dst.target,
+				})
+				src.gap -= qty
+				dst.gap += qty
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ProductSku != out[j].ProductSku {
+			return out[i].ProductSku < out[j].ProductSku
+		}
+		return out[i].Quantity > out[j].Quantity
+	})
+	return out, nil
+}
@@ -0,0 +1,265 @@
+package replenishment
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+)
+
+var (
+	ErrInvalidServiceLevel = errors.New("service level must be between 0.5 and 0.999")
+	ErrInvalidWindow       = errors.New("window must be between 7 and 365 days")
+	ErrInvalidReviewDays   = errors.New("review period must be between 1 and 365 days")
+	ErrInvalidLeadTime     = errors.New("default lead time must be between 1 and 365 days")
+)
+
+// Policy controls how reorder parameters are derived from demand history
+type Policy struct {
+	ServiceLevel        float64 // Probability of not stocking out during lead time, e.g. 0.95
+	WindowDays          int     // Days of sales history used to measure demand
+	ReviewDays          int     // Days of demand a single reorder should cover
+	DefaultLeadTimeDays int     // Used when neither product nor supplier defines a lead time
+}
+
+// DefaultPolicy returns the policy used when the caller does not override it
+func DefaultPolicy() Policy {
+	return Policy{
+		ServiceLevel:        0.95,
+		WindowDays:          90,
+		ReviewDays:          30,
+		DefaultLeadTimeDays: 7,
+	}
+}
+
+// Validate checks that the policy values are usable
+func (p Policy) Validate() error {
+	if p.ServiceLevel < 0.5 || p.ServiceLevel > 0.999 {
+		return ErrInvalidServiceLevel
+	}
+	if p.WindowDays < 7 || p.WindowDays > 365 {
+		return ErrInvalidWindow
+	}
+	if p.ReviewDays < 1 || p.ReviewDays > 365 {
+		return ErrInvalidReviewDays
+	}
+	if p.DefaultLeadTimeDays < 1 || p.DefaultLeadTimeDays > 365 {
+		return ErrInvalidLeadTime
+	}
+	return nil
+}
+
+// DemandStats summarises daily unit demand over a window
+type DemandStats struct {
+	TotalQty    int     `json:"totalQty"`
+	Days        int     `json:"days"`
+	AvgDaily    float64 `json:"avgDaily"`
+	StdDevDaily float64 `json:"stdDevDaily"`
+}
+
+// ComputeDemandStats derives mean and standard deviation from per-day quantities.
+// Days without sales must be present as zeros so variability is not understated.
+func ComputeDemandStats(daily []int) DemandStats {
+	stats := DemandStats{Days: len(daily)}
+	if len(daily) == 0 {
+		return stats
+	}
+	for _, q := range daily {
+		stats.TotalQty += q
+	}
+	stats.AvgDaily = float64(stats.TotalQty) / float64(len(daily))
+
+	var sumSq float64
+	for _, q := range daily {
+		d := float64(q) - stats.AvgDaily
+		sumSq += d * d
+	}
+	stats.StdDevDaily = math.Sqrt(sumSq / float64(len(daily)))
+	return stats
+}
+
+// ZScore returns the standard normal quantile for a service level
+func ZScore(serviceLevel float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*serviceLevel-1)
+}
+
+// Calculate returns safety stock, reorder point and reorder quantity.
+// Safety stock = z * σd * √L, reorder point = μd * L + safety stock,
+// reorder quantity = μd * review period.
+func Calculate(stats DemandStats, leadTimeDays int, p Policy) (safetyStock, reorderPoint, reorderQty int) {
+	if stats.AvgDaily <= 0 || leadTimeDays <= 0 {
+		return 0, 0, 0
+	}
+	lt := float64(leadTimeDays)
+	safetyStock = int(math.Ceil(ZScore(p.ServiceLevel) * stats.StdDevDaily * math.Sqrt(lt)))
+	reorderPoint = int(math.Ceil(stats.AvgDaily*lt)) + safetyStock
+	reorderQty = int(math.Ceil(stats.AvgDaily * float64(p.ReviewDays)))
+	if reorderQty < 1 {
+		reorderQty = 1
+	}
+	return safetyStock, reorderPoint, reorderQty
+}
+
+// Recommendation is the suggested reorder configuration for one product at one branch
+type Recommendation struct {
+	StockLevelID string `json:"stockLevelId"`
+	ProductID    string `json:"productId"`
+	ProductName  string `json:"productName"`
+	ProductSku   string `json:"productSku"`
+	BranchID     string `json:"branchId"`
+	SupplierID   string `json:"supplierId,omitempty"`
+
+	Quantity     int         `json:"quantity"`
+	Reserved     int         `json:"reserved"`
+	LeadTimeDays int         `json:"leadTimeDays"`
+	Demand       DemandStats `json:"demand"`
+
+	CurrentMinStock    int `json:"currentMinStock"`
+	CurrentSafetyStock int `json:"currentSafetyStock"`
+	CurrentReorderQty  int `json:"currentReorderQty"`
+
+	MinStock    int `json:"minStock"`
+	SafetyStock int `json:"safetyStock"`
+	ReorderQty  int `json:"reorderQty"`
+
+	Changed bool `json:"changed"`
+}
+
+// Service computes replenishment recommendations from stock and sales history
+type Service struct {
+	repo *repo.Repo
+}
+
+// New creates a new replenishment service
+func New(r *repo.Repo) *Service {
+	return &Service{repo: r}
+}
+
+// DailySales returns per-day sold quantities keyed by repo.StockLevelID(branchID, productID).
+// Each slice has one entry per day of the window ending at until, oldest first.
+func (s *Service) DailySales(ctx context.Context, orgID, branchID string, until time.Time, windowDays int) (map[string][]int, error) {
+	txns, err := s.repo.ListTransactionsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := until.AddDate(0, 0, -windowDays)
+	out := make(map[string][]int)
+	for _, t := range txns {
+		if strings.ToUpper(t.Type) != "SALE" {
+			continue
+		}
+		status := strings.ToUpper(t.Status)
+		if status == "CANCELLED" || status == "REFUNDED" || status == "DRAFT" {
+			continue
+		}
+		if branchID != "" && t.BranchID != branchID {
+			continue
+		}
+		txnTime, err := time.Parse(time.RFC3339, t.Date)
+		if err != nil || txnTime.Before(start) || !txnTime.Before(until) {
+			continue
+		}
+		day := int(txnTime.Sub(start).Hours() / 24)
+		if day < 0 || day >= windowDays {
+			continue
+		}
+		for _, it := range t.Items {
+			key := repo.StockLevelID(t.BranchID, it.ID)
+			series, ok := out[key]
+			if !ok {
+				series = make([]int, windowDays)
+				out[key] = series
+			}
+			series[day] += it.Kept() // Units cancelled before shipping are not counted as sold
+		}
+	}
+	return out, nil
+}
+
+// Recommend computes reorder recommendations for every stock level in the branch (or org when branchID is empty)
+func (s *Service) Recommend(ctx context.Context, orgID, branchID string, p Policy) ([]Recommendation, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	levels, err := s.repo.ListStockLevelsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	products, err := s.repo.ListProductsByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	suppliers, err := s.repo.ListSuppliersByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	sales, err := s.DailySales(ctx, orgID, branchID, time.Now().UTC(), p.WindowDays)
+	if err != nil {
+		return nil, err
+	}
+
+	productMap := make(map[string]models.Product, len(products))
+	for _, prod := range products {
+		productMap[prod.ID] = prod
+	}
+	supplierMap := make(map[string]models.Supplier, len(suppliers))
+	for _, sup := range suppliers {
+		supplierMap[sup.ID] = sup
+	}
+
+	out := make([]Recommendation, 0, len(levels))
+	for _, sl := range levels {
+		if branchID != "" && sl.BranchID != branchID {
+			continue
+		}
+		prod, ok := productMap[sl.ProductID]
+		if !ok {
+			continue
+		}
+
+		leadTime := s.leadTimeDays(prod, supplierMap, p)
+		daily := sales[repo.StockLevelID(sl.BranchID, sl.ProductID)]
+		if daily == nil {
+			daily = make([]int, p.WindowDays)
+		}
+		stats := ComputeDemandStats(daily)
+		safety, rop, qty := Calculate(stats, leadTime, p)
+
+		out = append(out, Recommendation{
+			StockLevelID:       sl.ID,
+			ProductID:          prod.ID,
+			ProductName:        prod.Name,
+			ProductSku:         prod.SKU,
+			BranchID:           sl.BranchID,
+			SupplierID:         prod.SupplierID,
+			Quantity:           sl.Quantity,
+			Reserved:           sl.Reserved,
+			LeadTimeDays:       leadTime,
+			Demand:             stats,
+			CurrentMinStock:    sl.MinStock,
+			CurrentSafetyStock: sl.SafetyStock,
+			CurrentReorderQty:  sl.ReorderQty,
+			MinStock:           rop,
+			SafetyStock:        safety,
+			ReorderQty:         qty,
+			Changed:            rop != sl.MinStock || safety != sl.SafetyStock || qty != sl.ReorderQty,
+		})
+	}
+	return out, nil
+}
+
+func (s *Service) leadTimeDays(p models.Product, suppliers map[string]models.Supplier, policy Policy) int {
+	if p.LeadTimeDays > 0 {
+		return p.LeadTimeDays
+	}
+	if sup, ok := suppliers[p.SupplierID]; ok && sup.LeadTimeDays > 0 {
+		return sup.LeadTimeDays
+	}
+	return policy.DefaultLeadTimeDays
+}
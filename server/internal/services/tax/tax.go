@@ -0,0 +1,205 @@
+package tax
+
+import (
+	"context"
+	"math"
+
+	"stockflows/server/internal/models"
+	"stockflows/server/internal/repo"
+	"stockflows/server/internal/services/costing"
+)
+
+// Service reads the org's tax settings
+type Service struct {
+	repo *repo.Repo
+}
+
+// New creates a new tax service
+func New(r *repo.Repo) *Service {
+	return &Service{repo: r}
+}
+
+// Settings returns the org's tax settings; an org that cannot be loaded is treated as not
+// VAT registered
+func (s *Service) Settings(ctx context.Context, orgID string) models.TaxSettings {
+	org, err := s.repo.GetOrg(ctx, orgID)
+	if err != nil {
+		return models.TaxSettings{}
+	}
+	return org.Settings.Tax
+}
+
+// ClassOf normalizes a product's tax class; empty means STANDARD
+func ClassOf(c models.TaxClass) models.TaxClass {
+	switch c {
+	case models.TaxClassZeroRated, models.TaxClassExempt:
+		return c
+	}
+	return models.TaxClassStandard
+}
+
+// RateFor returns the rate for a tax class in percent
+func RateFor(class models.TaxClass, standard float64) float64 {
+	if ClassOf(class) == models.TaxClassStandard {
+		return standard
+	}
+	return 0
+}
+
+// Of returns the tax on amount at rate (percent). When inclusive, amount already contains
+// the tax and it is extracted. Every document rounds per line, half away from zero, to the
+// satang so totals agree wherever they are recomputed.
+func Of(amount int64, rate float64, inclusive bool) int64 {
+	bp := int64(math.Round(rate * 100)) // Basis points
+	if bp <= 0 || amount == 0 {
+		return 0
+	}
+	if inclusive {
+		return divRound(amount*bp, 10000+bp)
+	}
+	return divRound(amount*bp, 10000)
+}
+
+func divRound(n, d int64) int64 {
+	if n < 0 {
+		return -divRound(-n, d)
+	}
+	return (2*n + d) / (2 * d)
+}
+
+// Share returns the part of a line amount for qty of its total units, e.g. on a partial return
+func Share(amount int64, qty, total int) int64 {
+	if total <= 0 || qty <= 0 {
+		return 0
+	}
+	if qty >= total {
+		return amount
+	}
+	return divRound(amount*int64(qty), int64(total))
+}
+
+// Line is an amount to tax after all its discounts
+type Line struct {
+	Amount int64
+	Class  models.TaxClass
+}
+
+// LineTax is the tax of one line
+type LineTax struct {
+	Class models.TaxClass
+	Rate  float64
+	Tax   int64
+	Net   int64 // Ex-tax amount
+}
+
+// Compute taxes each line at its class rate and sums the lines by class
+func Compute(standard float64, inclusive bool, lines []Line) ([]LineTax, models.TaxSummary) {
+	out := make([]LineTax, len(lines))
+	for i, l := range lines {
+		class := ClassOf(l.Class)
+		rate := RateFor(class, standard)
+		t := Of(l.Amount, rate, inclusive)
+		net := l.Amount
+		if inclusive {
+			net -= t
+		}
+		out[i] = LineTax{Class: class, Rate: rate, Tax: t, Net: net}
+	}
+	return out, Sum(standard, inclusive, out)
+}
+
+// Sum totals taxed lines by class
+func Sum(standard float64, inclusive bool, lines []LineTax) models.TaxSummary {
+	sum := models.TaxSummary{PricesIncludeTax: inclusive, Rate: standard}
+	for _, l := range lines {
+		sum.Tax += l.Tax
+		switch ClassOf(l.Class) {
+		case models.TaxClassZeroRated:
+			sum.ZeroRated += l.Net
+		case models.TaxClassExempt:
+			sum.Exempt += l.Net
+		default:
+			sum.Standard += l.Net
+		}
+	}
+	return sum
+}
+
+// Sale taxes sale items after their line discounts, spreading the order discount across lines
+// by value and taxing shipping at the standard rate. It sets each item's tax and returns the
+// summary (nil when no VAT is charged) and the amount the customer pays.
+//
+// legacyRate keeps the old per-order exclusive rate working for orgs without tax settings.
+func Sale(settings models.TaxSettings, items []models.TransactionItem, orderDiscount, shipping int64, legacyRate float64) (*models.TaxSummary, int64) {
+	basis := make([]int64, len(items))
+	for i, it := range items {
+		basis[i] = it.Price*int64(it.Quantity) - it.Discount
+	}
+	shares := costing.Allocate(orderDiscount, basis)
+
+	var net int64
+	lines := make([]Line, 0, len(items)+1)
+	for i, it := range items {
+		items[i].TaxClass = ClassOf(it.TaxClass)
+		items[i].TaxRate = 0
+		items[i].TaxAmount = 0
+		items[i].NetAmount = basis[i] - shares[i]
+		lines = append(lines, Line{Amount: basis[i] - shares[i], Class: items[i].TaxClass})
+		net += basis[i] - shares[i]
+	}
+
+	rate, inclusive, taxShipping := settings.Rate(), settings.PricesIncludeTax, true
+	if !settings.VATRegistered {
+		if legacyRate <= 0 {
+			return nil, net + shipping
+		}
+		rate, inclusive, taxShipping = legacyRate, false, false
+	}
+	if shipping > 0 && taxShipping {
+		lines = append(lines, Line{Amount: shipping, Class: models.TaxClassStandard})
+	}
+
+	taxed, sum := Compute(rate, inclusive, lines)
+	for i := range items {
+		items[i].TaxRate = taxed[i].Rate
+		items[i].TaxAmount = taxed[i].Tax
+		items[i].NetAmount = taxed[i].Net
+	}
+	if !taxShipping {
+		sum.Standard += shipping
+	}
+
+	total := net + shipping
+	if !inclusive {
+		total += sum.Tax
+	}
+	return &sum, total
+}
+
+// Purchase taxes purchase order lines at rate (percent, prices ex-tax) after line discounts and
+// their share of the order discount. Shipping is not taxed. It sets each item's tax and returns
+// the summary, or nil when rate is zero.
+func Purchase(rate float64, items []models.PurchaseOrderItem, orderDiscount int64) *models.TaxSummary {
+	basis := make([]int64, len(items))
+	for i, it := range items {
+		basis[i] = it.UnitCost*int64(it.Quantity) - it.Discount
+	}
+	shares := costing.Allocate(orderDiscount, basis)
+
+	lines := make([]Line, len(items))
+	for i, it := range items {
+		items[i].TaxClass = ClassOf(it.TaxClass)
+		items[i].TaxAmount = 0
+		items[i].NetAmount = basis[i] - shares[i]
+		lines[i] = Line{Amount: basis[i] - shares[i], Class: items[i].TaxClass}
+	}
+	if rate <= 0 {
+		return nil
+	}
+
+	taxed, sum := Compute(rate, false, lines)
+	for i := range items {
+		items[i].TaxAmount = taxed[i].Tax
+	}
+	return &sum
+}
@@ -0,0 +1,133 @@
+package tax
+
+import (
+	"testing"
+
+	"stockflows/server/internal/models"
+)
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    int64
+		rate      float64
+		inclusive bool
+		want      int64
+	}{
+		{"exclusive", 10000, 7, false, 700},
+		{"inclusive", 10700, 7, true, 700},
+		{"rounds half away from zero", 50, 7, false, 4}, // 3.5
+		{"negative rounds away from zero", -50, 7, false, -4},
+		{"zero rate", 10000, 0, false, 0},
+		{"zero amount", 0, 7, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Of(tt.amount, tt.rate, tt.inclusive); got != tt.want {
+				t.Errorf("Of(%d, %v, %v) = %d, want %d", tt.amount, tt.rate, tt.inclusive, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShare(t *testing.T) {
+	tests := []struct {
+		amount     int64
+		qty, total int
+		want       int64
+	}{
+		{1000, 1, 3, 333},
+		{1000, 2, 3, 667},
+		{1000, 3, 3, 1000},
+		{1000, 5, 3, 1000},
+		{1000, 0, 3, 0},
+		{1000, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := Share(tt.amount, tt.qty, tt.total); got != tt.want {
+			t.Errorf("Share(%d, %d, %d) = %d, want %d", tt.amount, tt.qty, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestSale(t *testing.T) {
+	registered := models.TaxSettings{VATRegistered: true, StandardRate: 7}
+	tests := []struct {
+		name      string
+		settings  models.TaxSettings
+		items     []models.TransactionItem
+		discount  int64
+		shipping  int64
+		legacy    float64
+		wantTotal int64
+		wantSum   *models.TaxSummary
+	}{
+		{
+			name:      "exclusive with shipping",
+			settings:  registered,
+			items:     []models.TransactionItem{{Price: 10000, Quantity: 2}},
+			shipping:  5000,
+			wantTotal: 26750,
+			wantSum:   &models.TaxSummary{Rate: 7, Standard: 25000, Tax: 1750},
+		},
+		{
+			name:      "inclusive prices",
+			settings:  models.TaxSettings{VATRegistered: true, PricesIncludeTax: true, StandardRate: 7},
+			items:     []models.TransactionItem{{Price: 10700, Quantity: 1}},
+			wantTotal: 10700,
+			wantSum:   &models.TaxSummary{PricesIncludeTax: true, Rate: 7, Standard: 10000, Tax: 700},
+		},
+		{
+			name:     "classes and order discount",
+			settings: registered,
+			items: []models.TransactionItem{
+				{Price: 10000, Quantity: 1},
+				{Price: 10000, Quantity: 1, TaxClass: models.TaxClassZeroRated},
+				{Price: 10000, Quantity: 1, TaxClass: models.TaxClassExempt, Discount: 5000},
+			},
+			discount:  5000,
+			wantTotal: 20560,
+			wantSum:   &models.TaxSummary{Rate: 7, Standard: 8000, ZeroRated: 8000, Exempt: 4000, Tax: 560},
+		},
+		{
+			name:      "not registered",
+			settings:  models.TaxSettings{},
+			items:     []models.TransactionItem{{Price: 10000, Quantity: 1}},
+			shipping:  1000,
+			wantTotal: 11000,
+		},
+		{
+			name:      "legacy rate leaves shipping untaxed",
+			settings:  models.TaxSettings{},
+			items:     []models.TransactionItem{{Price: 10000, Quantity: 1}},
+			shipping:  1000,
+			legacy:    7,
+			wantTotal: 11700,
+			wantSum:   &models.TaxSummary{Rate: 7, Standard: 11000, Tax: 700},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum, total := Sale(tt.settings, tt.items, tt.discount, tt.shipping, tt.legacy)
+			if total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+			switch {
+			case tt.wantSum == nil && sum != nil:
+				t.Errorf("summary = %+v, want none", *sum)
+			case tt.wantSum != nil && sum == nil:
+				t.Errorf("summary = nil, want %+v", *tt.wantSum)
+			case tt.wantSum != nil && *sum != *tt.wantSum:
+				t.Errorf("summary = %+v, want %+v", *sum, *tt.wantSum)
+			}
+
+			var lineTax int64
+			for _, it := range tt.items {
+				lineTax += it.TaxAmount
+			}
+			if sum != nil && tt.shipping == 0 && lineTax != sum.Tax {
+				t.Errorf("line tax adds up to %d, summary says %d", lineTax, sum.Tax)
+			}
+		})
+	}
+}
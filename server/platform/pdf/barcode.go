@@ -0,0 +1,62 @@
+package pdf
+
+import "errors"
+
+var ErrBarcodeText = errors.New("pdf: barcode text must be printable ASCII")
+
+// code128 holds the bar and space widths of each Code 128 symbol, in modules
+var code128 = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128Stop   = 106
+)
+
+// Barcode draws s as a Code 128 (set B) barcode filling width, with its top-left corner
+// at (x, y). Tracking numbers on shipping labels are printed this way.
+func (d *Document) Barcode(x, y, width, height float64, s string) error {
+	symbols := make([]int, 0, len(s)+3)
+	symbols = append(symbols, code128StartB)
+	sum := code128StartB
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch < 32 || ch > 126 {
+			return ErrBarcodeText
+		}
+		v := int(ch) - 32
+		symbols = append(symbols, v)
+		sum += v * (i + 1)
+	}
+	symbols = append(symbols, sum%103, code128Stop)
+
+	modules := 20 // Quiet zones of ten modules either side
+	for _, sym := range symbols {
+		for _, w := range code128[sym] {
+			modules += int(w - '0')
+		}
+	}
+	unit := width / float64(modules)
+	at := x + 10*unit
+	for _, sym := range symbols {
+		for i, w := range code128[sym] {
+			bar := unit * float64(w-'0')
+			if i%2 == 0 {
+				d.FillRect(at, y, bar, height, 0)
+			}
+			at += bar
+		}
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+// Package pdf is a small dependency-free PDF writer for reports and documents.
+//
+// Coordinates are in points (1/72 inch) measured from the top-left corner of the page.
+// Text uses the standard Helvetica fonts with WinAnsi encoding, where characters outside
+// Latin-1 are replaced with '?', unless a TrueType font is set with SetFonts.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Size is a page size in points
+type Size struct {
+	Width  float64
+	Height float64
+}
+
+var (
+	A4          = Size{Width: 595.28, Height: 841.89}
+	A4Landscape = Size{Width: 841.89, Height: 595.28}
+	A5          = Size{Width: 419.53, Height: 595.28}
+	Label4x6    = Size{Width: 288, Height: 432} // 4 x 6 inch shipping label
+)
+
+// Document is an in-memory PDF built page by page
+type Document struct {
+	size   Size
+	margin float64
+	pages  []*bytes.Buffer
+	page   *bytes.Buffer
+
+	fonts [2]*Font           // Regular and bold embedded fonts; nil uses Helvetica
+	used  [2]map[uint16]rune // Glyphs drawn per embedded font, for widths and text extraction
+
+	// Y is the flow cursor used by Heading, Paragraph and Table
+	Y float64
+}
+
+// New creates an empty document; call AddPage before drawing
+func New(size Size) *Document {
+	return &Document{size: size, margin: 36}
+}
+
+// Size returns the page size
+func (d *Document) Size() Size { return d.size }
+
+// Margin returns the page margin used by flowing content
+func (d *Document) Margin() float64 { return d.margin }
+
+// SetMargin changes the page margin used by flowing content
+func (d *Document) SetMargin(m float64) { d.margin = m }
+
+// AddPage starts a new page and resets the flow cursor to the top margin
+func (d *Document) AddPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.Y = d.margin
+}
+
+// PageCount returns the number of pages so far
+func (d *Document) PageCount() int { return len(d.pages) }
+
+// SetFonts embeds TrueType fonts for all text drawn afterwards. bold may be nil to use
+// regular for bold text as well.
+func (d *Document) SetFonts(regular, bold *Font) {
+	if bold == nil {
+		bold = regular
+	}
+	d.fonts = [2]*Font{regular, bold}
+	d.used = [2]map[uint16]rune{make(map[uint16]rune), make(map[uint16]rune)}
+}
+
+// Text draws s with its baseline at (x, y)
+func (d *Document) Text(x, y, size float64, bold bool, s string) {
+	i := 0
+	if bold {
+		i = 1
+	}
+	if f := d.fonts[i]; f != nil {
+		var hex strings.Builder
+		for _, r := range s {
+			g := f.glyph(r)
+			if _, ok := d.used[i][g]; !ok {
+				d.used[i][g] = r
+			}
+			fmt.Fprintf(&hex, "%04X", g)
+		}
+		fmt.Fprintf(d.page, "BT /F%d %.2f Tf %.2f %.2f Td <%s> Tj ET\n", 3+i, size, x, d.size.Height-y, hex.String())
+		return
+	}
+	fmt.Fprintf(d.page, "BT /F%d %.2f Tf %.2f %.2f Td (%s) Tj ET\n", 1+i, size, x, d.size.Height-y, escape(s))
+}
+
+// TextRight draws s so that it ends at x
+func (d *Document) TextRight(x, y, size float64, bold bool, s string) {
+	d.Text(x-d.TextWidth(s, size, bold), y, size, bold, s)
+}
+
+// TextWidth returns the width of s in points in the document's font
+func (d *Document) TextWidth(s string, size float64, bold bool) float64 {
+	i := 0
+	if bold {
+		i = 1
+	}
+	if f := d.fonts[i]; f != nil {
+		return f.width(s, size)
+	}
+	return TextWidth(s, size, bold)
+}
+
+// Fit truncates s so that it is at most width points wide in the document's font
+func (d *Document) Fit(s string, width, size float64, bold bool) string {
+	if d.TextWidth(s, size, bold) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && d.TextWidth(string(r)+"..", size, bold) > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + ".."
+}
+
+// Wrap breaks s into lines at most width points wide, at spaces where possible and
+// between letters otherwise (Thai is written without spaces between words)
+func (d *Document) Wrap(s string, width, size float64, bold bool) []string {
+	lines := make([]string, 0, 1)
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			next := word
+			if line != "" {
+				next = line + " " + word
+			}
+			if d.TextWidth(next, size, bold) <= width {
+				line = next
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			line = ""
+			for _, r := range word {
+				if line != "" && d.TextWidth(line+string(r), size, bold) > width && !isMark(r) {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// isMark reports Thai vowel and tone marks, which must stay with the preceding letter
+func isMark(r rune) bool {
+	return r == 0x0E31 || (r >= 0x0E34 && r <= 0x0E3A) || (r >= 0x0E47 && r <= 0x0E4E)
+}
+
+// Line draws a thin line from (x1, y1) to (x2, y2)
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, d.size.Height-y1, x2, d.size.Height-y2)
+}
+
+// Rect draws a rectangle outline with its top-left corner at (x, y)
+func (d *Document) Rect(x, y, w, h float64) {
+	fmt.Fprintf(d.page, "0.5 w %.2f %.2f %.2f %.2f re S\n", x, d.size.Height-y-h, w, h)
+}
+
+// FillRect draws a filled rectangle in the given grey level (0 black .. 1 white)
+func (d *Document) FillRect(x, y, w, h, grey float64) {
+	fmt.Fprintf(d.page, "q %.2f g %.2f %.2f %.2f %.2f re f Q\n", grey, x, d.size.Height-y-h, w, h)
+}
+
+// ensureSpace starts a new page when fewer than h points remain above the bottom margin
+func (d *Document) ensureSpace(h float64) bool {
+	if d.page == nil {
+		d.AddPage()
+		return true
+	}
+	if d.Y+h > d.size.Height-d.margin {
+		d.AddPage()
+		return true
+	}
+	return false
+}
+
+// Heading writes a bold line at the flow cursor
+func (d *Document) Heading(s string, size float64) {
+	d.ensureSpace(size * 1.6)
+	d.Y += size
+	d.Text(d.margin, d.Y, size, true, s)
+	d.Y += size * 0.6
+}
+
+// Paragraph writes a plain line at the flow cursor
+func (d *Document) Paragraph(s string, size float64) {
+	d.ensureSpace(size * 1.5)
+	d.Y += size
+	d.Text(d.margin, d.Y, size, false, s)
+	d.Y += size * 0.5
+}
+
+// Space advances the flow cursor
+func (d *Document) Space(h float64) { d.Y += h }
+
+// Column describes one table column
+type Column struct {
+	Header string
+	Width  float64 // Points; columns are laid out left to right from the margin
+	Right  bool    // Right align (numbers)
+}
+
+// Table writes rows at the flow cursor, repeating the header on every page.
+// Cell text that does not fit its column is truncated.
+func (d *Document) Table(cols []Column, rows [][]string, size float64) {
+	rowH := size * 1.6
+	header := func() {
+		x := d.margin
+		var width float64
+		for _, c := range cols {
+			width += c.Width
+		}
+		d.FillRect(d.margin, d.Y, width, rowH, 0.9)
+		for _, c := range cols {
+			d.cell(x, c, c.Header, size, true)
+			x += c.Width
+		}
+		d.Y += rowH
+		d.Line(d.margin, d.Y, d.margin+width, d.Y)
+	}
+
+	d.ensureSpace(rowH * 2)
+	header()
+	for _, row := range rows {
+		if d.ensureSpace(rowH) {
+			header()
+		}
+		x := d.margin
+		for i, c := range cols {
+			if i < len(row) {
+				d.cell(x, c, row[i], size, false)
+			}
+			x += c.Width
+		}
+		d.Y += rowH
+	}
+}
+
+func (d *Document) cell(x float64, c Column, s string, size float64, bold bool) {
+	pad := size * 0.3
+	s = d.Fit(s, c.Width-2*pad, size, bold)
+	baseline := d.Y + size*1.15
+	if c.Right {
+		d.TextRight(x+c.Width-pad, baseline, size, bold, s)
+		return
+	}
+	d.Text(x+pad, baseline, size, bold, s)
+}
+
+// Fit truncates s so that it is at most width points wide
+func Fit(s string, width, size float64, bold bool) string {
+	if TextWidth(s, size, bold) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && TextWidth(string(r)+"..", size, bold) > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + ".."
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() []byte {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var out bytes.Buffer
+	offsets := make([]int, 0, 4+2*len(d.pages))
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 page tree, 3-4 fonts, then a page and content stream per page, then
+	// five objects per embedded font.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	fonts := "/F1 3 0 R /F2 4 0 R"
+	embedded := 5 + 2*len(d.pages)
+	for i, f := range d.fonts {
+		if f == nil {
+			continue
+		}
+		ref := embedded + 5*i
+		if i == 1 && f == d.fonts[0] {
+			ref = embedded // Bold shares the regular font
+		}
+		fonts += fmt.Sprintf(" /F%d %d 0 R", 3+i, ref)
+	}
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			d.size.Width, d.size.Height, fonts, 6+2*i))
+		obj(stream(p.Bytes(), ""))
+	}
+	for i, f := range d.fonts {
+		if f == nil || (i == 1 && f == d.fonts[0]) {
+			continue
+		}
+		used := d.used[i]
+		if i == 0 && d.fonts[1] == f {
+			for g, r := range d.used[1] {
+				if _, ok := used[g]; !ok {
+					used[g] = r
+				}
+			}
+		}
+		base := len(offsets) + 1
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+			f.name, base+1, base+4))
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW 1000 /W [%s] /CIDToGIDMap /Identity >>",
+			f.name, base+2, glyphWidths(f, used)))
+		obj(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+			f.name, f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+			f.scale(f.ascent), f.scale(f.descent), f.scale(f.ascent), base+3))
+		obj(stream(f.data, fmt.Sprintf(" /Length1 %d", len(f.data))))
+		obj(stream([]byte(toUnicode(used)), ""))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// stream returns a compressed stream object body with extra dictionary entries
+func stream(data []byte, extra string) string {
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode%s >>\nstream\n%s\nendstream", z.Len(), extra, z.String())
+}
+
+// glyphWidths lists the advance widths of the used glyphs for a CID font's /W array
+func glyphWidths(f *Font, used map[uint16]rune) string {
+	gids := make([]int, 0, len(used))
+	for g := range used {
+		gids = append(gids, int(g))
+	}
+	sort.Ints(gids)
+	var b strings.Builder
+	for _, g := range gids {
+		if g < len(f.advances) {
+			fmt.Fprintf(&b, "%d [%d] ", g, f.scale(f.advances[g]))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// toUnicode maps the used glyphs back to text so documents can be searched and copied
+func toUnicode(used map[uint16]rune) string {
+	gids := make([]int, 0, len(used))
+	for g := range used {
+		if g != 0 { // .notdef stands for letters the font lacks
+			gids = append(gids, int(g))
+		}
+	}
+	sort.Ints(gids)
+
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for len(gids) > 0 {
+		n := len(gids)
+		if n > 100 { // Limit per block
+			n = 100
+		}
+		fmt.Fprintf(&b, "%d beginbfchar\n", n)
+		for _, g := range gids[:n] {
+			fmt.Fprintf(&b, "<%04X> <", g)
+			for _, u := range utf16.Encode([]rune{used[uint16(g)]}) {
+				fmt.Fprintf(&b, "%04X", u)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+		gids = gids[n:]
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.String()
+}
+
+// escape encodes s as a WinAnsi PDF string literal body
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
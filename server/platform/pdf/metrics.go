@@ -0,0 +1,32 @@
+package pdf
+
+// helveticaWidths are the Helvetica advance widths (1/1000 em) for ASCII 32..126
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space .. /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, // 0 .. 9
+	278, 278, 584, 584, 584, 556, 1015, // : .. @
+	667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, // A .. M
+	722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, // N .. Z
+	278, 278, 278, 469, 556, 333, // [ .. `
+	556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, // a .. m
+	556, 556, 556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, // n .. z
+	334, 260, 334, 584, // { .. ~
+}
+
+// TextWidth returns the width of s in points at the given font size
+func TextWidth(s string, size float64, bold bool) float64 {
+	var units int
+	for _, r := range s {
+		if r >= 32 && r <= 126 {
+			units += helveticaWidths[r-32]
+		} else {
+			units += 556
+		}
+	}
+	w := float64(units) * size / 1000
+	if bold {
+		// Helvetica-Bold is slightly wider on average
+		w *= 1.06
+	}
+	return w
+}
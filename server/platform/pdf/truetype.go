@@ -0,0 +1,259 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+var ErrUnsupportedFont = errors.New("pdf: unsupported font")
+
+// Font is a TrueType font embedded whole into documents that use it. Text is written as
+// glyph IDs (Identity-H), so any script the font covers can be drawn, including Thai.
+// Glyphs are placed by their advance widths without shaping, which suits fonts whose
+// combining marks are zero-width (e.g. Sarabun, Noto Sans Thai).
+type Font struct {
+	name       string
+	data       []byte
+	unitsPerEm int
+	advances   []int // Per glyph, in font units
+	cmap       map[rune]uint16
+	ascent     int
+	descent    int
+	bbox       [4]int
+}
+
+// LoadFont reads a TrueType (.ttf) file
+func LoadFont(path string) (*Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFont(data)
+}
+
+// ParseFont parses the tables needed to embed a TrueType font. Fonts with CFF outlines
+// and font collections are not supported.
+func ParseFont(data []byte) (*Font, error) {
+	if len(data) < 12 {
+		return nil, ErrUnsupportedFont
+	}
+	if v := binary.BigEndian.Uint32(data); v != 0x00010000 && v != 0x74727565 { // 1.0 or "true"
+		return nil, ErrUnsupportedFont
+	}
+	tables := make(map[string][]byte)
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < n; i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, ErrUnsupportedFont
+		}
+		off := int(binary.BigEndian.Uint32(data[rec+8:]))
+		length := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if off < 0 || length < 0 || off+length > len(data) {
+			return nil, ErrUnsupportedFont
+		}
+		tables[string(data[rec:rec+4])] = data[off : off+length]
+	}
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "cmap", "glyf"} {
+		if tables[tag] == nil {
+			return nil, ErrUnsupportedFont
+		}
+	}
+
+	f := &Font{data: data, name: "EmbeddedFont"}
+	head, hhea, maxp := tables["head"], tables["hhea"], tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 {
+		return nil, ErrUnsupportedFont
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	if f.unitsPerEm == 0 {
+		return nil, ErrUnsupportedFont
+	}
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	f.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	numMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	hmtx := tables["hmtx"]
+	if numMetrics == 0 || numMetrics > numGlyphs || len(hmtx) < 4*numMetrics {
+		return nil, ErrUnsupportedFont
+	}
+	f.advances = make([]int, numGlyphs)
+	for g := 0; g < numGlyphs; g++ {
+		m := g
+		if m >= numMetrics {
+			m = numMetrics - 1 // Trailing glyphs share the last advance
+		}
+		f.advances[g] = int(binary.BigEndian.Uint16(hmtx[4*m:]))
+	}
+
+	cmap, err := parseCmap(tables["cmap"])
+	if err != nil {
+		return nil, err
+	}
+	f.cmap = cmap
+	if name := postScriptName(tables["name"]); name != "" {
+		f.name = name
+	}
+	return f, nil
+}
+
+// parseCmap reads the Unicode mapping, preferring the full-repertoire format 12 subtable
+func parseCmap(t []byte) (map[rune]uint16, error) {
+	if len(t) < 4 {
+		return nil, ErrUnsupportedFont
+	}
+	var bmp, full []byte
+	n := int(binary.BigEndian.Uint16(t[2:]))
+	for i := 0; i < n; i++ {
+		rec := 4 + 8*i
+		if rec+8 > len(t) {
+			break
+		}
+		platform := binary.BigEndian.Uint16(t[rec:])
+		encoding := binary.BigEndian.Uint16(t[rec+2:])
+		off := int(binary.BigEndian.Uint32(t[rec+4:]))
+		if off+4 > len(t) {
+			continue
+		}
+		sub := t[off:]
+		switch format := binary.BigEndian.Uint16(sub); {
+		case format == 12 && (platform == 0 || (platform == 3 && encoding == 10)):
+			full = sub
+		case format == 4 && (platform == 0 || (platform == 3 && encoding == 1)):
+			bmp = sub
+		}
+	}
+
+	out := make(map[rune]uint16)
+	switch {
+	case full != nil && len(full) >= 16:
+		groups := int(binary.BigEndian.Uint32(full[12:]))
+		for i := 0; i < groups && 16+12*i+12 <= len(full); i++ {
+			g := full[16+12*i:]
+			start, end := binary.BigEndian.Uint32(g), binary.BigEndian.Uint32(g[4:])
+			gid := binary.BigEndian.Uint32(g[8:])
+			if end > 0x10FFFF || end < start || end-start > 0xFFFF {
+				continue
+			}
+			for c := start; c <= end; c++ {
+				out[rune(c)] = uint16(gid + c - start)
+			}
+		}
+	case bmp != nil && len(bmp) >= 14:
+		segs := int(binary.BigEndian.Uint16(bmp[6:])) / 2
+		ends, starts := 14, 16+2*segs
+		deltas, ranges := starts+2*segs, starts+4*segs
+		if ranges+2*segs > len(bmp) {
+			return nil, ErrUnsupportedFont
+		}
+		for s := 0; s < segs; s++ {
+			end := int(binary.BigEndian.Uint16(bmp[ends+2*s:]))
+			start := int(binary.BigEndian.Uint16(bmp[starts+2*s:]))
+			delta := int(binary.BigEndian.Uint16(bmp[deltas+2*s:]))
+			rangeOff := int(binary.BigEndian.Uint16(bmp[ranges+2*s:]))
+			for c := start; c <= end && c != 0xFFFF; c++ {
+				gid := 0
+				if rangeOff == 0 {
+					gid = (c + delta) & 0xFFFF
+				} else {
+					at := ranges + 2*s + rangeOff + 2*(c-start)
+					if at+2 > len(bmp) {
+						continue
+					}
+					if gid = int(binary.BigEndian.Uint16(bmp[at:])); gid != 0 {
+						gid = (gid + delta) & 0xFFFF
+					}
+				}
+				if gid != 0 {
+					out[rune(c)] = uint16(gid)
+				}
+			}
+		}
+	default:
+		return nil, ErrUnsupportedFont
+	}
+	return out, nil
+}
+
+// postScriptName returns name ID 6 with characters PDF names cannot hold removed
+func postScriptName(t []byte) string {
+	if len(t) < 6 {
+		return ""
+	}
+	count := int(binary.BigEndian.Uint16(t[2:]))
+	strings0 := int(binary.BigEndian.Uint16(t[4:]))
+	for i := 0; i < count; i++ {
+		rec := 6 + 12*i
+		if rec+12 > len(t) {
+			break
+		}
+		platform := binary.BigEndian.Uint16(t[rec:])
+		if binary.BigEndian.Uint16(t[rec+6:]) != 6 {
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(t[rec+8:]))
+		off := strings0 + int(binary.BigEndian.Uint16(t[rec+10:]))
+		if off+length > len(t) {
+			continue
+		}
+		raw := t[off : off+length]
+		var s string
+		if platform == 3 || platform == 0 {
+			u := make([]uint16, len(raw)/2)
+			for j := range u {
+				u[j] = binary.BigEndian.Uint16(raw[2*j:])
+			}
+			s = string(utf16.Decode(u))
+		} else {
+			s = string(raw)
+		}
+		s = strings.Map(func(r rune) rune {
+			if r > 32 && r < 127 && !strings.ContainsRune("[](){}<>/%#", r) {
+				return r
+			}
+			return -1
+		}, s)
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// glyph returns the glyph for r, or 0 (.notdef) when the font does not cover it
+func (f *Font) glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// Has reports whether the font has a glyph for every letter in s
+func (f *Font) Has(s string) bool {
+	for _, r := range s {
+		if r >= 32 && f.glyph(r) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// width returns the width of s in points at size
+func (f *Font) width(s string, size float64) float64 {
+	var units int
+	for _, r := range s {
+		if g := int(f.glyph(r)); g < len(f.advances) {
+			units += f.advances[g]
+		}
+	}
+	return float64(units) * size / float64(f.unitsPerEm)
+}
+
+// scale converts font units to the 1/1000 em PDF glyph space
+func (f *Font) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
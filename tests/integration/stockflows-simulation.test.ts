@@ -896,6 +896,202 @@ async function runAllTests(): Promise<void> {
     assert(res.status === 200 || res.status === 400 || res.status === 409, 'Should handle product with stock');
   });
 
+  // ============================================================
+  // SECTION 9: RESERVATIONS, PAYMENTS, TAX & COSTING (10 tests)
+  // ============================================================
+  console.log('\n--- SECTION 9: Reservations, Payments, Tax & Costing ---\n');
+
+  type Order = {
+    id: string;
+    status: string;
+    paymentStatus: string;
+    taxAmount: number;
+    totalAmount: number;
+    items: Array<{ productId: string; qtyBackordered?: number }>;
+  };
+  type Level = { quantity: number; reserved: number };
+
+  const stockOf = async (productId: string): Promise<Level> => {
+    const res = await apiCall('GET', `/api/inventory/stock-levels/${productId}?branchId=${ctx.branchId}`, undefined, ctx.cookies);
+    assertEqual(res.status, 200, 'Stock level query should succeed');
+    return (res.data as { data: Level }).data;
+  };
+  const vatOutputTax = async (): Promise<number> => {
+    const res = await apiCall('GET', '/api/reports/vat', undefined, ctx.cookies);
+    assertEqual(res.status, 200, 'VAT report should succeed');
+    return (res.data as { data: { total: { output: { tax: number } } } }).data.total.output.tax;
+  };
+
+  // Case 9.1: A backorderable product with 5 units received
+  await runTest('9.1 Receive stock for a backorderable product', async () => {
+    const productRes = await apiCall('POST', '/api/products', {
+      sku: 'HOODIE-GRY-M',
+      name: 'Hoodie Grey M',
+      price: 10000,
+      cost: 20000,
+      category: 'Apparel',
+      backorderPolicy: 'BACKORDER',
+    }, ctx.cookies);
+    assertEqual(productRes.status, 201, 'Product creation should succeed');
+    ctx.products['HOODIE-GRY-M'] = (productRes.data as { data: { id: string } }).data.id;
+
+    const poRes = await apiCall('POST', '/api/purchase-orders', {
+      supplierId: ctx.suppliers['SUP-TEXTILE'],
+      branchId: ctx.branchId,
+      items: [{ productId: ctx.products['HOODIE-GRY-M'], qtyOrdered: 5, unitCost: 20000 }],
+    }, ctx.cookies);
+    assertEqual(poRes.status, 201, 'PO creation should succeed');
+    const poId = (poRes.data as { data: { id: string } }).data.id;
+    await apiCall('POST', `/api/purchase-orders/${poId}/send`, {}, ctx.cookies);
+    const receiveRes = await apiCall('POST', `/api/purchase-orders/${poId}/receive`, {}, ctx.cookies);
+    assertEqual(receiveRes.status, 200, 'Receive should succeed');
+
+    const level = await stockOf(ctx.products['HOODIE-GRY-M']);
+    assertEqual(level.quantity, 5, 'Stock should be 5 after receiving');
+    assertEqual(level.reserved, 0, 'Nothing should be reserved yet');
+  });
+
+  // Case 9.2: Ordering beyond stock reserves what there is and backorders the rest
+  await runTest('9.2 Order beyond stock reserves on hand and backorders the shortfall', async () => {
+    const res = await apiCall('POST', '/api/orders', {
+      branchId: ctx.branchId,
+      items: [{ productId: ctx.products['HOODIE-GRY-M'], quantity: 8, unitPrice: 10000 }],
+    }, ctx.cookies);
+    assertEqual(res.status, 201, 'Backordered SO should succeed');
+    const order = (res.data as { data: Order }).data;
+    ctx.salesOrders['SO-BACKORDER'] = order.id;
+    assertEqual(order.status, 'PENDING', 'Order should be PENDING');
+    assertEqual(order.items[0].qtyBackordered, 3, 'Shortfall should be backordered');
+
+    const level = await stockOf(ctx.products['HOODIE-GRY-M']);
+    assertEqual(level.reserved, 5, 'Only the units on hand should be reserved');
+  });
+
+  // Case 9.3: Cancelling releases the reservation exactly once
+  await runTest('9.3 Cancelling twice releases the reservation once', async () => {
+    const first = await apiCall('POST', `/api/orders/${ctx.salesOrders['SO-BACKORDER']}/cancel`, {}, ctx.cookies);
+    assertEqual(first.status, 200, 'Cancel should succeed');
+    assertEqual((first.data as { data: Order }).data.status, 'CANCELLED', 'Status should be CANCELLED');
+    assertEqual((await stockOf(ctx.products['HOODIE-GRY-M'])).reserved, 0, 'Reservation should be released');
+
+    // Hold 2 units with another order so a second release would show
+    const other = await apiCall('POST', '/api/orders', {
+      branchId: ctx.branchId,
+      items: [{ productId: ctx.products['HOODIE-GRY-M'], quantity: 2, unitPrice: 10000 }],
+    }, ctx.cookies);
+    assertEqual(other.status, 201, 'SO creation should succeed');
+    ctx.salesOrders['SO-PAYMENT'] = (other.data as { data: Order }).data.id;
+
+    const second = await apiCall('POST', `/api/orders/${ctx.salesOrders['SO-BACKORDER']}/cancel`, {}, ctx.cookies);
+    assertEqual(second.status, 200, 'Cancelling again should be a no-op');
+    assertEqual((await stockOf(ctx.products['HOODIE-GRY-M'])).reserved, 2, 'Other order keeps its reservation');
+  });
+
+  // Case 9.4: Paying in full completes the order
+  let paymentId = '';
+  await runTest('9.4 Full payment completes the order', async () => {
+    const res = await apiCall('POST', `/api/orders/${ctx.salesOrders['SO-PAYMENT']}/payment`, {
+      method: 'CASH',
+    }, ctx.cookies);
+    assertEqual(res.status, 200, 'Payment should succeed');
+    const body = res.data as { data: Order; meta: { payment: { id: string } } };
+    paymentId = body.meta.payment.id;
+    assertEqual(body.data.status, 'COMPLETED', 'Paid order should be COMPLETED');
+    assertEqual(body.data.paymentStatus, 'PAID', 'Payment status should be PAID');
+  });
+
+  // Case 9.5: Voiding the payment reopens it
+  await runTest('9.5 Voiding the payment reopens the order', async () => {
+    const res = await apiCall('POST', `/api/orders/${ctx.salesOrders['SO-PAYMENT']}/payments/${paymentId}/void`, {
+      reason: 'Recorded against the wrong order',
+    }, ctx.cookies);
+    assertEqual(res.status, 200, 'Void should succeed');
+    const order = (res.data as { data: Order }).data;
+    assertEqual(order.paymentStatus, 'UNPAID', 'Payment status should be UNPAID');
+    assertEqual(order.status, 'PENDING', 'Order should go back to PENDING');
+
+    const again = await apiCall('POST', `/api/orders/${ctx.salesOrders['SO-PAYMENT']}/payments/${paymentId}/void`, {
+      reason: 'Again',
+    }, ctx.cookies);
+    assertEqual(again.status, 409, 'Voiding twice should conflict');
+  });
+
+  // Case 9.6: VAT-registered orgs charge VAT on top of the price
+  await runTest('9.6 VAT is added to orders once registered', async () => {
+    const settingsRes = await apiCall('PATCH', '/api/orgs/settings', {
+      tax: { vatRegistered: true, pricesIncludeTax: false, standardRate: 7 },
+    }, ctx.cookies);
+    assertEqual(settingsRes.status, 200, 'Tax settings should be saved');
+
+    const res = await apiCall('POST', '/api/orders', {
+      branchId: ctx.branchId,
+      items: [{ productId: ctx.products['HOODIE-GRY-M'], quantity: 1, unitPrice: 10000 }],
+    }, ctx.cookies);
+    assertEqual(res.status, 201, 'SO creation should succeed');
+    const order = (res.data as { data: Order }).data;
+    ctx.salesOrders['SO-TAXED'] = order.id;
+    assertEqual(order.taxAmount, 700, 'Tax should be 7% of the price');
+    assertEqual(order.totalAmount, 10700, 'Total should include tax');
+  });
+
+  // Case 9.7: Only confirmed sales are filed
+  let outputTax = 0;
+  await runTest('9.7 Confirmed sale is filed in the VAT report', async () => {
+    const before = await vatOutputTax();
+    const confirmRes = await apiCall('POST', `/api/orders/${ctx.salesOrders['SO-TAXED']}/confirm`, {}, ctx.cookies);
+    assertEqual(confirmRes.status, 200, 'Confirm should succeed');
+    outputTax = await vatOutputTax();
+    assertEqual(outputTax - before, 700, 'Output tax should include the confirmed sale');
+  });
+
+  // Case 9.8: A partial refund takes back its share of output tax
+  await runTest('9.8 Partial refund reduces output tax', async () => {
+    const payRes = await apiCall('POST', `/api/orders/${ctx.salesOrders['SO-TAXED']}/payment`, {
+      method: 'CASH',
+    }, ctx.cookies);
+    assertEqual(payRes.status, 200, 'Payment should succeed');
+    const payId = (payRes.data as { meta: { payment: { id: string } } }).meta.payment.id;
+
+    const refundRes = await apiCall('POST', `/api/orders/${ctx.salesOrders['SO-TAXED']}/payments/${payId}/refund`, {
+      amount: 5350,
+      reason: 'Goodwill',
+    }, ctx.cookies);
+    assertEqual(refundRes.status, 200, 'Refund should succeed');
+    assertEqual(await vatOutputTax(), outputTax - 350, 'Half the tax should come off');
+
+    await apiCall('PATCH', '/api/orgs/settings', { tax: { vatRegistered: false } }, ctx.cookies);
+  });
+
+  // Case 9.9: Switching to standard cost revalues what is on hand
+  await runTest('9.9 Standard cost revalues stock on hand', async () => {
+    const res = await apiCall('POST', `/api/products/${ctx.products['HOODIE-GRY-M']}/standard-cost`, {
+      standardCost: 30000,
+      notes: 'New supplier contract',
+    }, ctx.cookies);
+    assertEqual(res.status, 200, 'Standard cost should be set');
+
+    const valRes = await apiCall('GET', '/api/reports/inventory/valuation', undefined, ctx.cookies);
+    assertEqual(valRes.status, 200, 'Valuation should succeed');
+    const lines = (valRes.data as { data: { lines: Array<{ productId: string; method: string; quantity: number; value: number }> } }).data.lines;
+    const line = lines.find(l => l.productId === ctx.products['HOODIE-GRY-M']);
+    assert(line !== undefined, 'Product should be valued');
+    assertEqual(line!.method, 'STANDARD', 'Product should be on standard cost');
+    assertEqual(line!.value, line!.quantity * 30000, 'Stock should be valued at the standard');
+  });
+
+  // Case 9.10: A zero standard cost is refused and leaves the costing alone
+  await runTest('9.10 Invalid standard cost is refused', async () => {
+    const res = await apiCall('POST', `/api/products/${ctx.products['HOODIE-GRY-M']}/standard-cost`, {
+      standardCost: 0,
+    }, ctx.cookies);
+    assertEqual(res.status, 400, 'Zero standard cost should be refused');
+
+    const valRes = await apiCall('GET', '/api/reports/inventory/valuation', undefined, ctx.cookies);
+    const lines = (valRes.data as { data: { lines: Array<{ productId: string; value: number; quantity: number }> } }).data.lines;
+    const line = lines.find(l => l.productId === ctx.products['HOODIE-GRY-M']);
+    assertEqual(line!.value, line!.quantity * 30000, 'Valuation should be unchanged');
+  });
+
   // ============================================================
   // SUMMARY
   // ============================================================